@@ -0,0 +1,97 @@
+package commp
+
+// DefaultMaxBatchPairs is the maximum amount of node pairs handed to a
+// BatchHasher in a single call unless specified otherwise, matching the 16
+// lanes of an AVX-512 multi-buffer kernel.
+const DefaultMaxBatchPairs = 16
+
+// BatchHasher computes the SHA-256 of many independent 64-byte messages in one
+// call, allowing an implementation to offload the work to a multi-buffer
+// kernel or to external hardware such as a GPU or FPGA. in holds N
+// concatenated messages (pairs of tree nodes), and the N plain 32-byte
+// digests must be written in the same order to out, which is exactly half the
+// length of in. The truncation to 254 bits is applied by the caller.
+//
+// Every layer worker of a Calc issues its own batches, so HashBatch must be
+// safe for concurrent use. Neither slice may be retained after returning.
+type BatchHasher interface {
+	HashBatch(out, in []byte)
+}
+
+// WithBatchHasher instructs the Calc to hash the node pairs of every tree
+// layer through the supplied BatchHasher, in batches of up to maxPairs (or
+// DefaultMaxBatchPairs if 0). Layer workers never wait for a batch to fill up:
+// a batch is submitted as soon as no further pairs are queued, which keeps
+// latency low at the cost of smaller batches in the upper layers. The final
+// pairing with nul padding during Digest() goes through the regular
+// NodeHasher.
+func WithBatchHasher(bh BatchHasher, maxPairs int) Option {
+	if maxPairs <= 0 {
+		maxPairs = DefaultMaxBatchPairs
+	}
+	return func(c *config) {
+		c.batchHasher = bh
+		c.maxBatchPairs = maxPairs
+	}
+}
+
+// pairBatch accumulates the node pairs of a single layer worker, until they
+// are hashed together and sent to the next layer in their original order.
+type pairBatch struct {
+	bh   BatchHasher
+	in   []byte
+	out  []byte
+	dsts [][]byte
+}
+
+func newPairBatch(bh BatchHasher, maxPairs int) *pairBatch {
+	return &pairBatch{
+		bh:   bh,
+		in:   make([]byte, 0, maxPairs*64),
+		out:  make([]byte, maxPairs*32),
+		dsts: make([][]byte, 0, maxPairs),
+	}
+}
+
+// add queues up a pair: the result is going to overwrite half1 on flush(),
+// the same way hash254Into() recycles its first argument.
+func (pb *pairBatch) add(half1ToOverwrite, half2 []byte) {
+	pb.in = append(pb.in, half1ToOverwrite...)
+	pb.in = append(pb.in, half2...)
+	pb.dsts = append(pb.dsts, half1ToOverwrite)
+}
+
+// addInPlace is add() for callers not interested in the results being sent
+// anywhere: a full batch is hashed right away.
+func (pb *pairBatch) addInPlace(half1ToOverwrite, half2 []byte) {
+	pb.add(half1ToOverwrite, half2)
+	if pb.full() {
+		pb.hash()
+	}
+}
+
+func (pb *pairBatch) full() bool { return len(pb.dsts) == cap(pb.dsts) }
+
+func (pb *pairBatch) flush(out *outbox, q *layerQueue) {
+	for _, d := range pb.hash() {
+		out.add(q, d)
+	}
+}
+
+// hash computes all queued pairs in place, returning their results in
+// order. The returned slice is only valid until the next add().
+func (pb *pairBatch) hash() [][]byte {
+	dsts := pb.dsts
+	if len(dsts) == 0 {
+		return nil
+	}
+	res := pb.out[:len(pb.in)/2]
+	pb.bh.HashBatch(res, pb.in)
+	for i, d := range dsts {
+		dsts[i] = append(d[:0], res[i*32:i*32+32]...)
+		dsts[i][31] &= 0x3F
+	}
+	pb.in = pb.in[:0]
+	pb.dsts = pb.dsts[:0]
+	return dsts
+}
@@ -0,0 +1,79 @@
+package commp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync"
+	"testing"
+)
+
+type recordingBatchHasher struct {
+	mu       sync.Mutex
+	calls    int
+	pairs    int
+	maxPairs int
+}
+
+func (rb *recordingBatchHasher) HashBatch(out, in []byte) {
+	rb.mu.Lock()
+	rb.calls++
+	rb.pairs += len(in) / 64
+	if len(in)/64 > rb.maxPairs {
+		rb.maxPairs = len(in) / 64
+	}
+	rb.mu.Unlock()
+
+	for i := 0; i < len(in)/64; i++ {
+		d := sha256.Sum256(in[i*64 : i*64+64])
+		copy(out[i*32:], d[:])
+	}
+}
+
+func TestBatchHashing(t *testing.T) {
+	for _, size := range []int{65, 127, 128, 127 * 4, 127*4 + 1, 127 << 10, 1<<20 + 7} {
+		payload := bytes.Repeat([]byte{0xCC}, size)
+
+		cp := new(Calc)
+		cp.Write(payload)
+		expCommP, expSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, maxPairs := range []int{0, 1, 128} {
+			rb := new(recordingBatchHasher)
+			cp = New(WithBatchHasher(rb, maxPairs))
+			for i := 0; i < 2; i++ {
+				// many small writes, exercising partially filled batches
+				for p := payload; len(p) > 0; {
+					n := 4096
+					if n > len(p) {
+						n = len(p)
+					}
+					cp.Write(p[:n])
+					p = p[n:]
+				}
+				commP, paddedSize, err := cp.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(commP, expCommP) || paddedSize != expSize {
+					t.Fatalf("batched hashing of %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+				}
+			}
+
+			// all pairs of written data go through the batch hasher, only the
+			// pairing with nul padding on Digest() does not
+			if rb.pairs < 2*size/127*2 {
+				t.Fatalf("expected at least %d batched pairs for %d bytes, got %d", 2*size/127*2, size, rb.pairs)
+			}
+			limit := maxPairs
+			if limit == 0 {
+				limit = DefaultMaxBatchPairs
+			}
+			if rb.maxPairs > limit {
+				t.Fatalf("batch of %d pairs exceeds the maximum of %d", rb.maxPairs, limit)
+			}
+		}
+	}
+}
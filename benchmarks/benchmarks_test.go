@@ -0,0 +1,87 @@
+package benchmarks
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+var maxPieceSize = flag.String("benchmarks.max-piece-size", "64MiB", "largest padded piece size to benchmark, up to 64GiB")
+
+func BenchmarkCorpora(b *testing.B) {
+	max, err := ParseSize(*maxPieceSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	buf := make([]byte, BufSize)
+	for _, c := range Corpora {
+		for _, size := range PieceSizes(2<<10, max) {
+			c, payloadSize := c, int64(commp.PaddedPieceSize(size).Unpadded())
+			b.Run(c.Name+"/"+FormatSize(size), func(b *testing.B) {
+				cp := new(commp.Calc)
+				b.SetBytes(payloadSize)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := io.CopyBuffer(cp, c.NewReader(payloadSize), buf); err != nil {
+						b.Fatal(err)
+					}
+					if _, _, err := cp.Digest(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCorporaDeterministic(t *testing.T) {
+	for _, c := range Corpora {
+		// cross the cycle boundary
+		a, err := ioutil.ReadAll(c.NewReader(cycleSize + 4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a) != cycleSize+4096 {
+			t.Fatalf("corpus %s returned %d bytes instead of %d", c.Name, len(a), cycleSize+4096)
+		}
+		b, _ := ioutil.ReadAll(io.LimitReader(c.NewReader(cycleSize+4096), cycleSize+4096))
+		if !bytes.Equal(a, b) {
+			t.Fatalf("corpus %s is not deterministic", c.Name)
+		}
+		if !bytes.Equal(a[cycleSize:], a[:4096]) {
+			t.Fatalf("corpus %s does not cycle", c.Name)
+		}
+
+		res, err := Run(c, 2<<10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.PayloadSize != 2032 || res.PaddedPieceSize != 2048 || len(res.CommP) != 64 {
+			t.Fatalf("unexpected result %#v", res)
+		}
+	}
+}
+
+func TestSizes(t *testing.T) {
+	if s := PieceSizes(2<<10, 64<<30); len(s) != 26 || s[0] != 2<<10 || s[25] != 64<<30 {
+		t.Fatalf("unexpected piece sizes %v", s)
+	}
+	for _, s := range []string{"127", "2KiB", "64GiB", "1TiB"} {
+		n, err := ParseSize(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if FormatSize(n) != s {
+			t.Fatalf("size %s round-tripped to %s", s, FormatSize(n))
+		}
+	}
+	if _, err := ParseSize("2KB"); err == nil {
+		t.Fatal("unexpected success parsing an unsupported unit")
+	}
+}
@@ -0,0 +1,51 @@
+// Command commp-bench measures commP throughput over the corpora of the
+// benchmarks package, writing one JSON object per measurement to stdout.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/benchmarks"
+)
+
+func main() {
+	minSize := flag.String("min", "2KiB", "smallest padded piece size to measure")
+	maxSize := flag.String("max", "1GiB", "largest padded piece size to measure, up to 64GiB")
+	corpora := flag.String("corpus", "zeros,random,carlike", "comma-separated list of corpora to measure")
+	flag.Parse()
+
+	min, err := benchmarks.ParseSize(*minSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	max, err := benchmarks.ParseSize(*maxSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var cs []benchmarks.Corpus
+	for _, name := range strings.Split(*corpora, ",") {
+		c, found := benchmarks.CorpusByName(name)
+		if !found {
+			log.Fatalf("unknown corpus '%s'", name)
+		}
+		cs = append(cs, c)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, c := range cs {
+		for _, size := range benchmarks.PieceSizes(min, max) {
+			res, err := benchmarks.Run(c, size)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := enc.Encode(res); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
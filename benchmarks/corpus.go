@@ -0,0 +1,126 @@
+// Package benchmarks provides reproducible payload corpora and a small
+// measurement harness, allowing the throughput of commP calculation to be
+// tracked across changes. The corpora are generated deterministically, so the
+// same corpus and size always result in the same commP, regardless of the
+// machine running the benchmark.
+//
+// Standard Go benchmarks are available via
+//
+//	go test -bench . ./benchmarks -benchmarks.max-piece-size=1GiB
+//
+// while the commp-bench command emits one JSON object per measurement,
+// suitable for regression tracking by scripts.
+package benchmarks
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+)
+
+// Corpus is a named generator of deterministic payloads.
+type Corpus struct {
+	Name string
+
+	// NewReader returns a reader producing exactly size bytes of payload.
+	NewReader func(size int64) io.Reader
+}
+
+// cycleSize is the size of the pregenerated pattern repeated by every corpus:
+// large enough to avoid artificial cache effects, small enough to be cheap to
+// build, and not a multiple of the 127-byte fr32 block.
+const cycleSize = 4<<20 + 1
+
+var (
+	// Zeros is a payload consisting entirely of zero bytes.
+	Zeros = Corpus{Name: "zeros", NewReader: cycled(make([]byte, cycleSize))}
+
+	// Random is a payload of incompressible pseudo-random bytes.
+	Random = Corpus{Name: "random", NewReader: cycled(randomBytes(rand.New(rand.NewSource(1)), cycleSize))}
+
+	// CARLike is a payload mimicking a CARv1 stream: a header followed by
+	// length-prefixed frames of a CID and a block of data, with the blocks
+	// alternating between random and highly repetitive content.
+	CARLike = Corpus{Name: "carlike", NewReader: cycled(carLikeBytes(cycleSize))}
+)
+
+// Corpora lists all available corpora.
+var Corpora = []Corpus{Zeros, Random, CARLike}
+
+// CorpusByName returns the corpus with the given name, and whether it exists.
+func CorpusByName(name string) (Corpus, bool) {
+	for _, c := range Corpora {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Corpus{}, false
+}
+
+func randomBytes(rnd *rand.Rand, size int) []byte {
+	buf := make([]byte, size)
+	rnd.Read(buf)
+	return buf
+}
+
+func carLikeBytes(size int) []byte {
+	rnd := rand.New(rand.NewSource(2))
+	buf := make([]byte, 0, size+(1<<20))
+
+	frame := func(data []byte) {
+		var vi [binary.MaxVarintLen64]byte
+		buf = append(buf, vi[:binary.PutUvarint(vi[:], uint64(len(data)))]...)
+		buf = append(buf, data...)
+	}
+
+	// roughly a dag-cbor header with a single root
+	hdr := append([]byte{0xA2, 0x65, 'r', 'o', 'o', 't', 's', 0x81, 0xD8, 0x2A, 0x58, 0x25, 0x00, 0x01, 0x71, 0x12, 0x20}, randomBytes(rnd, 32)...)
+	hdr = append(hdr, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01)
+	frame(hdr)
+
+	for i := 0; len(buf) < size; i++ {
+		// CIDv1 raw sha2-256 followed by up to 1MiB of data
+		blk := append([]byte{0x01, 0x55, 0x12, 0x20}, randomBytes(rnd, 32)...)
+		blkLen := 1 + rnd.Intn(1<<20)
+		if i%2 == 0 {
+			blk = append(blk, randomBytes(rnd, blkLen)...)
+		} else {
+			line := []byte("the quick brown fox jumps over the lazy dog\n")
+			for len(blk) < blkLen {
+				blk = append(blk, line...)
+			}
+		}
+		frame(blk)
+	}
+
+	return buf[:size]
+}
+
+func cycled(pattern []byte) func(int64) io.Reader {
+	return func(size int64) io.Reader {
+		return &cycleReader{pattern: pattern, remaining: size}
+	}
+}
+
+type cycleReader struct {
+	pattern   []byte
+	off       int
+	remaining int64
+}
+
+func (cr *cycleReader) Read(p []byte) (int, error) {
+	if cr.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	var n int
+	for n < len(p) {
+		c := copy(p[n:], cr.pattern[cr.off:])
+		n += c
+		cr.off = (cr.off + c) % len(cr.pattern)
+	}
+	cr.remaining -= int64(n)
+	return n, nil
+}
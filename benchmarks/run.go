@@ -0,0 +1,127 @@
+package benchmarks
+
+import (
+	"encoding/hex"
+	"io"
+	"math/bits"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// Result is a single throughput measurement.
+type Result struct {
+	Corpus          string  `json:"corpus"`
+	PayloadSize     uint64  `json:"payload_size"`
+	PaddedPieceSize uint64  `json:"padded_piece_size"`
+	Seconds         float64 `json:"seconds"`
+	GBPerSec        float64 `json:"gb_per_sec"` // unpadded payload bytes, in units of 10^9
+	Allocs          uint64  `json:"allocs"`
+	AllocBytes      uint64  `json:"alloc_bytes"`
+	CommP           string  `json:"commp"` // hex, for verifying the corpus did not change
+	GoVersion       string  `json:"go_version"`
+	GOARCH          string  `json:"goarch"`
+}
+
+// BufSize is the size of the individual Write()s issued by Run, matching the
+// buffer size of cmd/stream-commp.
+const BufSize = (4 << 20) / 128 * 127
+
+// Run hashes a payload from the given corpus filling a piece of the given
+// padded size exactly, and reports the elapsed time and the allocations made
+// by the process while doing so.
+func Run(c Corpus, paddedPieceSize uint64) (Result, error) {
+	if err := commp.PaddedPieceSize(paddedPieceSize).Validate(); err != nil {
+		return Result{}, err
+	}
+	payloadSize := uint64(commp.PaddedPieceSize(paddedPieceSize).Unpadded())
+
+	src := c.NewReader(int64(payloadSize))
+	buf := make([]byte, BufSize)
+	cp := new(commp.Calc)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	if _, err := io.CopyBuffer(cp, src, buf); err != nil {
+		cp.Reset()
+		return Result{}, err
+	}
+	rawCommP, size, err := cp.Digest()
+	if err != nil {
+		return Result{}, err
+	}
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if size != paddedPieceSize {
+		return Result{}, xerrors.Errorf("corpus %s resulted in padded size %d instead of the expected %d", c.Name, size, paddedPieceSize)
+	}
+
+	return Result{
+		Corpus:          c.Name,
+		PayloadSize:     payloadSize,
+		PaddedPieceSize: paddedPieceSize,
+		Seconds:         elapsed.Seconds(),
+		GBPerSec:        float64(payloadSize) / elapsed.Seconds() / 1e9,
+		Allocs:          after.Mallocs - before.Mallocs,
+		AllocBytes:      after.TotalAlloc - before.TotalAlloc,
+		CommP:           hex.EncodeToString(rawCommP),
+		GoVersion:       runtime.Version(),
+		GOARCH:          runtime.GOARCH,
+	}, nil
+}
+
+// PieceSizes returns every power-of-two padded piece size between min and max
+// inclusive.
+func PieceSizes(min, max uint64) []uint64 {
+	var sizes []uint64
+	if min < 128 {
+		min = 128
+	}
+	for s := uint64(1) << uint(63-bits.LeadingZeros64(min)); s <= max && s != 0; s <<= 1 {
+		if s >= min {
+			sizes = append(sizes, s)
+		}
+	}
+	return sizes
+}
+
+// ParseSize parses a byte size such as "2048", "2KiB" or "64GiB".
+func ParseSize(s string) (uint64, error) {
+	mult := uint64(1)
+	for i, suffix := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if strings.HasSuffix(s, suffix) {
+			mult = 1 << uint(10*(i+1))
+			s = strings.TrimSuffix(s, suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, xerrors.Errorf("invalid size '%s': %w", s, err)
+	}
+	if n > ^uint64(0)/mult {
+		return 0, xerrors.Errorf("size '%s' overflows", s)
+	}
+	return n * mult, nil
+}
+
+// FormatSize is the inverse of ParseSize, using the largest unit that
+// represents the size exactly.
+func FormatSize(n uint64) string {
+	for i, suffix := range []string{"TiB", "GiB", "MiB", "KiB"} {
+		unit := uint64(1) << uint(10*(4-i))
+		if n >= unit && n%unit == 0 {
+			return strconv.FormatUint(n/unit, 10) + suffix
+		}
+	}
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,93 @@
+package commp
+
+import "hash"
+
+// DefaultBufferSize is the buffer size of a BufferedCalc, unless specified.
+const DefaultBufferSize = 127 << 10
+
+// BufferedCalc coalesces the Write()s to a Calc into writes of a whole buffer,
+// sparing callers issuing many small writes, such as encoders or tar writers,
+// the per-call overhead of a Calc. As the Calc only sees full buffers, size
+// errors are only returned by the Write() filling the buffer, or by Digest().
+// Unlike a Calc, a BufferedCalc is not safe for concurrent use.
+type BufferedCalc struct {
+	c   *Calc
+	buf []byte
+}
+
+var _ hash.Hash = &BufferedCalc{}
+var _ Digester = &BufferedCalc{}
+
+// NewBufferedCalc returns a BufferedCalc writing to c via a buffer of at least
+// size bytes, rounded up to a multiple of the 127-byte block size. A size of 0
+// or less selects DefaultBufferSize.
+func NewBufferedCalc(c *Calc, size int) *BufferedCalc {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &BufferedCalc{
+		c:   c,
+		buf: make([]byte, 0, (size+126)/127*127),
+	}
+}
+
+// Write adds p to the buffer, writing out the buffer once full. Writes at
+// least as large as the buffer go to the Calc directly.
+func (bc *BufferedCalc) Write(p []byte) (int, error) {
+	if len(bc.buf)+len(p) <= cap(bc.buf) {
+		bc.buf = append(bc.buf, p...)
+		return len(p), nil
+	}
+
+	if err := bc.Flush(); err != nil {
+		return 0, err
+	}
+	if len(p) >= cap(bc.buf) {
+		return bc.c.Write(p)
+	}
+	bc.buf = append(bc.buf, p...)
+	return len(p), nil
+}
+
+// Flush writes out the buffer. On failure the buffer is retained, as it was
+// not accepted by the Calc.
+func (bc *BufferedCalc) Flush() error {
+	if len(bc.buf) == 0 {
+		return nil
+	}
+	if _, err := bc.c.Write(bc.buf); err != nil {
+		return err
+	}
+	bc.buf = bc.buf[:0]
+	return nil
+}
+
+// Digest flushes the buffer and returns the Digest() of the Calc.
+func (bc *BufferedCalc) Digest() (commP []byte, paddedPieceSize uint64, err error) {
+	if err := bc.Flush(); err != nil {
+		return nil, 0, err
+	}
+	return bc.c.Digest()
+}
+
+// Sum is the Sum() of the Calc, after flushing the buffer. It panics on errors
+// returned from Digest().
+func (bc *BufferedCalc) Sum(buf []byte) []byte {
+	commP, _, err := bc.Digest()
+	if err != nil {
+		panic(err)
+	}
+	return append(buf, commP...)
+}
+
+// Reset discards the buffer and resets the Calc.
+func (bc *BufferedCalc) Reset() {
+	bc.buf = bc.buf[:0]
+	bc.c.Reset()
+}
+
+// Size is the Size() of the Calc.
+func (bc *BufferedCalc) Size() int { return bc.c.Size() }
+
+// BlockSize is the BlockSize() of the Calc.
+func (bc *BufferedCalc) BlockSize() int { return bc.c.BlockSize() }
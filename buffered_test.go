@@ -0,0 +1,75 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestBufferedCalc(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	payload := make([]byte, 1<<20+13)
+	rnd.Read(payload)
+	expCommP, expSize, err := Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, 127, 1000, 64 << 10} {
+		bc := NewBufferedCalc(new(Calc), size)
+		for i := 0; i < 2; i++ {
+			// writes of 1 to 512 bytes, and an occasional large one
+			for p := payload; len(p) > 0; {
+				n := 1 + rnd.Intn(512)
+				if rnd.Intn(100) == 0 {
+					n = 200 << 10
+				}
+				if n > len(p) {
+					n = len(p)
+				}
+				if _, err := bc.Write(p[:n]); err != nil {
+					t.Fatal(err)
+				}
+				p = p[n:]
+			}
+			commP, paddedSize, err := bc.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+				t.Fatalf("buffer of %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+			}
+		}
+
+		// a Reset() discards the buffer as well
+		bc.Write(bytes.Repeat([]byte{1}, 100))
+		bc.Reset()
+		if _, _, err := bc.Digest(); !xerrors.Is(err, ErrPayloadTooSmall) {
+			t.Fatalf("expected ErrPayloadTooSmall after a Reset(), got %v", err)
+		}
+	}
+}
+
+func BenchmarkSmallWrites(b *testing.B) {
+	payload := make([]byte, 127<<12)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	for name, h := range map[string]Digester{
+		"calc":     new(Calc),
+		"buffered": NewBufferedCalc(new(Calc), 0),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				for p := payload; len(p) > 0; p = p[64:] {
+					h.Write(p[:64])
+				}
+				if _, _, err := h.Digest(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
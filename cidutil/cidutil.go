@@ -0,0 +1,74 @@
+// Package cidutil converts between the raw commitments of the commp package
+// and their CIDs, via go-fil-commcid. It lives in a separate module so that
+// users of the commp package are not forced to depend on go-cid.
+//
+// Unlike go-fil-commcid, every conversion validates the commitment itself:
+// a raw commP is the root of a tree of fr32 nodes, so its two most
+// significant bits are always zero.
+package cidutil
+
+import (
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// ErrInvalidCommitment is matched by the errors of conversions of malformed
+// commitments or CIDs.
+var ErrInvalidCommitment = xerrors.New("invalid commitment")
+
+// ValidateCommitment checks that raw is a 32 byte fr32 node.
+func ValidateCommitment(raw []byte) error {
+	if len(raw) != 32 {
+		return xerrors.Errorf("commitment of %d bytes instead of 32: %w", len(raw), ErrInvalidCommitment)
+	}
+	if raw[31]&0xC0 != 0 {
+		return xerrors.Errorf("commitment %X is not a truncated fr32 node: %w", raw, ErrInvalidCommitment)
+	}
+	return nil
+}
+
+// PieceCID returns the piece CID of a raw commP, as computed by commp.Calc.
+func PieceCID(rawCommP []byte) (cid.Cid, error) {
+	if err := ValidateCommitment(rawCommP); err != nil {
+		return cid.Undef, err
+	}
+	return commcid.DataCommitmentV1ToCID(rawCommP)
+}
+
+// CommP returns the raw commP of a piece CID.
+func CommP(pieceCID cid.Cid) ([]byte, error) {
+	if !pieceCID.Defined() {
+		return nil, xerrors.Errorf("undefined piece CID: %w", ErrInvalidCommitment)
+	}
+	raw, err := commcid.CIDToDataCommitmentV1(pieceCID)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %s: %w", pieceCID, err, ErrInvalidCommitment)
+	}
+	if err := ValidateCommitment(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// FromPieceInfo returns the piece CID of pi, after validating its size.
+func FromPieceInfo(pi commp.PieceInfo) (cid.Cid, error) {
+	if err := commp.PaddedPieceSize(pi.PaddedPieceSize).Validate(); err != nil {
+		return cid.Undef, xerrors.Errorf("%s: %w", err, ErrInvalidCommitment)
+	}
+	return PieceCID(pi.CommP)
+}
+
+// ToPieceInfo returns the commp.PieceInfo of a piece CID with the given padded
+// size, which is not part of the CID.
+func ToPieceInfo(pieceCID cid.Cid, paddedPieceSize uint64) (commp.PieceInfo, error) {
+	if err := commp.PaddedPieceSize(paddedPieceSize).Validate(); err != nil {
+		return commp.PieceInfo{}, xerrors.Errorf("%s: %w", err, ErrInvalidCommitment)
+	}
+	raw, err := CommP(pieceCID)
+	if err != nil {
+		return commp.PieceInfo{}, err
+	}
+	return commp.PieceInfo{CommP: raw, PaddedPieceSize: paddedPieceSize}, nil
+}
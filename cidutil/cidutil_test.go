@@ -0,0 +1,60 @@
+package cidutil
+
+import (
+	"bytes"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/testvectors"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+func TestRoundtrip(t *testing.T) {
+	rawCommP, paddedSize, err := commp.Sum(bytes.Repeat([]byte{0xCC}, 127))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := FromPieceInfo(commp.PieceInfo{CommP: rawCommP[:], PaddedPieceSize: paddedSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := testvectors.PieceCID(rawCommP[:]); c.String() != exp {
+		t.Fatalf("piece CID %s, expected %s", c, exp)
+	}
+
+	pi, err := ToPieceInfo(c, paddedSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pi.CommP, rawCommP[:]) || pi.PaddedPieceSize != paddedSize {
+		t.Fatalf("roundtrip resulted in %X/%d", pi.CommP, pi.PaddedPieceSize)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	notFr32 := bytes.Repeat([]byte{0xFF}, 32)
+	rawCID := cid.NewCidV1(cid.Raw, []byte{0x12, 0x20, 0x00})
+
+	for name, err := range map[string]error{
+		"short":    ValidateCommitment(make([]byte, 31)),
+		"not fr32": ValidateCommitment(notFr32),
+		"size": func() error {
+			_, err := FromPieceInfo(commp.PieceInfo{CommP: make([]byte, 32), PaddedPieceSize: 100})
+			return err
+		}(),
+		"codec": func() error {
+			_, err := CommP(rawCID)
+			return err
+		}(),
+		"undefined": func() error {
+			_, err := CommP(cid.Undef)
+			return err
+		}(),
+	} {
+		if !xerrors.Is(err, ErrInvalidCommitment) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+}
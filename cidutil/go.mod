@@ -0,0 +1,12 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/cidutil
+
+go 1.11
+
+require (
+	github.com/filecoin-project/go-fil-commcid v0.1.0
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/ipfs/go-cid v0.0.7
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+)
+
+replace github.com/filecoin-project/go-fil-commp-hashhash => ../
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/datasegment"
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/options"
+)
+
+// subPiece is a constituent of an aggregate, either an input file or a piece
+// specified by its CID.
+type subPiece struct {
+	Name            string `json:"name"`
+	PieceCID        string `json:"pieceCid"`
+	Offset          uint64 `json:"offset"`
+	PaddedPieceSize uint64 `json:"paddedPieceSize"`
+
+	commP       []byte
+	payloadSize uint64 // 0 for pieces specified by their CID
+}
+
+// aggregateResult is the --json output of `commp aggregate`.
+type aggregateResult struct {
+	PieceCID        string     `json:"pieceCid"`
+	PieceCIDv2      string     `json:"pieceCidV2"`
+	PaddedPieceSize uint64     `json:"paddedPieceSize"`
+	IndexOffset     uint64     `json:"indexOffset"`
+	IndexEntries    uint64     `json:"indexEntries"`
+	SubPieces       []subPiece `json:"subPieces"`
+}
+
+// aggregateMain implements `commp aggregate`, laying out sub-pieces in an
+// FRC-0058 aggregate with a data segment index, and reporting the piece CID of
+// the aggregate and the location of every sub-piece within it.
+func aggregateMain(args []string) {
+	opts := &struct {
+		Size   string       `getopt:"-s --size=SIZE     Padded size of the aggregate, defaults to the smallest one fitting all sub-pieces"`
+		Pieces string       `getopt:"--pieces=FILE      Read sub-pieces from FILE instead of hashing input files, one per line as: PIECE_CID [PADDED_SIZE]. Use - for STDIN"`
+		Out    string       `getopt:"-o --out=FILE      Write the aggregate payload to FILE, which requires input files"`
+		Index  string       `getopt:"-i --index=FILE    Write the data segment index region to FILE, as 64-byte entries in their padded form"`
+		JSON   bool         `getopt:"--json             Output a JSON object instead of text"`
+		Help   options.Help `getopt:"-h --help          Display help"`
+	}{}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if (opts.Pieces == "") == (len(paths) == 0) {
+		log.Fatal("aggregate expects either input files or --pieces")
+	}
+	if opts.Out != "" && opts.Pieces != "" {
+		log.Fatal("--out requires input files")
+	}
+
+	var subs []subPiece
+	if opts.Pieces != "" {
+		subs, err = readPieceList(opts.Pieces)
+	} else if opts.Out != "" {
+		// only the sizes are needed upfront, the payload is hashed while the
+		// aggregate is written out
+		subs, err = statSubPieces(paths)
+	} else {
+		subs, err = hashSubPieces(paths)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var dealSize uint64
+	if opts.Size != "" {
+		if dealSize, err = parsePaddedSize(opts.Size); err != nil {
+			log.Fatalf("invalid --size: %s", err)
+		}
+	} else if dealSize, err = fitAggregate(subs); err != nil {
+		log.Fatal(err)
+	}
+
+	var aggCommP []byte
+	var index []datasegment.SegmentDesc
+	if opts.Out != "" {
+		aggCommP, index, err = buildAggregate(dealSize, subs, opts.Out)
+	} else {
+		aggCommP, index, err = planAggregate(dealSize, subs)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	res := aggregateResult{
+		PaddedPieceSize: dealSize,
+		IndexOffset:     datasegment.DataSegmentIndexStartOffset(dealSize),
+		IndexEntries:    uint64(len(index)),
+		SubPieces:       subs,
+	}
+	agg, err := newResult("", dealSize/128*127, aggCommP, dealSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res.PieceCID = agg.PieceCID.String()
+	res.PieceCIDv2 = agg.PieceCIDv2.String()
+	for i := range subs {
+		subs[i].Offset = index[i].Offset
+		sub, err := newResult(subs[i].Name, subs[i].payloadSize, index[i].CommDs[:], index[i].Size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		subs[i].PieceCID = sub.PieceCID.String()
+	}
+
+	if opts.Index != "" {
+		if err := writeIndexRegion(opts.Index, dealSize, index); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if opts.JSON {
+		err = json.NewEncoder(os.Stdout).Encode(res)
+	} else {
+		err = printAggregate(os.Stdout, &res)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readPieceList parses lines of a piece CID optionally followed by its padded
+// size, which is required for v1 piece CIDs.
+func readPieceList(listPath string) ([]subPiece, error) {
+	list := os.Stdin
+	if listPath != "-" {
+		f, err := os.Open(listPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		list = f
+	}
+
+	var subs []subPiece
+	scanner := bufio.NewScanner(list)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a piece CID optionally followed by a padded size", lineNo)
+		}
+
+		c, err := cid.Decode(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		rawCommP, paddedSize, payloadSize, err := parsePieceCID(c)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		if len(fields) == 2 {
+			size, err := parsePaddedSize(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			if paddedSize != 0 && size != paddedSize {
+				return nil, fmt.Errorf("line %d: size %d contradicts the size %d embedded in the v2 piece CID", lineNo, size, paddedSize)
+			}
+			paddedSize = size
+		}
+		if paddedSize == 0 {
+			return nil, fmt.Errorf("line %d: the padded size is required with a v1 piece CID", lineNo)
+		}
+
+		subs = append(subs, subPiece{
+			Name:            fields[0],
+			PaddedPieceSize: paddedSize,
+			commP:           rawCommP,
+			payloadSize:     payloadSize,
+		})
+	}
+	return subs, scanner.Err()
+}
+
+func hashSubPieces(paths []string) ([]subPiece, error) {
+	subs := make([]subPiece, 0, len(paths))
+	for _, path := range paths {
+		res, err := hashPath(path, &hashOpts{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		subs = append(subs, subPiece{
+			Name:            path,
+			PaddedPieceSize: res.PaddedSize,
+			commP:           res.CommP,
+			payloadSize:     res.PayloadSize,
+		})
+	}
+	return subs, nil
+}
+
+func statSubPieces(paths []string) ([]subPiece, error) {
+	subs := make([]subPiece, 0, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s: --out requires regular files as inputs", path)
+		}
+		if uint64(fi.Size()) < commp.MinPiecePayload {
+			return nil, fmt.Errorf("%s: payload of %d bytes is too small for a piece", path, fi.Size())
+		}
+		subs = append(subs, subPiece{
+			Name:            path,
+			PaddedPieceSize: uint64(commp.UnpaddedPieceSize(fi.Size()).NextPowerOfTwo().Padded()),
+			payloadSize:     uint64(fi.Size()),
+		})
+	}
+	return subs, nil
+}
+
+// fitAggregate returns the smallest aggregate size holding all sub-pieces.
+func fitAggregate(subs []subPiece) (uint64, error) {
+	pieces := make([]commp.PieceInfo, len(subs))
+	for i := range subs {
+		// only the layout matters here, not the commitments
+		pieces[i] = commp.PieceInfo{CommP: make([]byte, 32), PaddedPieceSize: subs[i].PaddedPieceSize}
+	}
+
+	for size := uint64(1 << 10); size <= commp.MaxPiecePayload/127*128; size <<= 1 {
+		if _, err := datasegment.NewIndex(size, pieces); err == nil {
+			return size, nil
+		}
+	}
+	return 0, fmt.Errorf("the %d sub-pieces do not fit in the largest supported aggregate", len(subs))
+}
+
+// planAggregate derives the aggregate from the sub-piece commitments alone.
+func planAggregate(dealSize uint64, subs []subPiece) ([]byte, []datasegment.SegmentDesc, error) {
+	pieces := make([]commp.PieceInfo, len(subs))
+	for i := range subs {
+		pieces[i] = commp.PieceInfo{CommP: subs[i].commP, PaddedPieceSize: subs[i].PaddedPieceSize}
+	}
+
+	index, err := datasegment.NewIndex(dealSize, pieces)
+	if err != nil {
+		return nil, nil, err
+	}
+	aggCommP, err := datasegment.AggregateCommP(dealSize, index)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aggCommP, index, nil
+}
+
+// buildAggregate writes out the aggregate payload to outPath, hashing the
+// sub-pieces on the way.
+func buildAggregate(dealSize uint64, subs []subPiece, outPath string) ([]byte, []datasegment.SegmentDesc, error) {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aggCommP, index, err := writeAggregate(dealSize, subs, bufio.NewWriterSize(out, BufSize))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return nil, nil, err
+	}
+	return aggCommP, index, nil
+}
+
+func writeAggregate(dealSize uint64, subs []subPiece, out *bufio.Writer) ([]byte, []datasegment.SegmentDesc, error) {
+	b, err := datasegment.NewBuilder(dealSize, out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, sub := range subs {
+		f, err := os.Open(sub.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = b.AddPiece(bufio.NewReaderSize(f, BufSize), sub.payloadSize)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", sub.Name, err)
+		}
+	}
+
+	aggCommP, index, err := b.Finish()
+	if err != nil {
+		return nil, nil, err
+	}
+	return aggCommP, index, out.Flush()
+}
+
+// writeIndexRegion writes the entire index region of the aggregate, including
+// the unused zero entries.
+func writeIndexRegion(path string, dealSize uint64, index []datasegment.SegmentDesc) error {
+	region := make([]byte, datasegment.MaxIndexEntriesInDeal(dealSize)*datasegment.EntrySize)
+	for i, sd := range index {
+		entry := sd.Serialize()
+		copy(region[i*datasegment.EntrySize:], entry[:])
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(region); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printAggregate(w io.Writer, res *aggregateResult) error {
+	_, err := fmt.Fprintf(w, `Aggregate:      %s
+Padded piece:   % 12d bytes
+Index offset:   % 12d (%d of %d entries used)
+Sub-pieces:
+`,
+		res.PieceCID,
+		res.PaddedPieceSize,
+		res.IndexOffset,
+		res.IndexEntries,
+		datasegment.MaxIndexEntriesInDeal(res.PaddedPieceSize),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range res.SubPieces {
+		if _, err := fmt.Fprintf(w, "% 16d % 12d  %s  %s\n", sub.Offset, sub.PaddedPieceSize, sub.PieceCID, sub.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
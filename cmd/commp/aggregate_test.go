@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPieceList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rawCommP := bytes.Repeat([]byte{0x22}, 32)
+	v1, err := newResult("", 1000, rawCommP, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1CID := v1.PieceCID.String()
+	v2CID := pieceCIDv2(rawCommP, 2048, 1500).String()
+
+	list := func(lines string) string {
+		path := filepath.Join(dir, "list")
+		if err := ioutil.WriteFile(path, []byte(lines), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	subs, err := readPieceList(list(v1CID + " 1KiB\n\n  " + v2CID + "\n" + v2CID + "\t2048\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []subPiece{
+		{Name: v1CID, PaddedPieceSize: 1024},
+		{Name: v2CID, PaddedPieceSize: 2048, payloadSize: 1500},
+		{Name: v2CID, PaddedPieceSize: 2048, payloadSize: 1500},
+	}
+	if len(subs) != len(expected) {
+		t.Fatalf("parsed %d sub-pieces, expected %d", len(subs), len(expected))
+	}
+	for i, sp := range subs {
+		exp := expected[i]
+		if sp.Name != exp.Name || sp.PaddedPieceSize != exp.PaddedPieceSize || sp.payloadSize != exp.payloadSize || !bytes.Equal(sp.commP, rawCommP) {
+			t.Fatalf("sub-piece %d parsed as %+v, expected %+v", i, sp, exp)
+		}
+	}
+
+	for _, lines := range []string{
+		v1CID + "\n",
+		v1CID + " 1000\n",
+		v2CID + " 1024\n",
+		v1CID + " 1024 extra\n",
+		"bogus 1024\n",
+	} {
+		if _, err := readPieceList(list(lines)); err == nil {
+			t.Fatalf("unexpected successful parse of %q", lines)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/benchmarks"
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+	sha256simd "github.com/minio/sha256-simd"
+	"github.com/pborman/options"
+)
+
+// benchMain implements `commp bench`, measuring the throughput of the
+// individual stages of commP calculation, and of whole pieces hashed by a
+// single and by many concurrent streams, over synthetic in-memory payloads.
+func benchMain(args []string) {
+	opts := &struct {
+		Size    string       `getopt:"-s --size=SIZE     Padded piece size hashed by every stream"`
+		Corpus  string       `getopt:"--corpus=NAME      Synthetic payload, one of: zeros random carlike"`
+		Streams int          `getopt:"-n --streams=N     Amount of concurrent streams for the multi-stream measurement"`
+		Help    options.Help `getopt:"-h --help          Display help"`
+	}{
+		Size:    "1GiB",
+		Corpus:  "random",
+		Streams: runtime.NumCPU(),
+	}
+
+	if rest, err := options.SubRegisterAndParse(opts, args); err != nil {
+		log.Fatal(err)
+	} else if len(rest) > 0 {
+		log.Fatal("bench does not take any inputs")
+	}
+
+	pieceSize, err := parsePaddedSize(opts.Size)
+	if err != nil {
+		log.Fatalf("invalid --size: %s", err)
+	}
+	corpus, found := benchmarks.CorpusByName(opts.Corpus)
+	if !found {
+		log.Fatalf("unknown corpus '%s'", opts.Corpus)
+	}
+	if opts.Streams < 1 {
+		log.Fatalf("invalid amount of streams %d", opts.Streams)
+	}
+	payloadSize := uint64(commp.PaddedPieceSize(pieceSize).Unpadded())
+
+	fmt.Printf("Machine:        %s/%s, %d CPUs, %s\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), runtime.Version())
+	fmt.Printf("Payload:        %s of %s per stream (%s padded piece)\n", formatBytes(payloadSize), corpus.Name, benchmarks.FormatSize(pieceSize))
+
+	elapsed, err := benchFr32(corpus, payloadSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("fr32 padding:   %6.2f GB/s\n", gbPerSec(payloadSize, elapsed))
+
+	// the binary tree over a piece consists of one node hash per 32 bytes
+	elapsed = benchTree(pieceSize / 32)
+	fmt.Printf("Tree hashing:   %6.2f GB/s  (%.1f M nodes/s)\n", gbPerSec(payloadSize, elapsed), float64(pieceSize/32)/elapsed.Seconds()/1e6)
+
+	res, err := benchmarks.Run(corpus, pieceSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Single stream:  %6.2f GB/s\n", res.GBPerSec)
+
+	elapsed, err = benchStreams(corpus, pieceSize, opts.Streams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	total := gbPerSec(payloadSize*uint64(opts.Streams), elapsed)
+	fmt.Printf("%-16s%6.2f GB/s  (%.2f GB/s per stream)\n", fmt.Sprintf("%d streams:", opts.Streams), total, total/float64(opts.Streams))
+}
+
+// benchFr32 measures the expansion of payloadSize bytes of the corpus into
+// tree leaves, without any hashing.
+func benchFr32(c benchmarks.Corpus, payloadSize uint64) (time.Duration, error) {
+	in := make([]byte, BufSize)
+	out := make([]byte, BufSize/127*128)
+	src := c.NewReader(int64(payloadSize))
+
+	var elapsed time.Duration
+	for {
+		n, err := io.ReadFull(src, in)
+		if err == io.EOF {
+			return elapsed, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		n -= n % 127
+
+		// only the padding is timed, not the generation of the payload
+		start := time.Now()
+		fr32.Pad(in[:n], out[:n/127*128])
+		elapsed += time.Since(start)
+	}
+}
+
+// benchTree measures the hashing of the given amount of tree nodes on a
+// single core, which bounds the throughput of a single stream: the bulk of
+// the nodes are on the lowest layers, each of which is hashed by one worker.
+func benchTree(nodes uint64) time.Duration {
+	nh := commp.NewNodeHasher(sha256simd.New)
+	pair := make([]byte, 64)
+
+	start := time.Now()
+	for i := uint64(0); i < nodes; i++ {
+		// feed every result back in, so nothing can be elided
+		nh.HashNodes(pair[:0], pair[:32], pair[32:])
+	}
+	return time.Since(start)
+}
+
+// benchStreams hashes a piece of the corpus on each of the given amount of
+// concurrent streams.
+func benchStreams(c benchmarks.Corpus, pieceSize uint64, streams int) (time.Duration, error) {
+	errs := make(chan error, streams)
+	start := time.Now()
+	for i := 0; i < streams; i++ {
+		go func() {
+			_, err := benchmarks.Run(c, pieceSize)
+			errs <- err
+		}()
+	}
+	for i := 0; i < streams; i++ {
+		if err := <-errs; err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start), nil
+}
+
+func gbPerSec(bytes uint64, elapsed time.Duration) float64 {
+	return float64(bytes) / elapsed.Seconds() / 1e9
+}
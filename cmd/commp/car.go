@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+)
+
+type CarHeader struct {
+	Roots   []cid.Cid
+	Version uint64
+}
+
+func init() {
+	cbor.RegisterCborType(CarHeader{})
+}
+
+// carInfo describes a CAR detected at the start of an input.
+type carInfo struct {
+	Version uint64
+	Roots   []cid.Cid
+	Blocks  uint64
+	// Length is the size of the CAR itself, excluding any trailing data. For
+	// a CARv2 this covers everything up to the end of the input, as the index
+	// is not parsed.
+	Length uint64
+	// DataSize is the size of the CARv1 payload of a CARv2, and equal to
+	// Length for a CARv1.
+	DataSize uint64
+	// Broken is set when the CAR frames stop being decodable before the end
+	// of the CAR data.
+	Broken bool
+}
+
+// carV2PragmaSize is the length of the varint-prefixed {version:2} header
+// of a CARv2, which is followed by a fixed 40-byte header.
+const carV2PragmaSize = 11
+
+// scanCar opportunistically parses a CAR at the start of r, consuming it. It
+// returns a nil carInfo if the data does not start with a valid CAR header.
+// The returned error is only set on read errors, which leave the carInfo
+// incomplete. A CARv2 is parsed all the way to the end of its data payload.
+func scanCar(r *bufio.Reader) (*carInfo, error) {
+	hdr, hdrLen, err := readCarHeader(r)
+	if hdr == nil || err != nil {
+		return nil, err
+	}
+
+	ci := &carInfo{
+		Version: hdr.Version,
+		Roots:   hdr.Roots,
+		Length:  hdrLen,
+	}
+
+	switch hdr.Version {
+	case 1:
+		ci.Blocks, ci.Length, ci.Broken, err = scanCarFrames(r, ci.Length)
+		ci.DataSize = ci.Length
+		return ci, err
+
+	case 2:
+		if hdrLen != carV2PragmaSize {
+			return nil, nil
+		}
+
+		var v2hdr [40]byte
+		if _, err := io.ReadFull(r, v2hdr[:]); err != nil {
+			return nil, ignoreEOF(err)
+		}
+		ci.Length += 40
+		dataOffset := binary.LittleEndian.Uint64(v2hdr[16:])
+		ci.DataSize = binary.LittleEndian.Uint64(v2hdr[24:])
+		if dataOffset < ci.Length {
+			ci.Broken = true
+			return ci, nil
+		}
+
+		n, err := io.CopyN(ioutil.Discard, r, int64(dataOffset-ci.Length))
+		ci.Length += uint64(n)
+		if err != nil {
+			return ci, ignoreEOF(err)
+		}
+
+		// the whole data payload is part of the CAR, decodable or not
+		data := &countingReader{r: io.LimitReader(r, int64(ci.DataSize))}
+		defer func() { ci.Length += data.n }()
+
+		inner := bufio.NewReaderSize(data, BufSize)
+		v1hdr, v1hdrLen, err := readCarHeader(inner)
+		if err != nil {
+			return ci, err
+		}
+		if v1hdr == nil || v1hdr.Version != 1 {
+			ci.Broken = true
+			return ci, nil
+		}
+		ci.Roots = v1hdr.Roots
+
+		var framesEnd uint64
+		ci.Blocks, framesEnd, ci.Broken, err = scanCarFrames(inner, v1hdrLen)
+		if err != nil {
+			return ci, err
+		}
+		if framesEnd != ci.DataSize {
+			ci.Broken = true
+		}
+
+		// the undecodable rest of the data payload, then everything past it,
+		// which belongs to the index
+		if _, err := io.Copy(ioutil.Discard, inner); err != nil {
+			return ci, err
+		}
+		n, err = io.Copy(ioutil.Discard, r)
+		ci.Length += uint64(n)
+		return ci, err
+
+	default:
+		return nil, nil
+	}
+}
+
+func readCarHeader(r *bufio.Reader) (*CarHeader, uint64, error) {
+	maybeHeaderLen, err := r.Peek(10)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, 0, err
+	}
+
+	hdrLen, viLen := binary.Uvarint(maybeHeaderLen)
+	// a CAR header is a small map: anything large is not a CAR
+	if viLen <= 0 || hdrLen == 0 || hdrLen > 1<<20 {
+		return nil, 0, nil
+	}
+
+	hdrBuf, err := r.Peek(viLen + int(hdrLen))
+	if err != nil {
+		return nil, 0, ignoreEOF(err)
+	}
+
+	hdr := new(CarHeader)
+	if cbor.DecodeInto(hdrBuf[viLen:], hdr) != nil {
+		return nil, 0, nil
+	}
+	if _, err := r.Discard(len(hdrBuf)); err != nil {
+		return nil, 0, err
+	}
+
+	return hdr, uint64(len(hdrBuf)), nil
+}
+
+// scanCarFrames consumes the block frames of a CARv1, returning their count
+// and the offset past the last complete frame.
+func scanCarFrames(r *bufio.Reader, offset uint64) (blocks uint64, end uint64, broken bool, err error) {
+	for {
+		maybeNextFrameLen, err := r.Peek(10)
+		if err == io.EOF && len(maybeNextFrameLen) == 0 {
+			return blocks, offset, false, nil
+		}
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return blocks, offset, false, err
+		}
+
+		frameLen, viLen := binary.Uvarint(maybeNextFrameLen)
+		if viLen <= 0 || frameLen == 0 || frameLen > 2<<20 {
+			// trailing garbage, or anything over ~2MiB which got to be a mistake
+			return blocks, offset, true, nil
+		}
+
+		n, err := io.CopyN(ioutil.Discard, r, int64(viLen)+int64(frameLen))
+		if err != nil {
+			// a truncated last frame is not part of the CAR
+			return blocks, offset, true, ignoreEOF(err)
+		}
+		offset += uint64(n)
+		blocks++
+	}
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
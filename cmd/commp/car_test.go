@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+)
+
+func varint(n uint64) []byte {
+	v := make([]byte, binary.MaxVarintLen64)
+	return v[:binary.PutUvarint(v, n)]
+}
+
+// carFrame returns a varint-prefixed CAR frame of the given length.
+func carFrame(length int) []byte {
+	return concat(varint(uint64(length)), bytes.Repeat([]byte{0xCA}, length))
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// testCID returns the CID of a dag-cbor block with a sha2-256 multihash.
+func testCID(t *testing.T, block string) cid.Cid {
+	c, err := cid.NewPrefixV1(cid.DagCBOR, 0x12).Sum([]byte(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestScanCarFrames(t *testing.T) {
+	small, large := carFrame(100), carFrame(200<<10)
+
+	for name, tc := range map[string]struct {
+		data   []byte
+		blocks uint64
+		end    int
+		broken bool
+	}{
+		"empty":     {nil, 0, 0, false},
+		"single":    {small, 1, len(small), false},
+		"several":   {concat(small, large, small), 3, 2*len(small) + len(large), false},
+		"zeroFrame": {concat(small, []byte{0}, small), 1, len(small), true},
+		"garbage":   {concat(small, []byte{0xFF}), 1, len(small), true},
+		"truncated": {concat(small, large[:len(large)-1]), 1, len(small), true},
+		"oversized": {concat(small, carFrame(3<<20)), 1, len(small), true},
+	} {
+		blocks, end, broken, err := scanCarFrames(bufio.NewReaderSize(bytes.NewReader(tc.data), 4096), 42)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if blocks != tc.blocks || end != uint64(42+tc.end) || broken != tc.broken {
+			t.Fatalf("%s: scanned %d blocks up to %d, broken %t, expected %d blocks up to %d, broken %t", name, blocks, end, broken, tc.blocks, 42+tc.end, tc.broken)
+		}
+	}
+}
+
+func TestScanCar(t *testing.T) {
+	root := testCID(t, "root")
+
+	carHeader := func(version uint64) []byte {
+		hdr, err := cbor.DumpObject(CarHeader{Roots: []cid.Cid{root}, Version: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return concat(varint(uint64(len(hdr))), hdr)
+	}
+	hdr := carHeader(1)
+	frames := concat(carFrame(100), carFrame(1000))
+
+	for name, data := range map[string][]byte{
+		"empty":   nil,
+		"zeroes":  make([]byte, 1000),
+		"random":  bytes.Repeat([]byte{0x9C, 0x01}, 500),
+		"version": concat(carHeader(3), frames),
+	} {
+		ci, err := scanCar(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil || ci != nil {
+			t.Fatalf("%s: detected %+v (%v)", name, ci, err)
+		}
+	}
+
+	// a CARv2 wrapping the CARv1 data past some padding, followed by an
+	// index
+	v1 := concat(hdr, frames)
+	carV2 := func(dataSize int) []byte {
+		pragma := []byte{0x0A, 0xA1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}
+		v2hdr := make([]byte, 40)
+		binary.LittleEndian.PutUint64(v2hdr[16:], carV2PragmaSize+40+5)
+		binary.LittleEndian.PutUint64(v2hdr[24:], uint64(dataSize))
+		binary.LittleEndian.PutUint64(v2hdr[32:], uint64(carV2PragmaSize+40+5+len(v1)))
+		return concat(pragma, v2hdr, make([]byte, 5), v1, bytes.Repeat([]byte{0x1D}, 300))
+	}
+
+	for name, tc := range map[string]struct {
+		data     []byte
+		version  uint64
+		blocks   uint64
+		length   int
+		dataSize int
+		broken   bool
+	}{
+		"headerOnly": {hdr, 1, 0, len(hdr), len(hdr), false},
+		"v1":         {v1, 1, 2, len(v1), len(v1), false},
+		"trailing":   {concat(v1, []byte{0, 1, 2}), 1, 2, len(v1), len(v1), true},
+		"v2":         {carV2(len(v1)), 2, 2, len(carV2(len(v1))), len(v1), false},
+		"v2Short":    {carV2(len(v1) + 10), 2, 2, len(carV2(len(v1))), len(v1) + 10, true},
+	} {
+		r := bufio.NewReader(bytes.NewReader(tc.data))
+		ci, err := scanCar(r)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if ci == nil || ci.Version != tc.version || len(ci.Roots) != 1 || !ci.Roots[0].Equals(root) {
+			t.Fatalf("%s: detected %+v", name, ci)
+		}
+		if ci.Blocks != tc.blocks || ci.Length != uint64(tc.length) || ci.DataSize != uint64(tc.dataSize) || ci.Broken != tc.broken {
+			t.Fatalf("%s: detected %d blocks in %d/%d bytes, broken %t, expected %d blocks in %d/%d bytes, broken %t", name, ci.Blocks, ci.Length, ci.DataSize, ci.Broken, tc.blocks, tc.length, tc.dataSize, tc.broken)
+		}
+	}
+}
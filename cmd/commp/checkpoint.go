@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+// checkpointSegmentSize is the padded size of the segments an input is hashed
+// in with --checkpoint: the checkpoint is updated whenever one is complete.
+const checkpointSegmentSize = 1 << 30
+
+// checkpoint is the state of hashing an input, saved to the --checkpoint file.
+// Every complete segment is a full subtree of the piece, so the commP of the
+// whole input can be derived from the segment commitments and the remainder
+// of the input after the last segment.
+type checkpoint struct {
+	Path              string    `json:"path"`
+	Size              int64     `json:"size"`
+	ModTime           time.Time `json:"modTime"`
+	SegmentPaddedSize uint64    `json:"segmentPaddedSize"`
+	Segments          []string  `json:"segments"` // hex raw commP of every complete segment
+}
+
+// hashCheckpointed computes the result for a regular file, resuming from the
+// state saved in the checkpoint file at cpPath if it was saved for the same
+// file. The checkpoint file is removed once the file is fully hashed.
+func hashCheckpointed(path string, opts *hashOpts) (*result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("--checkpoint requires a regular file")
+	}
+
+	cp, err := loadCheckpoint(opts.Checkpoint, path, fi)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]commp.PieceInfo, 0, len(cp.Segments)+1)
+	for i, s := range cp.Segments {
+		rawCommP, err := hex.DecodeString(s)
+		if err != nil || len(rawCommP) != 32 {
+			return nil, fmt.Errorf("invalid commP of segment %d in checkpoint %s", i, opts.Checkpoint)
+		}
+		segments = append(segments, commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: checkpointSegmentSize})
+	}
+
+	segmentPayload := int64(checkpointSegmentSize / 128 * 127)
+	offset := int64(len(segments)) * segmentPayload
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = f
+	if opts.Progress != nil {
+		r = opts.Progress.track(r)
+	}
+
+	buf := make([]byte, BufSize)
+	for {
+		calc := new(commp.Calc)
+		n, err := io.CopyBuffer(calc, io.LimitReader(r, segmentPayload), buf)
+		if err != nil {
+			calc.Reset()
+			return nil, err
+		}
+		offset += n
+
+		if n < segmentPayload {
+			if n > 0 && uint64(n) < commp.MinPiecePayload && len(segments) > 0 {
+				// the remainder is zero-padded anyway, and too short to be
+				// digested on its own
+				calc.Write(make([]byte, 127-n))
+			}
+			if n > 0 || len(segments) == 0 {
+				rawCommP, paddedSize, err := calc.Digest()
+				if err != nil {
+					return nil, err
+				}
+				segments = append(segments, commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: paddedSize})
+			}
+			break
+		}
+
+		rawCommP, _, err := calc.Digest()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: checkpointSegmentSize})
+		cp.Segments = append(cp.Segments, hex.EncodeToString(rawCommP))
+		if err := saveCheckpoint(opts.Checkpoint, cp); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := combineSegments(path, uint64(offset), segments)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(opts.Checkpoint); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if opts.PadTo > 0 {
+		return padResult(res, opts.PadTo)
+	}
+	return res, nil
+}
+
+// combineSegments derives the result of the whole payload from its
+// consecutive segments, all of which but the last are full subtrees of the
+// same size.
+func combineSegments(path string, payloadSize uint64, segments []commp.PieceInfo) (*result, error) {
+	if len(segments) == 1 {
+		return newResult(path, payloadSize, segments[0].CommP, segments[0].PaddedPieceSize)
+	}
+
+	paddedSize := uint64(commp.UnpaddedPieceSize(payloadSize).NextPowerOfTwo().Padded())
+	rawCommP, err := commp.ComputeCommD(paddedSize, segments)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(path, payloadSize, rawCommP, paddedSize)
+}
+
+// loadCheckpoint returns the checkpoint saved for the given file, or a fresh
+// one if there is none, or if the file changed since it was saved.
+func loadCheckpoint(cpPath, path string, fi os.FileInfo) (*checkpoint, error) {
+	fresh := &checkpoint{
+		Path:              path,
+		Size:              fi.Size(),
+		ModTime:           fi.ModTime(),
+		SegmentPaddedSize: checkpointSegmentSize,
+	}
+
+	saved, err := ioutil.ReadFile(cpPath)
+	if os.IsNotExist(err) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cp := new(checkpoint)
+	if err := json.Unmarshal(saved, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %s", cpPath, err)
+	}
+	if cp.Path != fresh.Path || cp.Size != fresh.Size || !cp.ModTime.Equal(fresh.ModTime) || cp.SegmentPaddedSize != checkpointSegmentSize {
+		return fresh, nil
+	}
+	return cp, nil
+}
+
+// saveCheckpoint atomically replaces the checkpoint file.
+func saveCheckpoint(cpPath string, cp *checkpoint) error {
+	j, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := cpPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(j, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cpPath)
+}
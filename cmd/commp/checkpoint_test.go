@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zeroSegment, err := commp.ZeroPieceCommP(checkpointSegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segmentPayload := int64(checkpointSegmentSize / 128 * 127)
+
+	tail := make([]byte, 127*1000+3)
+	rand.New(rand.NewSource(1)).Read(tail)
+
+	path := filepath.Join(dir, "input")
+	cpPath := filepath.Join(dir, "checkpoint")
+	for _, tailSize := range []int{0, 1, 64, 65, 127, 4000, len(tail)} {
+		// a sparse file whose first segment is recorded in the checkpoint
+		// as all zeroes, unlike its first byte: the segment is only ever
+		// hashed again if the checkpoint is ignored
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Truncate(segmentPayload + int64(tailSize)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt([]byte{0xFF}, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt(tail[:tailSize], segmentPayload); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = saveCheckpoint(cpPath, &checkpoint{
+			Path:              path,
+			Size:              fi.Size(),
+			ModTime:           fi.ModTime(),
+			SegmentPaddedSize: checkpointSegmentSize,
+			Segments:          []string{hex.EncodeToString(zeroSegment)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := hashPath(path, &hashOpts{Checkpoint: cpPath})
+		if err != nil {
+			t.Fatalf("resuming with %d bytes left: %s", tailSize, err)
+		}
+
+		cp := new(commp.Calc)
+		if err := cp.WriteZeros(uint64(segmentPayload)); err != nil {
+			t.Fatal(err)
+		}
+		cp.Write(tail[:tailSize])
+		expCommP, expSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(res.CommP, expCommP) || res.PaddedSize != expSize || res.PayloadSize != uint64(fi.Size()) {
+			t.Fatalf("resuming with %d bytes left produced 0x%X / %d / %d, expected 0x%X / %d / %d", tailSize, res.CommP, res.PaddedSize, res.PayloadSize, expCommP, expSize, fi.Size())
+		}
+		if _, err := os.Stat(cpPath); !os.IsNotExist(err) {
+			t.Fatalf("checkpoint left behind after resuming with %d bytes left (%v)", tailSize, err)
+		}
+	}
+}
+
+func TestCheckpointFresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	path := filepath.Join(dir, "input")
+	cpPath := filepath.Join(dir, "checkpoint")
+	for _, size := range []int{65, 127 * 5, 1000, len(data)} {
+		if err := ioutil.WriteFile(path, data[:size], 0644); err != nil {
+			t.Fatal(err)
+		}
+		expCommP, expSize, err := commp.Sum(data[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := hashPath(path, &hashOpts{Checkpoint: cpPath})
+		if err != nil {
+			t.Fatalf("%d bytes: %s", size, err)
+		}
+		if !bytes.Equal(res.CommP, expCommP[:]) || res.PaddedSize != expSize || res.PayloadSize != uint64(size) {
+			t.Fatalf("%d bytes produced 0x%X / %d / %d, expected 0x%X / %d", size, res.CommP, res.PaddedSize, res.PayloadSize, expCommP, expSize)
+		}
+		if _, err := os.Stat(cpPath); !os.IsNotExist(err) {
+			t.Fatalf("checkpoint left behind after %d bytes (%v)", size, err)
+		}
+	}
+
+	res, err := hashPath(path, &hashOpts{Checkpoint: cpPath, PadTo: 32 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PaddedSize != 32<<30 || res.Original == nil || res.Original.PaddedSize != 1<<21 {
+		t.Fatalf("zero-extended checkpointed result has padded size %d, from %+v", res.PaddedSize, res.Original)
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(path, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := []string{hex.EncodeToString(make([]byte, 32))}
+
+	cpPath := filepath.Join(dir, "checkpoint")
+	for name, tc := range map[string]struct {
+		saved  *checkpoint
+		resume bool
+	}{
+		"missing":  {nil, false},
+		"matching": {&checkpoint{Path: path, Size: 1000, ModTime: fi.ModTime(), SegmentPaddedSize: checkpointSegmentSize, Segments: segments}, true},
+		"path":     {&checkpoint{Path: path + "2", Size: 1000, ModTime: fi.ModTime(), SegmentPaddedSize: checkpointSegmentSize, Segments: segments}, false},
+		"size":     {&checkpoint{Path: path, Size: 1001, ModTime: fi.ModTime(), SegmentPaddedSize: checkpointSegmentSize, Segments: segments}, false},
+		"modTime":  {&checkpoint{Path: path, Size: 1000, ModTime: fi.ModTime().Add(time.Second), SegmentPaddedSize: checkpointSegmentSize, Segments: segments}, false},
+		"segments": {&checkpoint{Path: path, Size: 1000, ModTime: fi.ModTime(), SegmentPaddedSize: checkpointSegmentSize / 2, Segments: segments}, false},
+	} {
+		os.Remove(cpPath)
+		if tc.saved != nil {
+			if err := saveCheckpoint(cpPath, tc.saved); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cp, err := loadCheckpoint(cpPath, path, fi)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if resumed := len(cp.Segments) > 0; resumed != tc.resume {
+			t.Fatalf("%s: resumed %t, expected %t", name, resumed, tc.resume)
+		}
+		if cp.Path != path || cp.Size != 1000 || !cp.ModTime.Equal(fi.ModTime()) || cp.SegmentPaddedSize != checkpointSegmentSize {
+			t.Fatalf("%s: loaded %+v", name, cp)
+		}
+	}
+
+	if err := ioutil.WriteFile(cpPath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(cpPath, path, fi); err == nil {
+		t.Fatal("unexpected successful load of an invalid checkpoint")
+	}
+}
+
+func TestCombineSegments(t *testing.T) {
+	data := make([]byte, 127<<12)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	// full subtrees of the given payload size, followed by a remainder
+	for _, layout := range [][2]int{
+		{127 << 4, 127 << 4},
+		{127 << 4, 127<<4 + 65},
+		{127 << 4, 127<<5 + 1000},
+		{127 << 4, 127 << 8},
+		{127 << 6, 127<<10 + 127},
+		{127 << 10, len(data)},
+	} {
+		segmentPayload, size := layout[0], layout[1]
+		var segments []commp.PieceInfo
+		for offset := 0; offset < size; offset += segmentPayload {
+			end := offset + segmentPayload
+			if end > size {
+				end = size
+			}
+			segCommP, segSize, err := commp.Sum(data[offset:end])
+			if err != nil {
+				t.Fatal(err)
+			}
+			segments = append(segments, commp.PieceInfo{CommP: segCommP[:], PaddedPieceSize: segSize})
+		}
+
+		res, err := combineSegments("combined", uint64(size), segments)
+		if err != nil {
+			t.Fatalf("%d bytes in segments of %d: %s", size, segmentPayload, err)
+		}
+		expCommP, expSize, err := commp.Sum(data[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(res.CommP, expCommP[:]) || res.PaddedSize != expSize || res.PayloadSize != uint64(size) {
+			t.Fatalf("%d bytes in segments of %d produced 0x%X / %d, expected 0x%X / %d", size, segmentPayload, res.CommP, res.PaddedSize, expCommP, expSize)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/bits"
+	"os"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/options"
+)
+
+// manifestPiece is an entry of the --manifest of `commp commd`, using the
+// field names of --json output.
+type manifestPiece struct {
+	PieceCID        string `json:"pieceCid"`
+	PaddedPieceSize uint64 `json:"paddedPieceSize"`
+}
+
+// sectorRegion is a piece or a zero filler piece within a sector.
+type sectorRegion struct {
+	Offset          uint64  `json:"offset"`
+	PaddedPieceSize uint64  `json:"paddedPieceSize"`
+	PieceCID        *string `json:"pieceCid"` // null for fillers
+}
+
+// commdResult is the --json output of `commp commd`.
+type commdResult struct {
+	UnsealedCID string         `json:"unsealedCid"`
+	SectorSize  uint64         `json:"sectorSize"`
+	Layout      []sectorRegion `json:"layout"`
+}
+
+// commdMain implements `commp commd`, computing the unsealed sector CID of a
+// sector holding a list of pieces, and reporting the zero filler pieces
+// placed between them.
+func commdMain(args []string) {
+	opts := &struct {
+		Manifest   string       `getopt:"-m --manifest=FILE     Ordered pieces of the sector, either as a JSON array or as the JSON lines output by --json, with pieceCid and paddedPieceSize fields. Use - for STDIN"`
+		SectorSize string       `getopt:"-s --sector-size=SIZE  Padded sector size"`
+		JSON       bool         `getopt:"--json                 Output a JSON object instead of text"`
+		Help       options.Help `getopt:"-h --help              Display help"`
+	}{
+		SectorSize: "32GiB",
+	}
+
+	if rest, err := options.SubRegisterAndParse(opts, args); err != nil {
+		log.Fatal(err)
+	} else if len(rest) > 0 {
+		log.Fatal("commd does not take any inputs besides --manifest")
+	}
+	if opts.Manifest == "" {
+		log.Fatal("--manifest is required")
+	}
+
+	sectorSize, err := parsePaddedSize(opts.SectorSize)
+	if err != nil {
+		log.Fatalf("invalid --sector-size: %s", err)
+	}
+
+	manifest, err := readManifest(opts.Manifest)
+	if err != nil {
+		log.Fatalf("reading %s: %s", opts.Manifest, err)
+	}
+
+	pieces := make([]commp.PieceInfo, len(manifest))
+	for i, mp := range manifest {
+		if pieces[i], err = manifestPieceInfo(mp); err != nil {
+			log.Fatalf("piece %d: %s", i, err)
+		}
+	}
+
+	rawCommD, err := commp.ComputeCommD(sectorSize, pieces)
+	if err != nil {
+		log.Fatal(err)
+	}
+	commD, err := newResult("", sectorSize/128*127, rawCommD, sectorSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	res := commdResult{
+		UnsealedCID: commD.PieceCID.String(),
+		SectorSize:  sectorSize,
+	}
+	var filled uint64
+	for i := range manifest {
+		res.Layout = appendFillers(res.Layout, filled, pieces[i].PaddedPieceSize)
+		filled = alignUp(filled, pieces[i].PaddedPieceSize)
+		res.Layout = append(res.Layout, sectorRegion{
+			Offset:          filled,
+			PaddedPieceSize: pieces[i].PaddedPieceSize,
+			PieceCID:        &manifest[i].PieceCID,
+		})
+		filled += pieces[i].PaddedPieceSize
+	}
+	if filled == 0 {
+		res.Layout = append(res.Layout, sectorRegion{PaddedPieceSize: sectorSize})
+	} else {
+		res.Layout = appendFillers(res.Layout, filled, sectorSize)
+	}
+
+	if opts.JSON {
+		err = json.NewEncoder(os.Stdout).Encode(res)
+	} else {
+		err = printCommD(os.Stdout, &res)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readManifest parses either a JSON array of pieces, or a sequence of JSON
+// objects.
+func readManifest(path string) ([]manifestPiece, error) {
+	var j []byte
+	var err error
+	if path == "-" {
+		j, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		j, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest []manifestPiece
+	if trimmed := bytes.TrimSpace(j); len(trimmed) > 0 && trimmed[0] == '[' {
+		return manifest, json.Unmarshal(trimmed, &manifest)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	for {
+		var mp manifestPiece
+		if err := dec.Decode(&mp); err == io.EOF {
+			return manifest, nil
+		} else if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, mp)
+	}
+}
+
+func manifestPieceInfo(mp manifestPiece) (commp.PieceInfo, error) {
+	c, err := cid.Decode(mp.PieceCID)
+	if err != nil {
+		return commp.PieceInfo{}, err
+	}
+	rawCommP, paddedSize, _, err := parsePieceCID(c)
+	if err != nil {
+		return commp.PieceInfo{}, err
+	}
+
+	if paddedSize == 0 {
+		paddedSize = mp.PaddedPieceSize
+	} else if mp.PaddedPieceSize != 0 && mp.PaddedPieceSize != paddedSize {
+		return commp.PieceInfo{}, fmt.Errorf("paddedPieceSize %d contradicts the size %d embedded in the v2 piece CID", mp.PaddedPieceSize, paddedSize)
+	}
+	if paddedSize == 0 {
+		return commp.PieceInfo{}, fmt.Errorf("paddedPieceSize is required with a v1 piece CID")
+	}
+	if err := commp.PaddedPieceSize(paddedSize).Validate(); err != nil {
+		return commp.PieceInfo{}, err
+	}
+
+	return commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: paddedSize}, nil
+}
+
+// appendFillers appends the zero pieces ComputeCommD places after a region of
+// the given size in order to align it to the next multiple of alignTo: one
+// piece for every bit of the gap, in increasing size.
+func appendFillers(layout []sectorRegion, filled, alignTo uint64) []sectorRegion {
+	for toFill := alignUp(filled, alignTo) - filled; toFill > 0; {
+		size := uint64(1) << uint(bits.TrailingZeros64(toFill))
+		layout = append(layout, sectorRegion{Offset: filled, PaddedPieceSize: size})
+		filled += size
+		toFill -= size
+	}
+	return layout
+}
+
+func alignUp(n, alignTo uint64) uint64 {
+	return (n + alignTo - 1) / alignTo * alignTo
+}
+
+func printCommD(w io.Writer, res *commdResult) error {
+	_, err := fmt.Fprintf(w, `Unsealed CID:   %s
+Sector size:    % 12d bytes
+Layout:
+`,
+		res.UnsealedCID,
+		res.SectorSize,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range res.Layout {
+		name := "(zero filler)"
+		if r.PieceCID != nil {
+			name = *r.PieceCID
+		}
+		if _, err := fmt.Fprintf(w, "% 16d % 12d  %s\n", r.Offset, r.PaddedPieceSize, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rawCommP := bytes.Repeat([]byte{0x11}, 32)
+	v1, err := newResult("", 1000, rawCommP, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := pieceCIDv2(rawCommP, 2048, 1500).String()
+
+	for manifest, expSizes := range map[string][]uint64{
+		``:    nil,
+		`[]`:  nil,
+		"\n ": nil,
+		`[{"pieceCid":"` + v1.PieceCID.String() + `","paddedPieceSize":1024},{"pieceCid":"` + v2 + `"}]`:                            {1024, 2048},
+		` [{"pieceCid":"` + v2 + `","paddedPieceSize":2048}]`:                                                                       {2048},
+		`{"pieceCid":"` + v1.PieceCID.String() + `","paddedPieceSize":1024,"path":"a"}` + "\n" + `{"pieceCid":"` + v2 + `"}` + "\n": {1024, 2048},
+	} {
+		path := filepath.Join(dir, "manifest")
+		if err := ioutil.WriteFile(path, []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pieces, err := readManifest(path)
+		if err != nil {
+			t.Fatalf("%q: %s", manifest, err)
+		}
+		if len(pieces) != len(expSizes) {
+			t.Fatalf("%q: parsed %d pieces, expected %d", manifest, len(pieces), len(expSizes))
+		}
+		for i, mp := range pieces {
+			pi, err := manifestPieceInfo(mp)
+			if err != nil {
+				t.Fatalf("%q: piece %d: %s", manifest, i, err)
+			}
+			if !bytes.Equal(pi.CommP, rawCommP) || pi.PaddedPieceSize != expSizes[i] {
+				t.Fatalf("%q: piece %d parsed as 0x%X / %d, expected %d bytes", manifest, i, pi.CommP, pi.PaddedPieceSize, expSizes[i])
+			}
+		}
+	}
+
+	for _, mp := range []manifestPiece{
+		{PieceCID: "bogus", PaddedPieceSize: 1024},
+		{PieceCID: v1.PieceCID.String()},
+		{PieceCID: v1.PieceCID.String(), PaddedPieceSize: 1000},
+		{PieceCID: v2, PaddedPieceSize: 1024},
+	} {
+		if _, err := manifestPieceInfo(mp); err == nil {
+			t.Fatalf("unexpected successful parse of %+v", mp)
+		}
+	}
+}
+
+func TestAppendFillers(t *testing.T) {
+	for filled, expSizes := range map[uint64][]uint64{
+		0:          nil,
+		1024:       nil,
+		128:        {128, 256, 512},
+		256:        {256, 512},
+		128 + 256:  {128, 512},
+		512 + 128:  {128, 256},
+		1024 + 128: {128, 256, 512},
+		1024 - 128: {128},
+	} {
+		layout := appendFillers(nil, filled, 1024)
+		if len(layout) != len(expSizes) {
+			t.Fatalf("filling from %d produced %+v, expected sizes %v", filled, layout, expSizes)
+		}
+		offset := filled
+		for i, r := range layout {
+			if r.Offset != offset || r.PaddedPieceSize != expSizes[i] || r.PieceCID != nil {
+				t.Fatalf("filling from %d produced %+v, expected sizes %v", filled, layout, expSizes)
+			}
+			offset += r.PaddedPieceSize
+		}
+		if offset%1024 != 0 {
+			t.Fatalf("filling from %d ends unaligned at %d", filled, offset)
+		}
+	}
+}
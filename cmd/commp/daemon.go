@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpd"
+	"github.com/pborman/options"
+)
+
+// daemonMain implements `commp daemon`, serving hash jobs over a unix socket
+// with the protocol of package commpd, e.g. for `commp --daemon=SOCKET`.
+func daemonMain(args []string) {
+	opts := &struct {
+		Socket string       `getopt:"-s --socket=PATH  Unix socket to listen on"`
+		Jobs   int          `getopt:"-j --jobs=N       Amount of jobs hashed concurrently, further ones wait for their turn. Defaults to the amount of CPUs"`
+		Help   options.Help `getopt:"-h --help         Display help"`
+	}{
+		Jobs: runtime.NumCPU(),
+	}
+
+	if _, err := options.SubRegisterAndParse(opts, args); err != nil {
+		log.Fatal(err)
+	}
+	if opts.Socket == "" {
+		log.Fatal("--socket is required")
+	}
+
+	// a socket left behind by a daemon which did not shut down cleanly
+	if conn, err := net.Dial("unix", opts.Socket); err == nil {
+		conn.Close()
+		log.Fatalf("a daemon is already listening on %s", opts.Socket)
+	} else if fi, err := os.Lstat(opts.Socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(opts.Socket)
+	}
+
+	l, err := net.Listen("unix", opts.Socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		close(stopped)
+		l.Close() // removes the socket
+	}()
+
+	err = commpd.NewServer(opts.Jobs).Serve(l)
+	select {
+	case <-stopped:
+	default:
+		log.Fatal(err)
+	}
+}
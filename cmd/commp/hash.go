@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"os"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/benchmarks"
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpd"
+	"github.com/ipfs/go-cid"
+)
+
+// hashOpts controls the processing of every input.
+type hashOpts struct {
+	Car   bool   // try to parse the input as a CAR
+	Tar   bool   // parse the input as a tar archive
+	PadTo uint64 // padded piece size to zero-extend every piece to, if set
+
+	Progress *progress // reports the data read from every input, if set
+
+	Checkpoint string // file saving the hashing state, for resuming it later
+
+	Daemon string // unix socket of a `commp daemon` to hash via, if set
+
+	Calc []commp.Option // options of the commP calculator
+}
+
+// result describes the piece commitment of a single input.
+type result struct {
+	Path        string
+	PayloadSize uint64
+	PaddedSize  uint64
+	CommP       []byte
+	PieceCID    cid.Cid
+	PieceCIDv2  cid.Cid
+	Car         *carInfo // non-nil only if a CAR was detected
+	Original    *result  // the result before zero-extension to hashOpts.PadTo
+	Tar         []tarEntry
+}
+
+// hashPath computes the result for an input as opened by openInput.
+func hashPath(path string, opts *hashOpts) (*result, error) {
+	if opts.Checkpoint != "" {
+		return hashCheckpointed(path, opts)
+	}
+
+	r, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if opts.Progress != nil {
+		return hashReader(path, opts.Progress.track(r), opts)
+	}
+	return hashReader(path, r, opts)
+}
+
+// openInput opens a file, an http(s):// or s3:// URL, or STDIN when path is
+// "-".
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return stdin{os.Stdin}, nil
+	}
+	if isRemote(path) {
+		return openRemote(path)
+	}
+	return os.Open(path)
+}
+
+func hashReader(path string, r io.Reader, opts *hashOpts) (*result, error) {
+	var cp commp.Digester
+	if opts.Daemon != "" {
+		c, err := commpd.Dial(opts.Daemon)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		if err := c.Open(); err != nil {
+			return nil, err
+		}
+		cp = daemonJob{c}
+	} else {
+		cp = commp.New(opts.Calc...)
+	}
+	cw := &countingWriter{w: cp}
+
+	// the CAR is parsed from the same stream that is being hashed
+	var car *carInfo
+	var entries []tarEntry
+	var err error
+	if opts.Tar {
+		streamBuf := bufio.NewReaderSize(io.TeeReader(r, cw), BufSize)
+		if entries, err = scanTar(streamBuf); err == nil {
+			// whatever follows the end-of-archive marker is hashed as well
+			_, err = io.Copy(ioutil.Discard, streamBuf)
+		}
+	} else if opts.Car {
+		streamBuf := bufio.NewReaderSize(io.TeeReader(r, cw), BufSize)
+		if car, err = scanCar(streamBuf); err == nil {
+			_, err = io.Copy(ioutil.Discard, streamBuf)
+		}
+	} else {
+		_, err = io.CopyBuffer(cw, r, make([]byte, BufSize))
+	}
+	if err != nil {
+		cp.Reset()
+		return nil, err
+	}
+
+	rawCommP, paddedSize, err := cp.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResult(path, cw.n, rawCommP, paddedSize)
+	if err != nil {
+		return nil, err
+	}
+	res.Car = car
+	res.Tar = entries
+
+	if opts.PadTo > 0 {
+		return padResult(res, opts.PadTo)
+	}
+	return res, nil
+}
+
+// daemonJob is the commp.Digester of a job submitted to a daemon.
+type daemonJob struct {
+	*commpd.Client
+}
+
+func (j daemonJob) Reset() { j.Abort() }
+
+// padResult returns the result for the payload of res zero-extended to the
+// given padded piece size, without hashing any of the zeroes.
+func padResult(res *result, paddedSize uint64) (*result, error) {
+	if err := commp.PaddedPieceSize(paddedSize).Validate(); err != nil {
+		return nil, err
+	}
+	if paddedSize < res.PaddedSize {
+		return nil, fmt.Errorf("payload of %d bytes does not fit in a padded piece of %d bytes", res.PayloadSize, paddedSize)
+	}
+
+	rawCommP, err := commp.PadCommP(res.CommP, res.PaddedSize, paddedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	padded, err := newResult(res.Path, res.PayloadSize, rawCommP, paddedSize)
+	if err != nil {
+		return nil, err
+	}
+	padded.Car = res.Car
+	padded.Tar = res.Tar
+	padded.Original = res
+	return padded, nil
+}
+
+func newResult(path string, payloadSize uint64, rawCommP []byte, paddedSize uint64) (*result, error) {
+	commCid, err := commcid.DataCommitmentV1ToCID(rawCommP)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result{
+		Path:        path,
+		PayloadSize: payloadSize,
+		PaddedSize:  paddedSize,
+		CommP:       rawCommP,
+		PieceCID:    commCid,
+		PieceCIDv2:  pieceCIDv2(rawCommP, paddedSize, payloadSize),
+	}, nil
+}
+
+// parsePaddedSize parses a padded piece size such as 2048 or 32GiB.
+func parsePaddedSize(s string) (uint64, error) {
+	size, err := benchmarks.ParseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if err := commp.PaddedPieceSize(size).Validate(); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// parsePieceCID extracts the raw commP from a v1 or a FRC-0069 v2 piece
+// CID. For the latter it also returns the padded piece size and the payload
+// size embedded in the CID, which are 0 otherwise.
+func parsePieceCID(c cid.Cid) (rawCommP []byte, paddedSize, payloadSize uint64, err error) {
+	if c.Type() != cid.Raw {
+		rawCommP, err = commcid.CIDToPieceCommitmentV1(c)
+		return rawCommP, 0, 0, err
+	}
+
+	mh := []byte(c.Hash())
+	code, n := binary.Uvarint(mh)
+	if n <= 0 || code != 0x1011 {
+		return nil, 0, 0, fmt.Errorf("CID %s is not a piece CID", c)
+	}
+	mh = mh[n:]
+	digestLen, n := binary.Uvarint(mh)
+	if n <= 0 || digestLen != uint64(len(mh)-n) {
+		return nil, 0, 0, fmt.Errorf("malformed multihash in piece CID %s", c)
+	}
+	digest := mh[n:]
+
+	padding, n := binary.Uvarint(digest)
+	if n <= 0 || len(digest)-n != 33 {
+		return nil, 0, 0, fmt.Errorf("malformed digest in piece CID %s", c)
+	}
+	height := digest[n]
+	if height < 2 || height > 58 {
+		return nil, 0, 0, fmt.Errorf("invalid tree height %d in piece CID %s", height, c)
+	}
+	paddedSize = 32 << height
+	if padding > paddedSize/128*127 {
+		return nil, 0, 0, fmt.Errorf("padding of %d bytes exceeds the piece size in piece CID %s", padding, c)
+	}
+
+	return digest[n+1:], paddedSize, paddedSize/128*127 - padding, nil
+}
+
+// pieceCIDv2 encodes a FRC-0069 piece CID, which embeds the tree height and
+// the amount of padding between the payload and the unpadded piece size in
+// its fr32-sha256-trunc254-padbintree multihash.
+func pieceCIDv2(rawCommP []byte, paddedSize, payloadSize uint64) cid.Cid {
+	digest := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+1+32)
+	digest = digest[:binary.PutUvarint(digest, paddedSize/128*127-payloadSize)]
+	digest = append(digest, byte(bits.TrailingZeros64(paddedSize)-5))
+	digest = append(digest, rawCommP...)
+
+	mh := make([]byte, 2*binary.MaxVarintLen64, 2*binary.MaxVarintLen64+len(digest))
+	n := binary.PutUvarint(mh, 0x1011)
+	n += binary.PutUvarint(mh[n:], uint64(len(digest)))
+	mh = append(mh[:n], digest...)
+
+	return cid.NewCidV1(cid.Raw, mh)
+}
+
+// stdin is os.Stdin, which is not closed once hashed.
+type stdin struct{ *os.File }
+
+func (stdin) Close() error { return nil }
+
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+)
+
+func TestParsePaddedSize(t *testing.T) {
+	for s, exp := range map[string]uint64{
+		"128":   128,
+		"2048":  2048,
+		"2KiB":  2 << 10,
+		"8MiB":  8 << 20,
+		"32GiB": 32 << 30,
+		"64GiB": 64 << 30,
+	} {
+		size, err := parsePaddedSize(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		if size != exp {
+			t.Fatalf("%s parsed as %d, expected %d", s, size, exp)
+		}
+	}
+
+	for _, s := range []string{"", "64", "0", "1000", "3KiB", "128GiB", "2 KiB", "2kib", "-128", "0x80", "16EiB"} {
+		if size, err := parsePaddedSize(s); err == nil {
+			t.Fatalf("unexpected successful parse of '%s' as %d", s, size)
+		}
+	}
+}
+
+func TestPieceCIDRoundTrip(t *testing.T) {
+	rawCommP := bytes.Repeat([]byte{0x2C}, 32)
+
+	for payloadSize, paddedSize := range map[uint64]uint64{
+		65:               128,
+		127:              128,
+		128:              256,
+		1000:             1024,
+		127 << 20:        128 << 20,
+		(127 << 20) + 1:  256 << 20,
+		127 << 28:        32 << 30,
+		(127 << 28) - 31: 32 << 30,
+	} {
+		c := pieceCIDv2(rawCommP, paddedSize, payloadSize)
+		gotCommP, gotPadded, gotPayload, err := parsePieceCID(c)
+		if err != nil {
+			t.Fatalf("%d/%d: %s", payloadSize, paddedSize, err)
+		}
+		if !bytes.Equal(gotCommP, rawCommP) || gotPadded != paddedSize || gotPayload != payloadSize {
+			t.Fatalf("piece CID %s of %d/%d parsed as 0x%X / %d / %d", c, payloadSize, paddedSize, gotCommP, gotPadded, gotPayload)
+		}
+	}
+
+	res, err := newResult("v1", 1000, rawCommP, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotCommP, gotPadded, gotPayload, err := parsePieceCID(res.PieceCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotCommP, rawCommP) || gotPadded != 0 || gotPayload != 0 {
+		t.Fatalf("v1 piece CID parsed as 0x%X / %d / %d", gotCommP, gotPadded, gotPayload)
+	}
+
+	// a raw CID with a plain sha2-256 multihash is no piece CID
+	if _, _, _, err := parsePieceCID(cid.NewCidV1(cid.Raw, []byte{0x12, 0x20, 31: 0, 33: 0})); err == nil {
+		t.Fatal("unexpected successful parse of a non-piece CID")
+	}
+}
+
+func TestPadResult(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x77}, 1000)
+	rawCommP, paddedSize, err := commp.Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := newResult("payload", uint64(len(payload)), rawCommP[:], paddedSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, padTo := range []uint64{1024, 2048, 1 << 20, 32 << 30} {
+		padded, err := padResult(res, padTo)
+		if err != nil {
+			t.Fatalf("padding to %d: %s", padTo, err)
+		}
+
+		cp := new(commp.Calc)
+		cp.Write(payload)
+		if err := cp.WriteZeros(padTo/128*127 - uint64(len(payload))); err != nil {
+			t.Fatal(err)
+		}
+		expCommP, _, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(padded.CommP, expCommP) || padded.PaddedSize != padTo || padded.PayloadSize != res.PayloadSize {
+			t.Fatalf("padding to %d produced 0x%X / %d / %d, expected 0x%X / %d / %d", padTo, padded.CommP, padded.PaddedSize, padded.PayloadSize, expCommP, padTo, res.PayloadSize)
+		}
+		if padded.Original != res {
+			t.Fatalf("padding to %d lost the original result", padTo)
+		}
+		if _, _, gotPayload, err := parsePieceCID(padded.PieceCIDv2); err != nil || gotPayload != res.PayloadSize {
+			t.Fatalf("padding to %d embedded payload size %d in the v2 piece CID (%v)", padTo, gotPayload, err)
+		}
+	}
+
+	for _, padTo := range []uint64{512, 3000} {
+		if _, err := padResult(res, padTo); err == nil {
+			t.Fatalf("unexpected successful padding of a %d-byte piece to %d", res.PaddedSize, padTo)
+		}
+	}
+}
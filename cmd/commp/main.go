@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+	"github.com/pborman/options"
+)
+
+// BufSize is the size of the buffer used to read inputs, a multiple of the
+// 127-byte block size of the hasher.
+const BufSize = ((4 << 20) / 128 * 127)
+
+// subcommands are invoked as `commp <name> [options]`, with their own set of
+// options. Any other invocation is the default hashing mode, a file named
+// like a subcommand can be hashed by prefixing it with ./
+var subcommands = map[string]func(args []string){
+	"verify":       verifyMain,
+	"split":        splitMain,
+	"watch":        watchMain,
+	"bench":        benchMain,
+	"aggregate":    aggregateMain,
+	"tree":         treeMain,
+	"zero":         zeroMain,
+	"commd":        commdMain,
+	"selftest":     selftestMain,
+	"prove":        proveMain,
+	"verify-range": verifyRangeMain,
+	"daemon":       daemonMain,
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) > 1 {
+		if sub, found := subcommands[os.Args[1]]; found {
+			sub(os.Args[1:])
+			return
+		}
+	}
+
+	opts := &struct {
+		Car        bool         `getopt:"-c --car              Parse the input as a CARv1 or CARv2, additionally reporting its roots and length"`
+		Tar        bool         `getopt:"-t --tar              Parse the input as a tar archive, additionally reporting the location of every file within the piece"`
+		Format     string       `getopt:"-f --format=FORMAT    Output format, one of: text tsv json csv toml boost"`
+		JSON       bool         `getopt:"--json                Shorthand for --format=json: one JSON object per line and input"`
+		Quiet      bool         `getopt:"-q --quiet            Do not print informational messages to STDERR"`
+		NoProgress bool         `getopt:"--no-progress         Do not display progress and throughput on STDERR, which is otherwise done when it is a terminal"`
+		Jobs       int          `getopt:"-j --jobs=N           Amount of inputs to hash concurrently, results are printed as they complete"`
+		FilesFrom  string       `getopt:"-l --files-from=FILE  Read the paths to hash from FILE, one per line, in addition to the arguments. Use - for STDIN"`
+		PadTo      string       `getopt:"-p --pad-to=SIZE      Report the commP of every input zero-extended to the given padded piece size, e.g. 32GiB"`
+		Checkpoint string       `getopt:"--checkpoint=FILE     Periodically save the state of hashing a single input file to FILE, resuming from it if it exists"`
+		Daemon     string       `getopt:"--daemon=SOCKET       Submit the inputs to the hasher of a 'commp daemon' listening on SOCKET"`
+		Help       options.Help `getopt:"-h --help             Display help"`
+	}{
+		Format: "text",
+		Jobs:   1,
+	}
+
+	paths := options.RegisterAndParse(opts)
+
+	if opts.JSON {
+		opts.Format = "json"
+	}
+
+	printResult, known := printers[opts.Format]
+	if !known {
+		log.Fatalf("unknown output format '%s'", opts.Format)
+	}
+
+	if opts.Car && opts.Tar {
+		log.Fatal("--car and --tar are mutually exclusive")
+	}
+
+	hopts := &hashOpts{
+		Car: opts.Car,
+		Tar: opts.Tar,
+	}
+	if opts.PadTo != "" {
+		var err error
+		if hopts.PadTo, err = parsePaddedSize(opts.PadTo); err != nil {
+			log.Fatalf("invalid --pad-to: %s", err)
+		}
+	}
+
+	if opts.Checkpoint != "" {
+		if len(paths) != 1 || opts.FilesFrom != "" || paths[0] == "-" || isRemote(paths[0]) {
+			log.Fatal("--checkpoint requires a single input file")
+		}
+		if opts.Car || opts.Tar {
+			log.Fatal("--checkpoint can not be combined with --car or --tar")
+		}
+		hopts.Checkpoint = opts.Checkpoint
+	}
+	if opts.Daemon != "" {
+		if opts.Checkpoint != "" {
+			log.Fatal("--checkpoint can not be combined with --daemon")
+		}
+		hopts.Daemon = opts.Daemon
+	}
+
+	if opts.Jobs < 1 {
+		log.Fatalf("invalid amount of concurrent jobs %d", opts.Jobs)
+	}
+
+	if len(paths) == 0 && opts.FilesFrom == "" {
+		paths = []string{"-"}
+	}
+
+	var stdinUsers int
+	for _, path := range append(paths, opts.FilesFrom) {
+		if path == "-" {
+			stdinUsers++
+		}
+	}
+	if stdinUsers > 1 {
+		log.Fatal("STDIN can only be read once")
+	}
+	if stdinUsers > 0 && !opts.Quiet && (isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())) {
+		log.Println("Reading from STDIN...")
+	}
+
+	if !opts.Quiet && !opts.NoProgress && stderrIsTerminal() {
+		hopts.Progress = startProgress(os.Stderr)
+	}
+
+	queue := make(chan string, opts.Jobs)
+	go func() {
+		for _, path := range paths {
+			queue <- path
+		}
+		if opts.FilesFrom != "" {
+			if err := readPathList(opts.FilesFrom, queue); err != nil {
+				log.Fatalf("reading %s: %s", opts.FilesFrom, err)
+			}
+		}
+		close(queue)
+	}()
+
+	var mu sync.Mutex
+	var failed bool
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				res, err := hashPath(path, hopts)
+
+				report := func() {
+					if err != nil {
+						log.Printf("%s: %s", path, err)
+						failed = true
+					} else if err := printResult(os.Stdout, res); err != nil {
+						log.Fatal(err)
+					}
+				}
+
+				mu.Lock()
+				if hopts.Progress != nil {
+					hopts.Progress.Print(report)
+				} else {
+					report()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if hopts.Progress != nil {
+		hopts.Progress.Stop()
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// readPathList sends every non-empty line of the file at listPath (or STDIN
+// for "-") to queue.
+func readPathList(listPath string, queue chan<- string) error {
+	list := os.Stdin
+	if listPath != "-" {
+		f, err := os.Open(listPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		list = f
+	}
+
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		if path := scanner.Text(); path != "" {
+			queue <- path
+		}
+	}
+	return scanner.Err()
+}
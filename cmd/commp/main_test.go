@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPathList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	listPath := filepath.Join(dir, "list")
+	if err := ioutil.WriteFile(listPath, []byte("a\n\nb c\n/d/e\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue := make(chan string, 10)
+	if err := readPathList(listPath, queue); err != nil {
+		t.Fatal(err)
+	}
+	close(queue)
+	var paths []string
+	for p := range queue {
+		paths = append(paths, p)
+	}
+	if len(paths) != 3 || paths[0] != "a" || paths[1] != "b c" || paths[2] != "/d/e" {
+		t.Fatalf("unexpected paths %q", paths)
+	}
+
+	if err := readPathList(filepath.Join(dir, "missing"), queue); !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+}
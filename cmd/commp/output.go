@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var printers = map[string]func(io.Writer, *result) error{
+	"text":  printText,
+	"tsv":   printTSV,
+	"json":  printJSON,
+	"csv":   printCSV,
+	"toml":  printTOML,
+	"boost": printBoost,
+}
+
+// jsonResult is the stable schema of --json output. Fields are never removed
+// or renamed, and carRoot is null unless a CAR was detected.
+type jsonResult struct {
+	Path              string   `json:"path"`
+	PieceCID          string   `json:"pieceCid"`
+	PieceCIDv2        string   `json:"pieceCidV2"`
+	CommP             string   `json:"commP"`
+	PaddedPieceSize   uint64   `json:"paddedPieceSize"`
+	UnpaddedPieceSize uint64   `json:"unpaddedPieceSize"`
+	PayloadSize       uint64   `json:"payloadSize"`
+	CarRoot           *string  `json:"carRoot"`
+	CarRoots          []string `json:"carRoots,omitempty"`
+	CarLength         *uint64  `json:"carLength,omitempty"`
+
+	// only present with --tar
+	TarEntries []tarEntry `json:"tarEntries,omitempty"`
+
+	// only present with --pad-to
+	OriginalPieceCID        string `json:"originalPieceCid,omitempty"`
+	OriginalPaddedPieceSize uint64 `json:"originalPaddedPieceSize,omitempty"`
+}
+
+func printText(w io.Writer, res *result) error {
+	_, err := fmt.Fprintf(w, `File:           %s
+CommPCid:       %s
+Raw CommP:      %X
+Payload:        % 12d bytes
+Unpadded piece: % 12d bytes
+Padded piece:   % 12d bytes
+`,
+		res.Path,
+		res.PieceCID,
+		res.CommP,
+		res.PayloadSize,
+		res.PaddedSize/128*127,
+		res.PaddedSize,
+	)
+	if err != nil {
+		return err
+	}
+
+	if orig := res.Original; orig != nil {
+		_, err = fmt.Fprintf(w, `Zero-extended from:
+CommPCid:       %s
+Padded piece:   % 12d bytes
+`,
+			orig.PieceCID,
+			orig.PaddedSize,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if car := res.Car; car != nil {
+		var maybeInvalidText string
+		if car.Broken {
+			maybeInvalidText = "*CORRUPTED* "
+		}
+
+		_, err = fmt.Fprintf(w, `%sCARv%d detected in stream:
+CAR length:     % 12d bytes
+CARv1 data:     % 12d bytes
+Blocks:         % 12d
+Roots:          % 12d
+`,
+			maybeInvalidText,
+			car.Version,
+			car.Length,
+			car.DataSize,
+			car.Blocks,
+			len(car.Roots),
+		)
+		if err != nil {
+			return err
+		}
+		for i, c := range car.Roots {
+			if _, err := fmt.Fprintf(w, "% 5d: %s\n", i+1, c); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(res.Tar) > 0 {
+		if _, err := fmt.Fprintf(w, "Tar entries:    % 12d\n", len(res.Tar)); err != nil {
+			return err
+		}
+		for _, te := range res.Tar {
+			_, err := fmt.Fprintf(w, "% 12d % 12d  [% 12d, % 12d)  %s\n",
+				te.Offset,
+				te.Size,
+				te.PaddedOffset,
+				te.PaddedEnd,
+				te.Name,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// printTSV emits: piece CID, raw commP, padded size, unpadded size, payload
+// size, path and the comma-separated CAR roots if any, separated by tabs.
+func printTSV(w io.Writer, res *result) error {
+	_, err := fmt.Fprintf(w, "%s\t%x\t%d\t%d\t%d\t%s\t%s\n",
+		res.PieceCID,
+		res.CommP,
+		res.PaddedSize,
+		res.PaddedSize/128*127,
+		res.PayloadSize,
+		res.Path,
+		strings.Join(carRoots(res), ","),
+	)
+	return err
+}
+
+// csvHeader is printed once, ahead of the first CSV record.
+var csvHeader sync.Once
+
+// printCSV emits the records consumed by deal import tooling: piece CID,
+// padded piece size, payload (CAR root) CID, CAR size and path, preceded by a
+// header line.
+func printCSV(w io.Writer, res *result) error {
+	cw := csv.NewWriter(w)
+	csvHeader.Do(func() {
+		cw.Write([]string{"piece_cid", "piece_size", "payload_cid", "car_size", "car_path"})
+	})
+	cw.Write([]string{
+		res.PieceCID.String(),
+		strconv.FormatUint(res.PaddedSize, 10),
+		payloadCID(res),
+		strconv.FormatUint(res.PayloadSize, 10),
+		res.Path,
+	})
+	cw.Flush()
+	return cw.Error()
+}
+
+// printTOML emits the same fields as printCSV as a [[piece]] table.
+func printTOML(w io.Writer, res *result) error {
+	_, err := fmt.Fprintf(w, `[[piece]]
+piece_cid = %s
+piece_size = %d
+payload_cid = %s
+car_size = %d
+car_path = %s
+
+`,
+		tomlString(res.PieceCID.String()),
+		res.PaddedSize,
+		tomlString(payloadCID(res)),
+		res.PayloadSize,
+		tomlString(res.Path),
+	)
+	return err
+}
+
+// printBoost emits the piece-describing flags of `boost deal` and `boost
+// offline-deal`, to be completed with the remaining deal parameters. The
+// --payload-cid flag is only present with --car.
+func printBoost(w io.Writer, res *result) error {
+	line := fmt.Sprintf("--commp=%s --piece-size=%d --car-size=%d", res.PieceCID, res.PaddedSize, res.PayloadSize)
+	if c := payloadCID(res); c != "" {
+		line += " --payload-cid=" + c
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+// payloadCID is the first root of a CAR, if one was detected.
+func payloadCID(res *result) string {
+	if roots := carRoots(res); len(roots) > 0 {
+		return roots[0]
+	}
+	return ""
+}
+
+func tomlString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r < 0x20 || r == 0x7F:
+			fmt.Fprintf(&sb, "\\u%04X", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func carRoots(res *result) []string {
+	if res.Car == nil {
+		return nil
+	}
+	roots := make([]string, len(res.Car.Roots))
+	for i, c := range res.Car.Roots {
+		roots[i] = c.String()
+	}
+	return roots
+}
+
+func printJSON(w io.Writer, res *result) error {
+	// an Encoder terminates every object with a newline
+	return json.NewEncoder(w).Encode(newJSONResult(res))
+}
+
+func newJSONResult(res *result) jsonResult {
+	jr := jsonResult{
+		Path:              res.Path,
+		PieceCID:          res.PieceCID.String(),
+		PieceCIDv2:        res.PieceCIDv2.String(),
+		CommP:             fmt.Sprintf("%x", res.CommP),
+		PaddedPieceSize:   res.PaddedSize,
+		UnpaddedPieceSize: res.PaddedSize / 128 * 127,
+		PayloadSize:       res.PayloadSize,
+		TarEntries:        res.Tar,
+	}
+	if res.Car != nil {
+		jr.CarRoots = carRoots(res)
+		if len(jr.CarRoots) > 0 {
+			jr.CarRoot = &jr.CarRoots[0]
+		}
+		jr.CarLength = &res.Car.Length
+	}
+	if res.Original != nil {
+		jr.OriginalPieceCID = res.Original.PieceCID.String()
+		jr.OriginalPaddedPieceSize = res.Original.PaddedSize
+	}
+	return jr
+}
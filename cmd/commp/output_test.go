@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+)
+
+func testResult(t *testing.T, path string) *result {
+	payload := bytes.Repeat([]byte{0x5E}, 127)
+	res, err := newResult(path, uint64(len(payload)), bytes.Repeat([]byte{0x0B}, 32), 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// testCarResult is testResult for a CAR with two roots.
+func testCarResult(t *testing.T, path string) *result {
+	res := testResult(t, path)
+	roots := []cid.Cid{testCID(t, "root"), testCID(t, "second root")}
+	res.Car = &carInfo{Version: 1, Roots: roots, Blocks: 3, Length: 127, DataSize: 127}
+	return res
+}
+
+func TestPrinters(t *testing.T) {
+	plain := testResult(t, "plain.bin")
+	car := testCarResult(t, "dir/a \"car\"\t.car")
+	root := car.Car.Roots[0].String()
+
+	hexCommP := fmt.Sprintf("%x", plain.CommP)
+	for name, tc := range map[string]struct {
+		format string
+		res    *result
+		exp    string
+	}{
+		"tsv":       {"tsv", plain, fmt.Sprintf("%s\t%s\t128\t127\t127\tplain.bin\t\n", plain.PieceCID, hexCommP)},
+		"tsv car":   {"tsv", car, fmt.Sprintf("%s\t%s\t128\t127\t127\tdir/a \"car\"\t.car\t%s,%s\n", car.PieceCID, hexCommP, root, car.Car.Roots[1])},
+		"toml":      {"toml", plain, fmt.Sprintf("[[piece]]\npiece_cid = \"%s\"\npiece_size = 128\npayload_cid = \"\"\ncar_size = 127\ncar_path = \"plain.bin\"\n\n", plain.PieceCID)},
+		"toml car":  {"toml", car, fmt.Sprintf("[[piece]]\npiece_cid = \"%s\"\npiece_size = 128\npayload_cid = \"%s\"\ncar_size = 127\ncar_path = \"dir/a \\\"car\\\"\\u0009.car\"\n\n", car.PieceCID, root)},
+		"boost":     {"boost", plain, fmt.Sprintf("--commp=%s --piece-size=128 --car-size=127\n", plain.PieceCID)},
+		"boost car": {"boost", car, fmt.Sprintf("--commp=%s --piece-size=128 --car-size=127 --payload-cid=%s\n", car.PieceCID, root)},
+	} {
+		var out bytes.Buffer
+		if err := printers[tc.format](&out, tc.res); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if out.String() != tc.exp {
+			t.Fatalf("%s: printed\n%q\nexpected\n%q", name, out.String(), tc.exp)
+		}
+	}
+
+	// the CSV header precedes the first record only
+	csvHeader = sync.Once{}
+	var out bytes.Buffer
+	for _, res := range []*result{plain, car} {
+		if err := printCSV(&out, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp := fmt.Sprintf("piece_cid,piece_size,payload_cid,car_size,car_path\n%s,128,,127,plain.bin\n%s,128,%s,127,\"dir/a \"\"car\"\"\t.car\"\n", plain.PieceCID, car.PieceCID, root)
+	if out.String() != exp {
+		t.Fatalf("csv: printed\n%q\nexpected\n%q", out.String(), exp)
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	car := testCarResult(t, "a.car")
+	padded, err := padResult(car, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		res *result
+		exp map[string]interface{}
+	}{
+		"plain": {testResult(t, "plain.bin"), map[string]interface{}{
+			"path":              "plain.bin",
+			"paddedPieceSize":   128.0,
+			"unpaddedPieceSize": 127.0,
+			"payloadSize":       127.0,
+			"carRoot":           nil,
+		}},
+		"car": {car, map[string]interface{}{
+			"carRoot":   car.Car.Roots[0].String(),
+			"carLength": 127.0,
+		}},
+		"padded": {padded, map[string]interface{}{
+			"paddedPieceSize":         2048.0,
+			"unpaddedPieceSize":       2032.0,
+			"payloadSize":             127.0,
+			"originalPieceCid":        car.PieceCID.String(),
+			"originalPaddedPieceSize": 128.0,
+		}},
+	} {
+		var out bytes.Buffer
+		if err := printJSON(&out, tc.res); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(out.Bytes(), []byte("}\n")) || bytes.Count(out.Bytes(), []byte("\n")) != 1 {
+			t.Fatalf("%s: printed %q, expected a single line", name, out.String())
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &obj); err != nil {
+			t.Fatal(err)
+		}
+
+		// the stable fields are always present
+		for _, field := range []string{"path", "pieceCid", "pieceCidV2", "commP", "paddedPieceSize", "unpaddedPieceSize", "payloadSize", "carRoot"} {
+			if _, ok := obj[field]; !ok {
+				t.Fatalf("%s: field %s missing from %s", name, field, out.String())
+			}
+		}
+		if obj["pieceCid"] != tc.res.PieceCID.String() || obj["pieceCidV2"] != tc.res.PieceCIDv2.String() || obj["commP"] != fmt.Sprintf("%x", tc.res.CommP) {
+			t.Fatalf("%s: unexpected commitments in %s", name, out.String())
+		}
+		for field, v := range tc.exp {
+			if obj[field] != v {
+				t.Fatalf("%s: field %s is %v, expected %v", name, field, obj[field], v)
+			}
+		}
+	}
+}
+
+func TestTomlString(t *testing.T) {
+	for s, exp := range map[string]string{
+		"":            `""`,
+		"plain":       `"plain"`,
+		`a"b`:         `"a\"b"`,
+		`C:\dir`:      `"C:\\dir"`,
+		"tab\tline\n": `"tab\u0009line\u000A"`,
+		"\x7F":        `"\u007F"`,
+		"ünïcödé":     `"ünïcödé"`,
+	} {
+		if got := tomlString(s); got != exp {
+			t.Fatalf("%q quoted as %s, expected %s", s, got, exp)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// progressInterval is how often the progress line is redrawn.
+const progressInterval = 500 * time.Millisecond
+
+// progress maintains a status line on a terminal, reporting the amount of
+// data hashed across all inputs, the throughput and the estimated time until
+// the inputs started so far are complete.
+type progress struct {
+	done  uint64 // accessed atomically
+	total uint64 // accessed atomically, sum of the known input sizes
+	// set when the size of any input is not known, disabling the ETA
+	unknown uint32
+
+	mu       sync.Mutex
+	w        io.Writer
+	start    time.Time
+	last     time.Time
+	lastDone uint64
+	peakMem  uint64
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// stderrIsTerminal reports whether a progress line can be drawn on STDERR.
+func stderrIsTerminal() bool {
+	return isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+}
+
+// startProgress starts redrawing the progress line on w until Stop is called.
+func startProgress(w io.Writer) *progress {
+	now := time.Now()
+	p := &progress{
+		w:       w,
+		start:   now,
+		last:    now,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.stopped)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-t.C:
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+
+	return p
+}
+
+// track accounts for the size of an input about to be read from r, and
+// returns a reader reporting the progress of reading it.
+func (p *progress) track(r io.Reader) io.Reader {
+	if size := inputSize(r); size >= 0 {
+		atomic.AddUint64(&p.total, uint64(size))
+	} else {
+		atomic.StoreUint32(&p.unknown, 1)
+	}
+	return &progressReader{r: r, p: p}
+}
+
+// Print runs fn, which writes to the same terminal, with the progress line
+// cleared.
+func (p *progress) Print(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.w, "\r\x1b[K")
+	fn()
+	p.draw()
+}
+
+// Stop removes the progress line.
+func (p *progress) Stop() {
+	close(p.stop)
+	<-p.stopped
+	fmt.Fprint(p.w, "\r\x1b[K")
+}
+
+func (p *progress) draw() {
+	now := time.Now()
+	done := atomic.LoadUint64(&p.done)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.Sys > p.peakMem {
+		p.peakMem = ms.Sys
+	}
+
+	var rate, avgRate float64
+	if elapsed := now.Sub(p.last).Seconds(); elapsed > 0 {
+		rate = float64(done-p.lastDone) / elapsed
+	}
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		avgRate = float64(done) / elapsed
+	}
+	p.last, p.lastDone = now, done
+
+	line := formatBytes(done)
+	eta := "--:--"
+	if atomic.LoadUint32(&p.unknown) == 0 {
+		total := atomic.LoadUint64(&p.total)
+		line += " / " + formatBytes(total)
+		if avgRate > 0 && total >= done {
+			eta = formatDuration(time.Duration(float64(total-done) / avgRate * float64(time.Second)))
+		}
+	}
+
+	fmt.Fprintf(p.w, "\r%s  %.2f GB/s (avg %.2f GB/s)  ETA %s  peak mem %s\x1b[K",
+		line, rate/1e9, avgRate/1e9, eta, formatBytes(p.peakMem),
+	)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	atomic.AddUint64(&pr.p.done, uint64(n))
+	return n, err
+}
+
+// inputSize returns the size of a regular file or of a remote object, and -1
+// for anything else.
+func inputSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *remoteReader:
+		return r.size
+	case stdin:
+		return inputSize(r.File)
+	case *os.File:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return -1
+}
+
+func formatBytes(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(1024), 0
+	for n/div >= 1024 && exp < len(units)-1 {
+		div *= 1024
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), units[exp])
+}
+
+func formatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
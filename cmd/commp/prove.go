@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/options"
+)
+
+// proveCacheNodes bounds the amount of nodes retained in memory while hashing
+// an input to prove: lower levels are recomputed from the input on demand.
+const proveCacheNodes = 1 << 20
+
+// proofFile is the JSON representation of a range proof written by `commp
+// prove`. Head, Tail and Siblings are base64 encoded.
+type proofFile struct {
+	PieceCID        string   `json:"pieceCid"`
+	Offset          uint64   `json:"offset"`
+	Length          uint64   `json:"length"`
+	PaddedPieceSize uint64   `json:"paddedPieceSize"`
+	Head            []byte   `json:"head"`
+	Tail            []byte   `json:"tail"`
+	Siblings        [][]byte `json:"siblings"`
+}
+
+// proveMain implements `commp prove`, writing a proof of the inclusion of a
+// byte range of the input in its piece.
+func proveMain(args []string) {
+	opts := &struct {
+		Offset uint64       `getopt:"--offset=N      Offset of the first proven byte within the payload"`
+		Length uint64       `getopt:"--length=N      Amount of bytes to prove"`
+		Out    string       `getopt:"-o --out=FILE   Write the proof to FILE instead of STDOUT"`
+		Help   options.Help `getopt:"-h --help       Display help"`
+	}{}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] == "-" || isRemote(paths[0]) {
+		log.Fatal("prove expects a single input file")
+	}
+	if opts.Length == 0 {
+		log.Fatal("--length is required")
+	}
+
+	proof, err := proveRange(paths[0], opts.Offset, opts.Length)
+	if err != nil {
+		log.Fatalf("%s: %s", paths[0], err)
+	}
+
+	j, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	j = append(j, '\n')
+	if opts.Out == "" {
+		_, err = os.Stdout.Write(j)
+	} else {
+		err = ioutil.WriteFile(opts.Out, j, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func proveRange(path string, offset, length uint64) (*proofFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset+length < offset || offset+length > uint64(fi.Size()) {
+		return nil, fmt.Errorf("range of %d bytes at offset %d exceeds the payload size %d", length, offset, fi.Size())
+	}
+
+	// retain only the levels of the tree small enough to fit in memory
+	paddedSize := uint64(commp.UnpaddedPieceSize(fi.Size()).NextPowerOfTwo().Padded())
+	minLevel := uint(2)
+	for paddedSize/32>>minLevel > proveCacheNodes {
+		minLevel++
+	}
+	tc := new(commp.TreeCache)
+	res, err := hashReader(path, f, &hashOpts{
+		Calc: []commp.Option{commp.WithTreeLayers(minLevel, tc.Add)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	proof, err := tc.ProveRange(f, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proofFile{
+		PieceCID:        res.PieceCID.String(),
+		Offset:          proof.Offset,
+		Length:          proof.Length,
+		PaddedPieceSize: proof.PaddedPieceSize,
+		Head:            proof.Head,
+		Tail:            proof.Tail,
+		Siblings:        proof.Siblings,
+	}, nil
+}
+
+// verifyRangeMain implements `commp verify-range`, checking that the input
+// consists of the bytes of a piece covered by a proof written by `commp
+// prove`.
+func verifyRangeMain(args []string) {
+	opts := &struct {
+		Proof    string       `getopt:"--proof=FILE       Proof written by commp prove"`
+		PieceCID string       `getopt:"--piece-cid=CID    Trusted piece CID to verify against, either v1 or v2"`
+		Quiet    bool         `getopt:"-q --quiet         Do not print anything on success"`
+		Help     options.Help `getopt:"-h --help          Display help"`
+	}{}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	if len(paths) != 1 {
+		log.Fatal("verify-range expects a single input")
+	}
+	if opts.Proof == "" || opts.PieceCID == "" {
+		log.Fatal("--proof and --piece-cid are required")
+	}
+
+	c, err := cid.Decode(opts.PieceCID)
+	if err != nil {
+		log.Fatalf("invalid --piece-cid: %s", err)
+	}
+	rawCommP, paddedSize, _, err := parsePieceCID(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	j, err := ioutil.ReadFile(opts.Proof)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var pf proofFile
+	if err := json.Unmarshal(j, &pf); err != nil {
+		log.Fatalf("invalid proof %s: %s", opts.Proof, err)
+	}
+	if paddedSize != 0 && paddedSize != pf.PaddedPieceSize {
+		log.Fatalf("proof for a piece of %d bytes does not match the size %d embedded in the v2 piece CID", pf.PaddedPieceSize, paddedSize)
+	}
+
+	in, err := openInput(paths[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = commp.VerifyRange(rawCommP, data, &commp.RangeProof{
+		Offset:          pf.Offset,
+		Length:          pf.Length,
+		PaddedPieceSize: pf.PaddedPieceSize,
+		Head:            pf.Head,
+		Tail:            pf.Tail,
+		Siblings:        pf.Siblings,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: MISMATCH\n%s\n", paths[0], err)
+		os.Exit(1)
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "%s: OK\n%d bytes at offset %d of piece %s\n", paths[0], pf.Length, pf.Offset, c)
+	}
+}
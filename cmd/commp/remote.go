@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// remoteRetries is the amount of consecutive failures after which reading a
+// remote input is given up on.
+const remoteRetries = 5
+
+// isRemote reports whether path denotes an object to be streamed over HTTP.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "https://") ||
+		strings.HasPrefix(path, "http://") ||
+		strings.HasPrefix(path, "s3://")
+}
+
+// openRemote starts streaming the object at an http(s):// or s3:// URL.
+// Whenever the transfer is interrupted it is resumed from the current offset
+// via a range request, so that no part of the object is stored locally.
+func openRemote(path string) (io.ReadCloser, error) {
+	rr := &remoteReader{
+		path:   path,
+		client: http.DefaultClient,
+		size:   -1,
+	}
+
+	if strings.HasPrefix(path, "s3://") {
+		var err error
+		if rr.newRequest, err = newS3RequestFunc(path); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := url.Parse(path); err != nil {
+			return nil, err
+		}
+		rr.newRequest = func() (*http.Request, error) {
+			return http.NewRequest("GET", path, nil)
+		}
+	}
+
+	// fail early on e.g. a missing object
+	if err := rr.connect(); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+type remoteReader struct {
+	path       string
+	client     *http.Client
+	newRequest func() (*http.Request, error)
+	body       io.ReadCloser
+	offset     int64
+	size       int64 // -1 if not announced by the server
+	etag       string
+	failures   int
+}
+
+// remoteError is a failure which retrying will not fix.
+type remoteError struct{ error }
+
+func (rr *remoteReader) Read(p []byte) (int, error) {
+	for {
+		if rr.body == nil {
+			if err := rr.connect(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := rr.body.Read(p)
+		rr.offset += int64(n)
+		if n > 0 {
+			rr.failures = 0
+		}
+		if err == nil || (err == io.EOF && (rr.size < 0 || rr.offset == rr.size)) {
+			return n, err
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		rr.body.Close()
+		rr.body = nil
+		if err := rr.backoff(err); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (rr *remoteReader) Close() error {
+	if rr.body == nil {
+		return nil
+	}
+	err := rr.body.Close()
+	rr.body = nil
+	return err
+}
+
+// connect (re)issues the request for the remainder of the object, retrying
+// transient failures.
+func (rr *remoteReader) connect() error {
+	for {
+		err := rr.request()
+		if err == nil {
+			return nil
+		}
+		if fatal, isFatal := err.(remoteError); isFatal {
+			return fatal.error
+		}
+		if err := rr.backoff(err); err != nil {
+			return err
+		}
+	}
+}
+
+func (rr *remoteReader) backoff(err error) error {
+	rr.failures++
+	if rr.failures > remoteRetries {
+		return fmt.Errorf("giving up after %d attempts at offset %d: %s", remoteRetries, rr.offset, err)
+	}
+	time.Sleep(time.Second << uint(rr.failures-1))
+	return nil
+}
+
+func (rr *remoteReader) request() error {
+	req, err := rr.newRequest()
+	if err != nil {
+		return remoteError{err}
+	}
+	if rr.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", rr.offset))
+		// a changed object must not be stitched together with its old version
+		if rr.etag != "" && !strings.HasPrefix(rr.etag, "W/") {
+			req.Header.Set("If-Range", rr.etag)
+		}
+	}
+
+	resp, err := rr.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	expected := http.StatusOK
+	if rr.offset > 0 {
+		expected = http.StatusPartialContent
+	}
+	if resp.StatusCode != expected {
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return remoteError{fmt.Errorf("unable to resume at offset %d: the object changed or the server does not support range requests", rr.offset)}
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		default:
+			return remoteError{fmt.Errorf("unexpected HTTP status %s", resp.Status)}
+		}
+	}
+
+	if rr.offset == 0 {
+		rr.size = resp.ContentLength
+		rr.etag = resp.Header.Get("ETag")
+	} else if rr.etag != "" && resp.Header.Get("ETag") != rr.etag {
+		resp.Body.Close()
+		return remoteError{fmt.Errorf("object changed while resuming at offset %d", rr.offset)}
+	}
+
+	rr.body = resp.Body
+	return nil
+}
+
+// newS3RequestFunc returns a constructor of GET requests for the object at an
+// s3://bucket/key URL. Requests are signed with AWS Signature Version 4 when
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are set, and anonymous
+// otherwise. AWS_ENDPOINT_URL selects an S3-compatible service other than
+// AWS, which is addressed path-style.
+func newS3RequestFunc(path string) (func() (*http.Request, error), error) {
+	bucketKey := strings.TrimPrefix(path, "s3://")
+	slash := strings.IndexByte(bucketKey, '/')
+	if slash <= 0 || slash == len(bucketKey)-1 {
+		return nil, fmt.Errorf("invalid S3 URL '%s', expected s3://bucket/key", path)
+	}
+	bucket, key := bucketKey[:slash], bucketKey[slash+1:]
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var objectURL *url.URL
+	var err error
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		if objectURL, err = url.Parse(strings.TrimSuffix(endpoint, "/")); err != nil {
+			return nil, fmt.Errorf("invalid AWS_ENDPOINT_URL: %s", err)
+		}
+		objectURL.Path += "/" + bucket + "/" + key
+		objectURL.RawPath = objectURL.Path[:len(objectURL.Path)-len(key)] + s3Escape(key)
+	} else {
+		objectURL = &url.URL{
+			Scheme:  "https",
+			Host:    bucket + ".s3." + region + ".amazonaws.com",
+			Path:    "/" + key,
+			RawPath: "/" + s3Escape(key),
+		}
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	sessionToken := os.Getenv("AWS_SESSION_TOKEN")
+
+	return func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", objectURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if accessKey != "" {
+			signS3Request(req, region, accessKey, secretKey, sessionToken, time.Now().UTC())
+		}
+		return req, nil
+	}, nil
+}
+
+// signS3Request adds an AWS Signature Version 4 to a bodyless request.
+func signS3Request(req *http.Request, region, accessKey, secretKey, sessionToken string, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+		headers += "x-amz-security-token:" + sessionToken + "\n"
+		signedHeaders += ";x-amz-security-token"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSha256(key, part)
+	}
+	signature := hmacSha256(key, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+hex.EncodeToString(requestHash[:]))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes an object key the way AWS expects it in canonical
+// requests: everything besides unreserved characters and path separators.
+func s3Escape(key string) string {
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,96 @@
+//go:build ffi
+// +build ffi
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	ffi "github.com/filecoin-project/filecoin-ffi"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/options"
+)
+
+// selftestMain implements `commp selftest`, hashing every input both with
+// this package and with GeneratePieceCID of filecoin-ffi, exiting with a
+// non-zero status if the results differ for any of them.
+func selftestMain(args []string) {
+	opts := &struct {
+		Help options.Help `getopt:"-h --help  Display help"`
+	}{}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		log.Fatal("selftest expects at least one input file")
+	}
+
+	var failed bool
+	for _, path := range paths {
+		res, ffiCommP, err := selftest(path)
+		if err != nil {
+			log.Printf("%s: %s", path, err)
+			failed = true
+			continue
+		}
+
+		if res.PieceCID.Equals(ffiCommP) {
+			fmt.Printf("%s: OK %s\n", path, res.PieceCID)
+		} else {
+			fmt.Printf("%s: MISMATCH\n-%-16s %s\n+%-16s %s\n", path, "ffi:", ffiCommP, "commp:", res.PieceCID)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func selftest(path string) (*result, cid.Cid, error) {
+	res, err := hashPath(path, &hashOpts{})
+	if err != nil {
+		return nil, cid.Undef, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, cid.Undef, err
+	}
+	defer f.Close()
+
+	// filecoin-ffi reads exactly the unpadded piece size from a file
+	// descriptor: feed it the zero-extended payload through a pipe
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, cid.Undef, err
+	}
+	defer pr.Close()
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(pw, commp.NewNulPadReader(f))
+		pw.Close()
+		copyErr <- err
+	}()
+
+	ffiCommP, err := ffi.GeneratePieceCIDFromFile(
+		abi.RegisteredSealProof_StackedDrg64GiBV1_1,
+		pr,
+		abi.UnpaddedPieceSize(res.PaddedSize/128*127),
+	)
+	if err != nil {
+		return nil, cid.Undef, err
+	}
+	// a short read would make the results differ for the wrong reason
+	if err := <-copyErr; err != nil {
+		return nil, cid.Undef, err
+	}
+	return res, ffiCommP, nil
+}
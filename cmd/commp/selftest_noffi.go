@@ -0,0 +1,14 @@
+//go:build !ffi
+// +build !ffi
+
+package main
+
+import (
+	"log"
+)
+
+// selftestMain explains how to obtain `commp selftest`, which requires cgo
+// and a build of filecoin-ffi.
+func selftestMain(args []string) {
+	log.Fatal("selftest is only available when built with the ffi build tag, see the README")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/pborman/options"
+)
+
+// splitManifest is written by --manifest, describing every segment in order.
+type splitManifest struct {
+	Source          string         `json:"source"`
+	PayloadSize     uint64         `json:"payloadSize"`
+	PaddedPieceSize uint64         `json:"paddedPieceSize"`
+	Segments        []splitSegment `json:"segments"`
+}
+
+type splitSegment struct {
+	Index           int    `json:"index"`
+	Offset          uint64 `json:"offset"`
+	PayloadSize     uint64 `json:"payloadSize"`
+	Path            string `json:"path,omitempty"`
+	PieceCID        string `json:"pieceCid"`
+	PaddedPieceSize uint64 `json:"paddedPieceSize"`
+}
+
+// splitMain implements `commp split`, cutting a single input into sequential
+// segments each fitting in a piece of the given size.
+func splitMain(args []string) {
+	opts := &struct {
+		PieceSize string       `getopt:"-s --piece-size=SIZE  Padded piece size every segment must fit in, e.g. 32GiB, defaults to the maximum supported size"`
+		OutDir    string       `getopt:"-o --out-dir=DIR      Write every segment to DIR, named after the input with a .NNNN suffix. Without it only offsets are reported"`
+		Manifest  string       `getopt:"-m --manifest=FILE    Write a JSON manifest of all segments to FILE"`
+		Format    string       `getopt:"-f --format=FORMAT    Output format of the per-segment results, one of: text tsv json csv toml boost"`
+		Help      options.Help `getopt:"-h --help             Display help"`
+	}{
+		Format: "text",
+	}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	if len(paths) != 1 {
+		log.Fatal("split expects a single input")
+	}
+
+	printResult, known := printers[opts.Format]
+	if !known {
+		log.Fatalf("unknown output format '%s'", opts.Format)
+	}
+
+	pieceSize := commp.MaxPiecePayload / 127 * 128
+	if opts.PieceSize != "" {
+		if pieceSize, err = parsePaddedSize(opts.PieceSize); err != nil {
+			log.Fatalf("invalid --piece-size: %s", err)
+		}
+		if pieceSize > commp.MaxPiecePayload/127*128 {
+			log.Fatalf("--piece-size %d larger than the maximum supported piece size %d", pieceSize, commp.MaxPiecePayload/127*128)
+		}
+	}
+
+	src, err := openInput(paths[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close()
+
+	manifest := splitManifest{
+		Source:          paths[0],
+		PaddedPieceSize: pieceSize,
+	}
+
+	buf := make([]byte, BufSize)
+	for {
+		seg, err := splitSegmentOut(src, pieceSize/128*127, opts.OutDir, paths[0], len(manifest.Segments), buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("segment %d at offset %d: %s", len(manifest.Segments), manifest.PayloadSize, err)
+		}
+
+		offset := manifest.PayloadSize
+		manifest.PayloadSize += seg.PayloadSize
+		manifest.Segments = append(manifest.Segments, splitSegment{
+			Index:           len(manifest.Segments),
+			Offset:          offset,
+			PayloadSize:     seg.PayloadSize,
+			Path:            seg.Path,
+			PieceCID:        seg.PieceCID.String(),
+			PaddedPieceSize: seg.PaddedSize,
+		})
+
+		if seg.Path == "" {
+			seg.Path = fmt.Sprintf("%s@%d", paths[0], offset)
+		}
+		if err := printResult(os.Stdout, seg); err != nil {
+			log.Fatal(err)
+		}
+		if seg.PayloadSize < pieceSize/128*127 {
+			break
+		}
+	}
+
+	if opts.Manifest != "" {
+		m, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(opts.Manifest, append(m, '\n'), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// splitSegmentOut hashes (and optionally writes out) up to maxPayload bytes of
+// r, returning io.EOF if r was already exhausted.
+func splitSegmentOut(r io.Reader, maxPayload uint64, outDir, srcPath string, idx int, buf []byte) (*result, error) {
+	cp := new(commp.Calc)
+	var dst io.Writer = cp
+
+	var outPath string
+	var out *os.File
+	if outDir != "" {
+		base := filepath.Base(srcPath)
+		if srcPath == "-" {
+			base = "stdin"
+		}
+		outPath = filepath.Join(outDir, fmt.Sprintf("%s.%04d", base, idx))
+
+		var err error
+		if out, err = os.Create(outPath); err != nil {
+			return nil, err
+		}
+		defer out.Close()
+		dst = io.MultiWriter(cp, out)
+	}
+
+	n, err := io.CopyBuffer(dst, io.LimitReader(r, int64(maxPayload)), buf)
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+	if err == nil && out != nil {
+		err = out.Close()
+	}
+	if err != nil {
+		cp.Reset()
+		if out != nil {
+			os.Remove(outPath)
+		}
+		return nil, err
+	}
+
+	rawCommP, paddedSize, err := cp.Digest()
+	if err != nil {
+		if out != nil {
+			os.Remove(outPath)
+		}
+		return nil, err
+	}
+	return newResult(outPath, uint64(n), rawCommP, paddedSize)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+)
+
+// tarEntry describes where the contents of a file inside a tar archive are
+// located within the piece.
+type tarEntry struct {
+	Name string `json:"name"`
+	// Offset is the position of the file contents within the payload, and
+	// Size their length.
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
+	// PaddedOffset and PaddedEnd delimit the 128-byte blocks of the padded
+	// piece which hold the file contents.
+	PaddedOffset uint64 `json:"paddedOffset"`
+	PaddedEnd    uint64 `json:"paddedEnd"`
+}
+
+// scanTar consumes the tar archive in r, returning the location of every
+// regular file in it. Offsets are relative to the start of r.
+func scanTar(r io.Reader) ([]tarEntry, error) {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+
+	var entries []tarEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		// the reader consumes exactly the headers, and nothing of the contents
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			te := tarEntry{
+				Name:   hdr.Name,
+				Offset: cr.n,
+				Size:   uint64(hdr.Size),
+			}
+			te.PaddedOffset = te.Offset / 127 * 128
+			te.PaddedEnd = (te.Offset + te.Size + 126) / 127 * 128
+			entries = append(entries, te)
+		}
+
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return entries, err
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += uint64(n)
+	return n, err
+}
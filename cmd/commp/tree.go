@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"os"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/pborman/options"
+)
+
+// treeMain implements `commp tree`, writing the tree levels of a piece from
+// the given level up to the root into a single file. Every level is complete,
+// including the nodes over the zero-padded remainder of the piece, and the
+// levels follow each other in ascending order: the file holds exactly the
+// layout of a tree-d cache when starting from level 0.
+func treeMain(args []string) {
+	opts := &struct {
+		LevelsFrom uint         `getopt:"-k --levels-from=K     Lowest tree level to write out, 0 being the fr32-padded leaves"`
+		Out        string       `getopt:"-o --out=FILE          File to write the tree levels to"`
+		PieceSize  string       `getopt:"-s --piece-size=SIZE   Padded piece size of the tree, e.g. the sector size, defaults to the size of the input"`
+		Format     string       `getopt:"-f --format=FORMAT     Output format, one of: text tsv json csv toml boost"`
+		Help       options.Help `getopt:"-h --help              Display help"`
+	}{
+		Format: "text",
+	}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) != 1 {
+		log.Fatal("tree expects a single input")
+	}
+	if opts.Out == "" {
+		log.Fatal("--out is required")
+	}
+	printResult, known := printers[opts.Format]
+	if !known {
+		log.Fatalf("unknown output format '%s'", opts.Format)
+	}
+
+	var pieceSize uint64
+	if opts.PieceSize != "" {
+		if pieceSize, err = parsePaddedSize(opts.PieceSize); err != nil {
+			log.Fatalf("invalid --piece-size: %s", err)
+		}
+	}
+
+	res, err := writeTree(paths[0], opts.Out, opts.LevelsFrom, pieceSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := printResult(os.Stdout, res); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeTree hashes the input at path, writing the levels of its tree to
+// outPath as they are produced.
+func writeTree(path, outPath string, minLevel uint, pieceSize uint64) (*result, error) {
+	in, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	// the location of every level depends on the size of the tree
+	inSize := inputSize(in)
+	if inSize < 0 {
+		return nil, fmt.Errorf("%s: the size of the input must be known upfront", path)
+	}
+	if uint64(inSize) < commp.MinPiecePayload || uint64(inSize) > commp.MaxPiecePayload {
+		return nil, fmt.Errorf("%s: payload of %d bytes is outside the supported range", path, inSize)
+	}
+	natural := uint64(commp.UnpaddedPieceSize(inSize).NextPowerOfTwo().Padded())
+	if pieceSize == 0 {
+		pieceSize = natural
+	} else if pieceSize < natural {
+		return nil, fmt.Errorf("%s: payload of %d bytes does not fit in a padded piece of %d bytes", path, inSize, pieceSize)
+	}
+	height := uint(bits.TrailingZeros64(pieceSize)) - 5
+	if minLevel > height {
+		return nil, fmt.Errorf("level %d is above the root of a tree of height %d", minLevel, height)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return nil, err
+	}
+	res, err := writeTreeLevels(path, in, out, minLevel, height, natural)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return nil, err
+	}
+	return res, nil
+}
+
+func writeTreeLevels(path string, in io.Reader, out *os.File, minLevel, height uint, natural uint64) (*result, error) {
+	writers := make([]*levelWriter, height+1)
+	var offset int64
+	for l := minLevel; l <= height; l++ {
+		writers[l] = &levelWriter{
+			f:      out,
+			offset: offset,
+			buf:    make([]byte, 0, 1<<20),
+		}
+		offset += 32 << (height - l)
+	}
+	// zero leaves do not need to be written out explicitly
+	if err := out.Truncate(offset); err != nil {
+		return nil, err
+	}
+
+	res, err := hashReader(path, in, &hashOpts{
+		Calc: []commp.Option{commp.WithTreeLayers(minLevel, func(level uint, _ uint64, node []byte) {
+			writers[level].add(node)
+		})},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	naturalHeight := uint(bits.TrailingZeros64(natural)) - 5
+	var trace [][]byte
+	if height > naturalHeight {
+		if trace, err = commp.PadCommPTrace(res.CommP, natural, 32<<height); err != nil {
+			return nil, err
+		}
+		if res, err = padResult(res, 32<<height); err != nil {
+			return nil, err
+		}
+	}
+
+	for l := minLevel; l <= height; l++ {
+		w := writers[l]
+		if l > naturalHeight {
+			w.add(trace[l-naturalHeight])
+		}
+		if w.err == nil && l > 0 {
+			zero := zeroTreeNode(l)
+			for w.nodes < 1<<(height-l) && w.err == nil {
+				w.add(zero)
+			}
+		}
+		if err := w.flush(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// levelWriter buffers the nodes of a single level, which arrive from a single
+// goroutine, writing them out at the location of the level in the file.
+type levelWriter struct {
+	f      *os.File
+	offset int64
+	buf    []byte
+	nodes  uint64
+	err    error
+}
+
+func (w *levelWriter) add(node []byte) {
+	w.buf = append(w.buf, node...)
+	w.nodes++
+	if len(w.buf) == cap(w.buf) {
+		w.flush()
+	}
+}
+
+func (w *levelWriter) flush() error {
+	if w.err == nil && len(w.buf) > 0 {
+		_, w.err = w.f.WriteAt(w.buf, w.offset)
+		w.offset += int64(len(w.buf))
+	}
+	w.buf = w.buf[:0]
+	return w.err
+}
+
+// zeroTreeNode returns the node at the given level of an all-zero tree.
+func zeroTreeNode(level uint) []byte {
+	if level >= 2 {
+		n, _ := commp.ZeroPieceCommP(32 << level)
+		return n
+	}
+	n := make([]byte, 32)
+	for ; level > 0; level-- {
+		d := sha256.Sum256(append(n, n...))
+		d[31] &= 0x3F
+		n = d[:]
+	}
+	return n
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/options"
+)
+
+// verifyMain implements `commp verify`, exiting with a non-zero status and a
+// diff-style report when the input does not match the expected piece.
+func verifyMain(args []string) {
+	opts := &struct {
+		PieceCID  string       `getopt:"--piece-cid=CID    Expected piece CID, either v1 or v2"`
+		PieceSize string       `getopt:"--piece-size=SIZE  Expected padded piece size, required for a v1 piece CID"`
+		Car       bool         `getopt:"-c --car           Parse the input as a CAR, reporting its roots"`
+		Quiet     bool         `getopt:"-q --quiet         Do not print anything on success"`
+		Help      options.Help `getopt:"-h --help          Display help"`
+	}{}
+
+	paths, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	if len(paths) != 1 {
+		log.Fatal("verify expects a single input")
+	}
+
+	if opts.PieceCID == "" {
+		log.Fatal("--piece-cid is required")
+	}
+	c, err := cid.Decode(opts.PieceCID)
+	if err != nil {
+		log.Fatalf("invalid --piece-cid: %s", err)
+	}
+	expCommP, expSize, expPayloadSize, err := parsePieceCID(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.PieceSize != "" {
+		size, err := parsePaddedSize(opts.PieceSize)
+		if err != nil {
+			log.Fatalf("invalid --piece-size: %s", err)
+		}
+		if expSize != 0 && size != expSize {
+			log.Fatalf("--piece-size %d contradicts the size %d embedded in the v2 piece CID", size, expSize)
+		}
+		expSize = size
+	}
+	if expSize == 0 {
+		log.Fatal("--piece-size is required with a v1 piece CID")
+	}
+
+	res, err := hashPath(paths[0], &hashOpts{Car: opts.Car})
+	if err != nil {
+		log.Fatalf("%s: %s", paths[0], err)
+	}
+
+	// the piece may have been zero-extended, e.g. to the size of a deal
+	if res.PaddedSize < expSize {
+		if res, err = padResult(res, expSize); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	expected, err := newResult(res.Path, res.PayloadSize, expCommP, expSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if expPayloadSize != 0 {
+		expected.PayloadSize = expPayloadSize
+		expected.PieceCIDv2 = c
+	}
+
+	report, match := diffResults(expected, res, expPayloadSize != 0)
+	if !match {
+		fmt.Fprintf(os.Stderr, "%s: MISMATCH\n%s", res.Path, report)
+		os.Exit(1)
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "%s: OK\n%s", res.Path, report)
+	}
+}
+
+// diffResults renders the fields of two results in the style of a unified
+// diff: identical lines are prefixed with a space, differing ones with -/+.
+// The payload size is only compared when the expectation is a v2 piece CID.
+func diffResults(expected, actual *result, withPayloadSize bool) (string, bool) {
+	var buf bytes.Buffer
+	match := true
+
+	line := func(name string, exp, act interface{}) {
+		e, a := fmt.Sprint(exp), fmt.Sprint(act)
+		if e == a {
+			fmt.Fprintf(&buf, " %-16s %s\n", name+":", a)
+			return
+		}
+		match = false
+		fmt.Fprintf(&buf, "-%-16s %s\n+%-16s %s\n", name+":", e, name+":", a)
+	}
+
+	buf.WriteString("--- expected\n+++ actual\n")
+	line("pieceCid", expected.PieceCID, actual.PieceCID)
+	line("paddedPieceSize", expected.PaddedSize, actual.PaddedSize)
+	if withPayloadSize {
+		line("pieceCidV2", expected.PieceCIDv2, actual.PieceCIDv2)
+		line("payloadSize", expected.PayloadSize, actual.PayloadSize)
+	}
+	if actual.Car != nil {
+		for _, r := range carRoots(actual) {
+			fmt.Fprintf(&buf, " %-16s %s\n", "carRoot:", r)
+		}
+	}
+
+	return buf.String(), match
+}
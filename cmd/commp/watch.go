@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pborman/options"
+)
+
+// journalEntry is a line of the watch journal: a --json result, along with
+// the file attributes used to detect changes.
+type journalEntry struct {
+	jsonResult
+	FileSize    int64     `json:"fileSize"`
+	FileModTime time.Time `json:"fileModTime"`
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (fs fileStamp) matches(fi os.FileInfo) bool {
+	return fs.size == fi.Size() && fs.modTime.Equal(fi.ModTime())
+}
+
+// watchMain implements `commp watch`, hashing every new or changed regular
+// file under a directory and appending the results to a JSONL journal. Files
+// are identified by path, size and modification time, the latter also being
+// used to let files settle before hashing them.
+func watchMain(args []string) {
+	opts := &struct {
+		Journal  string        `getopt:"--journal=FILE       JSONL journal to append results to, defaults to commp-journal.jsonl in the watched directory"`
+		Interval time.Duration `getopt:"-i --interval=DUR    Time between directory scans"`
+		Settle   time.Duration `getopt:"-s --settle=DUR      Only hash files not modified for at least this long"`
+		Once     bool          `getopt:"--once               Scan only once, then exit"`
+		Car      bool          `getopt:"-c --car             Parse the files as CARs, see the default mode"`
+		PadTo    string        `getopt:"-p --pad-to=SIZE     Zero-extend every piece to the given padded size, see the default mode"`
+		Quiet    bool          `getopt:"-q --quiet           Do not print a line for every hashed file"`
+		Help     options.Help  `getopt:"-h --help            Display help"`
+	}{
+		Interval: 10 * time.Second,
+		Settle:   30 * time.Second,
+	}
+
+	dirs, err := options.SubRegisterAndParse(opts, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(dirs) != 1 {
+		log.Fatal("watch expects a single directory")
+	}
+	dir := dirs[0]
+
+	hopts := &hashOpts{Car: opts.Car}
+	if opts.PadTo != "" {
+		if hopts.PadTo, err = parsePaddedSize(opts.PadTo); err != nil {
+			log.Fatalf("invalid --pad-to: %s", err)
+		}
+	}
+
+	if opts.Journal == "" {
+		opts.Journal = filepath.Join(dir, "commp-journal.jsonl")
+	}
+	seen, err := readJournal(opts.Journal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	journal, err := os.OpenFile(opts.Journal, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer journal.Close()
+	journalAbs, _ := filepath.Abs(opts.Journal)
+
+	// unhashable files are reported once, and retried only once changed
+	failed := make(map[string]fileStamp)
+
+	for {
+		var pending []string
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				// files disappearing mid-scan are not a problem
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			if abs, _ := filepath.Abs(path); abs == journalAbs {
+				return nil
+			}
+			if time.Since(fi.ModTime()) < opts.Settle {
+				return nil
+			}
+			if seen[path].matches(fi) || failed[path].matches(fi) {
+				return nil
+			}
+			pending = append(pending, path)
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, path := range pending {
+			if err := watchHash(path, hopts, journal, seen, opts.Quiet); err != nil {
+				log.Printf("%s: %s", path, err)
+				if fi, err := os.Stat(path); err == nil {
+					failed[path] = fileStamp{size: fi.Size(), modTime: fi.ModTime()}
+				}
+			}
+		}
+
+		if opts.Once {
+			return
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+func watchHash(path string, hopts *hashOpts, journal *os.File, seen map[string]fileStamp, quiet bool) error {
+	before, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	res, err := hashPath(path, hopts)
+	if err != nil {
+		return err
+	}
+
+	// a file modified while being hashed is picked up again on the next scan
+	after, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return nil
+	}
+
+	line, err := json.Marshal(journalEntry{
+		jsonResult:  newJSONResult(res),
+		FileSize:    after.Size(),
+		FileModTime: after.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	seen[path] = fileStamp{size: after.Size(), modTime: after.ModTime()}
+
+	if !quiet {
+		log.Printf("%s: %s", path, res.PieceCID)
+	}
+	return nil
+}
+
+// readJournal returns the file stamps of all entries of an existing journal,
+// the last entry for a path taking precedence.
+func readJournal(path string) (map[string]fileStamp, error) {
+	seen := make(map[string]fileStamp)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		var je journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &je); err != nil {
+			// a truncated last line from an interrupted run is harmless
+			log.Printf("skipping line %d of journal %s: %s", lineNo, path, err)
+			continue
+		}
+		seen[je.Path] = fileStamp{size: je.FileSize, modTime: je.FileModTime}
+	}
+	return seen, scanner.Err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/benchmarks"
+	"github.com/pborman/options"
+)
+
+// zeroMain implements `commp zero`, reporting the commitment of an all-zero
+// piece from the precomputed padding table, without hashing anything.
+func zeroMain(args []string) {
+	opts := &struct {
+		Size   string       `getopt:"-s --size=SIZE      Padded piece size, e.g. 16GiB"`
+		Format string       `getopt:"-f --format=FORMAT  Output format, one of: text tsv json csv toml boost"`
+		Help   options.Help `getopt:"-h --help           Display help"`
+	}{
+		Format: "text",
+	}
+
+	if rest, err := options.SubRegisterAndParse(opts, args); err != nil {
+		log.Fatal(err)
+	} else if len(rest) > 0 {
+		log.Fatal("zero does not take any inputs")
+	}
+
+	printResult, known := printers[opts.Format]
+	if !known {
+		log.Fatalf("unknown output format '%s'", opts.Format)
+	}
+
+	if opts.Size == "" {
+		log.Fatal("--size is required")
+	}
+	size, err := parsePaddedSize(opts.Size)
+	if err != nil {
+		log.Fatalf("invalid --size: %s", err)
+	}
+
+	rawCommP, err := commp.ZeroPieceCommP(size)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the zeroes are the payload, filling the piece completely
+	res, err := newResult("zero-"+benchmarks.FormatSize(size), size/128*127, rawCommP, size)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := printResult(os.Stdout, res); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -140,7 +140,7 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		paddedSize = opts.PadPieceSize
+		paddedSize = uint64(commp.PaddedPieceSize(opts.PadPieceSize).NextPowerOfTwo())
 	}
 
 	commCid, err := commcid.DataCommitmentV1ToCID(rawCommP)
@@ -0,0 +1,137 @@
+package commp
+
+import (
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// PieceInfo describes a piece by its raw 32-byte commP and its padded size.
+type PieceInfo struct {
+	CommP           []byte
+	PaddedPieceSize uint64
+}
+
+// ComputeCommD calculates the raw unsealed sector commitment (commD) of a
+// sector of the given padded size, containing the supplied pieces in order.
+// Every piece is placed at the next offset aligned to its own size, with the
+// gaps and the remainder of the sector filled with zero pieces, exactly as
+// done by GenerateUnsealedCID of filecoin-ffi. An empty list of pieces results
+// in the commD of an entirely empty sector.
+//
+// Like Digest() the result is a raw 32-byte commitment: use the cidutil module
+// to convert it to a cid.Cid, or the commpabi module to compute it from
+// abi.PieceInfo values directly.
+func ComputeCommD(sectorPaddedSize uint64, pieces []PieceInfo) ([]byte, error) {
+
+	if bits.OnesCount64(sectorPaddedSize) != 1 || sectorPaddedSize < 128 {
+		return nil, xerrors.Errorf("sector size %d is not a power of 2 of at least 128 bytes", sectorPaddedSize)
+	}
+	if sectorPaddedSize > maxPaddedPieceSize {
+		return nil, xerrors.Errorf("sector size %d larger than Filecoin maximum of %d bytes", sectorPaddedSize, maxPaddedPieceSize)
+	}
+
+	// a stack of subtrees with strictly decreasing sizes, collapsed eagerly
+	stack := make([]PieceInfo, 0, MaxLayers+1)
+	push := func(p PieceInfo) {
+		stack = append(stack, p)
+		for len(stack) > 1 && stack[len(stack)-2].PaddedPieceSize == stack[len(stack)-1].PaddedPieceSize {
+			l, r := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-2]
+			stack = append(stack, PieceInfo{
+				CommP:           hashNode(make([]byte, 0, 32), l.CommP, r.CommP),
+				PaddedPieceSize: 2 * l.PaddedPieceSize,
+			})
+		}
+	}
+	fill := func(sizes []uint64) {
+		for _, s := range sizes {
+			push(PieceInfo{
+				CommP:           nulPadding(uint(bits.TrailingZeros64(s) - 5)),
+				PaddedPieceSize: s,
+			})
+		}
+	}
+
+	var filled uint64
+	for i, p := range pieces {
+		if len(p.CommP) != 32 {
+			return nil, xerrors.Errorf("commP of piece %d must be exactly 32 bytes long, got %d bytes instead", i, len(p.CommP))
+		}
+		if bits.OnesCount64(p.PaddedPieceSize) != 1 || p.PaddedPieceSize < 128 {
+			return nil, xerrors.Errorf("padded size %d of piece %d is not a power of 2 of at least 128 bytes", p.PaddedPieceSize, i)
+		}
+
+		fillers := fillerSizes(filled, p.PaddedPieceSize)
+		for _, s := range fillers {
+			filled += s
+		}
+		if filled+p.PaddedPieceSize > sectorPaddedSize {
+			return nil, xerrors.Errorf(
+				"piece %d of padded size %d at offset %d does not fit in a sector of %d bytes",
+				i, p.PaddedPieceSize, filled, sectorPaddedSize,
+			)
+		}
+
+		fill(fillers)
+		push(p)
+		filled += p.PaddedPieceSize
+	}
+	if filled == 0 {
+		fill([]uint64{sectorPaddedSize})
+	} else {
+		fill(fillerSizes(filled, sectorPaddedSize))
+	}
+
+	if len(stack) != 1 || stack[0].PaddedPieceSize != sectorPaddedSize {
+		// can not happen given the validation above
+		panic("tree reduction did not result in a single sector-sized root")
+	}
+
+	return append(make([]byte, 0, 32), stack[0].CommP...), nil
+}
+
+// FillerPieces returns the minimal list of zero pieces, in increasing size,
+// completing a sector or an aggregate of the given padded size, occupied up to
+// the padded offset occupied. Placed one after another from that offset, the
+// fillers are all aligned to their own size. This is the equivalent of
+// fillersFromRem of lotus, working with padded sizes, and along with the commP
+// of every filler.
+func FillerPieces(occupied, targetPaddedSize uint64) ([]PieceInfo, error) {
+	if err := PaddedPieceSize(targetPaddedSize).Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid target size: %w", err)
+	}
+	if occupied%128 != 0 {
+		return nil, xerrors.Errorf("occupied size %d is not a multiple of 128 bytes", occupied)
+	}
+	if occupied > targetPaddedSize {
+		return nil, xerrors.Errorf("occupied size %d larger than the target of %d bytes", occupied, targetPaddedSize)
+	}
+
+	sizes := []uint64{targetPaddedSize}
+	if occupied > 0 {
+		sizes = fillerSizes(occupied, targetPaddedSize)
+	}
+	fillers := make([]PieceInfo, len(sizes))
+	for i, s := range sizes {
+		fillers[i] = PieceInfo{
+			CommP:           append(make([]byte, 0, 32), nulPadding(uint(bits.TrailingZeros64(s)-5))...),
+			PaddedPieceSize: s,
+		}
+	}
+	return fillers, nil
+}
+
+// fillerSizes returns the minimal list of zero piece sizes, in increasing
+// order, which need to follow a region of the given padded size in order to
+// align it to the next multiple of alignTo.
+func fillerSizes(filled, alignTo uint64) []uint64 {
+	toFill := -filled % alignTo
+	fillers := make([]uint64, 0, bits.OnesCount64(toFill))
+	for toFill > 0 {
+		next := uint64(1) << uint(bits.TrailingZeros64(toFill))
+		fillers = append(fillers, next)
+		toFill ^= next
+	}
+	return fillers
+}
@@ -0,0 +1,153 @@
+package commp
+
+import (
+	"bytes"
+	"testing"
+
+	randmath "math/rand"
+)
+
+func TestComputeCommD(t *testing.T) {
+	t.Parallel()
+
+	const sectorSize = 16 << 10
+
+	rnd := randmath.New(randmath.NewSource(1337))
+
+	for _, layout := range [][]int{
+		{},
+		{100},
+		{sectorSize / 128 * 127},
+		{127, 1000, 300},
+		{5000, 65, 65, 2000},
+		{65, 4000, 127 * 2, 127 * 3},
+	} {
+		sector := make([]byte, sectorSize/128*127)
+		pieces := make([]PieceInfo, 0, len(layout))
+
+		var offset uint64
+		for _, payloadSize := range layout {
+			payload := make([]byte, payloadSize)
+			rnd.Read(payload)
+
+			cp := &Calc{}
+			cp.Write(payload)
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pieces = append(pieces, PieceInfo{CommP: commP, PaddedPieceSize: paddedSize})
+
+			// align and place
+			offset = (offset + paddedSize - 1) / paddedSize * paddedSize
+			copy(sector[offset/128*127:], payload)
+			offset += paddedSize
+		}
+
+		commD, err := ComputeCommD(sectorSize, pieces)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cp := &Calc{}
+		cp.Write(sector)
+		expCommD, _, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commD, expCommD) {
+			t.Fatalf("layout %v: commD 0x%X does not match streamed sector 0x%X", layout, commD, expCommD)
+		}
+	}
+}
+
+func TestComputeCommDOverflow(t *testing.T) {
+	t.Parallel()
+
+	zero, _ := ZeroPieceCommP(1024)
+	small, _ := ZeroPieceCommP(128)
+
+	if _, err := ComputeCommD(2048, []PieceInfo{
+		{CommP: zero, PaddedPieceSize: 1024},
+		{CommP: zero, PaddedPieceSize: 1024},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the alignment filler pushes the second piece out of the sector
+	if _, err := ComputeCommD(2048, []PieceInfo{
+		{CommP: small, PaddedPieceSize: 128},
+		{CommP: zero, PaddedPieceSize: 1024},
+		{CommP: small, PaddedPieceSize: 128},
+		{CommP: zero, PaddedPieceSize: 1024},
+	}); err == nil {
+		t.Fatal("unexpected success for pieces overflowing the sector")
+	}
+
+	if _, err := ComputeCommD(2048, []PieceInfo{{CommP: zero, PaddedPieceSize: 1000}}); err == nil {
+		t.Fatal("unexpected success for a non power-of-two piece")
+	}
+	if _, err := ComputeCommD(3000, nil); err == nil {
+		t.Fatal("unexpected success for a non power-of-two sector")
+	}
+}
+
+func TestFillerPieces(t *testing.T) {
+	t.Parallel()
+
+	const sectorSize = 32 << 10
+
+	piece, _ := ZeroPieceCommP(2048)
+	piece = append([]byte{}, piece...)
+	piece[0] ^= 0xFF
+
+	for _, tc := range []struct {
+		occupied uint64
+		sizes    []uint64
+	}{
+		{0, []uint64{sectorSize}},
+		{128, []uint64{128, 256, 512, 1 << 10, 2 << 10, 4 << 10, 8 << 10, 16 << 10}},
+		{2048, []uint64{2 << 10, 4 << 10, 8 << 10, 16 << 10}},
+		{3 << 10, []uint64{1 << 10, 4 << 10, 8 << 10, 16 << 10}},
+		{sectorSize, []uint64{}},
+	} {
+		fillers, err := FillerPieces(tc.occupied, sectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fillers) != len(tc.sizes) {
+			t.Fatalf("%d bytes occupied: %d fillers instead of %d", tc.occupied, len(fillers), len(tc.sizes))
+		}
+		for i, f := range fillers {
+			zero, _ := ZeroPieceCommP(tc.sizes[i])
+			if f.PaddedPieceSize != tc.sizes[i] || !bytes.Equal(f.CommP, zero) {
+				t.Fatalf("%d bytes occupied: filler %d of %d bytes, expected %d", tc.occupied, i, f.PaddedPieceSize, tc.sizes[i])
+			}
+		}
+
+		// the pieces up to the occupied size followed by the fillers result
+		// in the same commD as the pieces alone
+		var pieces []PieceInfo
+		for o := uint64(0); o+2048 <= tc.occupied; o += 2048 {
+			pieces = append(pieces, PieceInfo{CommP: piece, PaddedPieceSize: 2048})
+		}
+		if tc.occupied%2048 != 0 || len(pieces) == 0 {
+			continue
+		}
+		expCommD, _ := ComputeCommD(sectorSize, pieces)
+		commD, err := ComputeCommD(sectorSize, append(pieces, fillers...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commD, expCommD) {
+			t.Fatalf("%d bytes occupied: commD with fillers 0x%X does not match 0x%X", tc.occupied, commD, expCommD)
+		}
+	}
+
+	if _, err := FillerPieces(100, sectorSize); err == nil {
+		t.Fatal("unexpected success for an unaligned occupied size")
+	}
+	if _, err := FillerPieces(sectorSize+128, sectorSize); err == nil {
+		t.Fatal("unexpected success for an occupied size beyond the sector")
+	}
+}
@@ -3,15 +3,19 @@ package commp
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"encoding/base32"
 	"fmt"
 	"io"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	randmath "math/rand"
+
+	"golang.org/x/xerrors"
 )
 
 type testCase struct {
@@ -45,6 +49,40 @@ func BenchmarkCommP(b *testing.B) {
 	}
 }
 
+// BenchmarkWriteSizes shows the cost of the mutex held by Write(), "lock",
+// against the Write()s it serializes.
+func BenchmarkWriteSizes(b *testing.B) {
+	payload := make([]byte, 127<<12)
+	randmath.New(randmath.NewSource(1)).Read(payload)
+
+	b.Run("lock", func(b *testing.B) {
+		cp := new(Calc)
+		for i := 0; i < b.N; i++ {
+			cp.mu.Lock()
+			cp.mu.Unlock()
+		}
+	})
+
+	for _, size := range []int{64, 1 << 10, 4 << 10, 64 << 10} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cp := new(Calc)
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := cp.Write(payload[:size]); err != nil {
+					b.Fatal(err)
+				}
+				if i%(len(payload)/size) == len(payload)/size-1 {
+					b.StopTimer()
+					cp.Reset()
+					b.StartTimer()
+				}
+			}
+			b.StopTimer()
+			cp.Reset()
+		})
+	}
+}
+
 func TestCommP(t *testing.T) {
 	t.Parallel()
 
@@ -148,6 +186,365 @@ func TestZero(t *testing.T) {
 	}
 }
 
+func TestAutoPadMinimum(t *testing.T) {
+	cp := New(WithAutoPadMinimum())
+	if _, _, err := cp.Digest(); !xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("digesting nothing returned %v", err)
+	}
+
+	payload := bytes.Repeat([]byte{0xE1}, int(MinPiecePayload))
+	for n := 1; n <= len(payload); n++ {
+		expCommP, expSize, err := Sum(append(payload[:n:n], make([]byte, len(payload)-n)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cp.Write(payload[:n])
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("payload of %d bytes produced 0x%X / %d, expected 0x%X / %d", n, commP, paddedSize, expCommP, expSize)
+		}
+	}
+}
+
+func TestDigestInfo(t *testing.T) {
+	for _, c := range []struct {
+		opts    []Option
+		payload uint64
+		filler  uint64
+	}{
+		{nil, 127, 0},
+		{nil, 65, 62},
+		{nil, 128, 126},
+		{nil, 127 << 10, 0},
+		{nil, 127<<10 + 1, 127<<10 - 1},
+		{[]Option{WithAutoPadMinimum()}, 1, 126},
+	} {
+		cp := New(c.opts...)
+		cp.Write(bytes.Repeat([]byte{0x77}, int(c.payload)))
+		pd, err := cp.DigestInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pd.PayloadSize != c.payload || pd.FillerSize != c.filler || pd.PaddedPieceSize != (c.payload+c.filler)/127*128 {
+			t.Fatalf("payload of %d bytes reported as %+v, expected a filler of %d bytes", c.payload, pd, c.filler)
+		}
+	}
+}
+
+func TestDigestInto(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x3C}, 127*8+3)
+	expCommP, expSize, err := Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cp := range []*Calc{new(Calc), New(WithScratch(new(Scratch)))} {
+		var commP [32]byte
+		cp.Write(payload)
+		paddedSize, err := cp.DigestInto(&commP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commP != expCommP || paddedSize != expSize {
+			t.Fatalf("produced 0x%X / %d, expected 0x%X / %d", commP, paddedSize, expCommP, expSize)
+		}
+	}
+
+	// the result is not allocated per digest, which can not be told apart
+	// from pooled objects randomly dropped with the race detector
+	if raceEnabled {
+		return
+	}
+	cp := New(WithScratch(new(Scratch)))
+	var commP [32]byte
+	allocs := func(digest func()) float64 {
+		return testing.AllocsPerRun(20, func() {
+			cp.Write(payload)
+			digest()
+		})
+	}
+	plain := allocs(func() {
+		if _, _, err := cp.Digest(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	into := allocs(func() {
+		if _, err := cp.DigestInto(&commP); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if into > plain-1 {
+		t.Fatalf("expected fewer allocations with DigestInto, got %.0f vs %.0f", into, plain)
+	}
+}
+
+func TestSequentialPieces(t *testing.T) {
+	rnd := randmath.New(randmath.NewSource(1))
+	payload := make([]byte, 127<<11)
+	rnd.Read(payload)
+	sizes := []int{65, 127 << 11, 127*3 + 1, 127 << 7, 1000}
+
+	for name, opts := range map[string][]Option{
+		"default": nil,
+		"scratch": {WithScratch(new(Scratch))},
+		"batch":   {WithBatchHasher(new(recordingBatchHasher), 128)},
+		"sink":    {WithTreeLayers(3, func(uint, uint64, []byte) {})},
+		"inline":  {WithInlineFolding()},
+	} {
+		cp := New(opts...)
+		for i := 0; i < 3; i++ {
+			for _, size := range sizes {
+				expCommP, expSize, err := Sum(payload[:size])
+				if err != nil {
+					t.Fatal(err)
+				}
+				cp.Write(payload[:size])
+				commP, paddedSize, err := cp.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+					t.Fatalf("%s: piece of %d bytes produced 0x%X / %d, expected 0x%X / %d", name, size, commP, paddedSize, expCommP, expSize)
+				}
+
+				// an abandoned piece does not leave anything behind either
+				cp.Write(payload[:size])
+				cp.Reset()
+			}
+		}
+	}
+
+	if raceEnabled {
+		return
+	}
+	piece := payload[:127<<7]
+	reused := New()
+	allocs := func(cp func() *Calc) float64 {
+		return testing.AllocsPerRun(20, func() {
+			c := cp()
+			c.Write(piece)
+			if _, _, err := c.Digest(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	fresh := allocs(func() *Calc { return New() })
+	reuse := allocs(func() *Calc { return reused })
+	if reuse > fresh-8 {
+		t.Fatalf("expected fewer allocations reusing a Calc, got %.0f vs %.0f", reuse, fresh)
+	}
+}
+
+// a short final carry must not pick up leftovers of a longer earlier one
+func TestStaleCarry(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xFF}, 127+126+50)
+
+	cp := new(Calc)
+	cp.Write(payload[:126])
+	cp.Write(payload[126 : 127+126])
+	cp.Write(payload[127+126:])
+	commP, _, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, _, _ := Sum(payload)
+	if !bytes.Equal(commP, exp[:]) {
+		t.Fatalf("chunked Write() produced 0x%X, expected 0x%X", commP, exp)
+	}
+}
+
+func TestShortWrites(t *testing.T) {
+	data := make([]byte, 127*9+50)
+	randmath.New(randmath.NewSource(1)).Read(data)
+	expCommP, expSize, err := Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cp := range []*Calc{new(Calc), New(WithObserver(&countingObserver{depthSamples: map[uint]int{}}))} {
+		for _, step := range []int{1, 5, 64, 126} {
+			for p := data; len(p) > 0; {
+				n := step
+				if n > len(p) {
+					n = len(p)
+				}
+				cp.Write(p[:n])
+				p = p[n:]
+			}
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+				t.Fatalf("writes of %d bytes produced 0x%X / %d, expected 0x%X / %d", step, commP, paddedSize, expCommP, expSize)
+			}
+		}
+	}
+
+	// not even a single byte fits past the maximum
+	cp := new(Calc)
+	cp.Write(data[:1])
+	if err := cp.WriteZeros(MaxPiecePayload - 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Write(data[:1]); !xerrors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+	cp.Reset()
+}
+
+func TestZeroPieceCommP(t *testing.T) {
+	t.Parallel()
+
+	tests, err := getTestCases("testdata/zero.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checked int
+	for _, test := range tests {
+		// only pieces fully filled with zeroes
+		if uint64(test.PayloadSize) != test.PieceSize/128*127 {
+			continue
+		}
+		checked++
+
+		commP, err := ZeroPieceCommP(test.PieceSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, test.RawCommP) {
+			t.Fatalf("zero commP 0x%X for size %d doesn't match expected 0x%X", commP, test.PieceSize, test.RawCommP)
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no full zero pieces found in test vectors")
+	}
+
+	for _, invalid := range []uint64{0, 64, 129, 3 << 20, 1 << (MaxLayers + 6)} {
+		if _, err := ZeroPieceCommP(invalid); err == nil {
+			t.Fatalf("unexpected success for invalid padded size %d", invalid)
+		}
+	}
+}
+
+func TestNulPadding(t *testing.T) {
+	// levels are built concurrently, and past MaxLayers
+	const top = MaxLayers + 3
+	var wg sync.WaitGroup
+	for _, level := range []uint{top, 3, MaxLayers, 0, top - 1} {
+		wg.Add(1)
+		go func(level uint) {
+			defer wg.Done()
+			nulPadding(level)
+		}(level)
+	}
+	wg.Wait()
+
+	exp := make([]byte, 32)
+	for level := uint(0); level <= top; level++ {
+		if !bytes.Equal(nulPadding(level), exp) {
+			t.Fatalf("nul padding of level %d is 0x%X, expected 0x%X", level, nulPadding(level), exp)
+		}
+		d := sha256.Sum256(append(append([]byte{}, exp...), exp...))
+		d[31] &= 0x3F
+		exp = d[:]
+	}
+}
+
+func TestPadCommP(t *testing.T) {
+	t.Parallel()
+
+	rnd := randmath.New(randmath.NewSource(1337))
+	for _, payloadSize := range []int{65, 126, 127, 128, 254, 1000, 1024, 127 * 8, 5000} {
+		payload := make([]byte, payloadSize)
+		rnd.Read(payload)
+
+		cp := &Calc{}
+		cp.Write(payload)
+		srcCommP, srcSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for target := srcSize; target <= 1<<16; target <<= 1 {
+			// stream the same payload, zero-extended to the target size
+			cp.Write(payload)
+			cp.Write(make([]byte, int(target/128*127)-payloadSize))
+			expCommP, expSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expSize != target {
+				t.Fatalf("unexpected streamed padded size %d, expected %d", expSize, target)
+			}
+
+			for _, targetSize := range []uint64{target, target - 1} { // exact and rounded up
+				padded, err := PadCommP(srcCommP, srcSize, targetSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(padded, expCommP) {
+					t.Fatalf(
+						"padding %d-byte payload from %d to %d resulted in 0x%X, expected 0x%X",
+						payloadSize, srcSize, targetSize, padded, expCommP,
+					)
+				}
+			}
+			padded, err := PadPayloadCommP(srcCommP, UnpaddedPieceSize(payloadSize), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(padded, expCommP) {
+				t.Fatalf(
+					"padding %d-byte payload to %d resulted in 0x%X, expected 0x%X",
+					payloadSize, target, padded, expCommP,
+				)
+			}
+		}
+	}
+
+	zero128, _ := ZeroPieceCommP(128)
+	trace, err := PadCommPTrace(zero128, 128, 1<<16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace) != 10 {
+		t.Fatalf("expected 10 trace entries padding from 128 to 64KiB, got %d", len(trace))
+	}
+	for i, commP := range trace {
+		exp, _ := ZeroPieceCommP(128 << uint(i))
+		if !bytes.Equal(commP, exp) {
+			t.Fatalf("trace entry %d is 0x%X, expected zero-piece commP 0x%X", i, commP, exp)
+		}
+	}
+
+	commP := make([]byte, 32)
+	for _, invalid := range [][2]uint64{
+		{64, 128},
+		{256, 128},
+		{1000, 2048}, // a payload size, see PadPayloadCommP()
+		{1 << 20, 1<<(MaxLayers+5) + 1},
+		{1 << 20, 1 << (MaxLayers + 6)},
+	} {
+		if _, err := PadCommP(commP, invalid[0], invalid[1]); err == nil {
+			t.Fatalf("unexpected success padding from %d to %d", invalid[0], invalid[1])
+		}
+	}
+	if _, err := PadCommP(commP[:31], 128, 256); err == nil {
+		t.Fatal("unexpected success padding a short commP")
+	}
+	for _, invalid := range []UnpaddedPieceSize{0, 64, UnpaddedPieceSize(MaxPiecePayload) + 1} {
+		if _, err := PadPayloadCommP(commP, invalid, 1<<20); err == nil {
+			t.Fatalf("unexpected success padding the commP of %d bytes of payload", invalid)
+		}
+	}
+}
+
 func Test0b11001100(t *testing.T) {
 	t.Parallel()
 
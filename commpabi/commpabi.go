@@ -0,0 +1,62 @@
+// Package commpabi returns the results of the commp package as the abi types
+// of go-state-types, ready to be passed to lotus and boost APIs. It lives in
+// a separate module so that users of the commp package are not forced to
+// depend on go-state-types.
+package commpabi
+
+import (
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/cidutil"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+)
+
+// Digest calls d.Digest(), typically of a commp.Calc, returning the result as
+// an abi.PieceInfo.
+func Digest(d commp.Digester) (abi.PieceInfo, error) {
+	rawCommP, paddedSize, err := d.Digest()
+	if err != nil {
+		return abi.PieceInfo{}, err
+	}
+	return FromPieceInfo(commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: paddedSize})
+}
+
+// Sum is commp.Sum returning an abi.PieceInfo.
+func Sum(data []byte) (abi.PieceInfo, error) {
+	rawCommP, paddedSize, err := commp.Sum(data)
+	if err != nil {
+		return abi.PieceInfo{}, err
+	}
+	return FromPieceInfo(commp.PieceInfo{CommP: rawCommP[:], PaddedPieceSize: paddedSize})
+}
+
+// FromPieceInfo converts pi to an abi.PieceInfo.
+func FromPieceInfo(pi commp.PieceInfo) (abi.PieceInfo, error) {
+	c, err := cidutil.FromPieceInfo(pi)
+	if err != nil {
+		return abi.PieceInfo{}, err
+	}
+	return abi.PieceInfo{Size: abi.PaddedPieceSize(pi.PaddedPieceSize), PieceCID: c}, nil
+}
+
+// ToPieceInfo converts pi to a commp.PieceInfo.
+func ToPieceInfo(pi abi.PieceInfo) (commp.PieceInfo, error) {
+	return cidutil.ToPieceInfo(pi.PieceCID, uint64(pi.Size))
+}
+
+// UnsealedCID returns the CID of the commD of a sector containing the given
+// pieces in order, as computed by commp.ComputeCommD.
+func UnsealedCID(sectorSize abi.SectorSize, pieces []abi.PieceInfo) (cid.Cid, error) {
+	infos := make([]commp.PieceInfo, len(pieces))
+	for i, p := range pieces {
+		var err error
+		if infos[i], err = ToPieceInfo(p); err != nil {
+			return cid.Undef, err
+		}
+	}
+	commD, err := commp.ComputeCommD(uint64(sectorSize), infos)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cidutil.PieceCID(commD)
+}
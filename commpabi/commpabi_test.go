@@ -0,0 +1,47 @@
+package commpabi
+
+import (
+	"bytes"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+func TestDigest(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 1000)
+
+	cp := new(commp.Calc)
+	cp.Write(payload)
+	pi, err := Digest(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Size != 1024 || !pi.PieceCID.Equals(exp.PieceCID) {
+		t.Fatalf("got %s/%d, expected %s/1024", pi.PieceCID, pi.Size, exp.PieceCID)
+	}
+	if err := pi.Size.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := ToPieceInfo(pi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.PaddedPieceSize != 1024 {
+		t.Fatalf("roundtrip resulted in size %d", back.PaddedPieceSize)
+	}
+
+	// a sector holding a single piece of its own size has the commD of the piece
+	commD, err := UnsealedCID(abi.SectorSize(1024), []abi.PieceInfo{pi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !commD.Equals(pi.PieceCID) {
+		t.Fatalf("commD %s, expected %s", commD, pi.PieceCID)
+	}
+}
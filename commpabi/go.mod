@@ -0,0 +1,15 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commpabi
+
+go 1.20
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/filecoin-project/go-fil-commp-hashhash/cidutil v0.0.0
+	github.com/filecoin-project/go-state-types v0.13.3
+	github.com/ipfs/go-cid v0.4.1
+)
+
+replace (
+	github.com/filecoin-project/go-fil-commp-hashhash => ../
+	github.com/filecoin-project/go-fil-commp-hashhash/cidutil => ../cidutil
+)
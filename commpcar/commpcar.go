@@ -0,0 +1,186 @@
+// Package commpcar computes the commP of a CARv1 stream while validating it,
+// in a single pass, returning the information needed to make a deal out of
+// it: the payload root CIDs, the amount of blocks, the payload size and the
+// commP itself.
+//
+// The package has no dependencies beyond the commp package: CIDs are returned
+// in their binary form, to be turned into a cid.Cid via cid.Cast(). Only the
+// structure of the CAR is validated, the block contents are not verified
+// against their CIDs.
+package commpcar
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// MaxHeaderSize is the largest CAR header accepted.
+const MaxHeaderSize = 32 << 20
+
+// MaxSectionSize is the largest block section, CID and data, accepted.
+const MaxSectionSize = 32 << 20
+
+// ErrInvalidCar is matched by the errors of a stream which is not a valid
+// CARv1.
+var ErrInvalidCar = xerrors.New("invalid CARv1")
+
+// Result describes a CARv1 along with its piece commitment.
+type Result struct {
+	Roots           [][]byte // binary root CIDs
+	Blocks          uint64
+	PayloadSize     uint64 // size of the CAR, header included
+	CommP           []byte // raw 32 bytes
+	PaddedPieceSize uint64
+}
+
+// Block locates a block within a CAR.
+type Block struct {
+	CID    []byte // binary CID, only valid during the call of a BlockFunc
+	Offset uint64 // of the section, its length prefix included
+	Size   uint64 // of the block data
+}
+
+// BlockFunc is called by Walk for every block of a CAR. A non-nil error
+// aborts the Walk.
+type BlockFunc func(Block) error
+
+// Sum reads the CARv1 in r until EOF, returning its Result. The supplied
+// options apply to the commp.Calc hashing it.
+func Sum(r io.Reader, opts ...commp.Option) (*Result, error) {
+	return Walk(r, nil, opts...)
+}
+
+// Walk is Sum additionally calling fn, if not nil, for every block in the
+// order they appear in the CAR, e.g. to index them as they are hashed.
+func Walk(r io.Reader, fn BlockFunc, opts ...commp.Option) (*Result, error) {
+	cp := commp.New(opts...)
+	defer cp.Reset()
+
+	cr := &carReader{r: bufio.NewReaderSize(io.TeeReader(r, cp), 1<<20)}
+	res := new(Result)
+
+	var err error
+	if res.Roots, err = cr.readHeader(); err != nil {
+		return nil, err
+	}
+	for {
+		b, err := cr.readSection()
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			break
+		}
+		res.Blocks++
+		if fn != nil {
+			if err := fn(*b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res.PayloadSize = cr.offset
+	if res.CommP, res.PaddedPieceSize, err = cp.Digest(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type carReader struct {
+	r      *bufio.Reader
+	offset uint64
+	buf    []byte // reused across sections
+}
+
+func (cr *carReader) invalid(format string, args ...interface{}) error {
+	return xerrors.Errorf("%s at offset %d: %w", fmt.Sprintf(format, args...), cr.offset, ErrInvalidCar)
+}
+
+// readUvarint reads the length prefix of the header or of a section. A clean
+// EOF is returned as is.
+func (cr *carReader) readUvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(byteCounter{cr})
+	if err == io.ErrUnexpectedEOF {
+		return 0, cr.invalid("truncated varint")
+	}
+	if err != nil && err != io.EOF {
+		return 0, cr.invalid("%s", err)
+	}
+	return v, err
+}
+
+// readFull reads the next size bytes, valid until the next call.
+func (cr *carReader) readFull(size uint64) ([]byte, error) {
+	if uint64(cap(cr.buf)) < size {
+		cr.buf = make([]byte, size)
+	}
+	buf := cr.buf[:size]
+	n, err := io.ReadFull(cr.r, buf)
+	cr.offset += uint64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, cr.invalid("truncated after %d of %d bytes", n, size)
+	}
+	return buf, err
+}
+
+func (cr *carReader) readHeader() ([][]byte, error) {
+	size, err := cr.readUvarint()
+	if err == io.EOF {
+		return nil, cr.invalid("empty stream")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || size > MaxHeaderSize {
+		return nil, cr.invalid("header size %d out of bounds", size)
+	}
+	hdr, err := cr.readFull(size)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := decodeHeader(hdr)
+	if err != nil {
+		return nil, cr.invalid("header: %s", err)
+	}
+	return roots, nil
+}
+
+// readSection reads a block section, returning nil at the end of the CAR.
+func (cr *carReader) readSection() (*Block, error) {
+	offset := cr.offset
+	size, err := cr.readUvarint()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || size > MaxSectionSize {
+		return nil, cr.invalid("section size %d out of bounds", size)
+	}
+	sec, err := cr.readFull(size)
+	if err != nil {
+		return nil, err
+	}
+	n, err := cidLen(sec)
+	if err != nil {
+		return nil, cr.invalid("block CID: %s", err)
+	}
+	return &Block{CID: sec[:n], Offset: offset, Size: size - uint64(n)}, nil
+}
+
+type byteCounter struct{ cr *carReader }
+
+func (b byteCounter) ReadByte() (byte, error) {
+	c, err := b.cr.r.ReadByte()
+	if err == nil {
+		b.cr.offset++
+	}
+	return c, err
+}
@@ -0,0 +1,124 @@
+package commpcar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// rawCID returns the CIDv1 of data with the raw codec.
+func rawCID(data []byte) []byte {
+	d := sha256.Sum256(data)
+	return append([]byte{0x01, 0x55, 0x12, 0x20}, d[:]...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var vi [binary.MaxVarintLen64]byte
+	return append(b, vi[:binary.PutUvarint(vi[:], v)]...)
+}
+
+// header encodes a DAG-CBOR CAR header with the given version and roots.
+func header(version byte, roots ...[]byte) []byte {
+	h := []byte{0xa2, 0x65, 'r', 'o', 'o', 't', 's', 0x80 | byte(len(roots))}
+	for _, r := range roots {
+		h = append(h, 0xd8, 42, 0x58, byte(len(r)+1), 0x00)
+		h = append(h, r...)
+	}
+	h = append(h, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', version)
+	return append(appendUvarint(nil, uint64(len(h))), h...)
+}
+
+func section(data []byte) []byte {
+	c := rawCID(data)
+	s := appendUvarint(nil, uint64(len(c)+len(data)))
+	return append(append(s, c...), data...)
+}
+
+func TestSum(t *testing.T) {
+	blocks := [][]byte{
+		bytes.Repeat([]byte{1}, 1000),
+		bytes.Repeat([]byte{2}, 3000),
+		bytes.Repeat([]byte{3}, 5),
+	}
+	car := header(1, rawCID(blocks[0]), rawCID(blocks[2]))
+	for _, b := range blocks {
+		car = append(car, section(b)...)
+	}
+
+	res, err := Sum(bytes.NewReader(car))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expCommP, expSize, err := commp.Sum(car)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.CommP, expCommP[:]) || res.PaddedPieceSize != expSize {
+		t.Fatalf("got commP %X/%d, expected %X/%d", res.CommP, res.PaddedPieceSize, expCommP, expSize)
+	}
+	if res.PayloadSize != uint64(len(car)) || res.Blocks != 3 {
+		t.Fatalf("got %d bytes in %d blocks, expected %d bytes in 3 blocks", res.PayloadSize, res.Blocks, len(car))
+	}
+	if len(res.Roots) != 2 || !bytes.Equal(res.Roots[0], rawCID(blocks[0])) || !bytes.Equal(res.Roots[1], rawCID(blocks[2])) {
+		t.Fatalf("unexpected roots %X", res.Roots)
+	}
+}
+
+func TestSumInvalid(t *testing.T) {
+	block := bytes.Repeat([]byte{1}, 1000)
+	valid := append(header(1, rawCID(block)), section(block)...)
+
+	for name, car := range map[string][]byte{
+		"empty":             nil,
+		"not a CAR":         bytes.Repeat([]byte{0xFF}, 200),
+		"version 2":         append(header(2, rawCID(block)), section(block)...),
+		"no roots":          append(header(1), section(block)...),
+		"truncated section": valid[:len(valid)-1],
+		"zero section":      append(append([]byte(nil), valid...), 0),
+		"bad block CID":     append(append([]byte(nil), valid...), 3, 0x02, 0x55, 0x00),
+	} {
+		_, err := Sum(bytes.NewReader(car))
+		if !xerrors.Is(err, ErrInvalidCar) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	blocks := [][]byte{
+		bytes.Repeat([]byte{1}, 1000),
+		bytes.Repeat([]byte{2}, 200),
+	}
+	car := header(1, rawCID(blocks[0]))
+	var offsets []uint64
+	for _, b := range blocks {
+		offsets = append(offsets, uint64(len(car)))
+		car = append(car, section(b)...)
+	}
+
+	var seen []Block
+	if _, err := Walk(bytes.NewReader(car), func(b Block) error {
+		b.CID = append([]byte(nil), b.CID...)
+		seen = append(seen, b)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(blocks) {
+		t.Fatalf("walked %d blocks instead of %d", len(seen), len(blocks))
+	}
+	for i, b := range seen {
+		if !bytes.Equal(b.CID, rawCID(blocks[i])) || b.Offset != offsets[i] || b.Size != uint64(len(blocks[i])) {
+			t.Errorf("block %d: got %X at %d of %d bytes, expected %X at %d of %d bytes", i, b.CID, b.Offset, b.Size, rawCID(blocks[i]), offsets[i], len(blocks[i]))
+		}
+	}
+
+	errStop := xerrors.New("stop")
+	if _, err := Walk(bytes.NewReader(car), func(Block) error { return errStop }); err != errStop {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package commpcar
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/xerrors"
+)
+
+// CBOR major types used by the DAG-CBOR encoded CAR header.
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+)
+
+// cborTagCID is the CBOR tag of CIDs in DAG-CBOR.
+const cborTagCID = 42
+
+// decodeHeader decodes the DAG-CBOR {roots, version} map of a CARv1 header,
+// returning its roots.
+func decodeHeader(b []byte) ([][]byte, error) {
+	entries, b, err := readCborHead(b, cborMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots [][]byte
+	var version uint64
+	var seenRoots, seenVersion bool
+	for ; entries > 0; entries-- {
+		var keyLen uint64
+		if keyLen, b, err = readCborHead(b, cborText); err != nil {
+			return nil, err
+		}
+		if keyLen > uint64(len(b)) {
+			return nil, xerrors.New("truncated map key")
+		}
+		key := string(b[:keyLen])
+		b = b[keyLen:]
+
+		switch {
+		case key == "version" && !seenVersion:
+			seenVersion = true
+			if version, b, err = readCborHead(b, cborUint); err != nil {
+				return nil, err
+			}
+		case key == "roots" && !seenRoots:
+			seenRoots = true
+			if roots, b, err = decodeRoots(b); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, xerrors.Errorf("unexpected key %q", key)
+		}
+	}
+
+	switch {
+	case len(b) > 0:
+		return nil, xerrors.Errorf("%d trailing bytes", len(b))
+	case !seenVersion:
+		return nil, xerrors.New("missing version")
+	case version != 1:
+		return nil, xerrors.Errorf("unsupported version %d", version)
+	case len(roots) == 0:
+		return nil, xerrors.New("no roots")
+	}
+	return roots, nil
+}
+
+func decodeRoots(b []byte) ([][]byte, []byte, error) {
+	count, b, err := readCborHead(b, cborArray)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > uint64(len(b)) {
+		return nil, nil, xerrors.Errorf("truncated array of %d roots", count)
+	}
+
+	roots := make([][]byte, 0, count)
+	for ; count > 0; count-- {
+		var tag, size uint64
+		if tag, b, err = readCborHead(b, cborTag); err != nil {
+			return nil, nil, err
+		}
+		if tag != cborTagCID {
+			return nil, nil, xerrors.Errorf("unexpected tag %d instead of a CID", tag)
+		}
+		if size, b, err = readCborHead(b, cborBytes); err != nil {
+			return nil, nil, err
+		}
+		// the binary CID is prefixed with the 0x00 identity multibase
+		if size < 2 || size > uint64(len(b)) || b[0] != 0x00 {
+			return nil, nil, xerrors.New("malformed root CID")
+		}
+		root := b[1:size]
+		if n, err := cidLen(root); err != nil {
+			return nil, nil, xerrors.Errorf("root CID: %w", err)
+		} else if n != len(root) {
+			return nil, nil, xerrors.New("trailing bytes after root CID")
+		}
+		roots = append(roots, append([]byte(nil), root...))
+		b = b[size:]
+	}
+	return roots, b, nil
+}
+
+// readCborHead decodes the head of the next CBOR item, which must be of the
+// given major type, returning its argument and the bytes after the head.
+// Indefinite lengths are not allowed in DAG-CBOR.
+func readCborHead(b []byte, major byte) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, xerrors.New("truncated CBOR")
+	}
+	if b[0]>>5 != major {
+		return 0, nil, xerrors.Errorf("unexpected CBOR major type %d instead of %d", b[0]>>5, major)
+	}
+
+	info := b[0] & 0x1f
+	b = b[1:]
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), b, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, nil, xerrors.Errorf("unsupported CBOR additional info %d", info)
+	}
+	if len(b) < size {
+		return 0, nil, xerrors.New("truncated CBOR")
+	}
+
+	var arg uint64
+	for _, c := range b[:size] {
+		arg = arg<<8 | uint64(c)
+	}
+	return arg, b[size:], nil
+}
+
+// cidLen returns the length of the binary CID at the start of b.
+func cidLen(b []byte) (int, error) {
+	// CIDv0 is a bare sha2-256 multihash
+	if len(b) >= 2 && b[0] == 0x12 && b[1] == 0x20 {
+		if len(b) < 34 {
+			return 0, xerrors.New("truncated CIDv0")
+		}
+		return 34, nil
+	}
+
+	var pos int
+	var fields [4]uint64 // version, codec, multihash code, digest length
+	for i := range fields {
+		v, n := binary.Uvarint(b[pos:])
+		if n <= 0 {
+			return 0, xerrors.New("truncated CID")
+		}
+		fields[i] = v
+		pos += n
+	}
+	if fields[0] != 1 {
+		return 0, xerrors.Errorf("unsupported CID version %d", fields[0])
+	}
+	if fields[3] > uint64(len(b)-pos) {
+		return 0, xerrors.New("truncated CID digest")
+	}
+	return pos + int(fields[3]), nil
+}
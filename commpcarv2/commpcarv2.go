@@ -0,0 +1,145 @@
+// Package commpcarv2 writes a CARv2 with go-car/v2 while computing the commP
+// of its CARv1 data payload, sparing deal preparation a second pass over the
+// finished CAR just to hash it:
+//
+//	f, _ := os.Create("payload.car")
+//	w, _ := commpcarv2.NewWriter(f, []cid.Cid{root})
+//	for _, b := range blocks {
+//		w.Put(ctx, b.Cid().KeyString(), b.RawData())
+//	}
+//	res, err := w.Finalize()
+//
+// The piece is the CARv1 payload of the CARv2, as retrieved and sealed by
+// storage providers: its header, index and padding are not part of it.
+package commpcarv2
+
+import (
+	"io"
+	"sync"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+	"golang.org/x/xerrors"
+)
+
+// WriterAt is the destination of a CARv2, which is written out of order:
+// typically an *os.File.
+type WriterAt interface {
+	io.Writer
+	io.WriterAt
+}
+
+// Result describes the piece made of the CARv1 payload of a CARv2.
+type Result struct {
+	PieceCID        cid.Cid
+	CommP           []byte // raw 32 bytes
+	PaddedPieceSize uint64
+	PayloadSize     uint64 // size of the CARv1 payload
+}
+
+// Writer wraps a storage.WritableCar, hashing the CARv1 payload as it is
+// written. Blocks are added via Put(), and the CAR is completed by Finalize(),
+// which replaces the one of the storage.WritableCar.
+type Writer struct {
+	storage.WritableCar
+	hw *hashingWriterAt
+}
+
+// NewWriter starts a CARv2 with the given roots at the start of w, via
+// storage.NewWritable. Options requesting a CARv1 are rejected: use the
+// commpcar package to hash a CARv1 as it is written instead.
+func NewWriter(w WriterAt, roots []cid.Cid, opts ...carv2.Option) (*Writer, error) {
+	o := carv2.ApplyOptions(opts...)
+	if o.WriteAsCarV1 {
+		return nil, xerrors.New("commpcarv2 only writes CARv2")
+	}
+
+	hw := &hashingWriterAt{
+		WriterAt: w,
+		next:     int64(carv2.PragmaSize + carv2.HeaderSize + o.DataPadding),
+		hashing:  true,
+	}
+	wc, err := storage.NewWritable(hw, roots, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{WritableCar: wc, hw: hw}, nil
+}
+
+// Finalize writes the index and header of the CARv2, returning the Result of
+// its CARv1 payload.
+func (w *Writer) Finalize() (*Result, error) {
+	size, err := w.hw.stop()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.WritableCar.Finalize(); err != nil {
+		return nil, err
+	}
+
+	rawCommP, paddedSize, err := w.hw.cp.Digest()
+	if err != nil {
+		return nil, err
+	}
+	pieceCID, err := cid.Cast(append([]byte{0x01, 0x81, 0xE2, 0x03, 0x92, 0x20, 0x20}, rawCommP...))
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		PieceCID:        pieceCID,
+		CommP:           rawCommP,
+		PaddedPieceSize: paddedSize,
+		PayloadSize:     size,
+	}, nil
+}
+
+// hashingWriterAt hashes the data payload of a CARv2, written sequentially
+// from its data offset until stop().
+type hashingWriterAt struct {
+	WriterAt
+
+	mu      sync.Mutex
+	cp      commp.Calc
+	next    int64 // offset of the end of the payload written so far
+	size    uint64
+	hashing bool
+	err     error // of the first write which could not be hashed
+}
+
+func (h *hashingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// anything before the payload is not part of the piece
+	if !h.hashing || off+int64(len(p)) <= h.next-int64(h.size) {
+		return h.WriterAt.WriteAt(p, off)
+	}
+	if h.err != nil {
+		return 0, h.err
+	}
+	if off != h.next {
+		h.err = xerrors.Errorf("write of %d bytes at offset %d out of sequence with the payload ending at %d", len(p), off, h.next)
+		return 0, h.err
+	}
+
+	n, err := h.WriterAt.WriteAt(p, off)
+	if _, hashErr := h.cp.Write(p[:n]); hashErr != nil && err == nil {
+		err = hashErr
+	}
+	h.next += int64(n)
+	h.size += uint64(n)
+	if err != nil {
+		h.err = err
+	}
+	return n, err
+}
+
+// stop ends the payload before Finalize() writes anything past it.
+func (h *hashingWriterAt) stop() (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hashing = false
+	return h.size, h.err
+}
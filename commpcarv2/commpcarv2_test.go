@@ -0,0 +1,81 @@
+package commpcarv2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.car")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var blocks [][]byte
+	var cids []cid.Cid
+	for i := 0; i < 100; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, 100+i*37)
+		mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, data)
+		cids = append(cids, cid.NewCidV1(cid.Raw, mh))
+	}
+
+	w, err := NewWriter(f, cids[:1], carv2.UseDataPadding(13))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range blocks {
+		if err := w.Put(ctx, cids[i].KeyString(), blocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := w.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hash the CARv1 payload of the finished CARv2 in a second pass
+	r, err := carv2.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	dr, err := r.DataReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := new(commp.Calc)
+	n, err := io.Copy(cp, dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expCommP, expSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res.CommP, expCommP) || res.PaddedPieceSize != expSize || res.PayloadSize != uint64(n) {
+		t.Fatalf("got %X/%d of %d bytes, expected %X/%d of %d bytes", res.CommP, res.PaddedPieceSize, res.PayloadSize, expCommP, expSize, n)
+	}
+	if res.PayloadSize != r.Header.DataSize {
+		t.Fatalf("payload of %d bytes, expected %d", res.PayloadSize, r.Header.DataSize)
+	}
+	if res.PieceCID.Prefix().Codec != 0xf101 {
+		t.Fatalf("unexpected piece CID %s", res.PieceCID)
+	}
+}
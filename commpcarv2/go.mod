@@ -0,0 +1,13 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commpcarv2
+
+go 1.20
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/ipfs/go-cid v0.4.1
+	github.com/ipld/go-car/v2 v2.13.1
+	github.com/multiformats/go-multihash v0.2.3
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+)
+
+replace github.com/filecoin-project/go-fil-commp-hashhash => ../
@@ -0,0 +1,97 @@
+package commpd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"golang.org/x/xerrors"
+)
+
+// Client submits jobs to a Server. Like a commp.Calc it hashes everything
+// Write()n between Open() and Digest(). A Client is not safe for concurrent
+// use: open one per concurrent job.
+type Client struct {
+	conn io.ReadWriteCloser
+	w    *bufio.Writer
+	r    *bufio.Reader
+}
+
+// Dial connects to a Server listening on a unix socket.
+func Dial(socketPath string) (*Client, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client talking to a Server over conn, which may be any
+// stream connection, e.g. a libp2p stream.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{
+		conn: conn,
+		w:    bufio.NewWriterSize(conn, 1<<20),
+		r:    bufio.NewReader(conn),
+	}
+}
+
+// Open starts a job.
+func (c *Client) Open() error {
+	return writeFrame(c.w, OpOpen, nil)
+}
+
+// Write adds p to the payload of the job. Payload size errors are only
+// reported by Digest().
+func (c *Client) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxFrameSize {
+			chunk = chunk[:MaxFrameSize]
+		}
+		if err := writeFrame(c.w, OpAppend, chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Digest completes the job, returning the raw commP and the padded piece size
+// of its payload.
+func (c *Client) Digest() (commP []byte, paddedPieceSize uint64, err error) {
+	if err := writeFrame(c.w, OpDigest, nil); err != nil {
+		return nil, 0, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, 0, err
+	}
+
+	op, payload, err := readFrame(c.r, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case op == OpError:
+		return nil, 0, xerrors.Errorf("commpd: %s", payload)
+	case op != OpResult || len(payload) != resultSize:
+		return nil, 0, xerrors.Errorf("unexpected response op 0x%02X with %d bytes", op, len(payload))
+	}
+	return payload[:32], binary.BigEndian.Uint64(payload[32:]), nil
+}
+
+// Abort discards the job.
+func (c *Client) Abort() error {
+	if err := writeFrame(c.w, OpAbort, nil); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// Close closes the connection, discarding the job in progress if any.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
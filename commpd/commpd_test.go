@@ -0,0 +1,82 @@
+package commpd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+func TestDaemon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "commpd.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go NewServer(2).Serve(l)
+
+	c, err := Dial(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{127, 1 << 20, MaxFrameSize + 1000} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		expCommP, expSize, err := commp.Sum(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// an aborted job does not affect the next one
+		c.Open()
+		c.Write(payload[:100])
+		if err := c.Abort(); err != nil {
+			t.Fatal(err)
+		}
+
+		c.Open()
+		c.Write(payload[:size/2])
+		c.Write(payload[size/2:])
+		commP, paddedSize, err := c.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("job of %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+		}
+	}
+
+	// a failed job leaves the connection usable
+	c.Open()
+	c.Write(make([]byte, 64))
+	if _, _, err := c.Digest(); err == nil || !strings.Contains(err.Error(), "insufficient state") {
+		t.Fatalf("unexpected error for a short payload: %v", err)
+	}
+	c.Open()
+	c.Write(make([]byte, 65))
+	if _, _, err := c.Digest(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a protocol violation closes the connection
+	c.Write(make([]byte, 65))
+	if _, _, err := c.Digest(); err == nil || !strings.Contains(err.Error(), "without an open job") {
+		t.Fatalf("unexpected error for a job never opened: %v", err)
+	}
+}
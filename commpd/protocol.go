@@ -0,0 +1,80 @@
+// Package commpd implements a long-running commP hasher, serving jobs over a
+// stream connection, typically a unix socket, so that shell-level pipelines
+// can stream payloads to a persistent process instead of starting one per
+// file. Calc objects and their buffers are reused across jobs.
+//
+// The protocol consists of frames of a single op byte, followed by the
+// big-endian uint32 length of the frame payload, followed by the payload. A
+// connection processes one job at a time, with the client sending:
+//
+//	OPEN    (0x01)  empty          starts a job
+//	APPEND  (0x02)  payload bytes  adds to the payload of the job
+//	DIGEST  (0x03)  empty          completes the job
+//	ABORT   (0x04)  empty          discards the job
+//
+// Only DIGEST is answered by the server, either with:
+//
+//	RESULT  (0x81)  32 bytes of raw commP, the big-endian uint64 padded piece
+//	                size and the big-endian uint64 payload size
+//	ERROR   (0xFF)  the error message, e.g. for a payload out of bounds
+//
+// after which the connection is ready for the next OPEN. A protocol violation
+// is answered with ERROR, and the connection is closed.
+package commpd
+
+import (
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+// Frame op codes.
+const (
+	OpOpen   = byte(0x01)
+	OpAppend = byte(0x02)
+	OpDigest = byte(0x03)
+	OpAbort  = byte(0x04)
+	OpResult = byte(0x81)
+	OpError  = byte(0xFF)
+)
+
+// MaxFrameSize is the largest frame payload accepted by either side.
+const MaxFrameSize = 1 << 24
+
+// resultSize is the size of the payload of a RESULT frame.
+const resultSize = 32 + 8 + 8
+
+func writeFrame(w io.Writer, op byte, payload []byte) error {
+	var hdr [5]byte
+	hdr[0] = op
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads the next frame, reusing buf for its payload if large enough.
+func readFrame(r io.Reader, buf []byte) (op byte, payload []byte, err error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > MaxFrameSize {
+		return 0, nil, xerrors.Errorf("frame of %d bytes exceeds the maximum of %d", size, MaxFrameSize)
+	}
+	if uint32(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	payload = buf[:size]
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
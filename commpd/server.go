@@ -0,0 +1,161 @@
+package commpd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// Server hashes the jobs of any amount of connections.
+type Server struct {
+	calcs sync.Pool
+	slots chan struct{}
+}
+
+// NewServer returns a Server hashing up to maxJobs jobs concurrently, with an
+// OPEN over the limit waiting for a job to complete. A maxJobs of 0 means no
+// limit. The supplied options apply to every Calc, which additionally share a
+// single commp.Scratch.
+func NewServer(maxJobs int, opts ...commp.Option) *Server {
+	scratch := new(commp.Scratch)
+	opts = append([]commp.Option{commp.WithScratch(scratch)}, opts...)
+
+	s := &Server{
+		calcs: sync.Pool{New: func() interface{} { return commp.New(opts...) }},
+	}
+	if maxJobs > 0 {
+		s.slots = make(chan struct{}, maxJobs)
+	}
+	return s
+}
+
+// Serve accepts connections on l, serving each in its own goroutine, until
+// l fails, e.g. when it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection, or any other stream such as a libp2p
+// one, until the client closes it, closing it in turn.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	c := &serverConn{
+		s: s,
+		r: bufio.NewReaderSize(conn, 1<<20),
+		w: conn,
+	}
+	defer c.end()
+
+	if err := c.serve(); err != nil && err != io.EOF {
+		writeFrame(conn, OpError, []byte(err.Error()))
+	}
+}
+
+type serverConn struct {
+	s *Server
+	r *bufio.Reader
+	w io.Writer
+
+	cp      *commp.Calc // of the job in progress, if any
+	n       uint64
+	failure error // the first APPEND failure of the job
+}
+
+func (c *serverConn) serve() error {
+	var buf []byte
+	for {
+		op, payload, err := readFrame(c.r, buf)
+		if err != nil {
+			return err
+		}
+		if cap(payload) > cap(buf) {
+			buf = payload
+		}
+
+		if op != OpOpen && c.cp == nil {
+			return xerrors.Errorf("op 0x%02X without an open job", op)
+		}
+
+		switch op {
+		case OpOpen:
+			if c.cp != nil {
+				return xerrors.New("OPEN while a job is open")
+			}
+			c.start()
+
+		case OpAppend:
+			if c.failure == nil {
+				if _, err := c.cp.Write(payload); err != nil {
+					c.failure = err
+				}
+				c.n += uint64(len(payload))
+			}
+
+		case OpDigest:
+			if err := c.digest(); err != nil {
+				return err
+			}
+
+		case OpAbort:
+			c.end()
+
+		default:
+			return xerrors.Errorf("unknown op 0x%02X", op)
+		}
+	}
+}
+
+func (c *serverConn) start() {
+	if c.s.slots != nil {
+		c.s.slots <- struct{}{}
+	}
+	c.cp = c.s.calcs.Get().(*commp.Calc)
+	c.n = 0
+	c.failure = nil
+}
+
+// end returns the Calc of the job in progress, if any, to the pool.
+func (c *serverConn) end() {
+	if c.cp == nil {
+		return
+	}
+	c.cp.Reset()
+	c.s.calcs.Put(c.cp)
+	c.cp = nil
+	if c.s.slots != nil {
+		<-c.s.slots
+	}
+}
+
+func (c *serverConn) digest() error {
+	err := c.failure
+	var rawCommP []byte
+	var paddedSize uint64
+	if err == nil {
+		rawCommP, paddedSize, err = c.cp.Digest()
+	}
+	n := c.n
+	c.end()
+
+	if err != nil {
+		return writeFrame(c.w, OpError, []byte(err.Error()))
+	}
+
+	res := make([]byte, resultSize)
+	copy(res, rawCommP)
+	binary.BigEndian.PutUint64(res[32:], paddedSize)
+	binary.BigEndian.PutUint64(res[40:], n)
+	return writeFrame(c.w, OpResult, res)
+}
@@ -0,0 +1,79 @@
+// Package commpdag computes the piece of a DAG which already lives in a
+// blockstore: the DAG is serialized as a CARv1 stream, which is hashed as it
+// is produced, without the CAR ever being materialized unless requested.
+//
+// The CAR is serialized deterministically, by a depth-first traversal of the
+// DAG from its root, skipping blocks already written, so that the same DAG
+// always results in the same piece.
+package commpdag
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	car "github.com/ipld/go-car"
+)
+
+// Result describes the piece of a DAG.
+type Result struct {
+	Root            cid.Cid // of the DAG, the payload CID
+	PieceCID        cid.Cid
+	CommP           []byte // raw 32 bytes
+	PaddedPieceSize uint64
+	PayloadSize     uint64 // size of the CAR
+}
+
+// HashDAG walks the DAG rooted at root, fetching its nodes via ng, typically
+// an ipld.DAGService, and returns the piece of its CARv1. The CAR is also
+// written to w, unless w is nil. The supplied options apply to the commp.Calc
+// hashing the CAR.
+func HashDAG(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, w io.Writer, opts ...commp.Option) (*Result, error) {
+	return hashCar(root, w, opts, func(cw io.Writer) error {
+		return car.WriteCar(ctx, ng, []cid.Cid{root}, cw)
+	})
+}
+
+// hashCar hashes the CAR produced by writeCar.
+func hashCar(root cid.Cid, w io.Writer, opts []commp.Option, writeCar func(io.Writer) error) (*Result, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	cp := commp.New(opts...)
+	defer cp.Reset()
+
+	cw := &countingWriter{w: io.MultiWriter(w, cp)}
+	if err := writeCar(cw); err != nil {
+		return nil, err
+	}
+
+	rawCommP, paddedSize, err := cp.Digest()
+	if err != nil {
+		return nil, err
+	}
+	pieceCID, err := cid.Cast(append([]byte{0x01, 0x81, 0xE2, 0x03, 0x92, 0x20, 0x20}, rawCommP...))
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Root:            root,
+		PieceCID:        pieceCID,
+		CommP:           rawCommP,
+		PaddedPieceSize: paddedSize,
+		PayloadSize:     cw.n,
+	}, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
@@ -0,0 +1,67 @@
+package commpdag
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpcar"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+func TestHashDAG(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	// a root linking twice to a shared subtree of three leaves
+	var leaves []ipld.Node
+	for i := 0; i < 3; i++ {
+		leaves = append(leaves, merkledag.NodeWithData(bytes.Repeat([]byte{byte(i)}, 1000)))
+	}
+	sub := merkledag.NodeWithData([]byte("sub"))
+	for i, l := range leaves {
+		if err := sub.AddNodeLink(string(rune('a'+i)), l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := merkledag.NodeWithData([]byte("root"))
+	root.AddNodeLink("x", sub)
+	root.AddNodeLink("y", sub)
+	if err := ds.AddMany(ctx, append(leaves, sub, root)); err != nil {
+		t.Fatal(err)
+	}
+
+	var car bytes.Buffer
+	res, err := HashDAG(ctx, ds, root.Cid(), &car)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := commpcar.Sum(bytes.NewReader(car.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.CommP, exp.CommP) || res.PaddedPieceSize != exp.PaddedPieceSize || res.PayloadSize != exp.PayloadSize {
+		t.Fatalf("got %X/%d of %d bytes, expected %X/%d of %d bytes", res.CommP, res.PaddedPieceSize, res.PayloadSize, exp.CommP, exp.PaddedPieceSize, exp.PayloadSize)
+	}
+	if len(exp.Roots) != 1 || !bytes.Equal(exp.Roots[0], root.Cid().Bytes()) || exp.Blocks != 5 {
+		t.Fatalf("CAR of %d blocks rooted at %X", exp.Blocks, exp.Roots)
+	}
+
+	// without materializing the CAR
+	again, err := HashDAG(ctx, ds, root.Cid(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.PieceCID.Equals(res.PieceCID) {
+		t.Fatalf("second pass resulted in %s instead of %s", again.PieceCID, res.PieceCID)
+	}
+
+	if err := ds.Remove(ctx, leaves[1].Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HashDAG(ctx, ds, root.Cid(), nil); err == nil {
+		t.Fatal("unexpected success hashing a DAG with a missing block")
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commpdag
+
+go 1.21
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/ipfs/boxo v0.21.0
+	github.com/ipfs/go-block-format v0.2.0
+	github.com/ipfs/go-cid v0.4.1
+	github.com/ipfs/go-ipld-format v0.6.0
+	github.com/ipld/go-car v0.6.2
+	github.com/ipld/go-ipld-prime v0.21.0
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+)
+
+replace github.com/filecoin-project/go-fil-commp-hashhash => ../
@@ -0,0 +1,23 @@
+package commpdag
+
+import (
+	"context"
+	"io"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// HashSelector is HashDAG limited to the blocks visited by a traversal of the
+// DAG with the given go-ipld-prime selector, loaded from bs, typically a
+// blockstore. The CAR holds every block loaded by the traversal, in the order
+// loaded, e.g. only a subset of the shards of a sharded directory, and its
+// root is still root.
+func HashSelector(ctx context.Context, bs car.ReadStore, root cid.Cid, selector datamodel.Node, w io.Writer, opts ...commp.Option) (*Result, error) {
+	sc := car.NewSelectiveCar(ctx, bs, []car.Dag{{Root: root, Selector: selector}}, car.TraverseLinksOnlyOnce())
+	return hashCar(root, w, opts, func(cw io.Writer) error {
+		return sc.Write(cw)
+	})
+}
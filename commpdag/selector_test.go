@@ -0,0 +1,85 @@
+package commpdag
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpcar"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"golang.org/x/xerrors"
+)
+
+type mapStore map[cid.Cid]blocks.Block
+
+func (ms mapStore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	if b, ok := ms[c]; ok {
+		return b, nil
+	}
+	return nil, xerrors.Errorf("block %s not found", c)
+}
+
+func TestHashSelector(t *testing.T) {
+	ctx := context.Background()
+	bs := make(mapStore)
+	node := func(data string, children ...*merkledag.ProtoNode) *merkledag.ProtoNode {
+		n := merkledag.NodeWithData([]byte(data))
+		// dag-pb links are sorted by name
+		for i, c := range children {
+			if err := n.AddNodeLink(strconv.Itoa(i), c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bs[n.Cid()] = n
+		return n
+	}
+
+	// root -> a -> a1, a2
+	//      -> b -> b1
+	a := node("a", node("a1"), node("a2"))
+	b := node("b", node("b1"))
+	root := node("root", a, b)
+
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	firstLink := ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+		efsb.Insert("Links", ssb.ExploreIndex(0, ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+			efsb.Insert("Hash", ssb.ExploreRecursive(selector.RecursionLimitNone(), ssb.ExploreAll(ssb.ExploreRecursiveEdge())))
+		})))
+	}).Node()
+
+	for _, tc := range []struct {
+		name   string
+		blocks uint64
+	}{
+		{"all", 6},
+		{"first link", 4},
+	} {
+		sel := selectorparse.CommonSelector_ExploreAllRecursively
+		if tc.name == "first link" {
+			sel = firstLink
+		}
+
+		var car bytes.Buffer
+		res, err := HashSelector(ctx, bs, root.Cid(), sel, &car)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := commpcar.Sum(bytes.NewReader(car.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(res.CommP, exp.CommP) || res.PayloadSize != exp.PayloadSize {
+			t.Fatalf("%s: got %X of %d bytes, expected %X of %d bytes", tc.name, res.CommP, res.PayloadSize, exp.CommP, exp.PayloadSize)
+		}
+		if exp.Blocks != tc.blocks || !res.Root.Equals(root.Cid()) {
+			t.Fatalf("%s: CAR of %d blocks instead of %d", tc.name, exp.Blocks, tc.blocks)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package commpdatasegment converts the index entries and inclusion proofs of
+// the datasegment package to and from the structures of go-data-segment, so
+// that aggregates built by either library can be indexed, proven and verified
+// by the other. It lives in a separate module so that users of the commp
+// package are not forced to depend on go-data-segment.
+//
+// Both libraries express offsets and sizes in padded bytes, and serialize
+// index entries identically, as specified by FRC-0058.
+package commpdatasegment
+
+import (
+	"github.com/filecoin-project/go-data-segment/datasegment"
+	"github.com/filecoin-project/go-data-segment/merkletree"
+	commpds "github.com/filecoin-project/go-fil-commp-hashhash/datasegment"
+	"golang.org/x/xerrors"
+)
+
+// ToSegmentDesc converts an index entry to a go-data-segment SegmentDesc.
+func ToSegmentDesc(sd commpds.SegmentDesc) datasegment.SegmentDesc {
+	var out datasegment.SegmentDesc
+	copy(out.CommDs[:], sd.CommDs[:])
+	out.Offset = sd.Offset
+	out.Size = sd.Size
+	copy(out.Checksum[:], sd.Checksum[:])
+	return out
+}
+
+// FromSegmentDesc converts a go-data-segment SegmentDesc to an index entry,
+// validating its checksum.
+func FromSegmentDesc(sd datasegment.SegmentDesc) (commpds.SegmentDesc, error) {
+	var out commpds.SegmentDesc
+	copy(out.CommDs[:], sd.CommDs[:])
+	out.Offset = sd.Offset
+	out.Size = sd.Size
+	copy(out.Checksum[:], sd.Checksum[:])
+	if err := out.Validate(); err != nil {
+		return commpds.SegmentDesc{}, err
+	}
+	return out, nil
+}
+
+// ToIndexData converts the index entries of an aggregate, as returned by
+// Builder.Finish() or NewIndex(), to a go-data-segment IndexData.
+func ToIndexData(index []commpds.SegmentDesc) *datasegment.IndexData {
+	out := &datasegment.IndexData{Entries: make([]datasegment.SegmentDesc, len(index))}
+	for i, sd := range index {
+		out.Entries[i] = ToSegmentDesc(sd)
+	}
+	return out
+}
+
+// FromIndexData converts a go-data-segment IndexData to index entries,
+// validating the checksum of every entry.
+func FromIndexData(idx *datasegment.IndexData) ([]commpds.SegmentDesc, error) {
+	out := make([]commpds.SegmentDesc, len(idx.Entries))
+	for i, sd := range idx.Entries {
+		var err error
+		if out[i], err = FromSegmentDesc(sd); err != nil {
+			return nil, xerrors.Errorf("index entry %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
+
+// ToProofData converts a Merkle path to a go-data-segment ProofData.
+func ToProofData(pd commpds.ProofData) merkletree.ProofData {
+	out := merkletree.ProofData{
+		Path:  make([]merkletree.Node, len(pd.Path)),
+		Index: pd.Index,
+	}
+	for i, n := range pd.Path {
+		copy(out.Path[i][:], n)
+	}
+	return out
+}
+
+// FromProofData converts a go-data-segment ProofData to a Merkle path.
+func FromProofData(pd merkletree.ProofData) commpds.ProofData {
+	out := commpds.ProofData{
+		Path:  make([][]byte, len(pd.Path)),
+		Index: pd.Index,
+	}
+	for i := range pd.Path {
+		out.Path[i] = append(make([]byte, 0, 32), pd.Path[i][:]...)
+	}
+	return out
+}
+
+// ToInclusionProof converts an inclusion proof, as returned by
+// ComputeInclusionProof(), to a go-data-segment InclusionProof.
+func ToInclusionProof(ip *commpds.InclusionProof) *datasegment.InclusionProof {
+	return &datasegment.InclusionProof{
+		ProofSubtree: ToProofData(ip.ProofSubtree),
+		ProofIndex:   ToProofData(ip.ProofIndex),
+	}
+}
+
+// FromInclusionProof converts a go-data-segment InclusionProof to an inclusion
+// proof, to be checked with its Verify().
+func FromInclusionProof(ip *datasegment.InclusionProof) *commpds.InclusionProof {
+	return &commpds.InclusionProof{
+		ProofSubtree: FromProofData(ip.ProofSubtree),
+		ProofIndex:   FromProofData(ip.ProofIndex),
+	}
+}
@@ -0,0 +1,63 @@
+package commpdatasegment
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	commpds "github.com/filecoin-project/go-fil-commp-hashhash/datasegment"
+)
+
+func TestRoundTrip(t *testing.T) {
+	const dealSize = 1 << 20
+
+	rnd := rand.New(rand.NewSource(1))
+	b, err := commpds.NewBuilder(dealSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{65, 127 * 100, 3000, 200000} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		if _, err := b.AddPiece(bytes.NewReader(payload), uint64(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aggCommP, index, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := ToIndexData(index)
+	for i, sd := range idx.Entries {
+		// the checksums agree
+		if err := sd.Validate(); err != nil {
+			t.Fatalf("entry %d: %s", i, err)
+		}
+	}
+	back, err := FromIndexData(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range index {
+		if back[i] != index[i] {
+			t.Fatalf("entry %d changed in the round trip: %+v", i, back[i])
+		}
+	}
+
+	for i, sd := range index {
+		proof, err := commpds.ComputeInclusionProof(dealSize, index, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := FromInclusionProof(ToInclusionProof(proof)).Verify(aggCommP, dealSize, sd); err != nil {
+			t.Fatalf("entry %d: %s", i, err)
+		}
+	}
+
+	corrupt := ToSegmentDesc(index[0])
+	corrupt.Offset++
+	if _, err := FromSegmentDesc(corrupt); err == nil {
+		t.Fatal("unexpected success converting an entry with a mismatched checksum")
+	}
+}
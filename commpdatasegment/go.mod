@@ -0,0 +1,11 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commpdatasegment
+
+go 1.20
+
+require (
+	github.com/filecoin-project/go-data-segment v0.0.1
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+)
+
+replace github.com/filecoin-project/go-fil-commp-hashhash => ../
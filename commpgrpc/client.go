@@ -0,0 +1,272 @@
+package commpgrpc
+
+import (
+	"context"
+	"io"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultWindowSize is the amount of payload sent per Write stream, unless
+// overridden by WithWindowSize.
+const DefaultWindowSize = 16 << 20
+
+// DefaultRetries is the amount of consecutive failures after which a Client
+// gives up on a Write stream, unless overridden by WithRetries.
+const DefaultRetries = 5
+
+// DefaultRetryWait is the wait after the first failure of a Write stream,
+// unless overridden by WithRetries.
+const DefaultRetryWait = time.Second
+
+// chunkSize is the size of the Chunk messages sent by a Client, well within
+// the default 4MiB message limit of gRPC servers.
+const chunkSize = 1 << 20
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithWindowSize sets the amount of payload sent per Write stream. A Client
+// holds on to this much of the payload until the server accepts it, so that
+// it can be sent again after a failure.
+func WithWindowSize(n int) ClientOption {
+	return func(c *Client) {
+		if n > 0 {
+			c.window = n
+		}
+	}
+}
+
+// WithRetries sets the amount of consecutive failures after which a Client
+// gives up, waiting firstWait after the first failure and doubling the wait
+// after every subsequent one. Only unavailable servers and busy sessions are
+// retried.
+func WithRetries(n int, firstWait time.Duration) ClientOption {
+	return func(c *Client) {
+		c.retries = n
+		c.wait = firstWait
+	}
+}
+
+// Client computes commP on a remote Server, as a commp.Digester: a drop-in
+// replacement for a local commp.Calc. A session is opened by the first
+// Write(), and payload is sent in windows, each of which is retried from the
+// offset accepted by the server when its stream fails. A Client is not safe
+// for concurrent use.
+type Client struct {
+	ctx     context.Context
+	c       CommPClient
+	window  int
+	retries int
+	wait    time.Duration
+
+	token string
+	base  uint64 // payload offset of buf, accepted by the server
+	buf   []byte // written but not yet known to be accepted
+}
+
+var _ commp.Digester = &Client{}
+
+// NewClient returns a Client hashing via the server at the other end of cc.
+// The supplied ctx applies to all of its calls.
+func NewClient(ctx context.Context, cc grpc.ClientConnInterface, opts ...ClientOption) *Client {
+	c := &Client{
+		ctx:     ctx,
+		c:       NewCommPClient(cc),
+		window:  DefaultWindowSize,
+		retries: DefaultRetries,
+		wait:    DefaultRetryWait,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Write adds p to the payload, sending it to the server whenever a window is
+// complete. Payload size errors are reported by the server, possibly only by
+// a later Write() or Digest().
+func (c *Client) Write(p []byte) (int, error) {
+	if c.token == "" {
+		s, err := c.c.Open(c.ctx, &OpenRequest{})
+		if err != nil {
+			return 0, err
+		}
+		c.token = s.SessionToken
+	}
+	if c.buf == nil {
+		c.buf = make([]byte, 0, c.window)
+	}
+
+	var n int
+	for len(p) > 0 {
+		room := c.window - len(c.buf)
+		if room == 0 {
+			if _, err := c.flush(false); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if room > len(p) {
+			room = len(p)
+		}
+		c.buf = append(c.buf, p[:room]...)
+		p = p[room:]
+		n += room
+	}
+	return n, nil
+}
+
+// Digest sends the rest of the payload and completes the session, returning
+// the raw commP and the padded piece size. As with a commp.Calc, a successful
+// Digest() resets the Client for the next payload, while after a failure the
+// payload may still be extended.
+func (c *Client) Digest() (commP []byte, paddedPieceSize uint64, err error) {
+	if c.token == "" {
+		// nothing written: let the server report the empty payload
+		if _, err := c.Write(nil); err != nil {
+			return nil, 0, err
+		}
+	}
+	d, err := c.flush(true)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.clear()
+	return d.CommP, d.PaddedPieceSize, nil
+}
+
+// Reset discards the session in progress, if any.
+func (c *Client) Reset() {
+	if c.token != "" {
+		c.c.Abort(c.ctx, &SessionRequest{SessionToken: c.token})
+	}
+	c.clear()
+}
+
+// Checkpoint returns the token of the session in progress, and the amount of
+// payload accepted by the server. Persisting both allows a restarted process
+// to Resume() the session, for as long as the server keeps it.
+func (c *Client) Checkpoint() (sessionToken string, offset uint64) {
+	return c.token, c.base
+}
+
+// Resume discards the session in progress, if any, and continues the session
+// with the given token instead. It returns the offset the caller must resume
+// writing the payload from.
+func (c *Client) Resume(sessionToken string) (offset uint64, err error) {
+	s, err := c.c.Status(c.ctx, &SessionRequest{SessionToken: sessionToken})
+	if err != nil {
+		return 0, err
+	}
+	if c.token != s.SessionToken {
+		c.Reset()
+	}
+	c.clear()
+	c.token = s.SessionToken
+	c.base = s.Offset
+	return c.base, nil
+}
+
+func (c *Client) clear() {
+	c.token = ""
+	c.base = 0
+	c.buf = c.buf[:0]
+}
+
+// flush sends the buffered payload, retrying from the offset reported by
+// Status after a failure.
+func (c *Client) flush(finish bool) (*Digest, error) {
+	wait := c.wait
+	for attempt := 0; ; attempt++ {
+		if len(c.buf) == 0 && !finish {
+			return nil, nil
+		}
+
+		resp, err := c.send(finish)
+		if err == nil {
+			if err := c.advance(resp.GetSession().GetOffset()); err != nil {
+				return nil, err
+			}
+			if finish && resp.Digest == nil {
+				return nil, xerrors.Errorf("session %s finished without a digest", c.token)
+			}
+			return resp.Digest, nil
+		}
+		if attempt >= c.retries || !retryable(err) {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		}
+		wait *= 2
+
+		// a failed Status is retried along with the next stream
+		if s, err := c.c.Status(c.ctx, &SessionRequest{SessionToken: c.token}); err == nil {
+			if err := c.advance(s.Offset); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// send streams the buffered payload within a single Write stream.
+func (c *Client) send(finish bool) (*WriteResponse, error) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	stream, err := c.c.Write(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := c.buf
+	offset := c.base
+	for first := true; first || len(data) > 0; first = false {
+		chunk := &Chunk{Offset: offset, Data: data}
+		if len(data) > chunkSize {
+			chunk.Data = data[:chunkSize]
+		}
+		if first {
+			chunk.SessionToken = c.token
+		}
+		data = data[len(chunk.Data):]
+		offset += uint64(len(chunk.Data))
+		chunk.Finish = finish && len(data) == 0
+
+		if err := stream.Send(chunk); err == io.EOF {
+			// the server ended the stream, its status is returned below
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// advance drops the part of the buffered payload accepted by the server.
+func (c *Client) advance(offset uint64) error {
+	if offset < c.base || offset > c.base+uint64(len(c.buf)) {
+		return xerrors.Errorf("session %s at offset %d, outside of the %d bytes sent from offset %d", c.token, offset, len(c.buf), c.base)
+	}
+	c.buf = c.buf[:copy(c.buf, c.buf[offset-c.base:])]
+	c.base = offset
+	return nil
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package commpgrpc
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// flakyStream breaks off after receiving a given amount of chunks.
+type flakyStream struct {
+	grpc.ServerStream
+	left int
+}
+
+func (s *flakyStream) RecvMsg(m interface{}) error {
+	if s.left == 0 {
+		return status.Error(codes.Unavailable, "connection lost")
+	}
+	s.left--
+	return s.ServerStream.RecvMsg(m)
+}
+
+func TestClient(t *testing.T) {
+	payload := make([]byte, 5<<20+17)
+	rand.New(rand.NewSource(1)).Read(payload)
+	expCommP, expSize, err := commp.Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// break the first two Write streams after two chunks each
+	var breaks int32 = 2
+	flaky := grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if atomic.AddInt32(&breaks, -1) >= 0 {
+			ss = &flakyStream{ServerStream: ss, left: 2}
+		}
+		return handler(srv, ss)
+	})
+
+	ctx := context.Background()
+	c := NewClient(ctx, dialConn(t, []grpc.ServerOption{flaky}),
+		WithWindowSize(3<<20),
+		WithRetries(2, time.Millisecond),
+	)
+
+	var d commp.Digester = c
+	for i := 0; i < 2; i++ {
+		if _, err := d.Write(payload[:1000]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Write(payload[1000:]); err != nil {
+			t.Fatal(err)
+		}
+		gotCommP, gotSize, err := d.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotCommP, expCommP[:]) || gotSize != expSize {
+			t.Fatalf("run %d: got %X/%d, expected %X/%d", i, gotCommP, gotSize, expCommP, expSize)
+		}
+	}
+
+	if _, _, err := d.Digest(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unexpected error digesting an empty payload: %v", err)
+	}
+	d.Reset()
+}
+
+func TestClientResume(t *testing.T) {
+	payload := make([]byte, 3<<20+17)
+	rand.New(rand.NewSource(2)).Read(payload)
+	expCommP, expSize, err := commp.Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	conn := dialConn(t, nil)
+
+	// the first client sends two windows before going away
+	c := NewClient(ctx, conn, WithWindowSize(1<<20))
+	if _, err := c.Write(payload[:2<<20+5]); err != nil {
+		t.Fatal(err)
+	}
+	token, offset := c.Checkpoint()
+	if token == "" || offset != 2<<20 {
+		t.Fatalf("unexpected checkpoint %q at %d", token, offset)
+	}
+
+	c = NewClient(ctx, conn)
+	resumed, err := c.Resume(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed != offset {
+		t.Fatalf("resumed at %d instead of %d", resumed, offset)
+	}
+	if _, err := c.Write(payload[resumed:]); err != nil {
+		t.Fatal(err)
+	}
+	gotCommP, gotSize, err := c.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotCommP, expCommP[:]) || gotSize != expSize {
+		t.Fatalf("got %X/%d, expected %X/%d", gotCommP, gotSize, expCommP, expSize)
+	}
+
+	if _, err := c.Resume(token); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error resuming a completed session: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: commp.proto
+
+package commpgrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CommP_Open_FullMethodName   = "/filecoin.commp.v1.CommP/Open"
+	CommP_Status_FullMethodName = "/filecoin.commp.v1.CommP/Status"
+	CommP_Write_FullMethodName  = "/filecoin.commp.v1.CommP/Write"
+	CommP_Abort_FullMethodName  = "/filecoin.commp.v1.CommP/Abort"
+)
+
+// CommPClient is the client API for CommP service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CommP computes the piece commitment of a payload streamed over the
+// network. A payload is hashed within a session, which survives broken
+// streams: the client resumes it by opening a new Write stream at the offset
+// reported by Status.
+type CommPClient interface {
+	// Open starts a new hashing session.
+	Open(ctx context.Context, in *OpenRequest, opts ...grpc.CallOption) (*Session, error)
+	// Status reports how much payload a session has accepted so far. A client
+	// whose Write stream broke off uses it to find the offset to resume from.
+	Status(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*Session, error)
+	// Write streams payload into a session. The first chunk of every stream
+	// must carry the session token, later chunks may omit it. Chunks must be
+	// contiguous: a chunk starting before the accepted offset has its overlap
+	// skipped, a chunk starting past it is rejected with OUT_OF_RANGE.
+	//
+	// A stream ending with a chunk with finish set completes the session and
+	// returns its Digest. Any other stream end leaves the session open for
+	// another Write, and returns just the Session.
+	Write(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Chunk, WriteResponse], error)
+	// Abort discards a session.
+	Abort(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*Session, error)
+}
+
+type commPClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCommPClient(cc grpc.ClientConnInterface) CommPClient {
+	return &commPClient{cc}
+}
+
+func (c *commPClient) Open(ctx context.Context, in *OpenRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, CommP_Open_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *commPClient) Status(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, CommP_Status_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *commPClient) Write(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Chunk, WriteResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CommP_ServiceDesc.Streams[0], CommP_Write_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Chunk, WriteResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CommP_WriteClient = grpc.ClientStreamingClient[Chunk, WriteResponse]
+
+func (c *commPClient) Abort(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, CommP_Abort_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CommPServer is the server API for CommP service.
+// All implementations must embed UnimplementedCommPServer
+// for forward compatibility.
+//
+// CommP computes the piece commitment of a payload streamed over the
+// network. A payload is hashed within a session, which survives broken
+// streams: the client resumes it by opening a new Write stream at the offset
+// reported by Status.
+type CommPServer interface {
+	// Open starts a new hashing session.
+	Open(context.Context, *OpenRequest) (*Session, error)
+	// Status reports how much payload a session has accepted so far. A client
+	// whose Write stream broke off uses it to find the offset to resume from.
+	Status(context.Context, *SessionRequest) (*Session, error)
+	// Write streams payload into a session. The first chunk of every stream
+	// must carry the session token, later chunks may omit it. Chunks must be
+	// contiguous: a chunk starting before the accepted offset has its overlap
+	// skipped, a chunk starting past it is rejected with OUT_OF_RANGE.
+	//
+	// A stream ending with a chunk with finish set completes the session and
+	// returns its Digest. Any other stream end leaves the session open for
+	// another Write, and returns just the Session.
+	Write(grpc.ClientStreamingServer[Chunk, WriteResponse]) error
+	// Abort discards a session.
+	Abort(context.Context, *SessionRequest) (*Session, error)
+	mustEmbedUnimplementedCommPServer()
+}
+
+// UnimplementedCommPServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCommPServer struct{}
+
+func (UnimplementedCommPServer) Open(context.Context, *OpenRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Open not implemented")
+}
+func (UnimplementedCommPServer) Status(context.Context, *SessionRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedCommPServer) Write(grpc.ClientStreamingServer[Chunk, WriteResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedCommPServer) Abort(context.Context, *SessionRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Abort not implemented")
+}
+func (UnimplementedCommPServer) mustEmbedUnimplementedCommPServer() {}
+func (UnimplementedCommPServer) testEmbeddedByValue()               {}
+
+// UnsafeCommPServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CommPServer will
+// result in compilation errors.
+type UnsafeCommPServer interface {
+	mustEmbedUnimplementedCommPServer()
+}
+
+func RegisterCommPServer(s grpc.ServiceRegistrar, srv CommPServer) {
+	// If the following call pancis, it indicates UnimplementedCommPServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CommP_ServiceDesc, srv)
+}
+
+func _CommP_Open_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CommPServer).Open(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CommP_Open_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CommPServer).Open(ctx, req.(*OpenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CommP_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CommPServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CommP_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CommPServer).Status(ctx, req.(*SessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CommP_Write_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CommPServer).Write(&grpc.GenericServerStream[Chunk, WriteResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CommP_WriteServer = grpc.ClientStreamingServer[Chunk, WriteResponse]
+
+func _CommP_Abort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CommPServer).Abort(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CommP_Abort_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CommPServer).Abort(ctx, req.(*SessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CommP_ServiceDesc is the grpc.ServiceDesc for CommP service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CommP_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "filecoin.commp.v1.CommP",
+	HandlerType: (*CommPServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Open",
+			Handler:    _CommP_Open_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _CommP_Status_Handler,
+		},
+		{
+			MethodName: "Abort",
+			Handler:    _CommP_Abort_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Write",
+			Handler:       _CommP_Write_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "commp.proto",
+}
@@ -0,0 +1,21 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commpgrpc
+
+go 1.21
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/klauspost/cpuid/v2 v2.0.4 // indirect
+	github.com/minio/sha256-simd v1.0.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
+
+replace github.com/filecoin-project/go-fil-commp-hashhash => ../
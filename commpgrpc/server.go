@@ -0,0 +1,297 @@
+// Package commpgrpc implements the CommP gRPC service defined in commp.proto,
+// computing the commP of payloads streamed by clients in any language:
+//
+//	s := grpc.NewServer()
+//	commpgrpc.RegisterCommPServer(s, commpgrpc.NewServer())
+//
+// Payloads are hashed within sessions which outlive individual Write streams,
+// so that an upload interrupted by a network failure is resumed from the last
+// accepted offset instead of starting over. Sessions only live in the memory
+// of the server: they do not survive a restart.
+//
+// Go programs use a Client, which forwards everything written to it to a
+// Server, resuming its session after a failure on its own:
+//
+//	var cp commp.Digester = commpgrpc.NewClient(ctx, conn)
+//	io.Copy(cp, payload)
+//	rawCommP, paddedSize, err := cp.Digest()
+package commpgrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative commp.proto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/commphttp"
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultSessionTTL is how long a session without an active Write stream is
+// kept around, unless overridden by WithSessionTTL.
+const DefaultSessionTTL = time.Hour
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSessionTTL discards sessions which saw no Write stream for longer than
+// the given duration. Streams in progress keep their session alive regardless.
+func WithSessionTTL(d time.Duration) Option {
+	return func(s *Server) {
+		if d > 0 {
+			s.ttl = d
+		}
+	}
+}
+
+// WithMaxSessions caps the amount of open sessions, each of which holds on to
+// the state of a Calc. Open fails with RESOURCE_EXHAUSTED over the cap. The
+// default of 0 means no cap.
+func WithMaxSessions(n int) Option {
+	return func(s *Server) {
+		s.maxSessions = n
+	}
+}
+
+// WithCalcOptions supplies options for the Calc of every session.
+func WithCalcOptions(opts ...commp.Option) Option {
+	return func(s *Server) {
+		s.calcOpts = opts
+	}
+}
+
+// Server implements CommPServer.
+type Server struct {
+	UnimplementedCommPServer
+
+	ttl         time.Duration
+	maxSessions int
+	calcOpts    []commp.Option
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type session struct {
+	token    string
+	cp       *commp.Calc
+	offset   uint64 // guarded by Server.mu, only modified by the stream holding the session
+	busy     bool
+	lastUsed time.Time
+}
+
+// NewServer returns a Server configured by the supplied options.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		ttl:      DefaultSessionTTL,
+		sessions: make(map[string]*session),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Open implements CommPServer.
+func (s *Server) Open(ctx context.Context, _ *OpenRequest) (*Session, error) {
+	tok := make([]byte, 16)
+	if _, err := rand.Read(tok); err != nil {
+		return nil, status.Errorf(codes.Internal, "generating session token: %s", err)
+	}
+	sess := &session{
+		token:    hex.EncodeToString(tok),
+		cp:       commp.New(s.calcOpts...),
+		lastUsed: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	if s.maxSessions > 0 && len(s.sessions) >= s.maxSessions {
+		return nil, status.Errorf(codes.ResourceExhausted, "too many open sessions")
+	}
+	s.sessions[sess.token] = sess
+
+	return &Session{SessionToken: sess.token}, nil
+}
+
+// Status implements CommPServer.
+func (s *Server) Status(ctx context.Context, req *SessionRequest) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.lookup(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{SessionToken: sess.token, Offset: sess.offset}, nil
+}
+
+// Abort implements CommPServer.
+func (s *Server) Abort(ctx context.Context, req *SessionRequest) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.lookup(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if sess.busy {
+		return nil, status.Errorf(codes.Aborted, "session %s is in use by another stream", sess.token)
+	}
+	s.remove(sess)
+	return &Session{SessionToken: sess.token, Offset: sess.offset}, nil
+}
+
+// Write implements CommPServer.
+func (s *Server) Write(stream CommP_WriteServer) error {
+	chunk, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "empty stream")
+	}
+	if err != nil {
+		return err
+	}
+
+	sess, err := s.acquire(chunk.SessionToken)
+	if err != nil {
+		return err
+	}
+	defer s.release(sess)
+
+	for {
+		if chunk.SessionToken != "" && chunk.SessionToken != sess.token {
+			return status.Errorf(codes.InvalidArgument, "chunk for session %s on a stream of session %s", chunk.SessionToken, sess.token)
+		}
+		if err := s.write(sess, chunk); err != nil {
+			return err
+		}
+
+		if chunk.Finish {
+			rawCommP, paddedSize, err := sess.cp.Digest()
+			if err != nil {
+				// leave the session open: the client may still add payload
+				return statusFor(err)
+			}
+
+			s.mu.Lock()
+			s.remove(sess)
+			s.mu.Unlock()
+
+			r := commphttp.NewResult(rawCommP, paddedSize, sess.offset)
+			return stream.SendAndClose(&WriteResponse{
+				Session: &Session{SessionToken: sess.token, Offset: sess.offset},
+				Digest: &Digest{
+					PieceCid:          r.PieceCID,
+					PieceCidV2:        r.PieceCIDv2,
+					CommP:             rawCommP,
+					PaddedPieceSize:   r.PaddedPieceSize,
+					UnpaddedPieceSize: r.UnpaddedPieceSize,
+					PayloadSize:       r.PayloadSize,
+				},
+			})
+		}
+
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&WriteResponse{
+				Session: &Session{SessionToken: sess.token, Offset: sess.offset},
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write adds the part of chunk past the accepted offset to the session.
+func (s *Server) write(sess *session, chunk *Chunk) error {
+	if chunk.Offset > sess.offset {
+		return status.Errorf(codes.OutOfRange, "chunk at offset %d leaves a gap after the %d bytes accepted so far", chunk.Offset, sess.offset)
+	}
+
+	data := chunk.Data
+	if skip := sess.offset - chunk.Offset; skip >= uint64(len(data)) {
+		return nil
+	} else if skip > 0 {
+		data = data[skip:]
+	}
+
+	if _, err := sess.cp.Write(data); err != nil {
+		return statusFor(err)
+	}
+
+	s.mu.Lock()
+	sess.offset += uint64(len(data))
+	s.mu.Unlock()
+	return nil
+}
+
+// acquire hands out a session to a single Write stream at a time.
+func (s *Server) acquire(token string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	if sess.busy {
+		return nil, status.Errorf(codes.Aborted, "session %s is in use by another stream", token)
+	}
+	sess.busy = true
+	return sess, nil
+}
+
+func (s *Server) release(sess *session) {
+	s.mu.Lock()
+	sess.busy = false
+	sess.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+// lookup must be called with s.mu held.
+func (s *Server) lookup(token string) (*session, error) {
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing session token")
+	}
+	s.expire()
+	sess, found := s.sessions[token]
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "no session %s", token)
+	}
+	return sess, nil
+}
+
+// expire must be called with s.mu held.
+func (s *Server) expire() {
+	cutoff := time.Now().Add(-s.ttl)
+	for _, sess := range s.sessions {
+		if !sess.busy && sess.lastUsed.Before(cutoff) {
+			s.remove(sess)
+		}
+	}
+}
+
+// remove must be called with s.mu held.
+func (s *Server) remove(sess *session) {
+	delete(s.sessions, sess.token)
+	sess.cp.Reset()
+}
+
+// statusFor maps a hashing failure to a gRPC status: a payload size out of
+// bounds is the only possible one.
+func statusFor(err error) error {
+	if xerrors.Is(err, commp.ErrPayloadTooLarge) || xerrors.Is(err, commp.ErrPayloadTooSmall) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
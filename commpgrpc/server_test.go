@@ -0,0 +1,175 @@
+package commpgrpc
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dialServer(t *testing.T, opts ...Option) CommPClient {
+	return NewCommPClient(dialConn(t, nil, opts...))
+}
+
+func dialConn(t *testing.T, srvOpts []grpc.ServerOption, opts ...Option) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(srvOpts...)
+	RegisterCommPServer(srv, NewServer(opts...))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestResume(t *testing.T) {
+	payload := make([]byte, 1<<20+17)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	cp := new(commp.Calc)
+	cp.Write(payload)
+	expCommP, expSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := dialServer(t)
+
+	sess, err := c.Open(ctx, &OpenRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stream ending without finish leaves the session open
+	w, err := c.Write(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(&Chunk{SessionToken: sess.SessionToken, Data: payload[:1000]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(&Chunk{Offset: 1000, Data: payload[1000:5000]}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := w.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Session.Offset != 5000 || resp.Digest != nil {
+		t.Fatalf("unexpected response to an unfinished stream: %v", resp)
+	}
+
+	// resuming from an earlier offset skips the overlap
+	st, err := c.Status(ctx, &SessionRequest{SessionToken: sess.SessionToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Offset != 5000 {
+		t.Fatalf("session reports offset %d, expected 5000", st.Offset)
+	}
+	if w, err = c.Write(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(&Chunk{SessionToken: sess.SessionToken, Offset: 4096, Data: payload[4096 : 1<<19]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(&Chunk{Offset: 1 << 19, Data: payload[1<<19:], Finish: true}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = w.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	d := resp.Digest
+	if d == nil || !bytes.Equal(d.CommP, expCommP) || d.PaddedPieceSize != expSize || d.PayloadSize != uint64(len(payload)) {
+		t.Fatalf("unexpected digest %v, expected commP 0x%X with padded size %d", d, expCommP, expSize)
+	}
+
+	// a finished session is gone
+	if _, err := c.Status(ctx, &SessionRequest{SessionToken: sess.SessionToken}); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected status of a finished session: %v", err)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	ctx := context.Background()
+	c := dialServer(t)
+
+	write := func(chunks ...*Chunk) error {
+		w, err := c.Write(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ch := range chunks {
+			if err := w.Send(ch); err != nil {
+				break
+			}
+		}
+		_, err = w.CloseAndRecv()
+		return err
+	}
+
+	if err := write(&Chunk{SessionToken: "nope", Data: []byte{1}}); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error for an unknown session: %v", err)
+	}
+
+	sess, err := c.Open(ctx, &OpenRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(&Chunk{SessionToken: sess.SessionToken, Offset: 1, Data: []byte{1}}); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("unexpected error for a gap: %v", err)
+	}
+	if err := write(&Chunk{SessionToken: sess.SessionToken, Data: make([]byte, 64), Finish: true}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unexpected error for a short payload: %v", err)
+	}
+
+	// the session survives the failures, and aborting it reports its offset
+	st, err := c.Abort(ctx, &SessionRequest{SessionToken: sess.SessionToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Offset != 64 {
+		t.Fatalf("aborted session reports offset %d, expected 64", st.Offset)
+	}
+	if _, err := c.Status(ctx, &SessionRequest{SessionToken: sess.SessionToken}); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected status of an aborted session: %v", err)
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	ctx := context.Background()
+	c := dialServer(t, WithMaxSessions(1), WithSessionTTL(50*time.Millisecond))
+
+	sess, err := c.Open(ctx, &OpenRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Open(ctx, &OpenRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("unexpected error over the session cap: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Status(ctx, &SessionRequest{SessionToken: sess.SessionToken}); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected status of an expired session: %v", err)
+	}
+	if _, err := c.Open(ctx, &OpenRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
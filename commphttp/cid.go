@@ -0,0 +1,28 @@
+package commphttp
+
+import (
+	"encoding/base32"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+var b32enc = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// pieceCID renders a raw commP as a base32 CIDv1 with the
+// fil-commitment-unsealed codec and the sha2-256-trunc254-padded multihash,
+// without depending on go-cid.
+func pieceCID(rawCommP []byte) string {
+	// version 1, codec 0xf101, multihash 0x1012, digest length 32
+	prefix := []byte{0x01, 0x81, 0xE2, 0x03, 0x92, 0x20, 0x20}
+	return "b" + b32enc.EncodeToString(append(prefix, rawCommP...))
+}
+
+// pieceCIDv2 renders the FRC-0069 piece CID of a piece.
+func pieceCIDv2(rawCommP []byte, paddedSize, payloadSize uint64) string {
+	c, err := commp.NewPieceCIDv2(rawCommP, paddedSize, payloadSize)
+	if err != nil {
+		// only for sizes never returned by Digest()
+		return ""
+	}
+	return c.String()
+}
@@ -0,0 +1,209 @@
+// Package commphttp provides an http.Handler computing the commP of request
+// bodies, for running this package as a network service:
+//
+//	http.Handle("/commp", commphttp.New(commphttp.WithMaxConcurrent(8)))
+//
+// A POST of the payload results in a JSON Result. The body is streamed
+// through the hasher, and is never held in memory in its entirety. Payloads
+// too large for a single request are sent to Uploads instead, in resumable
+// chunks.
+//
+// Middleware instead hashes the request bodies consumed by another handler,
+// e.g. one storing uploads, making the piece CID a by-product of ingest.
+package commphttp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// Result is the JSON response to a successful request.
+type Result struct {
+	PieceCID          string `json:"pieceCid"`
+	PieceCIDv2        string `json:"pieceCidV2"`
+	CommP             string `json:"commP"` // hex
+	PaddedPieceSize   uint64 `json:"paddedPieceSize"`
+	UnpaddedPieceSize uint64 `json:"unpaddedPieceSize"`
+	PayloadSize       uint64 `json:"payloadSize"`
+}
+
+// errorResult is the JSON response to a failed request.
+type errorResult struct {
+	Error string `json:"error"`
+}
+
+// Option configures a Handler or Uploads. Options not applicable to the
+// one being configured are ignored.
+type Option func(*config)
+
+type config struct {
+	maxPayload uint64
+	slots      chan struct{}
+	calcOpts   []commp.Option
+
+	checkpointDir string
+	segmentSize   uint64
+	uploadTTL     time.Duration
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		maxPayload:  commp.MaxPiecePayload,
+		segmentSize: DefaultSegmentSize,
+		uploadTTL:   DefaultUploadTTL,
+	}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// WithMaxPayloadSize rejects request bodies longer than the given amount of
+// bytes with 413 Request Entity Too Large. The default, and the upper bound,
+// is commp.MaxPiecePayload.
+func WithMaxPayloadSize(n uint64) Option {
+	return func(c *config) {
+		if n < commp.MaxPiecePayload {
+			c.maxPayload = n
+		}
+	}
+}
+
+// WithMaxConcurrent caps the amount of requests hashed at the same time.
+// Requests over the cap are rejected immediately with 503 Service Unavailable,
+// instead of queueing up behind long-running uploads. The default of 0 means
+// no cap.
+func WithMaxConcurrent(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.slots = make(chan struct{}, n)
+		} else {
+			c.slots = nil
+		}
+	}
+}
+
+// WithCalcOptions supplies options for the Calc hashing every request.
+func WithCalcOptions(opts ...commp.Option) Option {
+	return func(c *config) {
+		c.calcOpts = opts
+	}
+}
+
+// Handler computes the commP of the bodies of POST requests.
+type Handler struct {
+	config
+}
+
+// New returns a Handler configured by the supplied options.
+func New(opts ...Option) *Handler {
+	return &Handler{config: newConfig(opts)}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, xerrors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if r.ContentLength > 0 && uint64(r.ContentLength) > h.maxPayload {
+		writeError(w, http.StatusRequestEntityTooLarge, payloadTooLarge(uint64(r.ContentLength), h.maxPayload))
+		return
+	}
+
+	if !h.admit(w) {
+		return
+	}
+	defer h.leave()
+
+	res, err := h.hash(r.Body)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) hash(body io.Reader) (*Result, error) {
+	cp := commp.New(h.calcOpts...)
+
+	// one byte past the limit tells an overlong body apart from an exact fit
+	n, err := io.Copy(cp, io.LimitReader(body, int64(h.maxPayload)+1))
+	if err == nil && uint64(n) > h.maxPayload {
+		err = payloadTooLarge(uint64(n), h.maxPayload)
+	}
+	if err != nil {
+		cp.Reset()
+		return nil, err
+	}
+
+	rawCommP, paddedSize, err := cp.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(rawCommP, paddedSize, uint64(n)), nil
+}
+
+// admit takes one of the slots capping concurrent requests, responding with
+// 503 Service Unavailable if there is none. A successful admit must be
+// followed by a leave.
+func (c *config) admit(w http.ResponseWriter) bool {
+	if c.slots == nil {
+		return true
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, xerrors.New("too many concurrent requests"))
+		return false
+	}
+}
+
+func (c *config) leave() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+// NewResult returns the Result describing a raw commP.
+func NewResult(rawCommP []byte, paddedSize, payloadSize uint64) *Result {
+	return &Result{
+		PieceCID:          pieceCID(rawCommP),
+		PieceCIDv2:        pieceCIDv2(rawCommP, paddedSize, payloadSize),
+		CommP:             hex.EncodeToString(rawCommP),
+		PaddedPieceSize:   paddedSize,
+		UnpaddedPieceSize: paddedSize / 128 * 127,
+		PayloadSize:       payloadSize,
+	}
+}
+
+func payloadTooLarge(size, limit uint64) error {
+	return xerrors.Errorf("payload of at least %d bytes exceeds the limit of %d bytes: %w", size, limit, commp.ErrPayloadTooLarge)
+}
+
+// statusFor maps a hashing failure to a response status: besides a payload
+// size out of bounds, the only possible failure is reading the body.
+func statusFor(err error) int {
+	if xerrors.Is(err, commp.ErrPayloadTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResult{Error: err.Error()})
+}
@@ -0,0 +1,141 @@
+package commphttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(New(WithMaxPayloadSize(1 << 20)))
+	defer srv.Close()
+
+	payload := bytes.Repeat([]byte{0xCC}, 127*1000)
+	expCommP, expSize, err := commp.Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(srv.URL, "application/octet-stream", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+
+	var res Result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if exp := NewResult(expCommP[:], expSize, uint64(len(payload))); res != *exp {
+		t.Fatalf("unexpected result %+v, expected %+v", res, *exp)
+	}
+
+	for _, tc := range []struct {
+		method string
+		body   []byte
+		status int
+	}{
+		{"GET", nil, http.StatusMethodNotAllowed},
+		{"POST", payload[:10], http.StatusBadRequest},
+		{"POST", make([]byte, 1<<20+1), http.StatusRequestEntityTooLarge},
+	} {
+		req, _ := http.NewRequest(tc.method, srv.URL, bytes.NewReader(tc.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s of %d bytes resulted in %s, expected %d", tc.method, len(tc.body), resp.Status, tc.status)
+		}
+	}
+}
+
+func TestResultEncoding(t *testing.T) {
+	zero, err := commp.ZeroPieceCommP(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := NewResult(zero, 2048, 2032)
+	if res.PieceCID != "baga6ea4seaqpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy" {
+		t.Fatalf("unexpected piece CID %s", res.PieceCID)
+	}
+	if res.PieceCIDv2 != "bafkzcibcaadpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy" {
+		t.Fatalf("unexpected v2 piece CID %s", res.PieceCIDv2)
+	}
+}
+
+func TestHandlerConcurrencyCap(t *testing.T) {
+	h := New(WithMaxConcurrent(1))
+	h.slots <- struct{}{} // occupy the only slot
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/commp", bytes.NewReader(make([]byte, 127))))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("unexpected response %d to a request over the concurrency cap", rec.Code)
+	}
+
+	<-h.slots
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/commp", bytes.NewReader(make([]byte, 127))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d once a slot is available", rec.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 127*1000)
+	expCommP, expSize, err := commp.Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		body    []byte
+		readAll bool
+		err     error
+	}{
+		{payload, true, nil},
+		{payload, false, ErrBodyPending},
+		{payload[:10], true, commp.ErrPayloadTooSmall},
+	} {
+		var res *Result
+		var resErr error
+		h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.readAll {
+				ioutil.ReadAll(r.Body)
+			} else {
+				r.Body.Read(make([]byte, 100))
+			}
+			res, resErr = BodyResult(r.Context())
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/", bytes.NewReader(tc.body)))
+
+		if tc.err != nil {
+			if !xerrors.Is(resErr, tc.err) {
+				t.Fatalf("unexpected error for a body of %d bytes: %v", len(tc.body), resErr)
+			}
+			continue
+		}
+		if resErr != nil {
+			t.Fatal(resErr)
+		}
+		pi, err := res.PieceInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pi.CommP, expCommP[:]) || pi.PaddedPieceSize != expSize || res.PayloadSize != uint64(len(payload)) {
+			t.Fatalf("unexpected result %+v, expected commP 0x%X with padded size %d", res, expCommP, expSize)
+		}
+	}
+}
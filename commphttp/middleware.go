@@ -0,0 +1,110 @@
+package commphttp
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// ErrBodyPending is returned by BodyResult for a request whose body has not
+// been read to EOF yet.
+var ErrBodyPending = xerrors.New("request body not read to EOF")
+
+type bodyKey struct{}
+
+// Middleware wraps an upload handler, hashing request bodies as a by-product
+// of next reading them, without buffering them a second time:
+//
+//	http.Handle("/upload", commphttp.Middleware(upload))
+//
+// Once next has read the body to EOF, BodyResult on the request context
+// returns its commP.
+func Middleware(next http.Handler, calcOpts ...commp.Option) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := &hashedBody{
+			ReadCloser: r.Body,
+			cp:         commp.New(calcOpts...),
+			err:        ErrBodyPending,
+		}
+		// terminates the Calc of a body next did not read to EOF
+		defer b.finish(ErrBodyPending)
+
+		r = r.WithContext(context.WithValue(r.Context(), bodyKey{}, b))
+		r.Body = b
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BodyResult returns the Result of hashing the body of the request carrying
+// ctx, which must have passed through Middleware. It fails with
+// ErrBodyPending until the body was read to EOF, and with the hashing error
+// when the body is too short or too long for a commP.
+func BodyResult(ctx context.Context) (*Result, error) {
+	b, ok := ctx.Value(bodyKey{}).(*hashedBody)
+	if !ok {
+		return nil, xerrors.New("request did not pass through commphttp.Middleware")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.res, b.err
+}
+
+// PieceInfo returns the commP and padded size of r.
+func (r *Result) PieceInfo() (commp.PieceInfo, error) {
+	rawCommP, err := hex.DecodeString(r.CommP)
+	if err != nil {
+		return commp.PieceInfo{}, err
+	}
+	return commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: r.PaddedPieceSize}, nil
+}
+
+// hashedBody feeds everything read from the wrapped body into a Calc.
+type hashedBody struct {
+	io.ReadCloser
+	cp *commp.Calc
+	n  uint64
+
+	mu   sync.Mutex
+	done bool
+	res  *Result
+	err  error
+}
+
+func (b *hashedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.done {
+		if _, werr := b.cp.Write(p[:n]); werr != nil {
+			b.finish(werr)
+		}
+		b.n += uint64(n)
+	}
+	if err == io.EOF && !b.done {
+		rawCommP, paddedSize, derr := b.cp.Digest()
+		if derr != nil {
+			b.finish(derr)
+		} else {
+			b.mu.Lock()
+			b.done = true
+			b.res, b.err = NewResult(rawCommP, paddedSize, b.n), nil
+			b.mu.Unlock()
+		}
+	}
+	return n, err
+}
+
+// finish records a failure, unless a result or an earlier failure are in.
+func (b *hashedBody) finish(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return
+	}
+	b.done = true
+	b.err = err
+	b.cp.Reset()
+}
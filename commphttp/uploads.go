@@ -0,0 +1,471 @@
+package commphttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// DefaultSegmentSize is the padded size of the segments an upload is hashed
+// in, unless overridden by WithSegmentSize. The commitment of every complete
+// segment is checkpointed.
+const DefaultSegmentSize = 1 << 30
+
+// DefaultUploadTTL is how long an idle upload is kept in memory, unless
+// overridden by WithUploadTTL.
+const DefaultUploadTTL = 24 * time.Hour
+
+// WithCheckpointDir persists the state of every upload to a file in dir,
+// updated whenever a segment is complete. An upload unknown to a restarted
+// server, or one expired from memory, is then resumed from its last complete
+// segment. Checkpoints of uploads which are never completed nor deleted are
+// left behind in dir.
+func WithCheckpointDir(dir string) Option {
+	return func(c *config) {
+		c.checkpointDir = dir
+	}
+}
+
+// WithSegmentSize sets the padded size of the segments uploads are hashed in,
+// which must be a power of two of at least 128. Smaller segments are
+// checkpointed more often, at the cost of more disk writes.
+func WithSegmentSize(paddedSize uint64) Option {
+	return func(c *config) {
+		if paddedSize >= 128 && bits.OnesCount64(paddedSize) == 1 {
+			c.segmentSize = paddedSize
+		}
+	}
+}
+
+// WithUploadTTL discards uploads from memory after the given duration without
+// a request. Completed uploads are discarded as well, making their Result no
+// longer available.
+func WithUploadTTL(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.uploadTTL = d
+		}
+	}
+}
+
+// Uploads is an http.Handler implementing resumable uploads in the style of
+// the tus protocol, for payloads too large to be reliably sent in a single
+// request over a WAN:
+//
+//	http.Handle("/uploads/", http.StripPrefix("/uploads", commphttp.NewUploads()))
+//
+//	POST   /      with Upload-Length   creates an upload, returning its Location
+//	HEAD   /{id}                       reports the Upload-Offset to resume from
+//	PATCH  /{id}  with Upload-Offset   appends the body to the upload
+//	GET    /{id}                       returns the Result of a completed upload
+//	DELETE /{id}                       discards the upload
+//
+// Payload is hashed as it arrives, and is never stored: an interrupted PATCH
+// keeps everything received up to the interruption, and the upload is
+// resumed by a PATCH at the offset reported by HEAD. The PATCH completing the
+// upload responds with its Result.
+type Uploads struct {
+	config
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// uploadCheckpoint is the persisted state of an upload.
+type uploadCheckpoint struct {
+	ID                string   `json:"id"`
+	Length            uint64   `json:"length"`
+	SegmentPaddedSize uint64   `json:"segmentPaddedSize"`
+	Segments          []string `json:"segments"` // hex raw commP of every complete segment
+}
+
+type upload struct {
+	uploadCheckpoint
+	calc     *commp.Calc // hashing the segment in progress
+	offset   uint64      // guarded by Uploads.mu, only modified by the request holding the upload
+	res      *Result
+	busy     bool
+	lastUsed time.Time
+}
+
+// NewUploads returns an Uploads handler configured by the supplied options.
+func NewUploads(opts ...Option) *Uploads {
+	return &Uploads{
+		config:  newConfig(opts),
+		uploads: make(map[string]*upload),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (u *Uploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	id := strings.Trim(r.URL.Path, "/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, xerrors.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		u.create(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet, http.MethodPatch, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "HEAD, GET, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, xerrors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	up, err := u.acquire(id)
+	if err != nil {
+		writeError(w, uploadStatusFor(err), err)
+		return
+	}
+	defer u.release(up)
+
+	switch r.Method {
+	case http.MethodHead:
+		u.writeOffset(w, up)
+	case http.MethodGet:
+		if up.res == nil {
+			writeError(w, http.StatusConflict, xerrors.Errorf("upload %s incomplete at offset %d of %d", id, up.offset, up.Length))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(up.res)
+	case http.MethodPatch:
+		u.patch(w, r, up)
+	case http.MethodDelete:
+		u.remove(up)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (u *Uploads) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseUint(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, xerrors.Errorf("invalid Upload-Length: %w", err))
+		return
+	}
+	if length > u.maxPayload {
+		writeError(w, http.StatusRequestEntityTooLarge, payloadTooLarge(length, u.maxPayload))
+		return
+	}
+	if length < commp.MinPiecePayload {
+		writeError(w, http.StatusBadRequest, xerrors.Errorf("Upload-Length %d below the minimum payload size %d: %w", length, commp.MinPiecePayload, commp.ErrPayloadTooSmall))
+		return
+	}
+
+	rnd := make([]byte, 16)
+	if _, err := rand.Read(rnd); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	up := &upload{
+		uploadCheckpoint: uploadCheckpoint{
+			ID:                hex.EncodeToString(rnd),
+			Length:            length,
+			SegmentPaddedSize: u.segmentSize,
+		},
+		calc:     commp.New(u.calcOpts...),
+		lastUsed: time.Now(),
+	}
+	if err := u.saveCheckpoint(up); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	u.mu.Lock()
+	u.expire()
+	u.uploads[up.ID] = up
+	u.mu.Unlock()
+
+	// the request URI is unaffected by http.StripPrefix
+	base := r.URL.Path
+	if ru, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		base = ru.Path
+	}
+	w.Header().Set("Location", strings.TrimSuffix(base, "/")+"/"+up.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (u *Uploads) patch(w http.ResponseWriter, r *http.Request, up *upload) {
+	offset, err := strconv.ParseUint(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, xerrors.Errorf("invalid Upload-Offset: %w", err))
+		return
+	}
+	if offset != up.offset {
+		w.Header().Set("Upload-Offset", strconv.FormatUint(up.offset, 10))
+		writeError(w, http.StatusConflict, xerrors.Errorf("Upload-Offset %d does not match the %d bytes received so far", offset, up.offset))
+		return
+	}
+	if up.res != nil {
+		writeError(w, http.StatusConflict, xerrors.Errorf("upload %s already complete", up.ID))
+		return
+	}
+
+	if !u.admit(w) {
+		return
+	}
+	defer u.leave()
+
+	if err := u.append(up, r.Body); err != nil {
+		u.writeOffset(w, up)
+		writeError(w, uploadStatusFor(err), err)
+		return
+	}
+	if up.offset < up.Length {
+		u.writeOffset(w, up)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := u.complete(up); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	u.writeOffset(w, up)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(up.res)
+}
+
+// append hashes body into up, sealing and checkpointing every segment as it
+// is complete. Everything read before a failure is kept.
+func (u *Uploads) append(up *upload, body io.Reader) error {
+	segPayload := up.SegmentPaddedSize / 128 * 127
+	buf := make([]byte, 1<<20)
+
+	for up.offset < up.Length {
+		want := segPayload - up.offset%segPayload
+		if left := up.Length - up.offset; left < want {
+			want = left
+		}
+		if want > uint64(len(buf)) {
+			want = uint64(len(buf))
+		}
+
+		n, err := body.Read(buf[:want])
+		if n > 0 {
+			if _, err := up.calc.Write(buf[:n]); err != nil {
+				return err
+			}
+			u.mu.Lock()
+			up.offset += uint64(n)
+			u.mu.Unlock()
+
+			if up.offset%segPayload == 0 {
+				rawCommP, _, err := up.calc.Digest()
+				if err != nil {
+					return err
+				}
+				up.Segments = append(up.Segments, hex.EncodeToString(rawCommP))
+				if err := u.saveCheckpoint(up); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if n, _ := body.Read(buf[:1]); n > 0 {
+		return payloadTooLarge(up.Length+1, up.Length)
+	}
+	return nil
+}
+
+// complete derives the Result of a fully received upload from its segments.
+func (u *Uploads) complete(up *upload) error {
+	segments := make([]commp.PieceInfo, 0, len(up.Segments)+1)
+	for _, s := range up.Segments {
+		rawCommP, err := hex.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: up.SegmentPaddedSize})
+	}
+
+	if tail := up.Length % (up.SegmentPaddedSize / 128 * 127); tail > 0 {
+		if tail < commp.MinPiecePayload && len(segments) > 0 {
+			// the remainder is zero-padded anyway, and too short to be
+			// digested on its own
+			up.calc.Write(make([]byte, 127-tail))
+		}
+		rawCommP, paddedSize, err := up.calc.Digest()
+		if err != nil {
+			return err
+		}
+		segments = append(segments, commp.PieceInfo{CommP: rawCommP, PaddedPieceSize: paddedSize})
+	}
+
+	res := NewResult(segments[0].CommP, segments[0].PaddedPieceSize, up.Length)
+	if len(segments) > 1 {
+		paddedSize := uint64(commp.UnpaddedPieceSize(up.Length).NextPowerOfTwo().Padded())
+		rawCommP, err := commp.ComputeCommD(paddedSize, segments)
+		if err != nil {
+			return err
+		}
+		res = NewResult(rawCommP, paddedSize, up.Length)
+	}
+
+	up.res = res
+	return u.removeCheckpoint(up.ID)
+}
+
+func (u *Uploads) writeOffset(w http.ResponseWriter, up *upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatUint(up.offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatUint(up.Length, 10))
+}
+
+var (
+	errUploadNotFound = xerrors.New("no such upload")
+	errUploadBusy     = xerrors.New("upload in use by another request")
+)
+
+// acquire hands out an upload to a single request at a time, loading it from
+// its checkpoint if it is not in memory.
+func (u *Uploads) acquire(id string) (*upload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expire()
+	up, found := u.uploads[id]
+	if !found {
+		var err error
+		if up, err = u.loadCheckpoint(id); err != nil {
+			return nil, err
+		}
+		u.uploads[id] = up
+	}
+	if up.busy {
+		return nil, xerrors.Errorf("upload %s: %w", id, errUploadBusy)
+	}
+	up.busy = true
+	return up, nil
+}
+
+func (u *Uploads) release(up *upload) {
+	u.mu.Lock()
+	up.busy = false
+	up.lastUsed = time.Now()
+	u.mu.Unlock()
+}
+
+// remove discards an upload held by the caller, along with its checkpoint.
+func (u *Uploads) remove(up *upload) {
+	u.mu.Lock()
+	delete(u.uploads, up.ID)
+	u.mu.Unlock()
+	up.calc.Reset()
+	u.removeCheckpoint(up.ID)
+}
+
+// expire must be called with u.mu held. Checkpoints are left in place, for
+// resuming the upload later.
+func (u *Uploads) expire() {
+	cutoff := time.Now().Add(-u.uploadTTL)
+	for id, up := range u.uploads {
+		if !up.busy && up.lastUsed.Before(cutoff) {
+			delete(u.uploads, id)
+			up.calc.Reset()
+		}
+	}
+}
+
+func (u *Uploads) checkpointPath(id string) string {
+	return filepath.Join(u.checkpointDir, id+".json")
+}
+
+// saveCheckpoint atomically replaces the checkpoint of up.
+func (u *Uploads) saveCheckpoint(up *upload) error {
+	if u.checkpointDir == "" {
+		return nil
+	}
+	j, err := json.Marshal(&up.uploadCheckpoint)
+	if err != nil {
+		return err
+	}
+	tmp := u.checkpointPath(up.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(j, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.checkpointPath(up.ID))
+}
+
+func (u *Uploads) loadCheckpoint(id string) (*upload, error) {
+	if u.checkpointDir == "" || !validUploadID(id) {
+		return nil, xerrors.Errorf("upload %s: %w", id, errUploadNotFound)
+	}
+	saved, err := ioutil.ReadFile(u.checkpointPath(id))
+	if os.IsNotExist(err) {
+		return nil, xerrors.Errorf("upload %s: %w", id, errUploadNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	up := &upload{calc: commp.New(u.calcOpts...)}
+	if err := json.Unmarshal(saved, &up.uploadCheckpoint); err != nil {
+		return nil, xerrors.Errorf("invalid checkpoint of upload %s: %w", id, err)
+	}
+	if up.ID != id || up.SegmentPaddedSize < 128 || bits.OnesCount64(up.SegmentPaddedSize) != 1 {
+		return nil, xerrors.Errorf("invalid checkpoint of upload %s", id)
+	}
+	up.offset = uint64(len(up.Segments)) * (up.SegmentPaddedSize / 128 * 127)
+	if up.offset > up.Length {
+		return nil, xerrors.Errorf("invalid checkpoint of upload %s", id)
+	}
+	return up, nil
+}
+
+func (u *Uploads) removeCheckpoint(id string) error {
+	if u.checkpointDir == "" {
+		return nil
+	}
+	if err := os.Remove(u.checkpointPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// validUploadID keeps the IDs looked up on disk to the ones generated by
+// create, in particular free of path separators.
+func validUploadID(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == 16
+}
+
+func uploadStatusFor(err error) int {
+	switch {
+	case xerrors.Is(err, errUploadNotFound):
+		return http.StatusNotFound
+	case xerrors.Is(err, errUploadBusy):
+		return http.StatusConflict
+	case xerrors.Is(err, commp.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
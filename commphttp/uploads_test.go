@@ -0,0 +1,124 @@
+package commphttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+// brokenReader fails after n bytes, like a body cut off by a network failure
+type brokenReader struct {
+	r io.Reader
+	n int
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.n == 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.r.Read(p)
+	b.n -= n
+	return n, err
+}
+
+func TestUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commphttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	do := func(h http.Handler, method, path string, hdr map[string]string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{2032*3 + 1000, 2032*2 + 10, 2032 * 4, 1000} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		expCommP, expSize, err := commp.Sum(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := []Option{WithSegmentSize(2048), WithCheckpointDir(dir)}
+		h := http.StripPrefix("/uploads", NewUploads(opts...))
+
+		w := do(h, "POST", "/uploads/", map[string]string{"Upload-Length": strconv.Itoa(size)}, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+		}
+		loc := w.Header().Get("Location")
+		if !strings.HasPrefix(loc, "/uploads/") {
+			t.Fatalf("unexpected Location %s", loc)
+		}
+
+		// a PATCH cut off keeps what was received
+		cut := size / 2
+		w = do(h, "PATCH", loc, map[string]string{"Upload-Offset": "0"}, &brokenReader{bytes.NewReader(payload), cut})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("unexpected status %d of a broken PATCH", w.Code)
+		}
+		w = do(h, "HEAD", loc, nil, nil)
+		if off := w.Header().Get("Upload-Offset"); off != strconv.Itoa(cut) {
+			t.Fatalf("upload reports offset %s, expected %d", off, cut)
+		}
+		if w = do(h, "PATCH", loc, map[string]string{"Upload-Offset": "0"}, bytes.NewReader(payload)); w.Code != http.StatusConflict {
+			t.Fatalf("unexpected status %d of a PATCH at a stale offset", w.Code)
+		}
+
+		// a restarted server resumes from the last complete segment
+		h = http.StripPrefix("/uploads", NewUploads(opts...))
+		w = do(h, "HEAD", loc, nil, nil)
+		off, err := strconv.Atoi(w.Header().Get("Upload-Offset"))
+		if err != nil || off != cut/2032*2032 {
+			t.Fatalf("restarted upload reports offset %s, expected %d", w.Header().Get("Upload-Offset"), cut/2032*2032)
+		}
+
+		w = do(h, "PATCH", loc, map[string]string{"Upload-Offset": strconv.Itoa(off)}, bytes.NewReader(payload[off:]))
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d of the final PATCH: %s", w.Code, w.Body)
+		}
+		var res Result
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if exp := NewResult(expCommP[:], expSize, uint64(size)); res != *exp {
+			t.Fatalf("upload of %d bytes resulted in %+v, expected %+v", size, res, *exp)
+		}
+		if w = do(h, "GET", loc, nil, nil); w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d of a completed upload", w.Code)
+		}
+
+		if w = do(h, "DELETE", loc, nil, nil); w.Code != http.StatusNoContent {
+			t.Fatalf("unexpected status %d of DELETE", w.Code)
+		}
+		if w = do(h, "HEAD", loc, nil, nil); w.Code != http.StatusNotFound {
+			t.Fatalf("unexpected status %d of a deleted upload", w.Code)
+		}
+	}
+
+	if left, _ := ioutil.ReadDir(dir); len(left) != 0 {
+		t.Fatalf("%d checkpoints left behind", len(left))
+	}
+}
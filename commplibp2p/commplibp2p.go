@@ -0,0 +1,120 @@
+// Package commplibp2p serves commP computation over the libp2p stream
+// protocol /fil/commp/1.0.0, allowing nodes of a deal-preparation cluster to
+// offload hashing to a remote worker:
+//
+//	// on the worker
+//	commplibp2p.Register(h, commplibp2p.WithAllowedPeers(clientID))
+//
+//	// on the client
+//	c, err := commplibp2p.NewClient(ctx, h, workerID)
+//	...
+//	c.Open()
+//	io.Copy(c, payload)
+//	rawCommP, paddedSize, err := c.Digest()
+//
+// Every stream carries the commpd protocol, one job at a time. Peers are
+// authenticated by the secure channel of the libp2p connection: a worker only
+// serves the peer IDs it allows.
+package commplibp2p
+
+import (
+	"context"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpd"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// ProtocolID identifies the commP stream protocol.
+const ProtocolID = protocol.ID("/fil/commp/1.0.0")
+
+// Option configures a Service.
+type Option func(*config)
+
+type config struct {
+	allowed  map[peer.ID]struct{}
+	maxJobs  int
+	calcOpts []commp.Option
+}
+
+// WithAllowedPeers restricts the Service to the given peers, resetting the
+// streams of any other. Without it every peer able to connect is served.
+func WithAllowedPeers(ids ...peer.ID) Option {
+	return func(c *config) {
+		if c.allowed == nil {
+			c.allowed = make(map[peer.ID]struct{}, len(ids))
+		}
+		for _, id := range ids {
+			c.allowed[id] = struct{}{}
+		}
+	}
+}
+
+// WithMaxJobs limits the amount of jobs hashed concurrently across all
+// streams, see commpd.NewServer.
+func WithMaxJobs(n int) Option {
+	return func(c *config) {
+		c.maxJobs = n
+	}
+}
+
+// WithCalcOptions applies opts to every commp.Calc of the Service.
+func WithCalcOptions(opts ...commp.Option) Option {
+	return func(c *config) {
+		c.calcOpts = append(c.calcOpts, opts...)
+	}
+}
+
+// Service hashes the jobs submitted over ProtocolID streams.
+type Service struct {
+	config
+	srv *commpd.Server
+}
+
+// NewService returns a Service, to be registered with a host via Register or
+// by passing its HandleStream to host.SetStreamHandler.
+func NewService(opts ...Option) *Service {
+	s := new(Service)
+	for _, o := range opts {
+		o(&s.config)
+	}
+	s.srv = commpd.NewServer(s.maxJobs, s.calcOpts...)
+	return s
+}
+
+// Register serves ProtocolID on h, until h.RemoveStreamHandler(ProtocolID).
+func Register(h host.Host, opts ...Option) *Service {
+	s := NewService(opts...)
+	h.SetStreamHandler(ProtocolID, s.HandleStream)
+	return s
+}
+
+// HandleStream serves a single stream until the remote peer closes it.
+func (s *Service) HandleStream(st network.Stream) {
+	if !s.Allowed(st.Conn().RemotePeer()) {
+		st.Reset()
+		return
+	}
+	s.srv.ServeConn(st)
+}
+
+// Allowed reports whether the Service serves peer id.
+func (s *Service) Allowed(id peer.ID) bool {
+	if s.allowed == nil {
+		return true
+	}
+	_, ok := s.allowed[id]
+	return ok
+}
+
+// NewClient opens a ProtocolID stream from h to the worker p.
+func NewClient(ctx context.Context, h host.Host, p peer.ID) (*commpd.Client, error) {
+	st, err := h.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	return commpd.NewClient(st), nil
+}
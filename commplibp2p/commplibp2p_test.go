@@ -0,0 +1,74 @@
+package commplibp2p
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpd"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// testStream is the server end of a stream from a given peer. Methods not
+// exercised by the Service panic via the nil embedded interface.
+type testStream struct {
+	network.Stream
+	pipe net.Conn
+	conn testConn
+}
+
+func (s *testStream) Read(p []byte) (int, error)  { return s.pipe.Read(p) }
+func (s *testStream) Write(p []byte) (int, error) { return s.pipe.Write(p) }
+func (s *testStream) Close() error                { return s.pipe.Close() }
+func (s *testStream) Reset() error                { return s.pipe.Close() }
+func (s *testStream) Conn() network.Conn          { return s.conn }
+
+type testConn struct {
+	network.Conn
+	remote peer.ID
+}
+
+func (c testConn) RemotePeer() peer.ID { return c.remote }
+
+func dialService(s *Service, from peer.ID) *commpd.Client {
+	client, server := net.Pipe()
+	go s.HandleStream(&testStream{pipe: server, conn: testConn{remote: from}})
+	return commpd.NewClient(client)
+}
+
+func TestService(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 1<<20+7)
+	want, wantSize, err := commp.Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(WithAllowedPeers("client"), WithMaxJobs(2))
+
+	c := dialService(s, "client")
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		got, gotSize, err := c.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want[:]) || gotSize != wantSize {
+			t.Fatalf("job %d: got %X/%d, expected %X/%d", i, got, gotSize, want, wantSize)
+		}
+	}
+
+	stranger := dialService(s, "stranger")
+	defer stranger.Close()
+	stranger.Open()
+	if _, _, err := stranger.Digest(); err == nil {
+		t.Fatal("unexpected service of a peer not allowed")
+	}
+}
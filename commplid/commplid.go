@@ -0,0 +1,75 @@
+// Package commplid indexes the blocks of a CAR while computing its commP,
+// producing the metadata ingested by the piece directory of boost, also known
+// as the local index directory (LID), without a separate indexing pass:
+//
+//	idx, err := commplid.WriteIndex(jsonOut, carFile)
+//
+// Records are emitted in the JSON form of boost's model.Record: the CID of
+// every block, the offset of its section within the CAR, and the size of its
+// data.
+package commplid
+
+import (
+	"encoding/json"
+	"io"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/cidutil"
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpcar"
+	"github.com/ipfs/go-cid"
+)
+
+// Record locates a block within a piece.
+type Record struct {
+	Cid    cid.Cid
+	Offset uint64 // of the block section, its length prefix included
+	Size   uint64 // of the block data
+}
+
+// Index is the piece directory metadata of a CAR.
+type Index struct {
+	PieceCid        cid.Cid
+	PayloadCid      cid.Cid // the first root of the CAR
+	CarSize         uint64
+	PaddedPieceSize uint64
+	Records         []Record
+}
+
+// Build reads the CARv1 in r until EOF, returning its Index. The supplied
+// options apply to the commp.Calc hashing it.
+func Build(r io.Reader, opts ...commp.Option) (*Index, error) {
+	idx := new(Index)
+	res, err := commpcar.Walk(r, func(b commpcar.Block) error {
+		c, err := cid.Cast(b.CID)
+		if err != nil {
+			return err
+		}
+		idx.Records = append(idx.Records, Record{Cid: c, Offset: b.Offset, Size: b.Size})
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.PieceCid, err = cidutil.PieceCID(res.CommP); err != nil {
+		return nil, err
+	}
+	if idx.PayloadCid, err = cid.Cast(res.Roots[0]); err != nil {
+		return nil, err
+	}
+	idx.CarSize = res.PayloadSize
+	idx.PaddedPieceSize = res.PaddedPieceSize
+	return idx, nil
+}
+
+// WriteIndex builds the Index of the CARv1 in r, and writes it to w as JSON.
+func WriteIndex(w io.Writer, r io.Reader, opts ...commp.Option) (*Index, error) {
+	idx, err := Build(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(w).Encode(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
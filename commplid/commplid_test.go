@@ -0,0 +1,77 @@
+package commplid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var vi [binary.MaxVarintLen64]byte
+	return append(b, vi[:binary.PutUvarint(vi[:], v)]...)
+}
+
+func TestWriteIndex(t *testing.T) {
+	var cids []cid.Cid
+	var blocks [][]byte
+	for i := 0; i < 3; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, 500*(i+1))
+		mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, cid.NewCidV1(cid.Raw, mh))
+		blocks = append(blocks, data)
+	}
+
+	// {"roots": [cids[0]], "version": 1}
+	root := cids[0].Bytes()
+	hdr := []byte{0xa2, 0x65, 'r', 'o', 'o', 't', 's', 0x81, 0xd8, 42, 0x58, byte(len(root) + 1), 0x00}
+	hdr = append(append(hdr, root...), 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01)
+	car := append(appendUvarint(nil, uint64(len(hdr))), hdr...)
+
+	var exp []Record
+	for i, b := range blocks {
+		c := cids[i].Bytes()
+		exp = append(exp, Record{Cid: cids[i], Offset: uint64(len(car)), Size: uint64(len(b))})
+		car = appendUvarint(car, uint64(len(c)+len(b)))
+		car = append(append(car, c...), b...)
+	}
+
+	var out bytes.Buffer
+	idx, err := WriteIndex(&out, bytes.NewReader(car))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp := new(commp.Calc)
+	cp.Write(car)
+	_, expSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idx.PayloadCid.Equals(cids[0]) || idx.CarSize != uint64(len(car)) || idx.PaddedPieceSize != expSize {
+		t.Fatalf("unexpected index %+v", idx)
+	}
+
+	var decoded Index
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.PieceCid.Equals(idx.PieceCid) || len(decoded.Records) != len(exp) {
+		t.Fatalf("unexpected JSON %s", out.Bytes())
+	}
+	for i, r := range decoded.Records {
+		if !r.Cid.Equals(exp[i].Cid) || r.Offset != exp[i].Offset || r.Size != exp[i].Size {
+			t.Errorf("record %d: got %+v, expected %+v", i, r, exp[i])
+		}
+	}
+	if !bytes.Contains(out.Bytes(), []byte(`"Cid":{"/":"`+cids[1].String()+`"}`)) {
+		t.Fatalf("record CIDs not in the JSON form of boost: %s", out.Bytes())
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commplid
+
+go 1.11
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/filecoin-project/go-fil-commp-hashhash/cidutil v0.0.0
+	github.com/ipfs/go-cid v0.0.7
+	github.com/multiformats/go-multihash v0.0.14
+)
+
+replace (
+	github.com/filecoin-project/go-fil-commp-hashhash => ../
+	github.com/filecoin-project/go-fil-commp-hashhash/cidutil => ../cidutil
+)
@@ -0,0 +1,78 @@
+// Package commpotel traces commp.Calc objects with OpenTelemetry. Every piece
+// results in a span, which is a child of the span carried by the context
+// supplied by the caller, with children for every Write(), for the lifetime
+// of every tree layer worker, and for Digest():
+//
+//	ctx, span := tracer.Start(ctx, "prepare-deal")
+//	defer span.End()
+//	cp := commp.New(commpotel.WithTracing(ctx, nil))
+//
+// The context is bound to the Calc: every piece it processes becomes a child
+// of the same span. Use a new Calc per context.
+package commpotel
+
+import (
+	"context"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the spans created by this package.
+const InstrumentationName = "github.com/filecoin-project/go-fil-commp-hashhash/commpotel"
+
+// SpanPiece is the name of the span covering a piece.
+const SpanPiece = "commp.piece"
+
+// WithTracing returns a commp.Option tracing pieces as children of the span in
+// ctx, using the given TracerProvider, or the global one if nil.
+func WithTracing(ctx context.Context, tp trace.TracerProvider) commp.Option {
+	return commp.WithTracer(NewTracer(ctx, tp))
+}
+
+// NewTracer returns the commp.Tracer behind WithTracing.
+func NewTracer(ctx context.Context, tp trace.TracerProvider) commp.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &tracer{ctx: ctx, tracer: tp.Tracer(InstrumentationName)}
+}
+
+type tracer struct {
+	ctx    context.Context
+	tracer trace.Tracer
+}
+
+func (t *tracer) StartPiece() commp.Span {
+	return t.start(t.ctx, SpanPiece)
+}
+
+func (t *tracer) start(ctx context.Context, name string) commp.Span {
+	ctx, s := t.tracer.Start(ctx, name)
+	return &span{t: t, ctx: ctx, span: s}
+}
+
+type span struct {
+	t    *tracer
+	ctx  context.Context
+	span trace.Span
+}
+
+func (s *span) StartChild(name string) commp.Span {
+	return s.t.start(s.ctx, name)
+}
+
+func (s *span) SetAttribute(key string, value int64) {
+	s.span.SetAttributes(attribute.Int64(key, value))
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,44 @@
+package commpotel
+
+import (
+	"context"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	cp := commp.New(WithTracing(ctx, tp))
+	cp.Write(make([]byte, 127*4))
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+	// 4 blocks pass through the block folder, and the layers 2 to 4
+	if len(byName[SpanPiece]) != 1 || len(byName[commp.SpanWrite]) != 1 || len(byName[commp.SpanDigest]) != 1 || len(byName[commp.SpanLayer]) != 4 {
+		t.Fatalf("unexpected spans %v", byName)
+	}
+
+	piece := byName[SpanPiece][0]
+	if piece.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("piece span is not a child of the span of the supplied context")
+	}
+	for _, name := range []string{commp.SpanWrite, commp.SpanDigest, commp.SpanLayer} {
+		for _, s := range byName[name] {
+			if s.Parent().SpanID() != piece.SpanContext().SpanID() {
+				t.Fatalf("%s span is not a child of the piece span", name)
+			}
+		}
+	}
+}
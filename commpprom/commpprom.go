@@ -0,0 +1,142 @@
+// Package commpprom exports the activity of commp.Calc objects as Prometheus
+// metrics. A single Metrics observes any amount of Calcs, including the ones
+// hashing requests of the network services:
+//
+//	m := commpprom.New("commp")
+//	prometheus.MustRegister(m)
+//	http.Handle("/commp", commphttp.New(commphttp.WithCalcOptions(commp.WithObserver(m))))
+//
+// The exported series are:
+//
+//	<namespace>_bytes_hashed_total       payload bytes written to all Calcs
+//	<namespace>_active_pipelines         pieces in progress
+//	<namespace>_layer_queue_depth        sampled nodes waiting per tree layer
+//	<namespace>_digest_duration_seconds  latency of Digest()
+//	<namespace>_errors_total             failed Write() and Digest() calls
+//
+// A stalled hasher shows as active pipelines with a flat byte counter, a
+// throughput regression as a drop in the rate of the byte counter, and the
+// layer holding up the pipeline as the one with queue depths near 256.
+package commpprom
+
+import (
+	"strconv"
+	"time"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/xerrors"
+)
+
+// Metrics is a commp.Observer maintaining Prometheus metrics, and the
+// prometheus.Collector exporting them.
+type Metrics struct {
+	bytes  prometheus.Counter
+	active prometheus.Gauge
+	queue  *prometheus.HistogramVec
+	digest prometheus.Histogram
+	errors *prometheus.CounterVec
+
+	queueByLayer [commp.MaxLayers + 1]prometheus.Observer
+}
+
+var (
+	_ commp.Observer       = (*Metrics)(nil)
+	_ prometheus.Collector = (*Metrics)(nil)
+)
+
+// New returns Metrics with series named within the given namespace, which may
+// be empty.
+func New(namespace string) *Metrics {
+	m := &Metrics{
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_hashed_total",
+			Help:      "Payload bytes written to commP calculators.",
+		}),
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_pipelines",
+			Help:      "Pieces being hashed, each with its own set of tree layer workers.",
+		}),
+		queue: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "layer_queue_depth",
+			Help:      "Sampled amount of nodes waiting to be processed by the worker of a tree layer, layer 0 holding entire blocks.",
+			Buckets:   []float64{0, 1, 4, 16, 64, 128, 192, 255, 256},
+		}, []string{"layer"}),
+		digest: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "digest_duration_seconds",
+			Help:      "Time taken by Digest(), which waits for the tree layer workers to drain.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Failed calls, by operation and reason.",
+		}, []string{"op", "reason"}),
+	}
+
+	for i := range m.queueByLayer {
+		m.queueByLayer[i] = m.queue.WithLabelValues(strconv.Itoa(i))
+	}
+	return m
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.bytes.Describe(ch)
+	m.active.Describe(ch)
+	m.queue.Describe(ch)
+	m.digest.Describe(ch)
+	m.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.bytes.Collect(ch)
+	m.active.Collect(ch)
+	m.queue.Collect(ch)
+	m.digest.Collect(ch)
+	m.errors.Collect(ch)
+}
+
+// PipelineStarted implements commp.Observer.
+func (m *Metrics) PipelineStarted() { m.active.Inc() }
+
+// PipelineStopped implements commp.Observer.
+func (m *Metrics) PipelineStopped() { m.active.Dec() }
+
+// BytesWritten implements commp.Observer.
+func (m *Metrics) BytesWritten(n int) { m.bytes.Add(float64(n)) }
+
+// QueueDepth implements commp.Observer.
+func (m *Metrics) QueueDepth(layer uint, depth int) {
+	if layer < uint(len(m.queueByLayer)) {
+		m.queueByLayer[layer].Observe(float64(depth))
+	}
+}
+
+// Digested implements commp.Observer.
+func (m *Metrics) Digested(d time.Duration, err error) {
+	m.digest.Observe(d.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues("digest", reason(err)).Inc()
+	}
+}
+
+// WriteFailed implements commp.Observer.
+func (m *Metrics) WriteFailed(err error) {
+	m.errors.WithLabelValues("write", reason(err)).Inc()
+}
+
+func reason(err error) string {
+	switch {
+	case xerrors.Is(err, commp.ErrPayloadTooSmall):
+		return "payload_too_small"
+	case xerrors.Is(err, commp.ErrPayloadTooLarge):
+		return "payload_too_large"
+	}
+	return "other"
+}
@@ -0,0 +1,48 @@
+package commpprom
+
+import (
+	"strings"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New("commp")
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m)
+
+	cp := commp.New(commp.WithObserver(m))
+	cp.Write(make([]byte, 64))
+	if _, _, err := cp.Digest(); err == nil {
+		t.Fatal("unexpected success digesting a short payload")
+	}
+	if v := testutil.ToFloat64(m.active); v != 1 {
+		t.Fatalf("%v active pipelines, expected 1", v)
+	}
+	cp.Write(make([]byte, 127*1000-64))
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP commp_active_pipelines Pieces being hashed, each with its own set of tree layer workers.
+# TYPE commp_active_pipelines gauge
+commp_active_pipelines 0
+# HELP commp_bytes_hashed_total Payload bytes written to commP calculators.
+# TYPE commp_bytes_hashed_total counter
+commp_bytes_hashed_total 127000
+# HELP commp_errors_total Failed calls, by operation and reason.
+# TYPE commp_errors_total counter
+commp_errors_total{op="digest",reason="payload_too_small"} 1
+`), "commp_active_pipelines", "commp_bytes_hashed_total", "commp_errors_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(m, "commp_digest_duration_seconds"); n != 1 {
+		t.Fatalf("collected %d digest latency series, expected 1", n)
+	}
+}
@@ -0,0 +1,107 @@
+// Package commpunixfs turns a raw file into a deal payload in one go: it
+// chunks the file into a UnixFS DAG stored via a caller-supplied DAGService,
+// serializes the DAG as a CARv1 and computes the commP of the CAR while
+// writing it, returning the payload root CID and the piece CID together.
+//
+// The CAR is serialized deterministically by commpdag, so that the same file
+// imported with the same options always results in the same piece.
+package commpunixfs
+
+import (
+	"context"
+	"io"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpdag"
+	chunk "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+)
+
+// Option configures Import.
+type Option func(*config)
+
+type config struct {
+	chunkSize int64
+	maxLinks  int
+	rawLeaves bool
+	calcOpts  []commp.Option
+}
+
+// WithChunkSize sets the size of the leaves of the DAG, chunk.DefaultBlockSize
+// unless set.
+func WithChunkSize(n int64) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.chunkSize = n
+		}
+	}
+}
+
+// WithMaxLinks sets the maximum amount of children of a DAG node,
+// helpers.DefaultLinksPerBlock unless set.
+func WithMaxLinks(n int) Option {
+	return func(c *config) {
+		if n > 1 {
+			c.maxLinks = n
+		}
+	}
+}
+
+// WithRawLeaves controls whether the leaves of the DAG are raw blocks, as
+// they are by default, or UnixFS nodes wrapping the file data.
+func WithRawLeaves(raw bool) Option {
+	return func(c *config) {
+		c.rawLeaves = raw
+	}
+}
+
+// WithCalcOptions applies opts to the commp.Calc hashing the CAR.
+func WithCalcOptions(opts ...commp.Option) Option {
+	return func(c *config) {
+		c.calcOpts = append(c.calcOpts, opts...)
+	}
+}
+
+// Result describes an imported file, whose Root is the root of its UnixFS
+// DAG.
+type Result = commpdag.Result
+
+// Import chunks r into a UnixFS DAG with CIDv1 nodes, adding its blocks to
+// ds, then writes the CARv1 of the DAG to w while hashing it. A nil w only
+// hashes the CAR.
+func Import(ctx context.Context, r io.Reader, ds ipld.DAGService, w io.Writer, opts ...Option) (*Result, error) {
+	cfg := config{
+		chunkSize: chunk.DefaultBlockSize,
+		maxLinks:  helpers.DefaultLinksPerBlock,
+		rawLeaves: true,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	params := helpers.DagBuilderParams{
+		Dagserv:   ds,
+		Maxlinks:  cfg.maxLinks,
+		RawLeaves: cfg.rawLeaves,
+		CidBuilder: cid.Prefix{
+			Version:  1,
+			Codec:    cid.DagProtobuf,
+			MhType:   multihash.SHA2_256,
+			MhLength: -1,
+		},
+	}
+	db, err := params.New(chunk.NewSizeSplitter(r, cfg.chunkSize))
+	if err != nil {
+		return nil, err
+	}
+	root, err := balanced.Layout(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return commpdag.HashDAG(ctx, ds, root.Cid(), w, cfg.calcOpts...)
+}
@@ -0,0 +1,47 @@
+package commpunixfs
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/commpcar"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+)
+
+func TestImport(t *testing.T) {
+	data := make([]byte, 3<<20+17)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	ctx := context.Background()
+	var car bytes.Buffer
+	res, err := Import(ctx, bytes.NewReader(data), mdtest.Mock(), &car, WithChunkSize(1<<16), WithMaxLinks(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, err := commpcar.Sum(bytes.NewReader(car.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.CommP, exp.CommP) || res.PaddedPieceSize != exp.PaddedPieceSize || res.PayloadSize != exp.PayloadSize {
+		t.Fatalf("got %X/%d of %d bytes, expected %X/%d of %d bytes", res.CommP, res.PaddedPieceSize, res.PayloadSize, exp.CommP, exp.PaddedPieceSize, exp.PayloadSize)
+	}
+	if len(exp.Roots) != 1 || !bytes.Equal(exp.Roots[0], res.Root.Bytes()) {
+		t.Fatalf("CAR rooted at %X instead of %s", exp.Roots, res.Root)
+	}
+	// 49 leaves, 7 intermediate nodes and the root
+	if exp.Blocks != 57 {
+		t.Fatalf("CAR of %d blocks", exp.Blocks)
+	}
+
+	// a second import of the same file results in the same piece
+	again, err := Import(ctx, bytes.NewReader(data), mdtest.Mock(), nil, WithChunkSize(1<<16), WithMaxLinks(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.PieceCID.Equals(res.PieceCID) || !again.Root.Equals(res.Root) {
+		t.Fatalf("reimport resulted in %s/%s instead of %s/%s", again.Root, again.PieceCID, res.Root, res.PieceCID)
+	}
+}
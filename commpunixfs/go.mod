@@ -0,0 +1,17 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/commpunixfs
+
+go 1.21
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/filecoin-project/go-fil-commp-hashhash/commpdag v0.0.0
+	github.com/ipfs/boxo v0.21.0
+	github.com/ipfs/go-cid v0.4.1
+	github.com/ipfs/go-ipld-format v0.6.0
+	github.com/multiformats/go-multihash v0.2.3
+)
+
+replace (
+	github.com/filecoin-project/go-fil-commp-hashhash => ../
+	github.com/filecoin-project/go-fil-commp-hashhash/commpdag => ../commpdag
+)
@@ -0,0 +1,223 @@
+package datasegment
+
+import (
+	"io"
+	"io/ioutil"
+	"math/bits"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+	"golang.org/x/xerrors"
+)
+
+// Builder assembles an aggregate piece out of a sequence of sub-pieces, writing
+// the resulting unpadded payload to an io.Writer while simultaneously deriving
+// the commP of every sub-piece and of the aggregate itself. Every sub-piece is
+// placed at the next offset aligned to its own padded size, and the data
+// segment index is appended at the end of the aggregate by Finish().
+type Builder struct {
+	dealSize uint64
+	out      io.Writer
+	agg      *commp.Calc
+	written  uint64 // unpadded bytes written so far
+	filled   uint64 // padded offset past the end of the last sub-piece
+	index    []SegmentDesc
+	err      error
+}
+
+// NewBuilder returns a Builder for an aggregate of the given padded size,
+// writing the aggregate payload to out. A nil out discards the payload, which
+// is useful when only the commitments and the index are of interest.
+func NewBuilder(dealPaddedSize uint64, out io.Writer) (*Builder, error) {
+	if err := validateDealSize(dealPaddedSize); err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = ioutil.Discard
+	}
+	return &Builder{
+		dealSize: dealPaddedSize,
+		out:      out,
+		agg:      new(commp.Calc),
+	}, nil
+}
+
+// AddPiece reads exactly payloadSize bytes from r and places them in the
+// aggregate as the next sub-piece, returning the corresponding index entry.
+// The payload size needs to be known upfront in order to determine the
+// alignment of the sub-piece.
+func (b *Builder) AddPiece(r io.Reader, payloadSize uint64) (SegmentDesc, error) {
+	if b.err != nil {
+		return SegmentDesc{}, b.err
+	}
+
+	if payloadSize < commp.MinPiecePayload {
+		return SegmentDesc{}, &commp.PayloadSizeError{
+			Err:   commp.ErrPayloadTooSmall,
+			Limit: commp.MinPiecePayload,
+			Size:  payloadSize,
+		}
+	}
+	size := uint64(commp.UnpaddedPieceSize(payloadSize).NextPowerOfTwo().Padded())
+	offset, err := placeSegment(b.dealSize, len(b.index), b.filled, size)
+	if err != nil {
+		return SegmentDesc{}, err
+	}
+
+	// from here on any failure leaves the aggregate in an inconsistent state
+	if err := b.writeZeroes(offset/128*127 - b.written); err != nil {
+		return SegmentDesc{}, b.fail(err)
+	}
+
+	sub := new(commp.Calc)
+	n, err := io.Copy(io.MultiWriter(b.agg, b.out, sub), io.LimitReader(r, int64(payloadSize)))
+	b.written += uint64(n)
+	if err == nil && uint64(n) != payloadSize {
+		err = xerrors.Errorf("sub-piece payload truncated: expected %d bytes, got %d", payloadSize, n)
+	}
+	if err != nil {
+		sub.Reset()
+		return SegmentDesc{}, b.fail(err)
+	}
+
+	commP, subSize, err := sub.Digest()
+	if err != nil {
+		return SegmentDesc{}, b.fail(err)
+	}
+	if subSize != size {
+		panic("mismatch between the predicted and actual padded sub-piece size")
+	}
+
+	sd, err := NewSegmentDesc(commP, offset, size)
+	if err != nil {
+		return SegmentDesc{}, b.fail(err)
+	}
+	b.index = append(b.index, sd)
+	b.filled = offset + size
+	return sd, nil
+}
+
+// Finish zero-fills the aggregate up to the index region, writes out the data
+// segment index and returns the raw commP of the entire aggregate together with
+// the index entries of all sub-pieces. The Builder can not be used afterwards.
+func (b *Builder) Finish() ([]byte, []SegmentDesc, error) {
+	if b.err != nil {
+		return nil, nil, b.err
+	}
+
+	indexStart := DataSegmentIndexStartOffset(b.dealSize)
+	if err := b.writeZeroes(indexStart/128*127 - b.written); err != nil {
+		return nil, nil, b.fail(err)
+	}
+
+	// serialize the index in its padded form, then unpad it into the payload
+	padded := make([]byte, b.dealSize-indexStart)
+	for i, sd := range b.index {
+		ser := sd.Serialize()
+		copy(padded[i*EntrySize:], ser[:])
+	}
+	unpadded := make([]byte, len(padded)/128*127)
+	fr32.Unpad(padded, unpadded)
+	if err := b.write(unpadded); err != nil {
+		return nil, nil, b.fail(err)
+	}
+
+	commP, aggSize, err := b.agg.Digest()
+	if err != nil {
+		return nil, nil, b.fail(err)
+	}
+	if aggSize != b.dealSize {
+		panic("mismatch between the requested and actual aggregate size")
+	}
+
+	b.err = xerrors.New("aggregate already finished")
+	return commP, b.index, nil
+}
+
+// NewIndex lays out sub-pieces with the given raw commPs and padded sizes in an
+// aggregate of the given padded size, in order and exactly like Builder does,
+// returning their index entries. Together with AggregateCommP this allows
+// planning an aggregate from the commitments of its sub-pieces alone.
+func NewIndex(dealPaddedSize uint64, pieces []commp.PieceInfo) ([]SegmentDesc, error) {
+	if err := validateDealSize(dealPaddedSize); err != nil {
+		return nil, err
+	}
+
+	var filled uint64
+	index := make([]SegmentDesc, 0, len(pieces))
+	for i, p := range pieces {
+		if err := commp.PaddedPieceSize(p.PaddedPieceSize).Validate(); err != nil {
+			return nil, xerrors.Errorf("sub-piece %d: %w", i, err)
+		}
+		offset, err := placeSegment(dealPaddedSize, len(index), filled, p.PaddedPieceSize)
+		if err != nil {
+			return nil, err
+		}
+		sd, err := NewSegmentDesc(p.CommP, offset, p.PaddedPieceSize)
+		if err != nil {
+			return nil, xerrors.Errorf("sub-piece %d: %w", i, err)
+		}
+		index = append(index, sd)
+		filled = offset + p.PaddedPieceSize
+	}
+	return index, nil
+}
+
+func validateDealSize(dealPaddedSize uint64) error {
+	if bits.OnesCount64(dealPaddedSize) != 1 || dealPaddedSize < 2*MaxIndexEntriesInDeal(dealPaddedSize)*EntrySize {
+		return xerrors.Errorf("deal size %d is not a power of 2 large enough to hold the data segment index", dealPaddedSize)
+	}
+	if dealPaddedSize > commp.MaxPiecePayload/127*128 {
+		return xerrors.Errorf("deal size %d larger than Filecoin maximum of %d bytes", dealPaddedSize, commp.MaxPiecePayload/127*128)
+	}
+	return nil
+}
+
+// placeSegment returns the offset of a sub-piece of the given padded size added
+// to an aggregate holding count sub-pieces, filled up to the given offset.
+func placeSegment(dealPaddedSize uint64, count int, filled, size uint64) (uint64, error) {
+	if uint64(count) >= MaxIndexEntriesInDeal(dealPaddedSize) {
+		return 0, xerrors.Errorf("aggregate of %d bytes can not hold more than %d sub-pieces", dealPaddedSize, count)
+	}
+
+	offset := (filled + size - 1) / size * size
+	if offset+size > DataSegmentIndexStartOffset(dealPaddedSize) {
+		return 0, xerrors.Errorf(
+			"sub-piece of padded size %d at offset %d overlaps the index region starting at %d",
+			size, offset, DataSegmentIndexStartOffset(dealPaddedSize),
+		)
+	}
+	return offset, nil
+}
+
+func (b *Builder) fail(err error) error {
+	b.err = err
+	b.agg.Reset()
+	return err
+}
+
+func (b *Builder) write(buf []byte) error {
+	if _, err := b.agg.Write(buf); err != nil {
+		return err
+	}
+	if _, err := b.out.Write(buf); err != nil {
+		return err
+	}
+	b.written += uint64(len(buf))
+	return nil
+}
+
+func (b *Builder) writeZeroes(n uint64) error {
+	zeroes := make([]byte, 127<<10)
+	for n > 0 {
+		chunk := zeroes
+		if n < uint64(len(chunk)) {
+			chunk = chunk[:n]
+		}
+		if err := b.write(chunk); err != nil {
+			return err
+		}
+		n -= uint64(len(chunk))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package datasegment
+
+import (
+	"bytes"
+	"testing"
+
+	randmath "math/rand"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	const dealSize = 1 << 20
+
+	rnd := randmath.New(randmath.NewSource(1337))
+	var out bytes.Buffer
+
+	b, err := NewBuilder(dealSize, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var filled uint64
+	payloads := make([][]byte, 0)
+	for _, size := range []int{1000, 65, 127 * 64, 3000, 127, 100000, 5000} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		payloads = append(payloads, payload)
+
+		sd, err := b.AddPiece(bytes.NewReader(payload), uint64(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd.Offset%sd.Size != 0 {
+			t.Fatalf("sub-piece of size %d placed at unaligned offset %d", sd.Size, sd.Offset)
+		}
+		if sd.Offset < filled {
+			t.Fatalf("sub-piece at offset %d overlaps the previous one ending at %d", sd.Offset, filled)
+		}
+		filled = sd.Offset + sd.Size
+	}
+
+	aggCommP, index, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.Finish(); err == nil {
+		t.Fatal("unexpected success finishing an aggregate twice")
+	}
+
+	if out.Len() != dealSize/128*127 {
+		t.Fatalf("aggregate payload is %d bytes, expected %d", out.Len(), dealSize/128*127)
+	}
+
+	// capture the padded representation of the index region while rehashing
+	indexStart := DataSegmentIndexStartOffset(dealSize)
+	var paddedIndex []byte
+	cp := commp.New(commp.WithLeafObserver(func(idx uint64, leaf []byte) {
+		if idx*32 >= indexStart {
+			paddedIndex = append(paddedIndex, leaf...)
+		}
+	}))
+	cp.Write(out.Bytes())
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paddedSize != dealSize || !bytes.Equal(commP, aggCommP) {
+		t.Fatal("aggregate commP does not match the hash of the aggregate payload")
+	}
+
+	for i, sd := range index {
+		if err := sd.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		start := sd.Offset / 128 * 127
+		cp.Write(out.Bytes()[start : start+uint64(len(payloads[i]))])
+		subCommP, subSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subSize != sd.Size || !bytes.Equal(subCommP, sd.CommDs[:]) {
+			t.Fatalf("sub-piece %d does not match its index entry", i)
+		}
+
+		ser := sd.Serialize()
+		if !bytes.Equal(paddedIndex[i*EntrySize:(i+1)*EntrySize], ser[:]) {
+			t.Fatalf("index entry %d not found at its expected location", i)
+		}
+	}
+	if !bytes.Equal(paddedIndex[len(index)*EntrySize:], make([]byte, len(paddedIndex)-len(index)*EntrySize)) {
+		t.Fatal("unused index entries are not zero")
+	}
+
+	// the same layout and commitment derived from the sub-piece commPs alone
+	pieces := make([]commp.PieceInfo, len(index))
+	for i := range index {
+		pieces[i] = commp.PieceInfo{CommP: index[i].CommDs[:], PaddedPieceSize: index[i].Size}
+	}
+	planned, err := NewIndex(dealSize, pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range index {
+		if planned[i] != index[i] {
+			t.Fatalf("planned index entry %d %+v does not match the built %+v", i, planned[i], index[i])
+		}
+	}
+	plannedCommP, err := AggregateCommP(dealSize, planned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plannedCommP, aggCommP) {
+		t.Fatalf("planned aggregate commP 0x%X does not match the built 0x%X", plannedCommP, aggCommP)
+	}
+}
+
+func TestBuilderLimits(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewBuilder(3000, nil); err == nil {
+		t.Fatal("unexpected success creating a non power-of-two aggregate")
+	}
+
+	b, err := NewBuilder(16<<10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddPiece(bytes.NewReader(make([]byte, 64)), 64); err == nil {
+		t.Fatal("unexpected success adding an undersized sub-piece")
+	}
+	if _, err := b.AddPiece(bytes.NewReader(make([]byte, 8128)), 8128); err != nil {
+		t.Fatal(err)
+	}
+	// the second half of the aggregate overlaps the index
+	if _, err := b.AddPiece(bytes.NewReader(make([]byte, 8128)), 8128); err == nil {
+		t.Fatal("unexpected success adding a sub-piece overlapping the index")
+	}
+	if _, err := b.AddPiece(bytes.NewReader(make([]byte, 10)), 100); err == nil {
+		t.Fatal("unexpected success adding a truncated sub-piece")
+	}
+	if _, _, err := b.Finish(); err == nil {
+		t.Fatal("unexpected success finishing a failed aggregate")
+	}
+}
+
+func TestSegmentDesc(t *testing.T) {
+	t.Parallel()
+
+	commP := bytes.Repeat([]byte{0x3F}, 32)
+	sd, err := NewSegmentDesc(commP, 1<<20, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if sd.Checksum[ChecksumSize-1]&0xC0 != 0 {
+		t.Fatal("checksum is not a valid fr32 fragment")
+	}
+	sd.Size++
+	if sd.Validate() == nil {
+		t.Fatal("unexpected successful validation of a modified entry")
+	}
+
+	if _, err := NewSegmentDesc(bytes.Repeat([]byte{0xFF}, 32), 0, 128); err == nil {
+		t.Fatal("unexpected success creating an entry with an invalid commP")
+	}
+}
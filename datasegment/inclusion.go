@@ -0,0 +1,228 @@
+package datasegment
+
+import (
+	"bytes"
+	"math/bits"
+	"sort"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// ProofData is a Merkle path from a node to the root of the aggregate tree.
+// Index is the position of the proven node within its level, and Path holds
+// the sibling nodes from the level of the proven node up to just below the
+// root.
+type ProofData struct {
+	Path  [][]byte
+	Index uint64
+}
+
+// InclusionProof is a proof of data segment inclusion (PoDSI) as described by
+// FRC-0058. ProofSubtree demonstrates that the sub-piece is located at the
+// recorded offset within the aggregate, while ProofIndex demonstrates that the
+// aggregate contains a valid index entry describing the same sub-piece.
+type InclusionProof struct {
+	ProofSubtree ProofData
+	ProofIndex   ProofData
+}
+
+// ComputeInclusionProof returns the inclusion proof for the sub-piece described
+// by entry i of the index of an aggregate of the given padded size, as returned
+// by Builder.Finish(). The proof is derived entirely from the index, without
+// access to the aggregate payload.
+func ComputeInclusionProof(dealPaddedSize uint64, index []SegmentDesc, i int) (*InclusionProof, error) {
+	if i < 0 || i >= len(index) {
+		return nil, xerrors.Errorf("entry %d does not exist in an index of %d entries", i, len(index))
+	}
+	if uint64(len(index)) > MaxIndexEntriesInDeal(dealPaddedSize) {
+		return nil, xerrors.Errorf("aggregate of %d bytes can not hold %d entries", dealPaddedSize, len(index))
+	}
+
+	t, err := newAggregateTree(dealPaddedSize, index)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := index[i]
+	sdLevel := uint(bits.TrailingZeros64(sd.Size)) - 5
+
+	return &InclusionProof{
+		ProofSubtree: t.path(sdLevel, sd.Offset/sd.Size),
+		ProofIndex:   t.path(1, (DataSegmentIndexStartOffset(dealPaddedSize)+uint64(i)*EntrySize)/EntrySize),
+	}, nil
+}
+
+// AggregateCommP returns the raw commP of an aggregate of the given padded size
+// with the given index, e.g. as returned by NewIndex. Like the inclusion proofs
+// it is derived entirely from the index, as the gaps between the sub-pieces of
+// an aggregate are zero-filled.
+func AggregateCommP(dealPaddedSize uint64, index []SegmentDesc) ([]byte, error) {
+	if uint64(len(index)) > MaxIndexEntriesInDeal(dealPaddedSize) {
+		return nil, xerrors.Errorf("aggregate of %d bytes can not hold %d entries", dealPaddedSize, len(index))
+	}
+
+	t, err := newAggregateTree(dealPaddedSize, index)
+	if err != nil {
+		return nil, err
+	}
+	return t.node(t.height, 0), nil
+}
+
+// Verify checks that the proof demonstrates the inclusion of the described
+// sub-piece in an aggregate with the given raw commP and padded size.
+func (ip *InclusionProof) Verify(aggCommP []byte, dealPaddedSize uint64, sd SegmentDesc) error {
+	if bits.OnesCount64(dealPaddedSize) != 1 || dealPaddedSize < 128 {
+		return xerrors.Errorf("deal size %d is not a power of 2 of at least 128 bytes", dealPaddedSize)
+	}
+	if bits.OnesCount64(sd.Size) != 1 || sd.Size < 128 || sd.Offset%sd.Size != 0 {
+		return xerrors.Errorf("segment of size %d at offset %d is not a valid aligned sub-piece", sd.Size, sd.Offset)
+	}
+	if err := sd.Validate(); err != nil {
+		return err
+	}
+
+	sdLevel := uint(bits.TrailingZeros64(sd.Size)) - 5
+	if ip.ProofSubtree.Index != sd.Offset/sd.Size {
+		return xerrors.Errorf("subtree proof is for node %d, not for the segment at offset %d", ip.ProofSubtree.Index, sd.Offset)
+	}
+	if err := verifyPath(aggCommP, dealPaddedSize, sd.CommDs[:], sdLevel, ip.ProofSubtree); err != nil {
+		return xerrors.Errorf("invalid subtree proof: %w", err)
+	}
+
+	indexStart := DataSegmentIndexStartOffset(dealPaddedSize)
+	if ip.ProofIndex.Index < indexStart/EntrySize || ip.ProofIndex.Index >= dealPaddedSize/EntrySize {
+		return xerrors.Errorf("index proof for node %d outside of the index region", ip.ProofIndex.Index)
+	}
+	ser := sd.Serialize()
+	if err := verifyPath(aggCommP, dealPaddedSize, hashNodes(ser[:32], ser[32:]), 1, ip.ProofIndex); err != nil {
+		return xerrors.Errorf("invalid index proof: %w", err)
+	}
+
+	return nil
+}
+
+func verifyPath(root []byte, dealPaddedSize uint64, node []byte, level uint, pd ProofData) error {
+	height := uint(bits.TrailingZeros64(dealPaddedSize)) - 5
+	if uint(len(pd.Path)) != height-level {
+		return xerrors.Errorf("path of length %d does not match a node at level %d of a tree with height %d", len(pd.Path), level, height)
+	}
+	if pd.Index >= 1<<(height-level) {
+		return xerrors.Errorf("node %d does not exist at level %d of a tree with height %d", pd.Index, level, height)
+	}
+
+	idx := pd.Index
+	for _, sibling := range pd.Path {
+		if len(sibling) != 32 {
+			return xerrors.Errorf("path contains a node of %d bytes", len(sibling))
+		}
+		if idx&1 == 0 {
+			node = hashNodes(node, sibling)
+		} else {
+			node = hashNodes(sibling, node)
+		}
+		idx >>= 1
+	}
+
+	if !bytes.Equal(node, root) {
+		return xerrors.Errorf("computed root 0x%X does not match expected 0x%X", node, root)
+	}
+	return nil
+}
+
+// aggregateTree computes arbitrary nodes of an aggregate tree from its layout.
+type aggregateTree struct {
+	height     uint
+	indexStart uint64
+	index      []byte // serialized index region
+	segments   []SegmentDesc
+}
+
+func newAggregateTree(dealPaddedSize uint64, index []SegmentDesc) (*aggregateTree, error) {
+	if bits.OnesCount64(dealPaddedSize) != 1 || dealPaddedSize < 2*MaxIndexEntriesInDeal(dealPaddedSize)*EntrySize {
+		return nil, xerrors.Errorf("deal size %d is not a power of 2 large enough to hold the data segment index", dealPaddedSize)
+	}
+
+	t := &aggregateTree{
+		height:     uint(bits.TrailingZeros64(dealPaddedSize)) - 5,
+		indexStart: DataSegmentIndexStartOffset(dealPaddedSize),
+		index:      make([]byte, MaxIndexEntriesInDeal(dealPaddedSize)*EntrySize),
+		segments:   make([]SegmentDesc, len(index)),
+	}
+
+	for i, sd := range index {
+		if bits.OnesCount64(sd.Size) != 1 || sd.Size < 128 || sd.Offset%sd.Size != 0 || sd.Offset+sd.Size > t.indexStart {
+			return nil, xerrors.Errorf("entry %d of size %d at offset %d is not a valid aligned sub-piece", i, sd.Size, sd.Offset)
+		}
+		ser := sd.Serialize()
+		copy(t.index[i*EntrySize:], ser[:])
+	}
+
+	copy(t.segments, index)
+	sort.Slice(t.segments, func(i, j int) bool { return t.segments[i].Offset < t.segments[j].Offset })
+	for i := 1; i < len(t.segments); i++ {
+		if t.segments[i-1].Offset+t.segments[i-1].Size > t.segments[i].Offset {
+			return nil, xerrors.Errorf("segments at offsets %d and %d overlap", t.segments[i-1].Offset, t.segments[i].Offset)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *aggregateTree) path(level uint, idx uint64) ProofData {
+	pd := ProofData{Index: idx}
+	for l := level; l < t.height; l++ {
+		pd.Path = append(pd.Path, t.node(l, idx^1))
+		idx >>= 1
+	}
+	return pd
+}
+
+func (t *aggregateTree) node(level uint, idx uint64) []byte {
+	size := uint64(32) << level
+	start := idx * size
+
+	// within the index region
+	if start >= t.indexStart {
+		if level == 0 {
+			return t.index[start-t.indexStart : start-t.indexStart+32]
+		}
+	} else {
+		// first segment ending past the start of the region
+		i := sort.Search(len(t.segments), func(i int) bool {
+			return t.segments[i].Offset+t.segments[i].Size > start
+		})
+		if i == len(t.segments) || t.segments[i].Offset >= start+size {
+			if start+size <= t.indexStart {
+				return zeroNode(level)
+			}
+		} else if t.segments[i].Offset == start && t.segments[i].Size == size {
+			return t.segments[i].CommDs[:]
+		} else if t.segments[i].Offset <= start && t.segments[i].Offset+t.segments[i].Size >= start+size {
+			panic("requested a node from within a sub-piece")
+		}
+	}
+
+	return hashNodes(t.node(level-1, 2*idx), t.node(level-1, 2*idx+1))
+}
+
+func zeroNode(level uint) []byte {
+	if level >= 2 {
+		n, _ := commp.ZeroPieceCommP(32 << level)
+		return n
+	}
+	n := make([]byte, 32)
+	for ; level > 0; level-- {
+		n = hashNodes(n, n)
+	}
+	return n
+}
+
+func hashNodes(left, right []byte) []byte {
+	h := newSha256()
+	h.Write(left)
+	h.Write(right)
+	d := h.Sum(make([]byte, 0, 32))
+	d[31] &= 0x3F
+	return d
+}
@@ -0,0 +1,59 @@
+package datasegment
+
+import (
+	"bytes"
+	"testing"
+
+	randmath "math/rand"
+)
+
+func TestInclusionProof(t *testing.T) {
+	t.Parallel()
+
+	const dealSize = 1 << 20
+
+	rnd := randmath.New(randmath.NewSource(42))
+	b, err := NewBuilder(dealSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{65, 127 * 100, 3000, 127, 200000, 1000} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		if _, err := b.AddPiece(bytes.NewReader(payload), uint64(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aggCommP, index, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, sd := range index {
+		proof, err := ComputeInclusionProof(dealSize, index, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proof.Verify(aggCommP, dealSize, sd); err != nil {
+			t.Fatalf("entry %d: %s", i, err)
+		}
+
+		// a proof for one segment does not prove another
+		other := index[(i+1)%len(index)]
+		if proof.Verify(aggCommP, dealSize, other) == nil {
+			t.Fatalf("entry %d: proof unexpectedly valid for entry %d", i, (i+1)%len(index))
+		}
+
+		// neither does a forged entry with a valid checksum
+		forged, _ := NewSegmentDesc(sd.CommDs[:], sd.Offset, sd.Size)
+		forged.CommDs[0] ^= 0x01
+		forged.Checksum = forged.computeChecksum()
+		if proof.Verify(aggCommP, dealSize, forged) == nil {
+			t.Fatalf("entry %d: proof unexpectedly valid for a forged entry", i)
+		}
+	}
+
+	if _, err := ComputeInclusionProof(dealSize, index, len(index)); err == nil {
+		t.Fatal("unexpected proof for a non-existent entry")
+	}
+}
@@ -0,0 +1,94 @@
+// Package datasegment implements the construction of aggregate pieces with an
+// embedded data segment index, as specified by FRC-0058:
+// https://github.com/filecoin-project/FIPs/blob/master/FRCs/frc-0058.md
+//
+// All offsets and sizes within this package are expressed in padded bytes,
+// matching the representation used within the index itself.
+package datasegment
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// EntrySize is the size of a single serialized index entry.
+const EntrySize = 64
+
+// ChecksumSize is the size of the truncated checksum protecting an entry.
+const ChecksumSize = 16
+
+// MaxIndexEntriesInDeal returns the amount of index entries reserved at the end
+// of an aggregate piece of the given padded size.
+func MaxIndexEntriesInDeal(dealPaddedSize uint64) uint64 {
+	res := (uint64(1) << uint(bits.TrailingZeros64(dealPaddedSize))) / 2048 / EntrySize
+	if res < 4 {
+		return 4
+	}
+	return res
+}
+
+// DataSegmentIndexStartOffset returns the padded offset at which the index
+// region starts within an aggregate piece of the given padded size. The region
+// extends to the end of the piece.
+func DataSegmentIndexStartOffset(dealPaddedSize uint64) uint64 {
+	return dealPaddedSize - MaxIndexEntriesInDeal(dealPaddedSize)*EntrySize
+}
+
+// SegmentDesc is a single entry of the data segment index, describing one
+// sub-piece of an aggregate.
+type SegmentDesc struct {
+	CommDs   [32]byte
+	Offset   uint64
+	Size     uint64
+	Checksum [ChecksumSize]byte
+}
+
+// NewSegmentDesc returns an index entry for a sub-piece with the given raw
+// commP, located at the given padded offset and of the given padded size, with
+// its checksum already computed.
+func NewSegmentDesc(commP []byte, offset, size uint64) (SegmentDesc, error) {
+	var sd SegmentDesc
+	if len(commP) != 32 {
+		return sd, xerrors.Errorf("provided commP must be exactly 32 bytes long, got %d bytes instead", len(commP))
+	}
+	if commP[31]&0xC0 != 0 {
+		return sd, xerrors.New("provided commP is not a valid fr32 node: the two most significant bits are set")
+	}
+	copy(sd.CommDs[:], commP)
+	sd.Offset = offset
+	sd.Size = size
+	sd.Checksum = sd.computeChecksum()
+	return sd, nil
+}
+
+// Serialize returns the 64-byte representation of the entry, which is a pair of
+// valid fr32 tree nodes.
+func (sd SegmentDesc) Serialize() [EntrySize]byte {
+	var out [EntrySize]byte
+	copy(out[:32], sd.CommDs[:])
+	binary.LittleEndian.PutUint64(out[32:40], sd.Offset)
+	binary.LittleEndian.PutUint64(out[40:48], sd.Size)
+	copy(out[48:], sd.Checksum[:])
+	return out
+}
+
+// Validate checks the consistency of the entry checksum.
+func (sd SegmentDesc) Validate() error {
+	if sd.Checksum != sd.computeChecksum() {
+		return xerrors.Errorf("checksum mismatch for segment at offset %d of size %d", sd.Offset, sd.Size)
+	}
+	return nil
+}
+
+func (sd SegmentDesc) computeChecksum() [ChecksumSize]byte {
+	sd.Checksum = [ChecksumSize]byte{}
+	ser := sd.Serialize()
+	digest := sum256(ser[:])
+
+	var res [ChecksumSize]byte
+	copy(res[:], digest[:])
+	res[ChecksumSize-1] &= 0x3F // keep the node a valid field element
+	return res
+}
@@ -0,0 +1,11 @@
+//go:build purego
+// +build purego
+
+package datasegment
+
+import "crypto/sha256"
+
+var (
+	newSha256 = sha256.New
+	sum256    = sha256.Sum256
+)
@@ -0,0 +1,11 @@
+//go:build !purego
+// +build !purego
+
+package datasegment
+
+import sha256simd "github.com/minio/sha256-simd"
+
+var (
+	newSha256 = sha256simd.New
+	sum256    = sha256simd.Sum256
+)
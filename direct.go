@@ -0,0 +1,25 @@
+package commp
+
+// directBufSize is the size of the reads of HashFileDirect, a multiple of the
+// logical block size of any storage device.
+const directBufSize = 8 << 20
+
+// directBuffers is the amount of reads of HashFileDirect in flight while the
+// payload read before them is hashed.
+const directBuffers = 4
+
+// HashFileDirect returns the raw commP and padded piece size of the file at
+// path, as computed by a Calc configured with opts. On linux the file is read
+// with O_DIRECT into aligned buffers, bypassing the page cache, by a goroutine
+// staying up to directBuffers reads ahead of the hashing. Overlapping I/O with
+// computation this way keeps sources with a high latency, such as spinning
+// disks, busy. Files on filesystems without O_DIRECT support, and on other
+// platforms, are read the regular way.
+func HashFileDirect(path string, opts ...Option) (commP []byte, paddedPieceSize uint64, err error) {
+	cp := New(opts...)
+	defer cp.Reset()
+	if err := hashFileDirect(cp, path); err != nil {
+		return nil, 0, err
+	}
+	return cp.Digest()
+}
@@ -0,0 +1,88 @@
+package commp
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// directAlign is the alignment of the buffers of O_DIRECT reads.
+const directAlign = 4096
+
+type directRead struct {
+	buf []byte
+	err error
+}
+
+func hashFileDirect(cp *Calc, path string) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECT, 0)
+	if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EINVAL {
+		// the filesystem does not support O_DIRECT
+		if f, err = os.Open(path); err != nil {
+			return err
+		}
+		defer f.Close()
+		return readFile(cp, f)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	free := make(chan []byte, directBuffers)
+	for i := 0; i < directBuffers; i++ {
+		free <- alignedBuffer(directBufSize)
+	}
+	// every buffer and a final error fit, the reader never blocks on it
+	full := make(chan directRead, directBuffers+1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(full)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-done:
+				return
+			}
+
+			// a read past the end is misaligned: stop at the first short one
+			n, err := f.Read(buf)
+			if n > 0 {
+				full <- directRead{buf: buf[:n]}
+			}
+			if err != nil && err != io.EOF {
+				full <- directRead{err: err}
+				return
+			}
+			if err != nil || n < len(buf) {
+				return
+			}
+		}
+	}()
+
+	for r := range full {
+		if r.err != nil {
+			return r.err
+		}
+		if _, err := cp.Write(r.buf); err != nil {
+			return err
+		}
+		free <- r.buf[:cap(r.buf)]
+	}
+	return nil
+}
+
+// alignedBuffer returns a buffer of size bytes starting at a multiple of
+// directAlign.
+func alignedBuffer(size int) []byte {
+	b := make([]byte, size+directAlign)
+	off := 0
+	if r := int(uintptr(unsafe.Pointer(&b[0])) & (directAlign - 1)); r > 0 {
+		off = directAlign - r
+	}
+	return b[off : off+size : off+size]
+}
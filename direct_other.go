@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package commp
+
+import "os"
+
+func hashFileDirect(cp *Calc, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readFile(cp, f)
+}
@@ -0,0 +1,53 @@
+package commp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestHashFileDirect(t *testing.T) {
+	// prefer a disk-backed directory: tmpfs does not support O_DIRECT
+	dir, err := ioutil.TempDir(".", "commp-direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rnd := rand.New(rand.NewSource(1))
+	path := filepath.Join(dir, "payload")
+	for _, size := range []int{65, 4096, 127 << 10, directBufSize, directBufSize*(directBuffers+1) + 1000} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		if err := ioutil.WriteFile(path, payload, 0644); err != nil {
+			t.Fatal(err)
+		}
+		expCommP, expSize, err := Sum(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commP, paddedSize, err := HashFileDirect(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("file of %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := HashFileDirect(path); !xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("expected ErrPayloadTooSmall for an empty file, got %v", err)
+	}
+	if _, _, err := HashFileDirect(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package commp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Sentinel errors identifying the class of a PayloadSizeError. Use errors.Is()
+// (or xerrors.Is() on older Go versions) to test for them, and errors.As() to
+// access the sizes involved.
+var (
+	ErrPayloadTooSmall = xerrors.New("payload too small")
+	ErrPayloadTooLarge = xerrors.New("payload too large")
+)
+
+// ErrInvalidPadding is returned by WritePadded() for input which is not the
+// result of an fr32 expansion.
+var ErrInvalidPadding = xerrors.New("invalid fr32 padding")
+
+// Sentinel errors identifying the class of a MisuseError.
+var (
+	ErrClosed           = xerrors.New("use of a closed Calc")
+	ErrDigestInProgress = xerrors.New("Digest() already in progress")
+	ErrPieceEnded       = xerrors.New("piece ended by a concurrent Digest() or Reset()")
+)
+
+// ErrDigestTimeout is the sentinel error wrapped by StallError.
+var ErrDigestTimeout = xerrors.New("digest timed out")
+
+// ErrMismatch is the sentinel error wrapped by MismatchError.
+var ErrMismatch = xerrors.New("commP mismatch")
+
+// PayloadSizeError is returned when the amount of payload is outside of the
+// range commP is defined for: either Digest()ing fewer than MinPiecePayload
+// bytes, or Write()ing past MaxPiecePayload bytes. It carries the state of the
+// accumulator at the time of the failure, so that callers can report e.g. how
+// much more data fits in the piece without redoing the arithmetic.
+type PayloadSizeError struct {
+	Err      error  // ErrPayloadTooSmall or ErrPayloadTooLarge
+	Limit    uint64 // the limit that was hit
+	Size     uint64 // the payload size that was attempted
+	Accepted uint64 // the payload bytes accepted before the failure
+}
+
+// Remaining returns how many more payload bytes could be added on top of the
+// accepted ones without going over MaxPiecePayload.
+func (e *PayloadSizeError) Remaining() uint64 {
+	if e.Accepted >= MaxPiecePayload {
+		return 0
+	}
+	return MaxPiecePayload - e.Accepted
+}
+
+// Missing returns how many more payload bytes are necessary on top of the
+// accepted ones in order to reach MinPiecePayload.
+func (e *PayloadSizeError) Missing() uint64 {
+	if e.Accepted >= MinPiecePayload {
+		return 0
+	}
+	return MinPiecePayload - e.Accepted
+}
+
+func (e *PayloadSizeError) Error() string {
+	if e.Err == ErrPayloadTooSmall {
+		return fmt.Sprintf(
+			"insufficient state accumulated: commP is not defined for inputs shorter than %d bytes, but only %d processed so far",
+			e.Limit, e.Size,
+		)
+	}
+	return fmt.Sprintf(
+		"payload of %d bytes would overflow the maximum supported unpadded piece size %d: at most %d more bytes can be added to the %d accepted so far",
+		e.Size, e.Limit, e.Remaining(), e.Accepted,
+	)
+}
+
+// Unwrap returns the sentinel error classifying e.
+func (e *PayloadSizeError) Unwrap() error { return e.Err }
+
+// MisuseError is returned by the methods of a Calc called in a state not
+// allowing them, see Lifecycle.
+type MisuseError struct {
+	Err   error     // ErrClosed, ErrDigestInProgress or ErrPieceEnded
+	Op    string    // the method called, e.g. "Write"
+	State Lifecycle // the state of the Calc at the time, Writing for a piece being digested
+}
+
+func (e *MisuseError) Error() string {
+	return fmt.Sprintf("%s() on a %s Calc: %s", e.Op, e.State, e.Err)
+}
+
+// Unwrap returns the sentinel error classifying e.
+func (e *MisuseError) Unwrap() error { return e.Err }
+
+// StallError is returned by Digest() when the layer workers do not complete
+// the tree within the timeout of WithDigestTimeout(). Layer is the one found
+// holding up the pipeline: normally the lowest one still processing nodes,
+// stuck within a NodeHasher, a TreeNodeSink or an Observer.
+type StallError struct {
+	Timeout time.Duration
+	Layer   uint
+	Stages  map[uint]string // of the workers still running, by layer
+}
+
+func (e *StallError) Error() string {
+	layers := make([]int, 0, len(e.Stages))
+	for l := range e.Stages {
+		layers = append(layers, int(l))
+	}
+	sort.Ints(layers)
+	stages := make([]string, len(layers))
+	for i, l := range layers {
+		stages[i] = fmt.Sprintf("%d:%s", l, e.Stages[uint(l)])
+	}
+	return fmt.Sprintf(
+		"digest timed out after %s, stalled at layer %d (workers by layer %s)",
+		e.Timeout, e.Layer, strings.Join(stages, " "),
+	)
+}
+
+// Unwrap returns ErrDigestTimeout.
+func (e *StallError) Unwrap() error { return ErrDigestTimeout }
+
+// MismatchError is returned by VerifyReader when the stream does not hash to
+// the expected commP and padded size, and by VerifyUnsealedSector when the
+// mismatch could not be localized.
+type MismatchError struct {
+	ExpectedCommP      []byte
+	ActualCommP        []byte
+	ExpectedPaddedSize uint64
+	ActualPaddedSize   uint64
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf(
+		"stream hashes to commP 0x%X with padded size %d, expected 0x%X with padded size %d",
+		e.ActualCommP, e.ActualPaddedSize, e.ExpectedCommP, e.ExpectedPaddedSize,
+	)
+}
+
+// Unwrap returns ErrMismatch.
+func (e *MismatchError) Unwrap() error { return ErrMismatch }
+
+// SectorFaultError is returned by VerifyUnsealedSector when the sector does
+// not hash to the expected commD, locating the first node of the checked level
+// which differs from the tree it was checked against. The fault lies within
+// the Size padded bytes of the sector starting at Offset.
+type SectorFaultError struct {
+	Level    uint
+	Index    uint64
+	Offset   uint64
+	Size     uint64
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *SectorFaultError) Error() string {
+	return fmt.Sprintf(
+		"node %d of level %d, covering %d padded bytes at offset %d, is 0x%X instead of 0x%X",
+		e.Index, e.Level, e.Size, e.Offset, e.Actual, e.Expected,
+	)
+}
+
+// Unwrap returns ErrMismatch.
+func (e *SectorFaultError) Unwrap() error { return ErrMismatch }
@@ -0,0 +1,33 @@
+package commp
+
+import (
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestPayloadSizeErrors(t *testing.T) {
+	cp := new(Calc)
+	cp.Write(make([]byte, 64))
+	_, _, err := cp.Digest()
+	if !xerrors.Is(err, ErrPayloadTooSmall) || xerrors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("unexpected error class for a short payload: %v", err)
+	}
+	var pse *PayloadSizeError
+	if !xerrors.As(err, &pse) || pse.Limit != MinPiecePayload || pse.Size != 64 || pse.Accepted != 64 || pse.Missing() != 1 {
+		t.Fatalf("unexpected error details for a short payload: %#v", err)
+	}
+	cp.Reset()
+
+	// pretend we are almost full, without writing 32GiB
+	cp = new(Calc)
+	cp.bytesConsumed = MaxPiecePayload - 10
+	_, err = cp.Write(make([]byte, 11))
+	if !xerrors.Is(err, ErrPayloadTooLarge) || xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("unexpected error class for an oversized payload: %v", err)
+	}
+	if !xerrors.As(err, &pse) || pse.Limit != MaxPiecePayload || pse.Size != MaxPiecePayload+1 ||
+		pse.Accepted != MaxPiecePayload-10 || pse.Remaining() != 10 {
+		t.Fatalf("unexpected error details for an oversized payload: %#v", err)
+	}
+}
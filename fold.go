@@ -0,0 +1,110 @@
+package commp
+
+// WithInlineFolding folds the first two levels of the tree of every 128-byte
+// block within the goroutine calling Write(), instead of within the background
+// worker receiving the blocks. Only the level 2 node of every block is then
+// handed to the background workers. This takes the hashing of 6 out of every
+// 7 nodes off the pipeline, which pays off when many Calcs are hashing at the
+// same time and every core is busy anyway, at the expense of the throughput of
+// a lone Calc. The resulting commP is the same either way. It has no effect in
+// combination with WithTreeHasher().
+func WithInlineFolding() Option {
+	return func(c *config) {
+		c.inlineFolding = true
+	}
+}
+
+// blockFolder reduces 128-byte blocks to their level 2 node, passing the nodes
+// of levels 0 and 1 to the sinks interested in them.
+type blockFolder struct {
+	nh        NodeHasher
+	pb        *pairBatch
+	maxBlocks int // folded at once, with a BatchHasher
+
+	sinks0, sinks1     []TreeNodeSink
+	leafIdx, level1Idx uint64
+	blocks             [][]byte // of the folding worker
+}
+
+// blockFolder returns the blockFolder of the Calc, retained across pieces, for
+// a new piece.
+func (cp *Calc) blockFolder() *blockFolder {
+	if cp.folderBuf == nil {
+		cp.folderBuf = cp.newBlockFolder()
+	}
+	cp.folderBuf.leafIdx, cp.folderBuf.level1Idx = 0, 0
+	return cp.folderBuf
+}
+
+func (cp *Calc) newBlockFolder() *blockFolder {
+	bf := &blockFolder{
+		nh:        cp.cfg.nodeHasher,
+		maxBlocks: 1,
+	}
+	if bf.nh == nil {
+		bf.nh = defaultNodeHasher
+	}
+
+	// with a BatchHasher fold as many already queued blocks as fit in a batch
+	if cp.cfg.batchHasher != nil {
+		bf.pb = newPairBatch(cp.cfg.batchHasher, cp.cfg.maxBatchPairs)
+		if cp.cfg.maxBatchPairs > 2 {
+			bf.maxBlocks = cp.cfg.maxBatchPairs / 2
+		}
+	}
+
+	for _, s := range cp.cfg.nodeSinks {
+		if s.minLevel == 0 {
+			bf.sinks0 = append(bf.sinks0, s.fn)
+		}
+		if s.minLevel <= 1 && s.maxLevel >= 1 {
+			bf.sinks1 = append(bf.sinks1, s.fn)
+		}
+	}
+	return bf
+}
+
+// fold leaves every block with its level 1 nodes at offsets 0 and 64, and its
+// level 2 node at offset 0.
+func (bf *blockFolder) fold(blocks [][]byte) {
+	for _, b := range blocks {
+		for i := 0; i < 128; i += 32 {
+			for _, sink := range bf.sinks0 {
+				sink(0, bf.leafIdx, b[i:i+32])
+			}
+			bf.leafIdx++
+		}
+	}
+
+	if bf.pb == nil {
+		for _, b := range blocks {
+			bf.nh.HashNodes(b[0:0], b[0:32], b[32:64])
+			bf.nh.HashNodes(b[64:64], b[64:96], b[96:128])
+		}
+	} else {
+		for _, b := range blocks {
+			bf.pb.addInPlace(b[0:32], b[32:64])
+			bf.pb.addInPlace(b[64:96], b[96:128])
+		}
+		bf.pb.hash()
+	}
+
+	for _, b := range blocks {
+		for _, sink := range bf.sinks1 {
+			sink(1, bf.level1Idx, b[0:32])
+			sink(1, bf.level1Idx+1, b[64:96])
+		}
+		bf.level1Idx += 2
+	}
+
+	if bf.pb == nil {
+		for _, b := range blocks {
+			bf.nh.HashNodes(b[0:0], b[0:32], b[64:96])
+		}
+	} else {
+		for _, b := range blocks {
+			bf.pb.addInPlace(b[0:32], b[64:96])
+		}
+		bf.pb.hash()
+	}
+}
@@ -0,0 +1,86 @@
+package commp
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestInlineFolding(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 127<<9)
+	rnd.Read(data)
+
+	for name, opts := range map[string][]Option{
+		"default": nil,
+		"scratch": {WithScratch(new(Scratch))},
+		"batch":   {WithBatchHasher(new(recordingBatchHasher), 16)},
+	} {
+		for _, size := range []int{65, 127, 128, 127 * 2, 127*3 + 1, 127 << 5, len(data)} {
+			var refNodes, nodes []string
+			collect := func(dst *[]string) TreeNodeSink {
+				var mu sync.Mutex
+				return func(level uint, index uint64, node []byte) {
+					mu.Lock()
+					*dst = append(*dst, fmt.Sprintf("%d/%d/%X", level, index, node))
+					mu.Unlock()
+				}
+			}
+
+			ref := New(append(opts, WithTreeLayers(0, collect(&refNodes)))...)
+			cp := New(append(opts, WithInlineFolding(), WithTreeLayers(0, collect(&nodes)))...)
+			ref.Write(data[:size])
+			cp.Write(data[:size])
+
+			expCommP, expSize, err := ref.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commP, expCommP) || paddedSize != expSize {
+				t.Fatalf("%s: %d bytes produced 0x%X / %d, expected 0x%X / %d", name, size, commP, paddedSize, expCommP, expSize)
+			}
+
+			if len(nodes) != len(refNodes) {
+				t.Fatalf("%s: %d bytes produced %d nodes, expected %d", name, size, len(nodes), len(refNodes))
+			}
+			seen := make(map[string]bool, len(refNodes))
+			for _, n := range refNodes {
+				seen[n] = true
+			}
+			for _, n := range nodes {
+				if !seen[n] {
+					t.Fatalf("%s: %d bytes produced unexpected node %s", name, size, n)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkInlineFolding(b *testing.B) {
+	data := make([]byte, 127<<14)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for name, opts := range map[string][]Option{
+		"worker": nil,
+		"inline": {WithInlineFolding()},
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.RunParallel(func(pb *testing.PB) {
+				cp := New(opts...)
+				for pb.Next() {
+					cp.Write(data)
+					if _, _, err := cp.Digest(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
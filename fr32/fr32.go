@@ -0,0 +1,135 @@
+// Package fr32 implements the bit-expansion applied by Filecoin to unpadded
+// piece payloads, ensuring every 32-byte leaf of the resulting tree is a valid
+// element of the BLS12-381 scalar field. Every 127 bytes (1016 bits) of payload
+// are split into 4 chunks of 254 bits, each stored in a 32-byte leaf with the
+// 2 topmost bits cleared, resulting in 128 bytes of padded output.
+package fr32
+
+import "fmt"
+
+const (
+	// UnpaddedBlockSize is the amount of payload bytes expanded at a time.
+	UnpaddedBlockSize = 127
+
+	// PaddedBlockSize is the amount of bytes resulting from the expansion of
+	// a single UnpaddedBlockSize block.
+	PaddedBlockSize = 128
+)
+
+// Pad performs the fr32 expansion of in, which must be a multiple of
+// UnpaddedBlockSize bytes long, into out, which must be able to hold the
+// corresponding multiple of PaddedBlockSize bytes. Every 127-byte block results
+// in 4 consecutive 32-byte leaves, with the 2 topmost bits of each leaf cleared.
+func Pad(in, out []byte) {
+	if len(in)%UnpaddedBlockSize != 0 {
+		panic(fmt.Sprintf("input of %d bytes is not a multiple of %d", len(in), UnpaddedBlockSize))
+	}
+	if len(out) < len(in)/UnpaddedBlockSize*PaddedBlockSize {
+		panic(fmt.Sprintf("output of %d bytes is too short for %d bytes of input", len(out), len(in)))
+	}
+
+	pad(in, out)
+}
+
+func padGeneric(in, out []byte) {
+	for len(in) > 0 {
+		padBlock(in, out)
+		in, out = in[UnpaddedBlockSize:], out[PaddedBlockSize:]
+	}
+}
+
+func padBlock(input, out []byte) {
+
+	// Cycle over four(4) 31-byte groups, leaving 1 byte in between:
+	// 31 + 1 + 31 + 1 + 31 + 1 + 31 = 127
+
+	// First 31 bytes + 6 bits are taken as-is (trimmed later)
+	copy(out, input[:32])
+
+	// first 2-bit "shim" forced into the otherwise identical bitstream
+	out[31] &= 0x3F
+
+	// simplify pointer math
+	inputPlus1, outPlus1 := input[1:], out[1:]
+
+	//  In: {{ C[7] C[6] }} X[7] X[6] X[5] X[4] X[3] X[2] X[1] X[0] Y[7] Y[6] Y[5] Y[4] Y[3] Y[2] Y[1] Y[0] Z[7] Z[6] Z[5]...
+	// Out:                 X[5] X[4] X[3] X[2] X[1] X[0] C[7] C[6] Y[5] Y[4] Y[3] Y[2] Y[1] Y[0] X[7] X[6] Z[5] Z[4] Z[3]...
+	for i := 31; i < 63; i++ {
+		outPlus1[i] = inputPlus1[i]<<2 | input[i]>>6
+	}
+
+	// next 2-bit shim
+	out[63] &= 0x3F
+
+	//  In: {{ C[7] C[6] C[5] C[4] }} X[7] X[6] X[5] X[4] X[3] X[2] X[1] X[0] Y[7] Y[6] Y[5] Y[4] Y[3] Y[2] Y[1] Y[0] Z[7] Z[6] Z[5]...
+	// Out:                           X[3] X[2] X[1] X[0] C[7] C[6] C[5] C[4] Y[3] Y[2] Y[1] Y[0] X[7] X[6] X[5] X[4] Z[3] Z[2] Z[1]...
+	for i := 63; i < 95; i++ {
+		outPlus1[i] = inputPlus1[i]<<4 | input[i]>>4
+	}
+
+	// next 2-bit shim
+	out[95] &= 0x3F
+
+	//  In: {{ C[7] C[6] C[5] C[4] C[3] C[2] }} X[7] X[6] X[5] X[4] X[3] X[2] X[1] X[0] Y[7] Y[6] Y[5] Y[4] Y[3] Y[2] Y[1] Y[0] Z[7] Z[6] Z[5]...
+	// Out:                                     X[1] X[0] C[7] C[6] C[5] C[4] C[3] C[2] Y[1] Y[0] X[7] X[6] X[5] X[4] X[3] X[2] Z[1] Z[0] Y[7]...
+	for i := 95; i < 126; i++ {
+		outPlus1[i] = inputPlus1[i]<<6 | input[i]>>2
+	}
+	// the final 6 bit remainder is exactly the value of the last expanded byte
+	out[127] = input[126] >> 2
+}
+
+// Validate checks that in, which must be a multiple of PaddedBlockSize bytes
+// long, is the result of an fr32 expansion: that the 2 topmost bits of every
+// leaf are cleared.
+func Validate(in []byte) error {
+	if len(in)%PaddedBlockSize != 0 {
+		return fmt.Errorf("input of %d bytes is not a multiple of %d", len(in), PaddedBlockSize)
+	}
+	for i := 31; i < len(in); i += 32 {
+		if in[i]&0xC0 != 0 {
+			return fmt.Errorf("leaf at offset %d has its topmost bits set", i-31)
+		}
+	}
+	return nil
+}
+
+// Unpad reverses the fr32 expansion of in, which must be a multiple of
+// PaddedBlockSize bytes long, into out, which must be able to hold the
+// corresponding multiple of UnpaddedBlockSize bytes. The 2 topmost bits of
+// every leaf are ignored.
+func Unpad(in, out []byte) {
+	if len(in)%PaddedBlockSize != 0 {
+		panic(fmt.Sprintf("input of %d bytes is not a multiple of %d", len(in), PaddedBlockSize))
+	}
+	if len(out) < len(in)/PaddedBlockSize*UnpaddedBlockSize {
+		panic(fmt.Sprintf("output of %d bytes is too short for %d bytes of input", len(out), len(in)))
+	}
+
+	for len(in) > 0 {
+		unpadBlock(in, out)
+		in, out = in[PaddedBlockSize:], out[UnpaddedBlockSize:]
+	}
+}
+
+func unpadBlock(in, out []byte) {
+
+	// first 254 bits are taken as-is, the remaining 2 come from the next leaf
+	copy(out[:31], in[:31])
+	out[31] = in[31]&0x3F | in[32]<<6
+
+	// the exact inverse of each of the shifting cycles in padBlock()
+	for i := 32; i < 63; i++ {
+		out[i] = in[i]>>2 | in[i+1]<<6
+	}
+	out[63] = (in[63]&0x3F)>>2 | in[64]<<4
+
+	for i := 64; i < 95; i++ {
+		out[i] = in[i]>>4 | in[i+1]<<4
+	}
+	out[95] = (in[95]&0x3F)>>4 | in[96]<<2
+
+	for i := 96; i < 127; i++ {
+		out[i] = in[i]>>6 | in[i+1]<<2
+	}
+}
@@ -0,0 +1,157 @@
+package fr32
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"testing/iotest"
+
+	randmath "math/rand"
+
+	"golang.org/x/xerrors"
+)
+
+// refPad is a bit-by-bit rendition of the fr32 expansion
+func refPad(in []byte) []byte {
+	out := make([]byte, len(in)/UnpaddedBlockSize*PaddedBlockSize)
+	for b := 0; b < len(in)/UnpaddedBlockSize; b++ {
+		src, dst := in[b*UnpaddedBlockSize:], out[b*PaddedBlockSize:]
+		for i := 0; i < 127*8; i++ {
+			bit := (src[i/8] >> uint(i%8)) & 1
+			o := i/254*256 + i%254
+			dst[o/8] |= bit << uint(o%8)
+		}
+	}
+	return out
+}
+
+func TestPad(t *testing.T) {
+	t.Parallel()
+
+	in := make([]byte, 127*64)
+	randmath.New(randmath.NewSource(1337)).Read(in)
+
+	out := make([]byte, 128*64)
+	Pad(in, out)
+	if !bytes.Equal(out, refPad(in)) {
+		t.Fatal("padded output does not match the reference implementation")
+	}
+	for i := 31; i < len(out); i += 32 {
+		if out[i]&0xC0 != 0 {
+			t.Fatalf("topmost bits of leaf %d are not cleared", i/32)
+		}
+	}
+}
+
+func TestPadImplementations(t *testing.T) {
+	t.Parallel()
+
+	in := make([]byte, 127*17)
+	randmath.New(randmath.NewSource(7)).Read(in)
+
+	for blocks := 1; blocks <= 17; blocks++ {
+		// guard bytes past the end of the output must not be touched
+		out := bytes.Repeat([]byte{0xAA}, blocks*128+1)
+		exp := bytes.Repeat([]byte{0xAA}, blocks*128+1)
+		Pad(in[:blocks*127], out)
+		padGeneric(in[:blocks*127], exp)
+		if !bytes.Equal(out, exp) {
+			t.Fatalf("padding of %d blocks differs from the generic implementation", blocks)
+		}
+	}
+}
+
+func BenchmarkPad(b *testing.B) {
+	for _, blocks := range []int{1, 1 << 10} {
+		in, out := make([]byte, blocks*127), make([]byte, blocks*128)
+		b.Run(strconv.Itoa(blocks), func(b *testing.B) {
+			b.SetBytes(int64(len(in)))
+			for i := 0; i < b.N; i++ {
+				Pad(in, out)
+			}
+		})
+		b.Run(strconv.Itoa(blocks)+"-generic", func(b *testing.B) {
+			b.SetBytes(int64(len(in)))
+			for i := 0; i < b.N; i++ {
+				padGeneric(in, out)
+			}
+		})
+	}
+}
+
+func TestPadReaderWriter(t *testing.T) {
+	t.Parallel()
+
+	rnd := randmath.New(randmath.NewSource(42))
+	for _, size := range []int{0, 1, 126, 127, 128, 127 * 3, 1 << 20, blocksPerRead*UnpaddedBlockSize + 5} {
+		in := make([]byte, size)
+		rnd.Read(in)
+
+		full := append([]byte{}, in...)
+		if size%127 != 0 {
+			full = append(full, make([]byte, 127-size%127)...)
+		}
+		expected := refPad(full)
+
+		padded, err := ioutil.ReadAll(NewPadReader(iotest.OneByteReader(bytes.NewReader(in))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(padded, expected) {
+			t.Fatalf("%d bytes: PadReader output does not match the reference implementation", size)
+		}
+
+		var buf bytes.Buffer
+		pw := NewPadWriter(&buf)
+		for rest := in; len(rest) > 0; {
+			n := 1 + rnd.Intn(300)
+			if n > len(rest) {
+				n = len(rest)
+			}
+			if _, err := pw.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Fatalf("%d bytes: PadWriter output does not match the reference implementation", size)
+		}
+	}
+}
+
+func TestUnpadReader(t *testing.T) {
+	t.Parallel()
+
+	rnd := randmath.New(randmath.NewSource(7))
+	for _, blocks := range []int{0, 1, 3, blocksPerRead, blocksPerRead*2 + 1} {
+		in := make([]byte, blocks*UnpaddedBlockSize)
+		rnd.Read(in)
+
+		padded, err := ioutil.ReadAll(NewPadReader(bytes.NewReader(in)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unpadded, err := ioutil.ReadAll(NewUnpadReader(iotest.HalfReader(bytes.NewReader(padded))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unpadded, in) {
+			t.Fatalf("%d blocks: unpadding did not restore the original payload", blocks)
+		}
+	}
+
+	// truncated padded stream
+	unpadded, err := ioutil.ReadAll(NewUnpadReader(bytes.NewReader(make([]byte, 128*2+5))))
+	if !xerrors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if len(unpadded) != 127*2 {
+		t.Fatalf("expected the 2 whole blocks before the error, got %d bytes", len(unpadded))
+	}
+}
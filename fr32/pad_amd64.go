@@ -0,0 +1,22 @@
+//go:build amd64 && gc && !purego && !noasm
+// +build amd64,gc,!purego,!noasm
+
+package fr32
+
+import "github.com/klauspost/cpuid/v2"
+
+var hasAVX2 = cpuid.CPU.Supports(cpuid.AVX2)
+
+// padBlocksAVX2 expands the given amount of 127-byte blocks from in to out.
+// It never reads past the end of the last input block.
+//
+//go:noescape
+func padBlocksAVX2(out, in *byte, blocks int)
+
+func pad(in, out []byte) {
+	if hasAVX2 && len(in) > 0 {
+		padBlocksAVX2(&out[0], &in[0], len(in)/UnpaddedBlockSize)
+		return
+	}
+	padGeneric(in, out)
+}
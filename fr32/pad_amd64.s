@@ -0,0 +1,74 @@
+//go:build amd64 && gc && !purego && !noasm
+// +build amd64,gc,!purego,!noasm
+
+#include "textflag.h"
+
+// clears the 2 topmost bits of the last byte of a 32-byte leaf
+DATA leafMask<>+0x00(SB)/8, $0xffffffffffffffff
+DATA leafMask<>+0x08(SB)/8, $0xffffffffffffffff
+DATA leafMask<>+0x10(SB)/8, $0xffffffffffffffff
+DATA leafMask<>+0x18(SB)/8, $0x3fffffffffffffff
+GLOBL leafMask<>(SB), RODATA|NOPTR, $32
+
+// Every leaf after the first is a 256-bit left shift by 2, 4 and 6 bits of
+// the input starting at offsets 32, 64 and 96 respectively. With the input
+// viewed as little-endian 64-bit words, every output word is the input word
+// shifted left, ORed with the topmost bits of the preceding input word, which
+// is exactly the word loaded 8 bytes earlier. The last leaf would need a byte
+// past the end of the block, so it is instead computed as a 2-bit right shift
+// of the 32 bytes at offset 95, with the lanes permuted to obtain the
+// following words.
+
+// func padBlocksAVX2(out, in *byte, blocks int)
+TEXT ·padBlocksAVX2(SB), NOSPLIT, $0-24
+	MOVQ out+0(FP), DI
+	MOVQ in+8(FP), SI
+	MOVQ blocks+16(FP), CX
+
+	VMOVDQU leafMask<>(SB), Y15
+	VPXOR   Y14, Y14, Y14
+
+	TESTQ CX, CX
+	JZ    done
+
+loop:
+	// leaf 0: as-is
+	VMOVDQU 0(SI), Y0
+	VPAND   Y15, Y0, Y0
+	VMOVDQU Y0, 0(DI)
+
+	// leaf 1: << 2
+	VMOVDQU 32(SI), Y1
+	VMOVDQU 24(SI), Y2
+	VPSLLQ  $2, Y1, Y1
+	VPSRLQ  $62, Y2, Y2
+	VPOR    Y2, Y1, Y1
+	VPAND   Y15, Y1, Y1
+	VMOVDQU Y1, 32(DI)
+
+	// leaf 2: << 4
+	VMOVDQU 64(SI), Y3
+	VMOVDQU 56(SI), Y4
+	VPSLLQ  $4, Y3, Y3
+	VPSRLQ  $60, Y4, Y4
+	VPOR    Y4, Y3, Y3
+	VPAND   Y15, Y3, Y3
+	VMOVDQU Y3, 64(DI)
+
+	// leaf 3: bytes 95..126 >> 2, the word following the last one is zero
+	VMOVDQU 95(SI), Y5
+	VPERMQ  $0x39, Y5, Y6     // words 1, 2, 3, 0
+	VPBLENDD $0xC0, Y14, Y6, Y6 // words 1, 2, 3, zero
+	VPSRLQ  $2, Y5, Y5
+	VPSLLQ  $62, Y6, Y6
+	VPOR    Y6, Y5, Y5
+	VMOVDQU Y5, 96(DI)
+
+	ADDQ $127, SI
+	ADDQ $128, DI
+	DECQ CX
+	JNZ  loop
+
+done:
+	VZEROUPPER
+	RET
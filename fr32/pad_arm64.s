@@ -0,0 +1,86 @@
+//go:build arm64 && gc && !purego && !noasm
+// +build arm64,gc,!purego,!noasm
+
+#include "textflag.h"
+
+// clears the 2 topmost bits of the last byte of a 32-byte leaf, applied to
+// the upper 16 bytes
+DATA leafMask<>+0x00(SB)/8, $0xffffffffffffffff
+DATA leafMask<>+0x08(SB)/8, $0x3fffffffffffffff
+GLOBL leafMask<>(SB), RODATA|NOPTR, $16
+
+// The same algorithm as padBlocksAVX2 on amd64, with every 32-byte leaf
+// processed as two 128-bit halves. Every output 64-bit word is the input word
+// shifted left, ORed with the topmost bits of the word loaded 8 bytes earlier,
+// except for the last leaf, computed as a 2-bit right shift of the 32 bytes at
+// offset 95 in order to not read past the end of the block.
+
+// func padBlocksNEON(out, in *byte, blocks int)
+TEXT ·padBlocksNEON(SB), NOSPLIT, $0-24
+	MOVD out+0(FP), R0
+	MOVD in+8(FP), R1
+	MOVD blocks+16(FP), R2
+
+	MOVD $leafMask<>(SB), R5
+	VLD1 (R5), [V15.B16]
+
+	CBZ R2, done
+
+loop:
+	// leaf 0: as-is
+	VLD1 (R1), [V0.B16, V1.B16]
+	VAND V15.B16, V1.B16, V1.B16
+	VST1 [V0.B16, V1.B16], (R0)
+
+	// leaf 1: << 2
+	ADD   $32, R1, R3
+	VLD1  (R3), [V0.B16, V1.B16]
+	ADD   $24, R1, R3
+	VLD1  (R3), [V2.B16, V3.B16]
+	VSHL  $2, V0.D2, V0.D2
+	VSHL  $2, V1.D2, V1.D2
+	VUSHR $62, V2.D2, V2.D2
+	VUSHR $62, V3.D2, V3.D2
+	VORR  V2.B16, V0.B16, V0.B16
+	VORR  V3.B16, V1.B16, V1.B16
+	VAND  V15.B16, V1.B16, V1.B16
+	ADD   $32, R0, R4
+	VST1  [V0.B16, V1.B16], (R4)
+
+	// leaf 2: << 4
+	ADD   $64, R1, R3
+	VLD1  (R3), [V0.B16, V1.B16]
+	ADD   $56, R1, R3
+	VLD1  (R3), [V2.B16, V3.B16]
+	VSHL  $4, V0.D2, V0.D2
+	VSHL  $4, V1.D2, V1.D2
+	VUSHR $60, V2.D2, V2.D2
+	VUSHR $60, V3.D2, V3.D2
+	VORR  V2.B16, V0.B16, V0.B16
+	VORR  V3.B16, V1.B16, V1.B16
+	VAND  V15.B16, V1.B16, V1.B16
+	ADD   $64, R0, R4
+	VST1  [V0.B16, V1.B16], (R4)
+
+	// leaf 3: bytes 95..126 >> 2, the word following the last one is zero
+	ADD   $95, R1, R3
+	VLD1  (R3), [V0.B16, V1.B16]
+	ADD   $103, R1, R3
+	VLD1  (R3), [V2.B16]
+	FMOVD 119(R1), F3
+	VUSHR $2, V0.D2, V0.D2
+	VUSHR $2, V1.D2, V1.D2
+	VSHL  $62, V2.D2, V2.D2
+	VSHL  $62, V3.D2, V3.D2
+	VORR  V2.B16, V0.B16, V0.B16
+	VORR  V3.B16, V1.B16, V1.B16
+	ADD   $96, R0, R4
+	VST1  [V0.B16, V1.B16], (R4)
+
+	ADD  $127, R1, R1
+	ADD  $128, R0, R0
+	SUB  $1, R2, R2
+	CBNZ R2, loop
+
+done:
+	RET
@@ -0,0 +1,6 @@
+//go:build (!amd64 && !arm64) || !gc || purego || noasm
+// +build !amd64,!arm64 !gc purego noasm
+
+package fr32
+
+func pad(in, out []byte) { padGeneric(in, out) }
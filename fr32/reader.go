@@ -0,0 +1,122 @@
+package fr32
+
+import (
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+// blocksPerRead is the amount of blocks processed by every PadReader refill.
+const blocksPerRead = 8 << 10 // ~1MiB of input per refill
+
+type padReader struct {
+	src    io.Reader
+	in     []byte
+	out    []byte
+	outPos int
+	err    error
+}
+
+// NewPadReader returns an io.Reader producing the fr32 expansion of the
+// contents of src: every 127 bytes read from src result in 128 bytes of output.
+// A trailing partial block is zero-extended to a full 127 bytes before being
+// expanded, which is identical to the implicit padding applied by a commP
+// calculator. An empty src results in an empty output.
+func NewPadReader(src io.Reader) io.Reader {
+	return &padReader{
+		src: src,
+		in:  make([]byte, blocksPerRead*UnpaddedBlockSize),
+		out: make([]byte, 0, blocksPerRead*PaddedBlockSize),
+	}
+}
+
+func (pr *padReader) Read(p []byte) (int, error) {
+	if pr.outPos == len(pr.out) {
+		if pr.err != nil {
+			return 0, pr.err
+		}
+		pr.fill()
+		if pr.outPos == len(pr.out) {
+			return 0, pr.err
+		}
+	}
+
+	n := copy(p, pr.out[pr.outPos:])
+	pr.outPos += n
+	return n, nil
+}
+
+func (pr *padReader) fill() {
+	n, err := io.ReadFull(pr.src, pr.in)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = io.EOF
+	}
+	pr.err = err
+
+	if n%UnpaddedBlockSize != 0 {
+		// pr.err is necessarily set: zero-fill the final block
+		for i := n; i < (n/UnpaddedBlockSize+1)*UnpaddedBlockSize; i++ {
+			pr.in[i] = 0
+		}
+		n = (n/UnpaddedBlockSize + 1) * UnpaddedBlockSize
+	}
+
+	pr.out = pr.out[:n/UnpaddedBlockSize*PaddedBlockSize]
+	pr.outPos = 0
+	Pad(pr.in[:n], pr.out)
+}
+
+type unpadReader struct {
+	src    io.Reader
+	in     []byte
+	out    []byte
+	outPos int
+	err    error
+}
+
+// NewUnpadReader returns an io.Reader reversing the fr32 expansion of the
+// contents of src, which must consist of whole 128-byte padded blocks: every
+// 128 bytes read from src result in 127 bytes of output. A src ending in a
+// partial block results in an io.ErrUnexpectedEOF error after all whole blocks
+// have been returned. Note that the zeroes used to extend the original payload
+// to a full block (or piece) can not be told apart from payload zeroes, and are
+// returned as well.
+func NewUnpadReader(src io.Reader) io.Reader {
+	return &unpadReader{
+		src: src,
+		in:  make([]byte, blocksPerRead*PaddedBlockSize),
+		out: make([]byte, 0, blocksPerRead*UnpaddedBlockSize),
+	}
+}
+
+func (ur *unpadReader) Read(p []byte) (int, error) {
+	if ur.outPos == len(ur.out) {
+		if ur.err != nil {
+			return 0, ur.err
+		}
+		ur.fill()
+		if ur.outPos == len(ur.out) {
+			return 0, ur.err
+		}
+	}
+
+	n := copy(p, ur.out[ur.outPos:])
+	ur.outPos += n
+	return n, nil
+}
+
+func (ur *unpadReader) fill() {
+	n, err := io.ReadFull(ur.src, ur.in)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = io.EOF
+		if n%PaddedBlockSize != 0 {
+			err = xerrors.Errorf("%w: padded stream ends with a partial block of %d bytes", io.ErrUnexpectedEOF, n%PaddedBlockSize)
+		}
+	}
+	ur.err = err
+
+	n -= n % PaddedBlockSize
+	ur.out = ur.out[:n/PaddedBlockSize*UnpaddedBlockSize]
+	ur.outPos = 0
+	Unpad(ur.in[:n], ur.out)
+}
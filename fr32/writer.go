@@ -0,0 +1,73 @@
+package fr32
+
+import "io"
+
+type padWriter struct {
+	dst   io.Writer
+	carry []byte
+	out   []byte
+}
+
+// NewPadWriter returns an io.WriteCloser expanding everything written to it,
+// and passing the fr32 padded result on to dst. Because expansion operates on
+// whole 127-byte blocks, up to 126 bytes may be held back between writes. A
+// call to Close() zero-extends and flushes any such trailing partial block. It
+// does not close dst.
+func NewPadWriter(dst io.Writer) io.WriteCloser {
+	return &padWriter{
+		dst:   dst,
+		carry: make([]byte, 0, UnpaddedBlockSize),
+		out:   make([]byte, blocksPerRead*PaddedBlockSize),
+	}
+}
+
+func (pw *padWriter) Write(p []byte) (int, error) {
+	inputSize := len(p)
+
+	if len(pw.carry) > 0 {
+		n := copy(pw.carry[len(pw.carry):UnpaddedBlockSize], p)
+		pw.carry = pw.carry[:len(pw.carry)+n]
+		p = p[n:]
+
+		if len(pw.carry) < UnpaddedBlockSize {
+			return inputSize, nil
+		}
+		if err := pw.flush(pw.carry); err != nil {
+			return 0, err
+		}
+		pw.carry = pw.carry[:0]
+	}
+
+	for len(p) >= UnpaddedBlockSize {
+		chunk := len(p) / UnpaddedBlockSize * UnpaddedBlockSize
+		if chunk > blocksPerRead*UnpaddedBlockSize {
+			chunk = blocksPerRead * UnpaddedBlockSize
+		}
+		if err := pw.flush(p[:chunk]); err != nil {
+			return inputSize - len(p), err
+		}
+		p = p[chunk:]
+	}
+
+	pw.carry = append(pw.carry, p...)
+	return inputSize, nil
+}
+
+func (pw *padWriter) Close() error {
+	if len(pw.carry) == 0 {
+		return nil
+	}
+	for len(pw.carry) < UnpaddedBlockSize {
+		pw.carry = append(pw.carry, 0)
+	}
+	err := pw.flush(pw.carry)
+	pw.carry = pw.carry[:0]
+	return err
+}
+
+func (pw *padWriter) flush(in []byte) error {
+	out := pw.out[:len(in)/UnpaddedBlockSize*PaddedBlockSize]
+	Pad(in, out)
+	_, err := pw.dst.Write(out)
+	return err
+}
@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func FuzzWriteChunking(f *testing.F) {
+	for _, size := range []int{0, 64, 65, 126, 127, 128, 254, 255, 1016, 1017, 4064} {
+		f.Add(bytes.Repeat([]byte{0xCC}, size), int64(size))
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte, seed int64) {
+		cp := new(Calc)
+		cp.Write(payload)
+		expCommP, expSize, expErr := cp.Digest()
+		if expErr != nil {
+			cp.Reset()
+		}
+
+		check := func(desc string, commP []byte, size uint64, err error) {
+			t.Helper()
+			if (err != nil) != (expErr != nil) {
+				t.Fatalf("%s: error mismatch, got %v, expected %v", desc, err, expErr)
+			}
+			if !bytes.Equal(commP, expCommP) || size != expSize {
+				t.Fatalf("%s: got 0x%X / %d, expected 0x%X / %d", desc, commP, size, expCommP, expSize)
+			}
+		}
+
+		// 1-byte writes
+		for i := range payload {
+			cp.Write(payload[i : i+1])
+		}
+		commP, size, err := cp.Digest()
+		check("single byte writes", commP, size, err)
+		if err != nil {
+			cp.Reset()
+		}
+
+		// random splits, with an abandoned prefix Reset() in-between
+		rnd := rand.New(rand.NewSource(seed))
+		cp.Write(payload[:rnd.Intn(len(payload)+1)])
+		cp.Reset()
+		for p := payload; len(p) > 0; {
+			n := 1 + rnd.Intn(len(p))
+			if rnd.Intn(4) == 0 {
+				n = len(p)
+			}
+			cp.Write(p[:n])
+			p = p[n:]
+		}
+		commP, size, err = cp.Digest()
+		check("random splits", commP, size, err)
+		if err != nil {
+			cp.Reset()
+		}
+
+		// reuse right after a successful digest
+		cp.Write(payload)
+		commP, size, err = cp.Digest()
+		check("reuse", commP, size, err)
+		if err != nil {
+			cp.Reset()
+		}
+	})
+}
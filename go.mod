@@ -3,6 +3,7 @@ module github.com/filecoin-project/go-fil-commp-hashhash
 go 1.11
 
 require (
+	github.com/klauspost/cpuid/v2 v2.0.4
 	github.com/minio/sha256-simd v1.0.0
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
@@ -0,0 +1,58 @@
+package commp
+
+import (
+	"hash"
+	"sync"
+)
+
+// NodeHasher computes the parent of two 32-byte tree nodes: the SHA-256 of
+// their concatenation, with the two most significant bits of the last byte
+// cleared. The result is appended to dst, which may share its backing array
+// with left: implementations must consume both inputs before writing to dst.
+// A NodeHasher is used concurrently by all layer workers of a Calc, and must
+// be safe for concurrent use.
+type NodeHasher interface {
+	HashNodes(dst, left, right []byte) []byte
+}
+
+// NewNodeHasher returns a NodeHasher backed by the supplied SHA-256
+// constructor, e.g. crypto/sha256.New. Hash objects are pooled and reused
+// across calls.
+func NewNodeHasher(newSha256 func() hash.Hash) NodeHasher {
+	return &poolNodeHasher{
+		pool: &sync.Pool{New: func() interface{} { return newSha256() }},
+	}
+}
+
+// WithNodeHasher instructs the Calc to use the supplied NodeHasher for all
+// tree hashing, instead of the default sha256-simd (or crypto/sha256 when
+// built with the purego tag) implementation.
+func WithNodeHasher(nh NodeHasher) Option {
+	return func(c *config) {
+		c.nodeHasher = nh
+	}
+}
+
+type poolNodeHasher struct {
+	pool *sync.Pool
+}
+
+// defaultNodeHasher goes through hashNode, specialized for 64-byte messages.
+var defaultNodeHasher NodeHasher = fixedNodeHasher{}
+
+type fixedNodeHasher struct{}
+
+func (fixedNodeHasher) HashNodes(dst, left, right []byte) []byte {
+	return hashNode(dst, left, right)
+}
+
+func (nh *poolNodeHasher) HashNodes(dst, left, right []byte) []byte {
+	h := nh.pool.Get().(hash.Hash)
+	h.Reset()
+	h.Write(left)
+	h.Write(right)
+	d := h.Sum(dst)
+	d[len(d)-1] &= 0x3F
+	nh.pool.Put(h)
+	return d
+}
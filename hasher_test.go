@@ -0,0 +1,84 @@
+package commp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+type countingHasher struct {
+	NodeHasher
+	calls uint64
+}
+
+func (ch *countingHasher) HashNodes(dst, left, right []byte) []byte {
+	atomic.AddUint64(&ch.calls, 1)
+	return ch.NodeHasher.HashNodes(dst, left, right)
+}
+
+func TestNodeHasher(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 127*8)
+
+	cp := new(Calc)
+	cp.Write(payload)
+	expCommP, expSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := &countingHasher{NodeHasher: NewNodeHasher(sha256.New)}
+	cp = New(WithNodeHasher(ch))
+	for i := 0; i < 2; i++ {
+		cp.Write(payload)
+		commP, size, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP) || size != expSize {
+			t.Fatalf("custom node hasher produced 0x%X / %d, expected 0x%X / %d", commP, size, expCommP, expSize)
+		}
+	}
+
+	// 8 blocks of 4 leaves each: 31 inner nodes per tree
+	if ch.calls != 2*31 {
+		t.Fatalf("expected %d HashNodes() calls, got %d", 2*31, ch.calls)
+	}
+}
+
+func TestSha254Node(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	pair := make([]byte, 64)
+	for i := 0; i < 1000; i++ {
+		rnd.Read(pair)
+		exp := sha256.Sum256(pair)
+		exp[31] &= 0x3F
+
+		for name, fn := range map[string]func(dst, left, right []byte) []byte{
+			"sha254Node": sha254Node,
+			"hashNode":   hashNode,
+		} {
+			// the result overwrites the left node, as within the layer workers
+			buf := append([]byte(nil), pair...)
+			if d := fn(buf[:0], buf[:32], buf[32:]); !bytes.Equal(d, exp[:]) {
+				t.Fatalf("%s of 0x%X produced 0x%X, expected 0x%X", name, pair, d, exp)
+			}
+		}
+	}
+}
+
+func BenchmarkHashNodes(b *testing.B) {
+	for name, nh := range map[string]NodeHasher{
+		"default": defaultNodeHasher,
+		"pooled":  NewNodeHasher(sha256.New),
+	} {
+		b.Run(name, func(b *testing.B) {
+			node := make([]byte, 32)
+			b.SetBytes(64)
+			for i := 0; i < b.N; i++ {
+				node = nh.HashNodes(node[:0], node, nulPadding(0))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package commp
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// activeWorkers counts the layer workers running across all Calc objects.
+var activeWorkers int32
+
+// ActiveWorkers returns the amount of layer workers currently running across
+// all Calc objects of the process, be they goroutines or, with WithPool(),
+// tasks of a Pool. Every piece in progress runs one per level of its tree
+// built so far: a count growing over time with
+// no matching amount of pieces being hashed points to Calc objects abandoned
+// without a Digest() or Reset().
+func ActiveWorkers() int { return int(atomic.LoadInt32(&activeWorkers)) }
+
+// ActiveWorkers returns the amount of layer workers of the piece in progress,
+// 0 once it was Digest()ed or Reset().
+func (cp *Calc) ActiveWorkers() int { return int(atomic.LoadInt32(&cp.workers)) }
+
+func (cp *Calc) workerStarted() {
+	atomic.AddInt32(&cp.workers, 1)
+	atomic.AddInt32(&activeWorkers, 1)
+}
+
+func (cp *Calc) workerExited() {
+	atomic.AddInt32(&cp.workers, -1)
+	atomic.AddInt32(&activeWorkers, -1)
+}
+
+// AbandonedPiece describes a piece reported by WithLeakCheck().
+type AbandonedPiece struct {
+	Workers int           // layer workers running at the time of the report
+	Idle    time.Duration // since the last Write() to the piece
+	Stack   []byte        // of the goroutine whose Write() started the piece
+}
+
+// WithLeakCheck calls report for every piece left without a Write(),
+// Digest() or Reset() for longer than idle, while its layer workers are still
+// running. A Calc abandoned mid-piece can not be told apart from a slow
+// writer otherwise: its workers keep it reachable, so it is never garbage
+// collected, and the goroutines simply linger. Each piece is reported at most
+// once, along with the stack of the Write() that started it, captured at a
+// small cost per piece.
+func WithLeakCheck(idle time.Duration, report func(AbandonedPiece)) Option {
+	return func(c *config) {
+		c.leakIdle = idle
+		c.leakReport = report
+	}
+}
+
+// leakWatch tracks the activity of a piece for WithLeakCheck().
+type leakWatch struct {
+	lastActive int64  // atomic, UnixNano
+	stopped    uint32 // atomic
+	stack      []byte
+}
+
+// startLeakWatch starts watching the piece started by the current Write().
+func (cp *Calc) startLeakWatch() *leakWatch {
+	w := &leakWatch{lastActive: time.Now().UnixNano()}
+	w.stack = make([]byte, 4096)
+	w.stack = w.stack[:runtime.Stack(w.stack, false)]
+
+	idle := cp.cfg.leakIdle
+	var check func()
+	check = func() {
+		if atomic.LoadUint32(&w.stopped) != 0 {
+			return
+		}
+		since := time.Since(time.Unix(0, atomic.LoadInt64(&w.lastActive)))
+		if since < idle {
+			time.AfterFunc(idle-since, check)
+			return
+		}
+		cp.cfg.leakReport(AbandonedPiece{
+			Workers: cp.ActiveWorkers(),
+			Idle:    since,
+			Stack:   w.stack,
+		})
+	}
+	time.AfterFunc(idle, check)
+	return w
+}
+
+func (w *leakWatch) touch() { atomic.StoreInt64(&w.lastActive, time.Now().UnixNano()) }
+
+func (w *leakWatch) stop() { atomic.StoreUint32(&w.stopped, 1) }
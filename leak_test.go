@@ -0,0 +1,48 @@
+package commp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLeakCheck(t *testing.T) {
+	reports := make(chan AbandonedPiece, 1)
+	cp := New(WithLeakCheck(100*time.Millisecond, func(p AbandonedPiece) { reports <- p }))
+	payload := make([]byte, 127<<4)
+
+	// a digested piece is not reported
+	cp.Write(payload)
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+	if n := cp.ActiveWorkers(); n != 0 {
+		t.Fatalf("%d workers running after Digest()", n)
+	}
+	select {
+	case p := <-reports:
+		t.Fatalf("unexpected report of a digested piece %+v", p)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// an abandoned one is, once
+	cp.Write(payload)
+	workers := cp.ActiveWorkers()
+	if workers == 0 {
+		t.Fatal("no workers running after Write()")
+	}
+	p := <-reports
+	if p.Workers != workers || p.Idle < 100*time.Millisecond || !bytes.Contains(p.Stack, []byte("TestLeakCheck")) {
+		t.Fatalf("unexpected report %+v of a piece with %d workers", p, workers)
+	}
+	select {
+	case p := <-reports:
+		t.Fatalf("piece reported again %+v", p)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cp.Reset()
+	if n := cp.ActiveWorkers(); n != 0 {
+		t.Fatalf("%d workers running after Reset()", n)
+	}
+}
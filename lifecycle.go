@@ -0,0 +1,95 @@
+package commp
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Lifecycle is the stage a Calc is at, as returned by Calc.Lifecycle().
+type Lifecycle int
+
+const (
+	// Empty is the state of a Calc without payload: fresh, or Reset().
+	Empty Lifecycle = iota
+	// Writing is the state of a Calc accumulating the payload of a piece.
+	Writing
+	// Digested is the state of a Calc whose last piece was Digest()ed. It
+	// accepts the payload of the next piece just like an Empty one.
+	Digested
+	// Closed is the final state of a Calc, see Close().
+	Closed
+)
+
+func (l Lifecycle) String() string {
+	switch l {
+	case Empty:
+		return "empty"
+	case Writing:
+		return "writing"
+	case Digested:
+		return "digested"
+	case Closed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+var _ io.Closer = &Calc{}
+
+// Lifecycle returns the state the Calc is in. It blocks while a Write() or
+// Digest() is in progress.
+func (cp *Calc) Lifecycle() Lifecycle {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.lifecycle
+}
+
+// Close terminates the background goroutines of an unfinished piece, like
+// Reset(), and releases the buffers the Calc retains across pieces. Any
+// subsequent Write(), Digest() or Close() fails with a MisuseError matching
+// ErrClosed, while Reset() does nothing.
+func (cp *Calc) Close() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.lifecycle == Closed {
+		return &MisuseError{Err: ErrClosed, Op: "Close", State: Closed}
+	}
+	cp.abort()
+	cp.retained = retained{}
+	cp.lifecycle = Closed
+	return nil
+}
+
+// enterDigest marks the start of a Digest(), failing if one is in progress
+// already: a second Digest() waiting for the first one would otherwise find
+// an Empty Calc, and fail in a misleading way.
+func (cp *Calc) enterDigest() error {
+	if !atomic.CompareAndSwapUint32(&cp.digesting, 0, 1) {
+		return &MisuseError{Err: ErrDigestInProgress, Op: "Digest", State: Writing}
+	}
+	return nil
+}
+
+func (cp *Calc) leaveDigest() { atomic.StoreUint32(&cp.digesting, 0) }
+
+// enterWrite fails a Write() called while a Digest() is in progress, which
+// would otherwise wait for it and start the next piece. It returns the epoch
+// of the piece the Write() is meant for, to be passed to checkEpoch() once the
+// Calc is locked.
+func (cp *Calc) enterWrite(op string) (uint64, error) {
+	epoch := atomic.LoadUint64(&cp.epoch)
+	if atomic.LoadUint32(&cp.digesting) != 0 {
+		return 0, &MisuseError{Err: ErrDigestInProgress, Op: op, State: Writing}
+	}
+	return epoch, nil
+}
+
+// checkEpoch fails a Write() which waited for the Calc while the piece it was
+// meant for was Digest()ed or Reset().
+func (cp *Calc) checkEpoch(op string, epoch uint64) error {
+	if atomic.LoadUint64(&cp.epoch) != epoch {
+		return &MisuseError{Err: ErrPieceEnded, Op: op, State: cp.lifecycle}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package commp
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestLifecycle(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x5A}, 127*8)
+	padded := make([]byte, 128)
+
+	cp := new(Calc)
+	expect := func(l Lifecycle) {
+		t.Helper()
+		if s := cp.Lifecycle(); s != l {
+			t.Fatalf("calc is %s, expected %s", s, l)
+		}
+	}
+
+	expect(Empty)
+	cp.Write(payload)
+	expect(Writing)
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+	expect(Digested)
+	cp.Write(payload)
+	expect(Writing)
+	cp.Reset()
+	expect(Empty)
+	cp.Write(payload)
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect(Closed)
+	cp.Reset()
+	expect(Closed)
+
+	for op, call := range map[string]func() error{
+		"Write": func() error {
+			_, err := cp.Write(payload)
+			return err
+		},
+		"WriteZeros": func() error { return cp.WriteZeros(127) },
+		"WritePadded": func() error {
+			_, err := cp.WritePadded(padded)
+			return err
+		},
+		"Digest": func() error {
+			_, _, err := cp.Digest()
+			return err
+		},
+		"Close": cp.Close,
+	} {
+		err := call()
+		var me *MisuseError
+		if !xerrors.Is(err, ErrClosed) || !xerrors.As(err, &me) || me.Op != op || me.State != Closed {
+			t.Fatalf("%s() after Close() returned %v", op, err)
+		}
+	}
+}
+
+// gatedHasher holds up all hashing until its gate is closed.
+type gatedHasher struct {
+	countingHasher
+	gate    chan struct{}
+	waiting uint32
+}
+
+func (gh *gatedHasher) HashNodes(dst, left, right []byte) []byte {
+	atomic.AddUint32(&gh.waiting, 1)
+	<-gh.gate
+	return gh.countingHasher.HashNodes(dst, left, right)
+}
+
+func TestAbort(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x5A}, 127*maxSendBatch*3)
+	gh := &gatedHasher{countingHasher: countingHasher{NodeHasher: defaultNodeHasher}, gate: make(chan struct{})}
+	s := new(Scratch)
+	cp := New(WithNodeHasher(gh), WithScratch(s))
+
+	// the first batch of blocks is stuck being folded, the others queued
+	cp.Write(payload)
+	for atomic.LoadUint32(&gh.waiting) == 0 {
+		runtime.Gosched()
+	}
+	done := make(chan struct{})
+	go func() {
+		cp.Reset()
+		close(done)
+	}()
+	for atomic.LoadUint32(&cp.aborting) == 0 {
+		runtime.Gosched()
+	}
+	close(gh.gate)
+	<-done
+
+	// only the blocks of the first batch were hashed, into level 2 nodes
+	if calls := atomic.LoadUint64(&gh.calls); calls != 3*maxSendBatch {
+		t.Fatalf("hashed %d pairs of nodes, expected %d", calls, 3*maxSendBatch)
+	}
+	if len(s.free) != 3*maxSendBatch {
+		t.Fatalf("%d buffers returned to the scratch, expected %d", len(s.free), 3*maxSendBatch)
+	}
+
+	expCommP, expSize, err := Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.Write(payload)
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+		t.Fatalf("produced 0x%X / %d after Reset(), expected 0x%X / %d", commP, paddedSize, expCommP, expSize)
+	}
+}
+
+func TestConcurrentDigest(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	// the root of the piece is only hashed during Digest()
+	cp := New(WithLevelObserver(5, func(uint64, []byte) {
+		close(entered)
+		<-release
+	}))
+	cp.Write(bytes.Repeat([]byte{0x5A}, 127*8))
+
+	done := make(chan error)
+	go func() {
+		_, _, err := cp.Digest()
+		done <- err
+	}()
+	<-entered
+
+	if _, _, err := cp.Digest(); !xerrors.Is(err, ErrDigestInProgress) {
+		t.Fatalf("concurrent Digest() returned %v", err)
+	}
+	if _, err := cp.Write([]byte{1}); !xerrors.Is(err, ErrDigestInProgress) {
+		t.Fatalf("Write() during Digest() returned %v", err)
+	}
+	if err := cp.WriteZeros(1); !xerrors.Is(err, ErrDigestInProgress) {
+		t.Fatalf("WriteZeros() during Digest() returned %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s := cp.Lifecycle(); s != Digested {
+		t.Fatalf("calc is %s, expected %s", s, Digested)
+	}
+}
+
+func TestWriteAfterPieceEnded(t *testing.T) {
+	cp := new(Calc)
+	cp.Write(make([]byte, 127))
+
+	// a Write() waiting for the Calc while the piece is Reset()
+	epoch, err := cp.enterWrite("Write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.Reset()
+	cp.mu.Lock()
+	err = cp.checkEpoch("Write", epoch)
+	cp.mu.Unlock()
+	var me *MisuseError
+	if !xerrors.Is(err, ErrPieceEnded) || !xerrors.As(err, &me) || me.State != Empty {
+		t.Fatalf("Write() overlapping Reset() returned %v", err)
+	}
+
+	// Reset() of an empty Calc ends no piece
+	epoch, _ = cp.enterWrite("Write")
+	cp.Reset()
+	if err := cp.checkEpoch("Write", epoch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	chunk := bytes.Repeat([]byte{0xA7}, 127)
+	cp := new(Calc)
+
+	// writers racing with Digest() and Reset() never tear a piece: every
+	// digested piece consists of whole writes
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := cp.Write(chunk); err != nil && !xerrors.Is(err, ErrDigestInProgress) && !xerrors.Is(err, ErrPieceEnded) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	rounds := 100
+	if testing.Short() {
+		rounds = 20
+	}
+	for i := 0; i < rounds; i++ {
+		time.Sleep(time.Millisecond)
+		if i%10 == 9 {
+			cp.Reset()
+			continue
+		}
+		commP, _, payloadSize, err := cp.digest(nil)
+		if xerrors.Is(err, ErrPayloadTooSmall) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payloadSize%127 != 0 {
+			t.Fatalf("digested a torn piece of %d bytes", payloadSize)
+		}
+		expCommP, _, err := Sum(bytes.Repeat(chunk, int(payloadSize/127)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) {
+			t.Fatalf("piece of %d bytes produced 0x%X, expected 0x%X", payloadSize, commP, expCommP)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	cp.Reset()
+}
@@ -0,0 +1,10 @@
+module github.com/filecoin-project/go-fil-commp-hashhash/mhregister
+
+go 1.11
+
+require (
+	github.com/filecoin-project/go-fil-commp-hashhash v0.1.0
+	github.com/multiformats/go-multihash v0.0.16
+)
+
+replace github.com/filecoin-project/go-fil-commp-hashhash => ../
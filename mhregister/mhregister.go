@@ -0,0 +1,32 @@
+// Package mhregister has no purpose except to register this commP calculator
+// with go-multihash, as the implementation of fr32-sha256-trunc254-padded
+// (0x1012). It is meant to be used as a side-effecting import:
+//
+//	import (
+//		_ "github.com/filecoin-project/go-fil-commp-hashhash/mhregister"
+//	)
+//
+// Afterwards multihash.Sum(), multihash.GetHasher() and everything built on top
+// of them are able to produce piece commitments from unpadded payloads. Keep in
+// mind that, just like commp.Calc.Sum(), hashing less than MinPiecePayload
+// bytes results in a panic, as commP is not defined for such short inputs.
+package mhregister
+
+import (
+	"hash"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	multihash "github.com/multiformats/go-multihash/core"
+)
+
+// Code is the multicodec code of commP, defined as
+// SHA2_256_TRUNC254_PADDED by the main go-multihash package. Repeated here to
+// avoid pulling in the dependencies of the full go-multihash.
+const Code = 0x1012
+
+func init() {
+	multihash.Register(
+		Code,
+		func() hash.Hash { return new(commp.Calc) },
+	)
+}
@@ -0,0 +1,31 @@
+package mhregister
+
+import (
+	"bytes"
+	"testing"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	multihash "github.com/multiformats/go-multihash/core"
+)
+
+func TestRegistered(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 1000)
+
+	h, err := multihash.GetHasher(Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write(payload)
+	digest := h.Sum(nil)
+
+	cp := new(commp.Calc)
+	cp.Write(payload)
+	commP, _, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(digest, commP) {
+		t.Fatalf("registered hasher produced 0x%X, expected 0x%X", digest, commP)
+	}
+}
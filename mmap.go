@@ -0,0 +1,51 @@
+package commp
+
+import (
+	"io"
+	"os"
+)
+
+// mmapWindow is the amount of a memory-mapped file handed to a Calc at once:
+// a multiple of both the 127-byte block and the page size.
+const mmapWindow = 127 << 20
+
+// HashFileMmap returns the raw commP and padded piece size of the file at
+// path. On linux the file is memory-mapped and written to a Calc configured
+// with opts a window at a time, advising the kernel to read ahead the next
+// window while the current one is hashed. Unlike streaming the file through
+// read() this does not copy it into an intermediate buffer, which pays off
+// with fast local storage. The holes of a sparse file, as reported by
+// SEEK_DATA / SEEK_HOLE, are not read at all but passed to WriteZeros().
+// On other platforms the file is read the regular way.
+func HashFileMmap(path string, opts ...Option) (commP []byte, paddedPieceSize uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if size := uint64(fi.Size()); size > MaxPiecePayload {
+		return nil, 0, &PayloadSizeError{
+			Err:   ErrPayloadTooLarge,
+			Limit: MaxPiecePayload,
+			Size:  size,
+		}
+	}
+
+	cp := New(opts...)
+	defer cp.Reset()
+	if err := hashFile(cp, f, uint64(fi.Size())); err != nil {
+		return nil, 0, err
+	}
+	return cp.Digest()
+}
+
+// readFile is the fallback of hashFile where a file can not be mapped.
+func readFile(cp *Calc, f *os.File) error {
+	_, err := io.CopyBuffer(cp, f, make([]byte, 127<<10))
+	return err
+}
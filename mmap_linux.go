@@ -0,0 +1,81 @@
+package commp
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// lseek whence values, absent from package syscall
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+func hashFile(cp *Calc, f *os.File, size uint64) error {
+	if size == 0 {
+		return nil
+	}
+	if uint64(int(size)) != size {
+		// beyond the address space of 32-bit platforms
+		return readFile(cp, f)
+	}
+
+	m, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return xerrors.Errorf("mmap of %s failed: %w", f.Name(), err)
+	}
+	defer syscall.Munmap(m)
+
+	// the advice is merely a hint, failing it is of no consequence
+	syscall.Madvise(m, syscall.MADV_SEQUENTIAL)
+	page := uint64(os.Getpagesize())
+
+	for off := uint64(0); off < size; {
+		data, hole := nextData(f, off, size)
+		if data > off {
+			if err := cp.WriteZeros(data - off); err != nil {
+				return err
+			}
+		}
+
+		for w := data; w < hole; w += mmapWindow {
+			end := w + mmapWindow
+			if end > hole {
+				end = hole
+			}
+			if end < hole {
+				ahead := end + mmapWindow
+				if ahead > hole {
+					ahead = hole
+				}
+				syscall.Madvise(m[end/page*page:ahead], syscall.MADV_WILLNEED)
+			}
+			if _, err := cp.Write(m[w:end]); err != nil {
+				return err
+			}
+		}
+		off = hole
+	}
+	return nil
+}
+
+// nextData returns the bounds of the first data region at or past off. Where
+// holes can not be detected, the rest of the file is a single data region.
+func nextData(f *os.File, off, size uint64) (data, hole uint64) {
+	fd := int(f.Fd())
+	d, err := syscall.Seek(fd, int64(off), seekData)
+	if err == syscall.ENXIO {
+		// nothing but a hole up to the end
+		return size, size
+	}
+	if err != nil {
+		return off, size
+	}
+	h, err := syscall.Seek(fd, d, seekHole)
+	if err != nil || h <= d || uint64(h) > size {
+		return uint64(d), size
+	}
+	return uint64(d), uint64(h)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package commp
+
+import "os"
+
+func hashFile(cp *Calc, f *os.File, size uint64) error {
+	return readFile(cp, f)
+}
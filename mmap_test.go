@@ -0,0 +1,119 @@
+package commp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestHashFileMmap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rnd := rand.New(rand.NewSource(1))
+	path := filepath.Join(dir, "payload")
+
+	// (offset, size) of the data regions of a sparse file of the given size
+	for _, layout := range []struct {
+		size    int64
+		regions [][2]int64
+	}{
+		{65, [][2]int64{{0, 65}}},
+		{127 << 10, [][2]int64{{0, 127 << 10}}},
+		{mmapWindow*2 + 1000, [][2]int64{{0, mmapWindow*2 + 1000}}},
+		{1 << 20, nil},
+		{3 << 20, [][2]int64{{1 << 20, 4096}, {2<<20 + 5, 12345}}},
+		{4<<20 + 17, [][2]int64{{0, 100}, {4 << 20, 17}}},
+	} {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Truncate(layout.size); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range layout.regions {
+			b := make([]byte, r[1])
+			rnd.Read(b)
+			if _, err := f.WriteAt(b, r[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+
+		payload, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expCommP, expSize, err := Sum(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commP, paddedSize, err := HashFileMmap(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("file of %d bytes with data at %v produced 0x%X / %d, expected 0x%X / %d", layout.size, layout.regions, commP, paddedSize, expCommP, expSize)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := HashFileMmap(path); !xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("expected ErrPayloadTooSmall for an empty file, got %v", err)
+	}
+	if _, _, err := HashFileMmap(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+}
+
+func BenchmarkHashFile(b *testing.B) {
+	f, err := ioutil.TempFile("", "commp-mmap")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	payload := make([]byte, 127<<20)
+	rand.New(rand.NewSource(1)).Read(payload)
+	if _, err := f.Write(payload); err != nil {
+		b.Fatal(err)
+	}
+	f.Close()
+
+	b.Run("mmap", func(b *testing.B) {
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := HashFileMmap(f.Name()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("read", func(b *testing.B) {
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			r, err := os.Open(f.Name())
+			if err != nil {
+				b.Fatal(err)
+			}
+			cp := new(Calc)
+			if err := readFile(cp, r); err != nil {
+				b.Fatal(err)
+			}
+			r.Close()
+			if _, _, err := cp.Digest(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
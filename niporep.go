@@ -0,0 +1,108 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// SectorPiece is a piece placed within a sector.
+type SectorPiece struct {
+	PieceInfo
+	Offset uint64 // padded offset within the sector
+	Index  int    // position among the pieces supplied
+}
+
+// UnsealedSector holds the unsealed commitment inputs of a sector: the pieces
+// in the order they are placed, along with the resulting commD. Non-interactive
+// PoRep (NI-PoRep) seals sectors without a pre-commit, so these need to be
+// derived identically by every party without a round-trip to the chain.
+type UnsealedSector struct {
+	SectorPaddedSize uint64
+	Pieces           []SectorPiece
+	CommD            []byte // raw 32 bytes
+}
+
+// OrderPieces returns the indexes of pieces in their canonical sector order:
+// by decreasing padded size, then by increasing commP, then by their original
+// position. As every piece is placed at an offset aligned to its own size,
+// pieces in decreasing size need no zero filler in between, so the order
+// results in the smallest possible sector utilization, while being the same
+// regardless of the order pieces were supplied in.
+func OrderPieces(pieces []PieceInfo) []int {
+	order := make([]int, len(pieces))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, pb := pieces[order[a]], pieces[order[b]]
+		if pa.PaddedPieceSize != pb.PaddedPieceSize {
+			return pa.PaddedPieceSize > pb.PaddedPieceSize
+		}
+		return bytes.Compare(pa.CommP, pb.CommP) < 0
+	})
+	return order
+}
+
+// NewUnsealedSector places pieces within a sector of the given padded size in
+// the order of OrderPieces(), and computes its commD via ComputeCommD().
+func NewUnsealedSector(sectorPaddedSize uint64, pieces []PieceInfo) (*UnsealedSector, error) {
+	if err := PaddedPieceSize(sectorPaddedSize).Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid sector size: %w", err)
+	}
+
+	var total uint64
+	for i, p := range pieces {
+		if len(p.CommP) != 32 {
+			return nil, xerrors.Errorf("commP of piece %d must be exactly 32 bytes long, got %d bytes instead", i, len(p.CommP))
+		}
+		if err := PaddedPieceSize(p.PaddedPieceSize).Validate(); err != nil {
+			return nil, xerrors.Errorf("piece %d: %w", i, err)
+		}
+		total += p.PaddedPieceSize
+		if total > sectorPaddedSize {
+			return nil, xerrors.Errorf("pieces 0-%d add up to %d bytes, more than the sector size of %d bytes", i, total, sectorPaddedSize)
+		}
+	}
+
+	s := &UnsealedSector{
+		SectorPaddedSize: sectorPaddedSize,
+		Pieces:           make([]SectorPiece, 0, len(pieces)),
+	}
+	ordered := make([]PieceInfo, 0, len(pieces))
+	var offset uint64
+	for _, i := range OrderPieces(pieces) {
+		s.Pieces = append(s.Pieces, SectorPiece{PieceInfo: pieces[i], Offset: offset, Index: i})
+		ordered = append(ordered, pieces[i])
+		offset += pieces[i].PaddedPieceSize
+	}
+
+	var err error
+	if s.CommD, err = ComputeCommD(sectorPaddedSize, ordered); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// HashUnsealedSector computes the commP of every payload, using a single Calc
+// configured with opts, and returns the NewUnsealedSector() of the resulting
+// pieces. The Index of every piece is the position of its payload.
+func HashUnsealedSector(sectorPaddedSize uint64, payloads []io.Reader, opts ...Option) (*UnsealedSector, error) {
+	cp := New(opts...)
+	defer cp.Reset()
+
+	pieces := make([]PieceInfo, len(payloads))
+	for i, r := range payloads {
+		if _, err := io.Copy(cp, r); err != nil {
+			return nil, xerrors.Errorf("reading payload %d: %w", i, err)
+		}
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			return nil, xerrors.Errorf("hashing payload %d: %w", i, err)
+		}
+		pieces[i] = PieceInfo{CommP: commP, PaddedPieceSize: paddedSize}
+	}
+	return NewUnsealedSector(sectorPaddedSize, pieces)
+}
@@ -0,0 +1,75 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestUnsealedSector(t *testing.T) {
+	const sectorSize = 16 << 10
+
+	rnd := rand.New(rand.NewSource(1))
+	var payloads [][]byte
+	for _, size := range []int{65, 4000, 127 * 2, 1000, 127 * 2, 65} {
+		p := make([]byte, size)
+		rnd.Read(p)
+		payloads = append(payloads, p)
+	}
+	readers := func() []io.Reader {
+		rs := make([]io.Reader, len(payloads))
+		for i, p := range payloads {
+			rs[i] = bytes.NewReader(p)
+		}
+		return rs
+	}
+
+	s, err := HashUnsealedSector(sectorSize, readers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// placed back to back in decreasing size, with the commD of the sector
+	// holding the payloads at those offsets
+	sector := make([]byte, sectorSize/128*127)
+	var offset uint64
+	for i, p := range s.Pieces {
+		if p.Offset != offset {
+			t.Fatalf("piece %d at offset %d, expected %d", i, p.Offset, offset)
+		}
+		if i > 0 && p.PaddedPieceSize > s.Pieces[i-1].PaddedPieceSize {
+			t.Fatalf("piece %d of %d bytes placed after a smaller one", i, p.PaddedPieceSize)
+		}
+		copy(sector[p.Offset/128*127:], payloads[p.Index])
+		offset += p.PaddedPieceSize
+	}
+	expCommD, _, err := Sum(sector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.CommD, expCommD[:]) {
+		t.Fatalf("commD 0x%X does not match the streamed sector 0x%X", s.CommD, expCommD)
+	}
+
+	// the order pieces are supplied in does not matter
+	pieces := make([]PieceInfo, len(s.Pieces))
+	for _, p := range s.Pieces {
+		pieces[p.Index] = p.PieceInfo
+	}
+	rnd.Shuffle(len(pieces), func(i, j int) { pieces[i], pieces[j] = pieces[j], pieces[i] })
+	s2, err := NewUnsealedSector(sectorSize, pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s2.CommD, s.CommD) {
+		t.Fatalf("shuffled pieces resulted in commD 0x%X instead of 0x%X", s2.CommD, s.CommD)
+	}
+
+	if _, err := NewUnsealedSector(2<<10, pieces); err == nil {
+		t.Fatal("expected an error for pieces exceeding the sector")
+	}
+	if _, err := NewUnsealedSector(sectorSize, []PieceInfo{{CommP: make([]byte, 32), PaddedPieceSize: 100}}); err == nil {
+		t.Fatal("expected an error for an invalid piece size")
+	}
+}
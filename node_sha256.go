@@ -0,0 +1,90 @@
+package commp
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// sha256Init is the initial hash value of SHA-256.
+var sha256Init = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+var sha256K = [64]uint32{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+// sha256PadKW holds the round constants plus the message schedule of the
+// second block of every 64-byte message, which is the same for all of them:
+// the 0x80 terminator, zeros and the length of 512 bits.
+var sha256PadKW [64]uint32
+
+func init() {
+	var w [64]uint32
+	w[0] = 0x80000000
+	w[15] = 512
+	for i := 16; i < 64; i++ {
+		w[i] = sigma1(w[i-2]) + w[i-7] + sigma0(w[i-15]) + w[i-16]
+	}
+	for i := range w {
+		sha256PadKW[i] = sha256K[i] + w[i]
+	}
+}
+
+func sigma0(x uint32) uint32 { return bits.RotateLeft32(x, -7) ^ bits.RotateLeft32(x, -18) ^ x>>3 }
+func sigma1(x uint32) uint32 { return bits.RotateLeft32(x, -17) ^ bits.RotateLeft32(x, -19) ^ x>>10 }
+
+// sha256Rounds runs the 64 rounds of the compression function over h, given
+// the sums of the round constants and the message schedule.
+func sha256Rounds(h *[8]uint32, kw *[64]uint32) {
+	a, b, c, d, e, f, g, hh := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+	for i := 0; i < 64; i++ {
+		t1 := hh + (bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)) + ((e & f) ^ (^e & g)) + kw[i]
+		t2 := (bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)) + ((a & b) ^ (a & c) ^ (b & c))
+		hh, g, f, e, d, c, b, a = g, f, e, d+t1, c, b, a, t1+t2
+	}
+	h[0] += a
+	h[1] += b
+	h[2] += c
+	h[3] += d
+	h[4] += e
+	h[5] += f
+	h[6] += g
+	h[7] += hh
+}
+
+// sha254Node appends the truncated SHA-256 of the concatenation of two 32-byte
+// nodes to dst. A message of exactly 64 bytes takes two runs of the
+// compression function, the second one over a constant padding block whose
+// schedule is precomputed, with none of the buffering of a hash.Hash.
+func sha254Node(dst, left, right []byte) []byte {
+	var kw [64]uint32
+	for i := 0; i < 8; i++ {
+		kw[i] = binary.BigEndian.Uint32(left[i*4:])
+		kw[i+8] = binary.BigEndian.Uint32(right[i*4:])
+	}
+	for i := 16; i < 64; i++ {
+		kw[i] = sigma1(kw[i-2]) + kw[i-7] + sigma0(kw[i-15]) + kw[i-16]
+	}
+	for i := range kw {
+		kw[i] += sha256K[i]
+	}
+
+	h := sha256Init
+	sha256Rounds(&h, &kw)
+	sha256Rounds(&h, &sha256PadKW)
+
+	var out [32]byte
+	for i, v := range h {
+		binary.BigEndian.PutUint32(out[i*4:], v)
+	}
+	out[31] &= 0x3F
+	return append(dst, out[:]...)
+}
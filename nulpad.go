@@ -0,0 +1,81 @@
+package commp
+
+import (
+	"io"
+)
+
+// NulPadReader wraps an io.Reader, and once the source is exhausted continues
+// returning zero bytes until the total amount of output is exactly the unpadded
+// size of the smallest piece able to contain the source payload. Hashing its
+// output results in the same commP as hashing the original payload, while the
+// output itself is the physical representation of the entire piece.
+type NulPadReader struct {
+	src         io.Reader
+	payloadSize uint64
+	emitted     uint64
+	target      uint64
+	srcDone     bool
+}
+
+var _ io.Reader = &NulPadReader{}
+
+// NewNulPadReader returns a NulPadReader extending src to its piece boundary.
+func NewNulPadReader(src io.Reader) *NulPadReader {
+	return &NulPadReader{src: src}
+}
+
+// Read implements io.Reader.
+func (nr *NulPadReader) Read(p []byte) (int, error) {
+	if !nr.srcDone {
+		n, err := nr.src.Read(p)
+		nr.payloadSize += uint64(n)
+		nr.emitted += uint64(n)
+
+		if nr.payloadSize > MaxPiecePayload {
+			return n, &PayloadSizeError{
+				Err:      ErrPayloadTooLarge,
+				Limit:    MaxPiecePayload,
+				Size:     nr.payloadSize,
+				Accepted: nr.payloadSize - uint64(n),
+			}
+		}
+
+		if err != io.EOF {
+			return n, err
+		}
+
+		nr.srcDone = true
+		if nr.payloadSize > 0 {
+			nr.target = paddedSizeFor(nr.payloadSize) / 128 * 127
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	if nr.emitted == nr.target {
+		return 0, io.EOF
+	}
+
+	if remaining := nr.target - nr.emitted; uint64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	nr.emitted += uint64(len(p))
+	return len(p), nil
+}
+
+// PayloadSize returns the amount of bytes read from the source so far.
+func (nr *NulPadReader) PayloadSize() uint64 { return nr.payloadSize }
+
+// UnpaddedPieceSize returns the total amount of bytes the reader will produce,
+// including the trailing zeroes. It is only valid once the source has been
+// exhausted, and returns 0 before that, or for an empty source.
+func (nr *NulPadReader) UnpaddedPieceSize() uint64 { return nr.target }
+
+// PaddedPieceSize returns the padded size of the piece represented by the
+// reader output. It is only valid once the source has been exhausted, and
+// returns 0 before that, or for an empty source.
+func (nr *NulPadReader) PaddedPieceSize() uint64 { return nr.target / 127 * 128 }
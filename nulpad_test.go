@@ -0,0 +1,51 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNulPadReader(t *testing.T) {
+	t.Parallel()
+
+	for _, size := range []int{0, 1, 65, 127, 128, 1000, 127 * 8, 127*8 + 1} {
+		payload := bytes.Repeat([]byte{0xCC}, size)
+
+		nr := NewNulPadReader(iotest.HalfReader(bytes.NewReader(payload)))
+		out, err := ioutil.ReadAll(nr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if nr.PayloadSize() != uint64(size) {
+			t.Fatalf("reported payload size %d, expected %d", nr.PayloadSize(), size)
+		}
+		if uint64(len(out)) != nr.UnpaddedPieceSize() || nr.UnpaddedPieceSize()/127*128 != nr.PaddedPieceSize() {
+			t.Fatalf("%d bytes: produced %d bytes, inconsistent with reported unpadded size %d and padded size %d",
+				size, len(out), nr.UnpaddedPieceSize(), nr.PaddedPieceSize())
+		}
+		if !bytes.Equal(out[:size], payload) || !bytes.Equal(out[size:], make([]byte, len(out)-size)) {
+			t.Fatalf("%d bytes: output is not the payload followed by zeroes", size)
+		}
+
+		if size < int(MinPiecePayload) {
+			continue
+		}
+
+		cp := &Calc{}
+		io.Copy(cp, bytes.NewReader(payload))
+		expCommP, expSize, _ := cp.Digest()
+
+		cp.Write(out)
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paddedSize != expSize || paddedSize != nr.PaddedPieceSize() || !bytes.Equal(commP, expCommP) {
+			t.Fatalf("%d bytes: zero-extended stream does not hash to the same piece", size)
+		}
+	}
+}
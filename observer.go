@@ -0,0 +1,43 @@
+package commp
+
+import "time"
+
+// Observer receives instrumentation events from every Calc configured via
+// WithObserver, e.g. to export them as metrics. A single Observer is
+// typically shared by many Calc objects: its methods must be safe for
+// concurrent use, and cheap, as they are invoked synchronously from within
+// Write(), Digest() and the background workers.
+type Observer interface {
+	// PipelineStarted is called when the first Write() of a piece starts the
+	// background workers, PipelineStopped when Digest() or Reset() terminates
+	// them.
+	PipelineStarted()
+	PipelineStopped()
+
+	// BytesWritten is called on every successful Write().
+	BytesWritten(n int)
+
+	// QueueDepth samples the amount of batches of nodes waiting to be
+	// processed by the worker of the given layer. Layer 0 holds entire
+	// blocks. A depth persistently at the capacity of the queue, which grows
+	// with GOMAXPROCS, identifies the layer holding up the pipeline.
+	QueueDepth(layer uint, depth int)
+
+	// Digested is called on every Digest() with the time it took, and the
+	// PayloadSizeError if it failed.
+	Digested(d time.Duration, err error)
+
+	// WriteFailed is called with the PayloadSizeError of a failed Write().
+	WriteFailed(err error)
+}
+
+// queueSampleInterval is the amount of nodes a layer worker processes between
+// two QueueDepth samples.
+const queueSampleInterval = 256
+
+// WithObserver reports the activity of the Calc to o.
+func WithObserver(o Observer) Option {
+	return func(c *config) {
+		c.observer = o
+	}
+}
@@ -0,0 +1,68 @@
+package commp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+type countingObserver struct {
+	mu                        sync.Mutex
+	started, stopped, written int
+	depthSamples              map[uint]int
+	digests                   []error
+}
+
+func (o *countingObserver) PipelineStarted() { o.mu.Lock(); o.started++; o.mu.Unlock() }
+func (o *countingObserver) PipelineStopped() { o.mu.Lock(); o.stopped++; o.mu.Unlock() }
+func (o *countingObserver) BytesWritten(n int) {
+	o.mu.Lock()
+	o.written += n
+	o.mu.Unlock()
+}
+func (o *countingObserver) QueueDepth(layer uint, depth int) {
+	o.mu.Lock()
+	o.depthSamples[layer]++
+	o.mu.Unlock()
+}
+func (o *countingObserver) Digested(d time.Duration, err error) {
+	o.mu.Lock()
+	o.digests = append(o.digests, err)
+	o.mu.Unlock()
+}
+func (o *countingObserver) WriteFailed(err error) {}
+
+func TestObserver(t *testing.T) {
+	obs := &countingObserver{depthSamples: make(map[uint]int)}
+	cp := New(WithObserver(obs))
+
+	if _, _, err := cp.Digest(); err == nil {
+		t.Fatal("unexpected success digesting nothing")
+	}
+
+	cp.Write(make([]byte, 127<<10))
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp.Write(make([]byte, 1000))
+	cp.Reset()
+
+	if obs.started != 2 || obs.stopped != 2 {
+		t.Fatalf("observed %d pipelines started and %d stopped, expected 2", obs.started, obs.stopped)
+	}
+	if obs.written != 127<<10+1000 {
+		t.Fatalf("observed %d bytes written, expected %d", obs.written, 127<<10+1000)
+	}
+	if len(obs.digests) != 2 || !xerrors.Is(obs.digests[0], ErrPayloadTooSmall) || obs.digests[1] != nil {
+		t.Fatalf("unexpected observed digests %v", obs.digests)
+	}
+	// every 256th node is sampled starting with the first: the 1024 blocks
+	// and level 2 nodes of the first piece result in 4 samples per layer,
+	// while those of the second are discarded by Reset() unseen
+	if obs.depthSamples[0] != 4 || obs.depthSamples[2] != 4 {
+		t.Fatalf("unexpected queue depth samples %v", obs.depthSamples)
+	}
+}
@@ -0,0 +1,52 @@
+package commp
+
+// The functions below map between positions within the payload of a piece and
+// positions within its fr32-padded form and tree. Every 127-byte block of
+// payload expands into 4 leaves of 254 payload bits each, so payload bytes do
+// not line up with padded bytes: the offsets map the bytes holding the first
+// bit of a payload byte.
+
+// PaddedOffset returns the offset of the padded byte holding the first bit of
+// the payload byte at the given unpadded offset.
+func PaddedOffset(unpadded uint64) uint64 {
+	bit := unpadded % 127 * 8
+	return unpadded/127*128 + bit/254*32 + bit%254/8
+}
+
+// UnpaddedOffset returns the unpadded offset of the first payload byte whose
+// first bit is not held by a padded byte before the given padded offset. It is
+// the inverse of PaddedOffset(), and maps the padded range [a, b) to the
+// payload bytes starting within it, [UnpaddedOffset(a), UnpaddedOffset(b)).
+func UnpaddedOffset(padded uint64) uint64 {
+	inBlock := padded % 128
+	bit := inBlock/32*254 + inBlock%32*8
+	return padded/128*127 + (bit+7)/8
+}
+
+// LeafIndex returns the index of the leaf holding the first bit of the payload
+// byte at the given unpadded offset.
+func LeafIndex(unpadded uint64) uint64 {
+	return PaddedOffset(unpadded) / 32
+}
+
+// NodeIndex returns the index of the node of the given tree level (0 being the
+// leaves) covering the first bit of the payload byte at the given unpadded
+// offset.
+func NodeIndex(level uint, unpadded uint64) uint64 {
+	return LeafIndex(unpadded) >> level
+}
+
+// NodePaddedRange returns the padded offset and size of the part of the piece
+// covered by the node at the given position.
+func NodePaddedRange(level uint, index uint64) (offset, size uint64) {
+	return index << (level + 5), 32 << level
+}
+
+// NodeUnpaddedRange returns the unpadded offset and size of the payload bytes
+// whose first bit is covered by the node at the given position. From level 2
+// up nodes cover whole 127-byte blocks.
+func NodeUnpaddedRange(level uint, index uint64) (offset, size uint64) {
+	start, n := NodePaddedRange(level, index)
+	offset = UnpaddedOffset(start)
+	return offset, UnpaddedOffset(start+n) - offset
+}
@@ -0,0 +1,79 @@
+package commp
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+)
+
+func TestOffsets(t *testing.T) {
+	t.Parallel()
+
+	// locate every payload byte within the padded form by expanding it alone
+	in := make([]byte, 127*2)
+	out := make([]byte, 128*2)
+	for u := uint64(0); u < uint64(len(in)); u++ {
+		for i := range in {
+			in[i] = 0
+		}
+		in[u] = 0xFF
+		fr32.Pad(in[:127], out[:128])
+		fr32.Pad(in[127:], out[128:])
+
+		first := -1
+		for i, b := range out {
+			if b != 0 {
+				first = i
+				break
+			}
+		}
+		if p := PaddedOffset(u); p != uint64(first) {
+			t.Fatalf("payload byte %d mapped to padded byte %d, expected %d", u, p, first)
+		}
+		if back := UnpaddedOffset(PaddedOffset(u)); back != u {
+			t.Fatalf("payload byte %d mapped back to %d", u, back)
+		}
+		if l := LeafIndex(u); l != uint64(first/32) {
+			t.Fatalf("payload byte %d mapped to leaf %d, expected %d", u, l, first/32)
+		}
+	}
+
+	// every padded range maps to the payload bytes starting within it
+	prev := UnpaddedOffset(0)
+	for p := uint64(1); p <= 512; p++ {
+		cur := UnpaddedOffset(p)
+		for u := prev; u < cur; u++ {
+			if PaddedOffset(u) != p-1 {
+				t.Fatalf("payload byte %d mapped from padded byte %d, but starts at %d", u, p-1, PaddedOffset(u))
+			}
+		}
+		prev = cur
+	}
+
+	for _, tc := range []struct {
+		level       uint
+		index       uint64
+		off, size   uint64
+		uoff, usize uint64
+	}{
+		{0, 0, 0, 32, 0, 32},
+		{0, 1, 32, 32, 32, 32},
+		{0, 3, 96, 32, 96, 31},
+		{1, 1, 64, 64, 64, 63},
+		{2, 0, 0, 128, 0, 127},
+		{2, 5, 640, 128, 635, 127},
+		{10, 3, 3 << 15, 1 << 15, 3 * 127 << 8, 127 << 8},
+	} {
+		off, size := NodePaddedRange(tc.level, tc.index)
+		uoff, usize := NodeUnpaddedRange(tc.level, tc.index)
+		if off != tc.off || size != tc.size || uoff != tc.uoff || usize != tc.usize {
+			t.Fatalf(
+				"node %d of level %d covers padded %d+%d and unpadded %d+%d, expected %d+%d and %d+%d",
+				tc.index, tc.level, off, size, uoff, usize, tc.off, tc.size, tc.uoff, tc.usize,
+			)
+		}
+		if NodeIndex(tc.level, uoff) != tc.index {
+			t.Fatalf("unpadded offset %d mapped to node %d of level %d, expected %d", uoff, NodeIndex(tc.level, uoff), tc.level, tc.index)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package commp
+
+import (
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+	"golang.org/x/xerrors"
+)
+
+// WritePadded adds payload which is already fr32-padded, e.g. read from an
+// unsealed sector, to the accumulator without expanding it again. The input
+// must consist of whole 128-byte blocks, each the expansion of 127 bytes of
+// payload, and can be mixed with Write()s as long as those leave no partial
+// 127-byte block behind. Input with the 2 topmost bits of any 32-byte leaf set
+// is rejected as a whole (matching ErrInvalidPadding). The returned count is
+// of padded bytes, while the sizes of a PayloadSizeError are of unpadded ones.
+func (cp *Calc) WritePadded(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := fr32.Validate(p); err != nil {
+		return 0, xerrors.Errorf("%s: %w", err, ErrInvalidPadding)
+	}
+
+	epoch, err := cp.enterWrite("WritePadded")
+	if err != nil {
+		return 0, err
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if err := cp.checkEpoch("WritePadded", epoch); err != nil {
+		return 0, err
+	}
+
+	if len(cp.carry) > 0 {
+		return 0, xerrors.Errorf("padded input written after a partial block of %d bytes", len(cp.carry))
+	}
+
+	ws, err := cp.begin("WritePadded", uint64(len(p))/128*127)
+	if err != nil {
+		return 0, err
+	}
+	if ws != nil {
+		defer ws.End(nil)
+	}
+
+	for b := p; len(b) > 0; b = b[128:] {
+		// the layer workers overwrite the block in place
+		expander := cp.newExpander()
+		copy(expander, b[:128])
+		cp.digestPaddedBlock(expander)
+	}
+	return len(p), nil
+}
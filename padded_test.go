@@ -0,0 +1,66 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+	"golang.org/x/xerrors"
+)
+
+func TestWritePadded(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	payload := make([]byte, 127<<12)
+	rnd.Read(payload)
+	padded := make([]byte, 128<<12)
+	fr32.Pad(payload, padded)
+
+	for _, opts := range [][]Option{nil, {WithScratch(new(Scratch))}, {WithExperimentalTree(sha254TreeHasher(4))}} {
+		for _, blocks := range []int{1, 2, 5, 1 << 12} {
+			ref := New(opts...)
+			ref.Write(payload[:blocks*127])
+			ref.Write(payload[:100])
+			expCommP, expSize, err := ref.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// padded blocks in chunks, followed by an unpadded tail
+			cp := New(opts...)
+			for b := 0; b < blocks; {
+				n := 1 + rnd.Intn(64)
+				if b+n > blocks {
+					n = blocks - b
+				}
+				if w, err := cp.WritePadded(padded[b*128 : (b+n)*128]); err != nil || w != n*128 {
+					t.Fatalf("wrote %d bytes: %v", w, err)
+				}
+				b += n
+			}
+			cp.Write(payload[:100])
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commP, expCommP) || paddedSize != expSize {
+				t.Fatalf("%d padded blocks produced 0x%X / %d, expected 0x%X / %d", blocks, commP, paddedSize, expCommP, expSize)
+			}
+		}
+	}
+
+	cp := new(Calc)
+	defer cp.Reset()
+	invalid := append([]byte{}, padded[:256]...)
+	invalid[128+63] |= 0x80
+	if _, err := cp.WritePadded(invalid); !xerrors.Is(err, ErrInvalidPadding) {
+		t.Fatalf("expected ErrInvalidPadding, got %v", err)
+	}
+	if _, err := cp.WritePadded(padded[:100]); !xerrors.Is(err, ErrInvalidPadding) {
+		t.Fatalf("expected ErrInvalidPadding for a partial block, got %v", err)
+	}
+	cp.Write(payload[:10])
+	if _, err := cp.WritePadded(padded[:128]); err == nil {
+		t.Fatal("unexpected success writing padded input after a partial block")
+	}
+}
@@ -0,0 +1,155 @@
+package commp
+
+import (
+	"io"
+	"math/bits"
+	"os"
+	"runtime"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// minParallelSegment is the smallest padded size of the segments of a payload
+// hashed concurrently by HashReaderAt: below that, starting a pipeline per
+// segment costs more than it saves.
+const minParallelSegment = 16 << 20
+
+// parallelReadSize is the size of the reads of every segment.
+const parallelReadSize = 127 << 12
+
+// HashReaderAt returns the raw commP and padded piece size of the size bytes
+// of payload readable from r, saturating as many cores as GOMAXPROCS allows
+// for a single piece. Instead of streaming the payload through one pipeline,
+// whose block folding worker caps the throughput at what a single core can
+// hash, the payload is split into segments covering aligned subtrees of the
+// piece. The segments are read and hashed by independent Calcs configured
+// with opts, each of them keeping about two cores busy, and their roots are
+// then combined the way ComputeCommD() combines pieces. Options observing the
+// tree, which would only see the nodes of a segment, are not supported.
+func HashReaderAt(r io.ReaderAt, size uint64, opts ...Option) (commP []byte, paddedPieceSize uint64, err error) {
+	workers := runtime.GOMAXPROCS(0) / 2
+	if workers < 1 {
+		workers = 1
+	}
+
+	// about 4 segments per worker balance the load
+	segment := paddedSizeFor(size) >> uint(bits.Len(uint(workers*4-1)))
+	if segment < minParallelSegment {
+		segment = minParallelSegment
+	}
+	return hashSegments(r, size, segment, workers, opts)
+}
+
+// HashFileParallel returns the raw commP and padded piece size of the file at
+// path, read concurrently by HashReaderAt.
+func HashFileParallel(path string, opts ...Option) (commP []byte, paddedPieceSize uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	return HashReaderAt(f, uint64(fi.Size()), opts...)
+}
+
+// hashSegments hashes the payload in segments of the given padded size using
+// the given amount of workers.
+func hashSegments(r io.ReaderAt, size, segmentPaddedSize uint64, workers int, opts []Option) ([]byte, uint64, error) {
+	if size < MinPiecePayload {
+		return nil, 0, &PayloadSizeError{Err: ErrPayloadTooSmall, Limit: MinPiecePayload, Size: size, Accepted: size}
+	}
+	if size > MaxPiecePayload {
+		return nil, 0, &PayloadSizeError{Err: ErrPayloadTooLarge, Limit: MaxPiecePayload, Size: size}
+	}
+	var cfg config
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if len(cfg.nodeSinks) > 0 || cfg.treeHasher != nil || cfg.paddedSink != nil {
+		return nil, 0, xerrors.New("options observing the tree are not supported when hashing segments concurrently")
+	}
+
+	paddedSize := paddedSizeFor(size)
+	if segmentPaddedSize > paddedSize {
+		segmentPaddedSize = paddedSize
+	}
+	segment := segmentPaddedSize / 128 * 127
+	roots := make([]PieceInfo, (size+segment-1)/segment)
+	if workers > len(roots) {
+		workers = len(roots)
+	}
+
+	var (
+		mu       sync.Mutex
+		next     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	claim := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil || next == len(roots) {
+			return -1
+		}
+		next++
+		return next - 1
+	}
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			cp := New(opts...)
+			defer cp.Reset()
+			buf := make([]byte, parallelReadSize)
+
+			for i := claim(); i >= 0; i = claim() {
+				off := uint64(i) * segment
+				n := segment
+				if off+n > size {
+					n = size - off
+				}
+				copied, err := io.CopyBuffer(cp, io.NewSectionReader(r, int64(off), int64(n)), buf)
+				if err == nil && uint64(copied) != n {
+					err = xerrors.Errorf("segment %d at offset %d: %w", i, off, io.ErrUnexpectedEOF)
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+				// the zeros following a short tail are part of its padding
+				if n < MinPiecePayload {
+					cp.WriteZeros(MinPiecePayload - n)
+				}
+				root, rootSize, err := cp.Digest()
+				if err != nil {
+					fail(err)
+					return
+				}
+				roots[i] = PieceInfo{CommP: root, PaddedPieceSize: rootSize}
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+
+	commP, err := ComputeCommD(paddedSize, roots)
+	if err != nil {
+		return nil, 0, err
+	}
+	return commP, paddedSize, nil
+}
@@ -0,0 +1,77 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestHashSegments(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 127<<12)
+	rnd.Read(data)
+
+	for _, size := range []int{65, 127, 1000, 127 << 6, 127<<6 + 1, 127<<6 + 64, 127<<7 - 1, 127 * 3000, len(data)} {
+		expCommP, expSize, err := Sum(data[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, segment := range []uint64{128, 1 << 10, 8 << 10, 1 << 20} {
+			for _, workers := range []int{1, 3, 8} {
+				commP, paddedSize, err := hashSegments(bytes.NewReader(data), uint64(size), segment, workers, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+					t.Fatalf(
+						"%d bytes in segments of %d by %d workers produced 0x%X / %d, expected 0x%X / %d",
+						size, segment, workers, commP, paddedSize, expCommP, expSize,
+					)
+				}
+			}
+		}
+	}
+
+	commP, paddedSize, err := HashReaderAt(bytes.NewReader(data), uint64(len(data)), WithScratch(new(Scratch)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expCommP, expSize, _ := Sum(data); !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+		t.Fatalf("produced 0x%X / %d, expected 0x%X / %d", commP, paddedSize, expCommP, expSize)
+	}
+
+	if _, _, err := hashSegments(bytes.NewReader(data[:5000]), 6000, 1<<10, 2, nil); !xerrors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF for a short reader, got %v", err)
+	}
+	if _, _, err := HashReaderAt(bytes.NewReader(data), 64); !xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("expected ErrPayloadTooSmall, got %v", err)
+	}
+	if _, _, err := HashReaderAt(bytes.NewReader(data), 1000, WithTreeLayers(0, func(uint, uint64, []byte) {})); err == nil {
+		t.Fatal("unexpected success observing the tree")
+	}
+}
+
+func BenchmarkHashReaderAt(b *testing.B) {
+	data := make([]byte, 127<<18)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.Run("calc", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := Sum(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("segments", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := HashReaderAt(bytes.NewReader(data), uint64(len(data))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
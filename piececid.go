@@ -0,0 +1,147 @@
+package commp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// PieceCIDv2 is a binary piece CID in the format of FRC-0069: a CIDv1 with the
+// raw codec and the fr32-sha256-trunc254-padbintree multihash, whose digest
+// embeds the size of the piece and of its payload ahead of the commP, so that
+// neither needs to be conveyed separately.
+type PieceCIDv2 []byte
+
+// MultihashFr32Sha256Trunc254Padbintree is the multihash code of the digest of
+// a PieceCIDv2.
+const MultihashFr32Sha256Trunc254Padbintree = 0x1011
+
+// ErrInvalidPieceCIDv2 is matched by the errors of malformed PieceCIDv2 values.
+var ErrInvalidPieceCIDv2 = xerrors.New("invalid v2 piece CID")
+
+// version 1, codec raw, multihash 0x1011
+var pieceCIDv2Prefix = []byte{0x01, 0x55, 0x91, 0x20}
+
+var pieceCIDv2Base32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// NewPieceCIDv2 encodes the PieceCIDv2 of a piece of the given padded size,
+// holding payloadSize bytes of payload.
+func NewPieceCIDv2(rawCommP []byte, paddedPieceSize, payloadSize uint64) (PieceCIDv2, error) {
+	if len(rawCommP) != 32 {
+		return nil, xerrors.Errorf("commP of %d bytes instead of 32: %w", len(rawCommP), ErrInvalidPieceCIDv2)
+	}
+	if err := PaddedPieceSize(paddedPieceSize).Validate(); err != nil {
+		return nil, xerrors.Errorf("%s: %w", err, ErrInvalidPieceCIDv2)
+	}
+	capacity := uint64(PaddedPieceSize(paddedPieceSize).Unpadded())
+	if payloadSize > capacity {
+		return nil, xerrors.Errorf("payload of %d bytes exceeds the %d bytes of a %d byte piece: %w", payloadSize, capacity, paddedPieceSize, ErrInvalidPieceCIDv2)
+	}
+
+	var vi [binary.MaxVarintLen64]byte
+	padding := vi[:binary.PutUvarint(vi[:], capacity-payloadSize)]
+	digestLen := uint64(len(padding) + 1 + 32)
+
+	c := make([]byte, 0, len(pieceCIDv2Prefix)+2+int(digestLen))
+	c = append(c, pieceCIDv2Prefix...)
+	var dl [binary.MaxVarintLen64]byte
+	c = append(c, dl[:binary.PutUvarint(dl[:], digestLen)]...)
+	c = append(c, padding...)
+	c = append(c, byte(bits.TrailingZeros64(paddedPieceSize)-5))
+	c = append(c, rawCommP...)
+	return PieceCIDv2(c), nil
+}
+
+// DecodePieceCIDv2 validates a binary PieceCIDv2.
+func DecodePieceCIDv2(b []byte) (PieceCIDv2, error) {
+	if _, _, _, err := PieceCIDv2(b).decode(); err != nil {
+		return nil, err
+	}
+	return PieceCIDv2(b), nil
+}
+
+// ParsePieceCIDv2 parses the base32 string form of a PieceCIDv2, as returned
+// by its String().
+func ParsePieceCIDv2(s string) (PieceCIDv2, error) {
+	if len(s) < 2 || s[0] != 'b' {
+		return nil, xerrors.Errorf("%q is not a base32 CID: %w", s, ErrInvalidPieceCIDv2)
+	}
+	b, err := pieceCIDv2Base32.DecodeString(s[1:])
+	if err != nil {
+		return nil, xerrors.Errorf("%q is not a base32 CID: %w", s, ErrInvalidPieceCIDv2)
+	}
+	return DecodePieceCIDv2(b)
+}
+
+// String returns the base32 form of c, as customarily displayed.
+func (c PieceCIDv2) String() string {
+	return "b" + pieceCIDv2Base32.EncodeToString(c)
+}
+
+// CommP returns the raw commP of the piece.
+func (c PieceCIDv2) CommP() []byte {
+	commP, _, _, _ := c.decode()
+	return commP
+}
+
+// PaddedPieceSize returns the padded size of the piece.
+func (c PieceCIDv2) PaddedPieceSize() uint64 {
+	_, paddedSize, _, _ := c.decode()
+	return paddedSize
+}
+
+// PayloadSize returns the size of the payload of the piece.
+func (c PieceCIDv2) PayloadSize() uint64 {
+	_, _, payloadSize, _ := c.decode()
+	return payloadSize
+}
+
+// PieceInfo returns the commp.PieceInfo of the piece.
+func (c PieceCIDv2) PieceInfo() PieceInfo {
+	commP, paddedSize, _, _ := c.decode()
+	return PieceInfo{CommP: commP, PaddedPieceSize: paddedSize}
+}
+
+func (c PieceCIDv2) decode() (commP []byte, paddedSize, payloadSize uint64, err error) {
+	invalid := func(what string) error {
+		return xerrors.Errorf("%s: %w", what, ErrInvalidPieceCIDv2)
+	}
+
+	if !bytes.HasPrefix(c, pieceCIDv2Prefix) {
+		return nil, 0, 0, invalid("not a CIDv1 with the raw codec and the fr32-sha256-trunc254-padbintree multihash")
+	}
+	digest := c[len(pieceCIDv2Prefix):]
+	digestLen, n := binary.Uvarint(digest)
+	if n <= 0 || digestLen != uint64(len(digest)-n) {
+		return nil, 0, 0, invalid("digest length mismatch")
+	}
+	digest = digest[n:]
+
+	padding, n := binary.Uvarint(digest)
+	if n <= 0 || len(digest) != n+1+32 {
+		return nil, 0, 0, invalid("malformed digest")
+	}
+	height := uint(digest[n])
+	if height < 2 || height > MaxLayers {
+		return nil, 0, 0, invalid("tree height out of bounds")
+	}
+	paddedSize = 32 << height
+	capacity := uint64(PaddedPieceSize(paddedSize).Unpadded())
+	if padding > capacity {
+		return nil, 0, 0, invalid("padding exceeds the size of the piece")
+	}
+
+	return digest[n+1:], paddedSize, capacity - padding, nil
+}
+
+// DigestV2 is Digest() returning the PieceCIDv2 of the piece.
+func (cp *Calc) DigestV2() (PieceCIDv2, error) {
+	commP, paddedSize, payloadSize, err := cp.digest(nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewPieceCIDv2(commP, paddedSize, payloadSize)
+}
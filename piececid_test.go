@@ -0,0 +1,49 @@
+package commp
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestPieceCIDv2(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 1000)
+
+	cp := new(Calc)
+	cp.Write(payload)
+	c, err := cp.DigestV2()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commP, paddedSize, err := Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.CommP(), commP[:]) || c.PaddedPieceSize() != paddedSize || c.PayloadSize() != 1000 {
+		t.Fatalf("%s decodes to %X/%d/%d", c, c.CommP(), c.PaddedPieceSize(), c.PayloadSize())
+	}
+
+	parsed, err := ParsePieceCIDv2(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed, c) {
+		t.Fatalf("%s parsed as %s", c, parsed)
+	}
+
+	for name, b := range map[string][]byte{
+		"truncated": c[:len(c)-1],
+		"v1 CID":    append([]byte{0x01, 0x81, 0xE2, 0x03, 0x92, 0x20, 0x20}, commP[:]...),
+		"height":    append(append([]byte(nil), c[:len(c)-33]...), append([]byte{40}, commP[:]...)...),
+	} {
+		if _, err := DecodePieceCIDv2(b); !xerrors.Is(err, ErrInvalidPieceCIDv2) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	if _, err := NewPieceCIDv2(commP[:], paddedSize, paddedSize); !xerrors.Is(err, ErrInvalidPieceCIDv2) {
+		t.Errorf("unexpected error for an oversized payload: %v", err)
+	}
+}
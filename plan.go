@@ -0,0 +1,106 @@
+package commp
+
+import (
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// Placement is the position of a piece within a sector or an aggregate.
+type Placement struct {
+	Index  int    // position among the sizes supplied
+	Offset uint64 // padded offset
+	Size   uint64 // padded size
+}
+
+// Filler is a run of zeroes within a sector or an aggregate, which is the
+// zero piece of the given size.
+type Filler struct {
+	Offset uint64 // padded offset
+	Size   uint64 // padded size, a power of two
+}
+
+// Plan is the layout of a set of pieces within a sector or an aggregate of
+// TargetPaddedSize bytes. Every piece is placed at the next offset aligned to
+// its own size, the same way ComputeCommD() and GenerateUnsealedCID of
+// filecoin-ffi do, with the gaps in between and the remainder of the target
+// taken up by zero fillers.
+type Plan struct {
+	TargetPaddedSize uint64
+	Pieces           []Placement // in offset order
+	Fillers          []Filler    // in offset order
+	PiecesSize       uint64      // total padded size of the pieces
+}
+
+// Utilization returns the share of the target taken up by pieces.
+func (p *Plan) Utilization() float64 {
+	return float64(p.PiecesSize) / float64(p.TargetPaddedSize)
+}
+
+// PlanPieces places pieces of the given padded sizes within a target of the
+// given padded size in the order supplied.
+func PlanPieces(targetPaddedSize uint64, pieceSizes []uint64) (*Plan, error) {
+	order := make([]int, len(pieceSizes))
+	for i := range order {
+		order[i] = i
+	}
+	return planPieces(targetPaddedSize, pieceSizes, order)
+}
+
+// PlanPiecesSorted places pieces of the given padded sizes within a target of
+// the given padded size by decreasing size, which requires no fillers between
+// the pieces. Pieces of equal size keep the order supplied.
+func PlanPiecesSorted(targetPaddedSize uint64, pieceSizes []uint64) (*Plan, error) {
+	order := make([]int, len(pieceSizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return pieceSizes[order[a]] > pieceSizes[order[b]]
+	})
+	return planPieces(targetPaddedSize, pieceSizes, order)
+}
+
+func planPieces(targetPaddedSize uint64, pieceSizes []uint64, order []int) (*Plan, error) {
+	if err := PaddedPieceSize(targetPaddedSize).Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid target size: %w", err)
+	}
+
+	p := &Plan{
+		TargetPaddedSize: targetPaddedSize,
+		Pieces:           make([]Placement, 0, len(order)),
+	}
+	var filled uint64
+	fill := func(sizes []uint64) {
+		for _, s := range sizes {
+			p.Fillers = append(p.Fillers, Filler{Offset: filled, Size: s})
+			filled += s
+		}
+	}
+
+	for _, i := range order {
+		size := pieceSizes[i]
+		if err := PaddedPieceSize(size).Validate(); err != nil {
+			return nil, xerrors.Errorf("piece %d: %w", i, err)
+		}
+
+		fill(fillerSizes(filled, size))
+		if filled+size > targetPaddedSize {
+			return nil, xerrors.Errorf(
+				"piece %d of padded size %d at offset %d does not fit in a target of %d bytes",
+				i, size, filled, targetPaddedSize,
+			)
+		}
+
+		p.Pieces = append(p.Pieces, Placement{Index: i, Offset: filled, Size: size})
+		p.PiecesSize += size
+		filled += size
+	}
+	if filled == 0 {
+		fill([]uint64{targetPaddedSize})
+	} else {
+		fill(fillerSizes(filled, targetPaddedSize))
+	}
+
+	return p, nil
+}
@@ -0,0 +1,95 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestPlanPieces(t *testing.T) {
+	const target = 32 << 10
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, sizes := range [][]uint64{
+		{},
+		{target},
+		{128},
+		{128, 1 << 10, 256},
+		{256, 256, 4 << 10, 128, 8 << 10, 512},
+		{16 << 10, 128, 8 << 10},
+	} {
+		for _, plan := range []func(uint64, []uint64) (*Plan, error){PlanPieces, PlanPiecesSorted} {
+			p, err := plan(target, sizes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// pieces and fillers tile the target, with a commD identical to
+			// the one of the pieces alone
+			var pieces, tiles []PieceInfo
+			var offsets []uint64
+			byOffset := make(map[uint64]PieceInfo)
+			for _, pl := range p.Pieces {
+				if pl.Offset%pl.Size != 0 || pl.Size != sizes[pl.Index] {
+					t.Fatalf("%v: misplaced piece %+v", sizes, pl)
+				}
+				commP := make([]byte, 32)
+				rnd.Read(commP)
+				commP[31] &= 0x3F
+				pi := PieceInfo{CommP: commP, PaddedPieceSize: pl.Size}
+				pieces = append(pieces, pi)
+				byOffset[pl.Offset] = pi
+				offsets = append(offsets, pl.Offset)
+			}
+			for _, f := range p.Fillers {
+				commP, err := ZeroPieceCommP(f.Size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				byOffset[f.Offset] = PieceInfo{CommP: commP, PaddedPieceSize: f.Size}
+				offsets = append(offsets, f.Offset)
+			}
+			sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+			var filled uint64
+			for _, o := range offsets {
+				if o != filled {
+					t.Fatalf("%v: gap or overlap at offset %d", sizes, filled)
+				}
+				tiles = append(tiles, byOffset[o])
+				filled += byOffset[o].PaddedPieceSize
+			}
+			if filled != target {
+				t.Fatalf("%v: pieces and fillers take up %d bytes instead of %d", sizes, filled, target)
+			}
+
+			expCommD, err := ComputeCommD(target, pieces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commD, err := ComputeCommD(target, tiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commD, expCommD) {
+				t.Fatalf("%v: commD of the tiled plan 0x%X does not match 0x%X", sizes, commD, expCommD)
+			}
+		}
+	}
+
+	p, err := PlanPiecesSorted(target, []uint64{128, 1 << 10, 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no fillers between the pieces
+	if p.Fillers[0].Offset != 1408 || p.Utilization() != 1408.0/target {
+		t.Fatalf("unexpected sorted plan %+v", p)
+	}
+
+	if _, err := PlanPieces(target, []uint64{128, 16 << 10, 16 << 10}); err == nil {
+		t.Fatal("expected an error for pieces exceeding the target once aligned")
+	}
+	if _, err := PlanPieces(target, []uint64{1000}); err == nil {
+		t.Fatal("expected an error for an invalid piece size")
+	}
+}
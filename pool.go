@@ -0,0 +1,95 @@
+package commp
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Pool is a fixed set of goroutines running the layer workers of any number of
+// Calcs configured via WithPool, putting a process-wide ceiling on the cores
+// spent hashing regardless of how many pieces are in progress. Rather than a
+// goroutine per level of every tree, the workers are tasks of the pool,
+// scheduled whenever nodes are queued for them: the goroutines of the process
+// no longer grow with the amount of pieces in progress. The NodeHasher,
+// BatchHasher, TreeNodeSinks and Observer of these Calcs are called within the
+// pool, where a call that never returns holds up one of its goroutines.
+type Pool struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	tasks  []func()
+	head   int // of tasks
+	closed bool
+	group  sync.WaitGroup
+}
+
+// NewPool starts a Pool of the given amount of workers, or GOMAXPROCS if 0.
+func NewPool(workers int) *Pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := new(Pool)
+	p.cond.L = &p.mu
+	p.group.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// WithPool runs the layer workers of the Calc within p. It combines with all
+// other options, the NodeHasher or BatchHasher configured is used as usual.
+func WithPool(p *Pool) Option {
+	return func(c *config) {
+		c.pool = p
+	}
+}
+
+// Close stops the workers once they are done with the tasks queued so far.
+// It is safe to keep using the Calcs configured with the pool afterwards:
+// their layer workers run as goroutines of their own from then on, as if
+// without WithPool().
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.group.Wait()
+}
+
+// submit queues a task, without ever waiting for a worker to take it up: the
+// tasks of the layers queue up nodes for one another.
+func (p *Pool) submit(task func()) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		go task()
+		return
+	}
+	p.tasks = append(p.tasks, task)
+	p.cond.Signal()
+	p.mu.Unlock()
+}
+
+func (p *Pool) work() {
+	defer p.group.Done()
+
+	p.mu.Lock()
+	for {
+		for p.head == len(p.tasks) && !p.closed {
+			p.cond.Wait()
+		}
+		if p.head == len(p.tasks) {
+			p.mu.Unlock()
+			return
+		}
+		task := p.tasks[p.head]
+		p.tasks[p.head] = nil
+		p.head++
+		if p.head == len(p.tasks) {
+			p.tasks, p.head = p.tasks[:0], 0
+		}
+		p.mu.Unlock()
+		task()
+		p.mu.Lock()
+	}
+}
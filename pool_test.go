@@ -0,0 +1,176 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 127<<12)
+	rnd.Read(data)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		size := 65 + i*(len(data)-65)/15
+		wg.Add(1)
+		go func(payload []byte) {
+			defer wg.Done()
+			expCommP, expSize, err := Sum(payload)
+			if err != nil {
+				errs <- err
+				return
+			}
+			cp := New(WithPool(p))
+			cp.Write(payload)
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+				t.Errorf("%d bytes produced 0x%X / %d, expected 0x%X / %d", len(payload), commP, paddedSize, expCommP, expSize)
+			}
+		}(data[:size])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolGoroutines(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 127<<10)
+	rnd.Read(data)
+	expCommP, expSize, err := Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pieces in progress hold on to no goroutine of their own
+	before := runtime.NumGoroutine()
+	calcs := make([]*Calc, 32)
+	for i := range calcs {
+		calcs[i] = New(WithPool(p))
+		calcs[i].Write(data)
+	}
+	if n := runtime.NumGoroutine(); n > before+2 {
+		t.Errorf("%d pieces in progress run %d goroutines, %d beforehand", len(calcs), n, before)
+	}
+
+	for _, cp := range calcs {
+		if cp.ActiveWorkers() == 0 {
+			t.Fatal("piece in progress reports no layer workers")
+		}
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("pooled piece produced 0x%X / %d, expected 0x%X / %d", commP, paddedSize, expCommP, expSize)
+		}
+	}
+}
+
+type countingNodeHasher struct {
+	calls uint64
+}
+
+func (nh *countingNodeHasher) HashNodes(dst, left, right []byte) []byte {
+	atomic.AddUint64(&nh.calls, 1)
+	return hashNode(dst, left, right)
+}
+
+func TestPoolOptions(t *testing.T) {
+	p := NewPool(1)
+	defer p.Close()
+
+	data := bytes.Repeat([]byte{0xA5}, 127<<8)
+	expCommP, expSize, err := Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nh := new(countingNodeHasher)
+	for name, opts := range map[string][]Option{
+		"nodeHasher": {WithNodeHasher(nh)},
+		"batch":      {WithBatchHasher(new(recordingBatchHasher), 128)},
+		"inline":     {WithInlineFolding()},
+		"timeout":    {WithDigestTimeout(time.Minute)},
+	} {
+		cp := New(append(opts, WithPool(p))...)
+		cp.Write(data)
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("%s: pooled piece produced 0x%X / %d, expected 0x%X / %d", name, commP, paddedSize, expCommP, expSize)
+		}
+	}
+	if atomic.LoadUint64(&nh.calls) == 0 {
+		t.Fatal("the configured NodeHasher was bypassed by the pool")
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := NewPool(2)
+	data := bytes.Repeat([]byte{0x3C}, 127<<6)
+	expCommP, expSize, err := Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp := New(WithPool(p))
+	cp.Write(data[:len(data)/2])
+	p.Close()
+	p.Close()
+
+	// the piece carries on without the pool
+	cp.Write(data[len(data)/2:])
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+		t.Fatalf("piece outliving its pool produced 0x%X / %d, expected 0x%X / %d", commP, paddedSize, expCommP, expSize)
+	}
+}
+
+func TestPoolDigestTimeout(t *testing.T) {
+	p := NewPool(1)
+	defer p.Close()
+	release := make(chan struct{})
+
+	cp := New(WithPool(p), WithDigestTimeout(50*time.Millisecond), WithLevelObserver(5, func(uint64, []byte) {
+		<-release
+	}))
+	cp.Write(bytes.Repeat([]byte{0x5A}, 127*8))
+
+	_, _, err := cp.Digest()
+	var se *StallError
+	if !xerrors.As(err, &se) || se.Layer != 5 {
+		t.Fatalf("stalled Digest() returned %v", err)
+	}
+
+	close(release)
+	for cp.ActiveWorkers() > 0 {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,224 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+	"golang.org/x/xerrors"
+)
+
+// RangeProof demonstrates that a range of unpadded payload bytes is included
+// in a piece with a specific commP. Because fr32 expansion operates on 127-byte
+// blocks, the proof carries the payload bytes between the enclosing block
+// boundaries and the requested range, alongside the sibling nodes necessary to
+// climb from the enclosing blocks to the root of the tree.
+type RangeProof struct {
+	Offset          uint64 // unpadded offset of the first proven byte
+	Length          uint64 // amount of proven bytes
+	PaddedPieceSize uint64
+
+	// Head holds the payload bytes from the start of the first enclosing block
+	// up to Offset, Tail the bytes from Offset+Length to the end of the last
+	// enclosing block. Bytes past the end of the payload are zeroes.
+	Head, Tail []byte
+
+	// Siblings holds the nodes necessary to compute the root, starting at the
+	// level of the 127-byte blocks (level 2) and moving up. Within every level
+	// the left sibling of the range (if any) precedes the right one (if any).
+	Siblings [][]byte
+}
+
+// ProveRange generates a RangeProof for length bytes starting at the unpadded
+// offset, using the supplied tree cache. Sibling nodes from levels not held by
+// the cache, as well as the Head and Tail bytes, are derived from the original
+// payload, accessed via the supplied ReaderAt. The closer the lowest cached
+// level is to 2, the less data needs to be re-read in order to build a proof.
+func (tc *TreeCache) ProveRange(payload io.ReaderAt, offset, length uint64) (*RangeProof, error) {
+
+	height := tc.Height()
+	if height < 2 {
+		return nil, xerrors.New("tree cache does not contain the root of a valid tree")
+	}
+	paddedSize := uint64(32) << uint(height)
+
+	if length == 0 {
+		return nil, xerrors.New("unable to prove a zero-length range")
+	}
+	if offset+length < offset || offset+length > paddedSize/128*127 {
+		return nil, xerrors.Errorf(
+			"range of %d bytes at offset %d exceeds the unpadded piece size %d",
+			length, offset, paddedSize/128*127,
+		)
+	}
+
+	firstBlock, lastBlock := offset/127, (offset+length-1)/127
+
+	head := make([]byte, offset-firstBlock*127)
+	if err := readFullAt(payload, head, firstBlock*127); err != nil {
+		return nil, err
+	}
+	tail := make([]byte, (lastBlock+1)*127-offset-length)
+	if err := readFullAt(payload, tail, offset+length); err != nil {
+		return nil, err
+	}
+
+	proof := &RangeProof{
+		Offset:          offset,
+		Length:          length,
+		PaddedPieceSize: paddedSize,
+		Head:            head,
+		Tail:            tail,
+	}
+
+	sibling := func(level uint, idx uint64) ([]byte, error) {
+		if tc.HasLevel(level) {
+			return tc.Node(level, idx), nil
+		}
+		return subtreeRoot(payload, level, idx)
+	}
+
+	lo, hi := firstBlock, lastBlock
+	for level := uint(2); level < uint(height); level++ {
+		if lo&1 == 1 {
+			n, err := sibling(level, lo-1)
+			if err != nil {
+				return nil, err
+			}
+			proof.Siblings = append(proof.Siblings, n)
+		}
+		if hi&1 == 0 {
+			n, err := sibling(level, hi+1)
+			if err != nil {
+				return nil, err
+			}
+			proof.Siblings = append(proof.Siblings, n)
+		}
+		lo, hi = lo/2, hi/2
+	}
+
+	return proof, nil
+}
+
+// VerifyRange checks that data, combined with the supplied proof, hashes up to
+// the expected commP. A nil return means the data is included in the piece at
+// the offset recorded in the proof.
+func VerifyRange(commP, data []byte, proof *RangeProof) error {
+
+	if len(commP) != 32 {
+		return xerrors.Errorf("provided commP must be exactly 32 bytes long, got %d bytes instead", len(commP))
+	}
+	if bits.OnesCount64(proof.PaddedPieceSize) != 1 || proof.PaddedPieceSize < 128 {
+		return xerrors.Errorf("padded piece size %d is not a power of 2 of at least 128 bytes", proof.PaddedPieceSize)
+	}
+	if uint64(len(data)) != proof.Length || proof.Length == 0 {
+		return xerrors.Errorf("proof covers %d bytes, but %d bytes were supplied", proof.Length, len(data))
+	}
+	if proof.Offset+proof.Length < proof.Offset || proof.Offset+proof.Length > proof.PaddedPieceSize/128*127 {
+		return xerrors.Errorf(
+			"range of %d bytes at offset %d exceeds the unpadded piece size %d",
+			proof.Length, proof.Offset, proof.PaddedPieceSize/128*127,
+		)
+	}
+
+	firstBlock, lastBlock := proof.Offset/127, (proof.Offset+proof.Length-1)/127
+	if uint64(len(proof.Head)) != proof.Offset-firstBlock*127 ||
+		uint64(len(proof.Tail)) != (lastBlock+1)*127-proof.Offset-proof.Length {
+		return xerrors.New("proof head or tail do not align the range to 127-byte block boundaries")
+	}
+
+	payload := make([]byte, 0, (lastBlock-firstBlock+1)*127)
+	payload = append(payload, proof.Head...)
+	payload = append(payload, data...)
+	payload = append(payload, proof.Tail...)
+
+	// collapse every block down to its level-2 node
+	nodes := make([][]byte, 0, lastBlock-firstBlock+1)
+	var expanded [128]byte
+	for ; len(payload) > 0; payload = payload[127:] {
+		fr32.Pad(payload[:127], expanded[:])
+		n0 := hashNode(nil, expanded[0:32], expanded[32:64])
+		n1 := hashNode(nil, expanded[64:96], expanded[96:128])
+		nodes = append(nodes, hashNode(n0[:0], n0, n1))
+	}
+
+	siblings := proof.Siblings
+	lo, hi := firstBlock, lastBlock
+	for level := 2; level < bits.TrailingZeros64(proof.PaddedPieceSize)-5; level++ {
+		if lo&1 == 1 {
+			if len(siblings) == 0 {
+				return xerrors.Errorf("proof is missing a left sibling at level %d", level)
+			}
+			nodes = append([][]byte{siblings[0]}, nodes...)
+			siblings = siblings[1:]
+		}
+		if hi&1 == 0 {
+			if len(siblings) == 0 {
+				return xerrors.Errorf("proof is missing a right sibling at level %d", level)
+			}
+			nodes = append(nodes, siblings[0])
+			siblings = siblings[1:]
+		}
+		for i := 0; i < len(nodes)/2; i++ {
+			if len(nodes[2*i]) != 32 || len(nodes[2*i+1]) != 32 {
+				return xerrors.Errorf("proof contains a node at level %d which is not 32 bytes long", level)
+			}
+			nodes[i] = hashNode(nil, nodes[2*i], nodes[2*i+1])
+		}
+		nodes = nodes[:len(nodes)/2]
+		lo, hi = lo/2, hi/2
+	}
+
+	if len(siblings) != 0 {
+		return xerrors.Errorf("proof contains %d superfluous sibling nodes", len(siblings))
+	}
+	if !bytes.Equal(nodes[0], commP) {
+		return xerrors.Errorf("computed root 0x%X does not match expected commP 0x%X", nodes[0], commP)
+	}
+
+	return nil
+}
+
+// subtreeRoot recomputes the node at the given level (2 or above) and index
+// from the payload it covers.
+func subtreeRoot(payload io.ReaderAt, level uint, idx uint64) ([]byte, error) {
+	span := uint64(127) << (level - 2)
+
+	cp := new(Calc)
+	n, err := io.Copy(cp, io.NewSectionReader(payload, int64(idx*span), int64(span)))
+	if err != nil {
+		cp.Reset()
+		return nil, err
+	}
+	if n == 0 {
+		return append(make([]byte, 0, 32), nulPadding(level)...), nil
+	}
+
+	// round up to a full block: the trailing zeroes are indistinguishable
+	// from the implicit padding, and circumvent MinPiecePayload
+	if n%127 != 0 {
+		if _, err := cp.Write(make([]byte, 127-n%127)); err != nil {
+			cp.Reset()
+			return nil, err
+		}
+	}
+
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return PadCommP(commP, paddedSize, 32<<level)
+}
+
+func readFullAt(r io.ReaderAt, buf []byte, offset uint64) error {
+	n, err := r.ReadAt(buf, int64(offset))
+	if err == io.EOF {
+		// past the end of payload: implicit zero padding
+		for i := n; i < len(buf); i++ {
+			buf[i] = 0
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package commp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	randmath "math/rand"
+)
+
+func TestProveRange(t *testing.T) {
+	t.Parallel()
+
+	rnd := randmath.New(randmath.NewSource(1337))
+	payload := make([]byte, 127*100+42)
+	rnd.Read(payload)
+
+	for _, minLevel := range []uint{0, 2, 5} {
+		minLevel := minLevel
+		t.Run(fmt.Sprintf("minLevel%d", minLevel), func(t *testing.T) {
+			t.Parallel()
+
+			tc := new(TreeCache)
+			cp := New(WithTreeLayers(minLevel, tc.Add))
+			if _, err := cp.Write(payload); err != nil {
+				t.Fatal(err)
+			}
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ranges := [][2]uint64{
+				{0, 1},
+				{0, uint64(len(payload))},
+				{126, 2},
+				{127, 127},
+				{1000, 5000},
+				{uint64(len(payload)) - 1, 1},
+			}
+			rr := randmath.New(randmath.NewSource(42))
+			for i := 0; i < 20; i++ {
+				off := uint64(rr.Intn(len(payload)))
+				ranges = append(ranges, [2]uint64{off, 1 + uint64(rr.Intn(len(payload)-int(off)))})
+			}
+
+			for _, r := range ranges {
+				proof, err := tc.ProveRange(bytes.NewReader(payload), r[0], r[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if proof.PaddedPieceSize != paddedSize {
+					t.Fatalf("proof padded size %d does not match %d", proof.PaddedPieceSize, paddedSize)
+				}
+
+				data := payload[r[0] : r[0]+r[1]]
+				if err := VerifyRange(commP, data, proof); err != nil {
+					t.Fatalf("range %d+%d: %s", r[0], r[1], err)
+				}
+
+				tampered := append([]byte{}, data...)
+				tampered[len(tampered)/2] ^= 0x01
+				if VerifyRange(commP, tampered, proof) == nil {
+					t.Fatalf("range %d+%d: tampered data passed verification", r[0], r[1])
+				}
+			}
+		})
+	}
+}
+
+func TestProveRangeBounds(t *testing.T) {
+	t.Parallel()
+
+	tc := new(TreeCache)
+	if _, err := tc.ProveRange(bytes.NewReader(nil), 0, 1); err == nil {
+		t.Fatal("unexpected proof from an empty tree cache")
+	}
+
+	cp := New(WithTreeLayers(2, tc.Add))
+	if _, err := cp.Write(make([]byte, 200)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.ProveRange(bytes.NewReader(nil), 200, 100); err == nil {
+		t.Fatal("unexpected proof of a range past the unpadded piece size")
+	}
+	if _, err := tc.ProveRange(bytes.NewReader(nil), 10, 0); err == nil {
+		t.Fatal("unexpected proof of an empty range")
+	}
+
+	// a crafted proof whose range wraps around
+	crafted := &RangeProof{
+		PaddedPieceSize: 128,
+		Offset:          ^uint64(0) - 10,
+		Length:          20,
+		Head:            make([]byte, 118),
+		Tail:            make([]byte, 118),
+	}
+	if err := VerifyRange(make([]byte, 32), make([]byte, 20), crafted); err == nil {
+		t.Fatal("unexpected verification of a range overflowing the offset")
+	}
+}
@@ -0,0 +1,197 @@
+package commp
+
+import (
+	"sync"
+	"time"
+)
+
+// maxSendBatch is the amount of entries a worker accumulates at most before
+// sending them on to the next layer, in a single channel operation.
+const maxSendBatch = 32
+
+// nodeBatch carries consecutive entries of a layer queue: blocks, nodes or
+// zero runs.
+type nodeBatch struct {
+	nodes [][]byte
+}
+
+var nodeBatchPool = sync.Pool{New: func() interface{} {
+	return &nodeBatch{nodes: make([][]byte, 0, maxSendBatch)}
+}}
+
+// releaseBatch returns a batch to the pool once all of its entries have been
+// processed.
+func releaseBatch(b *nodeBatch) {
+	for i := range b.nodes {
+		b.nodes[i] = nil
+	}
+	b.nodes = b.nodes[:0]
+	nodeBatchPool.Put(b)
+}
+
+// queue returns the queue feeding the worker of the given layer, holding about
+// as many entries as queueDepth() calls for, in batches.
+func (cp *Calc) queue(layer uint) *layerQueue {
+	if cp.queues[layer] == nil {
+		depth := cp.cfg.queueDepth(layer)/maxSendBatch + 1
+		q := &layerQueue{pool: cp.cfg.pool}
+		switch {
+		case q.pool == nil:
+			q.ch = make(chan *nodeBatch, depth)
+		case layer == 0:
+			q.slots = make(chan struct{}, depth)
+		}
+		cp.queues[layer] = q
+	}
+	return cp.queues[layer]
+}
+
+// layerQueue feeds the worker of a layer. By default the worker is a goroutine
+// of its own, receiving from ch. With WithPool() it is a task of the pool
+// instead, scheduled whenever batches are queued and not kept around waiting
+// for further ones: no goroutine is tied to a layer. A single task per queue
+// runs at a time, which keeps the batches in order. The workers never wait on
+// one another then, only the writer waits for room on layer 0.
+type layerQueue struct {
+	ch chan *nodeBatch
+
+	pool    *Pool
+	slots   chan struct{} // of layer 0 with a pool, bounding what the writer queues
+	mu      sync.Mutex
+	batches []*nodeBatch
+	head    int // of batches
+	running bool
+	handle  func(*nodeBatch) bool
+	idle    func()
+}
+
+// start runs the worker of the piece on the queue: handle is passed every
+// batch until it returns true, at the end of the piece, and idle is called
+// whenever nothing further is queued for the time being.
+func (q *layerQueue) start(handle func(*nodeBatch) bool, idle func()) {
+	if q.pool == nil {
+		go func() {
+			for !handle(<-q.ch) {
+				if len(q.ch) == 0 {
+					idle()
+				}
+			}
+		}()
+		return
+	}
+
+	// a task of the previous piece may be finishing up, see run()
+	q.mu.Lock()
+	q.handle, q.idle = handle, idle
+	q.mu.Unlock()
+}
+
+// send queues a batch, or nil at the end of the piece.
+func (q *layerQueue) send(b *nodeBatch) {
+	if q.pool == nil {
+		q.ch <- b
+		return
+	}
+	if q.slots != nil {
+		q.slots <- struct{}{}
+	}
+	q.push(b)
+}
+
+// sendTimeout is send(), giving up once timeout fires.
+func (q *layerQueue) sendTimeout(b *nodeBatch, timeout <-chan time.Time) bool {
+	if q.pool == nil {
+		select {
+		case q.ch <- b:
+			return true
+		case <-timeout:
+			return false
+		}
+	}
+	if q.slots != nil {
+		select {
+		case q.slots <- struct{}{}:
+		case <-timeout:
+			return false
+		}
+	}
+	q.push(b)
+	return true
+}
+
+func (q *layerQueue) push(b *nodeBatch) {
+	q.mu.Lock()
+	q.batches = append(q.batches, b)
+	if !q.running {
+		q.running = true
+		q.pool.submit(q.run)
+	}
+	q.mu.Unlock()
+}
+
+// len returns the amount of batches queued.
+func (q *layerQueue) len() int {
+	if q.pool == nil {
+		return len(q.ch)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.batches) - q.head
+}
+
+// run is the task draining the queue within the pool. It carries on with the
+// next piece should its batches arrive before the task is done.
+func (q *layerQueue) run() {
+	q.mu.Lock()
+	for q.head < len(q.batches) {
+		b := q.batches[q.head]
+		q.batches[q.head] = nil
+		q.head++
+		if q.head == len(q.batches) {
+			q.batches, q.head = q.batches[:0], 0
+		}
+		handle, idle := q.handle, q.idle
+		q.mu.Unlock()
+
+		if q.slots != nil {
+			<-q.slots
+		}
+		done := handle(b)
+
+		q.mu.Lock()
+		if !done && len(q.batches) == 0 {
+			q.mu.Unlock()
+			idle()
+			q.mu.Lock()
+		}
+	}
+	q.running = false
+	q.mu.Unlock()
+}
+
+// outbox accumulates the entries a worker (or the writer) sends to the next
+// layer. A full batch is sent right away, anything less once the sender has
+// nothing further to add for the time being: batches never wait to fill up.
+type outbox struct {
+	b     *nodeBatch
+	stage *uint32 // of the sending worker, see setStage()
+}
+
+func (ob *outbox) add(q *layerQueue, entry []byte) {
+	if ob.b == nil {
+		ob.b = nodeBatchPool.Get().(*nodeBatch)
+	}
+	ob.b.nodes = append(ob.b.nodes, entry)
+	if len(ob.b.nodes) == maxSendBatch {
+		ob.flush(q)
+	}
+}
+
+func (ob *outbox) flush(q *layerQueue) {
+	if ob.b != nil {
+		setStage(ob.stage, stageSending)
+		q.send(ob.b)
+		setStage(ob.stage, stageProcessing)
+		ob.b = nil
+	}
+}
@@ -0,0 +1,110 @@
+package commp
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// scratchBlockSize is the size of a single fr32-expanded block, which is
+// subsequently reused to hold the nodes derived from it.
+const scratchBlockSize = 128
+
+// maxScratchBlocks caps the amount of buffers retained by a Scratch. It is
+// well above the amount of blocks concurrently in flight within a Calc.
+const maxScratchBlocks = 1 << 15
+
+// Scratch is a reusable arena of the 128-byte buffers holding the
+// fr32-expansion of every 127-byte block written to a Calc. Buffers are
+// returned to the arena as soon as the tree no longer references them, so a
+// Calc configured with a Scratch does not allocate per block, and a Scratch
+// reused across many pieces eliminates what is otherwise the dominant
+// allocation of the package. The zero value is ready for use, and a Scratch
+// can be shared by multiple Calc objects, including concurrently.
+type Scratch struct {
+	mu   sync.Mutex
+	free [][]byte
+}
+
+// WithScratch instructs the Calc to take its expansion buffers from the
+// supplied Scratch.
+func WithScratch(s *Scratch) Option {
+	return func(c *config) {
+		c.scratch = s
+	}
+}
+
+// NewScratch returns a Scratch holding the given amount of buffers upfront,
+// carved out of a single allocation.
+func NewScratch(blocks int) *Scratch {
+	slab := make([]byte, blocks*scratchBlockSize)
+	s := &Scratch{free: make([][]byte, blocks)}
+	for i := range s.free {
+		s.free[i] = slab[i*scratchBlockSize : (i+1)*scratchBlockSize : (i+1)*scratchBlockSize]
+	}
+	return s
+}
+
+// WithArena gives every Calc constructed with it a Scratch of its own, sized
+// for the pipeline of a piece of the given padded size and preallocated in
+// one go, so that the memory footprint of the Calc is fixed upfront and stays
+// the same across pieces: the buffers of a piece return to the arena by the
+// time Digest() or Reset() returns. It implies WithExpectedPieceSize().
+func WithArena(expectedPaddedPieceSize uint64) Option {
+	return func(c *config) {
+		WithExpectedPieceSize(expectedPaddedPieceSize)(c)
+		c.scratch = NewScratch(c.arenaBlocks())
+	}
+}
+
+// arenaBlocks returns the amount of buffers a piece of the expected size keeps
+// in flight at most: the blocks or nodes filling every queue, plus those held
+// by the workers in between, in the batch received and the one to be sent.
+func (c *config) arenaBlocks() int {
+	height := uint(bits.TrailingZeros64(c.expectedSize)) - 5
+	perWorker := 4 + 2*maxSendBatch
+	if c.batchHasher != nil {
+		perWorker += 2 * c.maxBatchPairs
+	}
+	var blocks int
+	for l := uint(0); l <= height; l++ {
+		blocks += c.queueDepth(l) + perWorker
+	}
+	if max := int(c.expectedSize / 128); blocks > max {
+		blocks = max
+	}
+	return blocks
+}
+
+func (s *Scratch) get() []byte {
+	s.mu.Lock()
+	if n := len(s.free); n > 0 {
+		b := s.free[n-1]
+		s.free = s.free[:n-1]
+		s.mu.Unlock()
+		return b
+	}
+	s.mu.Unlock()
+	return make([]byte, scratchBlockSize)
+}
+
+// discard returns the buffers of blocks or nodes of the binary tree, which are
+// no longer going to be hashed, to any Scratch. Zero runs are skipped.
+func (cp *Calc) discard(nodes [][]byte) {
+	if cp.cfg.scratch == nil || cp.cfg.treeHasher != nil {
+		return
+	}
+	for _, n := range nodes {
+		if zeroRunNodes(n) == 0 {
+			cp.cfg.scratch.put(n)
+		}
+	}
+}
+
+// put returns a buffer to the arena, given the node stored at its start.
+func (s *Scratch) put(node []byte) {
+	s.mu.Lock()
+	if len(s.free) < maxScratchBlocks {
+		s.free = append(s.free, node[:scratchBlockSize])
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,90 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestScratch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	payload := make([]byte, 127<<12+3)
+	rnd.Read(payload)
+
+	s := new(Scratch)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			cp := New(WithScratch(s))
+			for _, size := range []int{65, 127, 128, 127 * 4, 127*4 + 1, 127 << 8, 127<<12 + w} {
+				expCommP, expSize, _ := Sum(payload[:size])
+
+				cp.Write(payload[:size])
+				commP, paddedSize, err := cp.Digest()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+					t.Errorf("scratch-backed calc over %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// the expansion buffers are no longer allocated per block
+	payload = payload[:127<<10]
+	allocs := func(cp *Calc) float64 {
+		return testing.AllocsPerRun(5, func() {
+			cp.Write(payload)
+			if _, _, err := cp.Digest(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	without, with := allocs(new(Calc)), allocs(New(WithScratch(new(Scratch))))
+	if with > without-1000 {
+		t.Fatalf("expected at least 1000 fewer allocations per piece with a scratch, got %.0f vs %.0f", with, without)
+	}
+}
+
+func TestArena(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xA5}, 127<<10)
+	expCommP, expSize, err := Sum(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp := New(WithArena(128 << 10))
+	blocks := len(cp.cfg.scratch.free)
+	if blocks == 0 || blocks > 1<<10 {
+		t.Fatalf("unexpected arena of %d blocks for a piece of 1024", blocks)
+	}
+
+	for i := 0; i < 3; i++ {
+		cp.Write(payload)
+		if i == 1 {
+			cp.Reset()
+			continue
+		}
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("produced 0x%X / %d, expected 0x%X / %d", commP, paddedSize, expCommP, expSize)
+		}
+	}
+
+	// every buffer made it back, and none were allocated on top
+	cp.cfg.scratch.mu.Lock()
+	defer cp.cfg.scratch.mu.Unlock()
+	if len(cp.cfg.scratch.free) != blocks {
+		t.Fatalf("arena of %d blocks holds %d after 3 pieces", blocks, len(cp.cfg.scratch.free))
+	}
+}
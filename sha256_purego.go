@@ -0,0 +1,11 @@
+//go:build purego
+// +build purego
+
+package commp
+
+// hashNode appends the truncated SHA-256 of the concatenation of two 32-byte
+// nodes to dst, via the compression function specialized for 64-byte
+// messages, which is slightly faster than crypto/sha256 without assembly.
+func hashNode(dst, left, right []byte) []byte {
+	return sha254Node(dst, left, right)
+}
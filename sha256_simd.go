@@ -0,0 +1,19 @@
+//go:build !purego
+// +build !purego
+
+package commp
+
+import sha256simd "github.com/minio/sha256-simd"
+
+// hashNode appends the truncated SHA-256 of the concatenation of two 32-byte
+// nodes to dst, hashing a copy on the stack in a single call, which avoids
+// the pooling and buffering of a hash.Hash. The assembly of sha256-simd beats
+// sha254Node several times over, precomputed padding block or not.
+func hashNode(dst, left, right []byte) []byte {
+	var msg [64]byte
+	copy(msg[:32], left)
+	copy(msg[32:], right)
+	d := sha256simd.Sum256(msg[:])
+	d[31] &= 0x3F
+	return append(dst, d[:]...)
+}
@@ -0,0 +1,73 @@
+package commp
+
+import (
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// PaddedPieceSize is the size of a piece after fr32 expansion: always a power
+// of two between 128 bytes and 64GiB for valid pieces. This is the size
+// returned by Digest(), and is what Filecoin refers to as "piece size".
+type PaddedPieceSize uint64
+
+// UnpaddedPieceSize is the amount of payload a piece can hold before fr32
+// expansion: always 127/128 of the corresponding PaddedPieceSize.
+type UnpaddedPieceSize uint64
+
+// Unpadded returns the payload capacity of a piece of this padded size.
+func (s PaddedPieceSize) Unpadded() UnpaddedPieceSize {
+	return UnpaddedPieceSize(s / 128 * 127)
+}
+
+// Validate checks that the size is a power of two within the range of piece
+// sizes supported by Filecoin.
+func (s PaddedPieceSize) Validate() error {
+	if bits.OnesCount64(uint64(s)) != 1 {
+		return xerrors.Errorf("padded piece size %d is not a power of 2", s)
+	}
+	if s < 128 {
+		return xerrors.Errorf("padded piece size %d smaller than the minimum of 128 bytes", s)
+	}
+	if uint64(s) > maxPaddedPieceSize {
+		return xerrors.Errorf("padded piece size %d larger than Filecoin maximum of %d bytes", s, maxPaddedPieceSize)
+	}
+	return nil
+}
+
+// NextPowerOfTwo returns the smallest valid padded piece size which is not
+// smaller than s.
+func (s PaddedPieceSize) NextPowerOfTwo() PaddedPieceSize {
+	if s <= 128 {
+		return 128
+	}
+	if bits.OnesCount64(uint64(s)) == 1 {
+		return s
+	}
+	return 1 << uint(64-bits.LeadingZeros64(uint64(s)))
+}
+
+// Padded returns the padded size of a piece with this payload capacity.
+func (s UnpaddedPieceSize) Padded() PaddedPieceSize {
+	return PaddedPieceSize(s / 127 * 128)
+}
+
+// Validate checks that the size is the payload capacity of a piece of a valid
+// padded size, i.e. that it is 127 times a power of two within range.
+func (s UnpaddedPieceSize) Validate() error {
+	if s%127 != 0 {
+		return xerrors.Errorf("unpadded piece size %d is not a multiple of 127", s)
+	}
+	if err := s.Padded().Validate(); err != nil {
+		return xerrors.Errorf("unpadded piece size %d does not correspond to a valid padded size: %w", s, err)
+	}
+	return nil
+}
+
+// NextPowerOfTwo returns the smallest valid unpadded piece size which is not
+// smaller than s. This is the capacity of the piece resulting from Digest()ing
+// s bytes of payload.
+func (s UnpaddedPieceSize) NextPowerOfTwo() UnpaddedPieceSize {
+	// round up to whole blocks, why is 6 afraid of 7...?
+	return PaddedPieceSize((s + 126) / 127 * 128).NextPowerOfTwo().Unpadded()
+}
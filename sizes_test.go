@@ -0,0 +1,49 @@
+package commp
+
+import "testing"
+
+func TestPieceSizes(t *testing.T) {
+	t.Parallel()
+
+	for payload, expPadded := range map[UnpaddedPieceSize]PaddedPieceSize{
+		0:       128,
+		1:       128,
+		127:     128,
+		128:     256,
+		254:     256,
+		255:     512,
+		1000:    1024,
+		8128:    8192,
+		8129:    16384,
+		1 << 20: 2 << 20,
+	} {
+		next := payload.NextPowerOfTwo()
+		if err := next.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if next.Padded() != expPadded || expPadded.Unpadded() != next {
+			t.Fatalf("payload of %d bytes resulted in piece of %d/%d bytes, expected padded %d", payload, next, next.Padded(), expPadded)
+		}
+		if next < payload {
+			t.Fatalf("unpadded size %d rounded down to %d", payload, next)
+		}
+		if uint64(expPadded) != paddedSizeFor(uint64(payload)) {
+			t.Fatalf("internal padded size of %d-byte payload differs from %d", payload, expPadded)
+		}
+	}
+
+	for _, s := range []PaddedPieceSize{0, 64, 129, 3 << 10, 1 << (MaxLayers + 6)} {
+		if s.Validate() == nil {
+			t.Fatalf("unexpected successful validation of padded size %d", s)
+		}
+	}
+	for _, s := range []UnpaddedPieceSize{0, 126, 128, 127 * 3, 127 << (MaxLayers + 1)} {
+		if s.Validate() == nil {
+			t.Fatalf("unexpected successful validation of unpadded size %d", s)
+		}
+	}
+
+	if PaddedPieceSize(3000).NextPowerOfTwo() != 4096 || PaddedPieceSize(4096).NextPowerOfTwo() != 4096 {
+		t.Fatal("unexpected padded power-of-two rounding")
+	}
+}
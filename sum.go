@@ -0,0 +1,86 @@
+package commp
+
+import (
+	"math/bits"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+)
+
+// Sum computes the raw commP and padded piece size of data in a single call.
+// Unlike Calc it does not start any goroutines and does all hashing on the
+// calling goroutine, keeping only a single node per tree level in memory.
+// This makes it the fastest option for small pieces, where the setup of the
+// Calc pipeline dominates, and for callers hashing many pieces in parallel
+// anyway. The result is identical to that of Write()ing data to a Calc and
+// calling Digest().
+func Sum(data []byte) (commP [32]byte, paddedPieceSize uint64, err error) {
+	if uint64(len(data)) < MinPiecePayload {
+		return commP, 0, &PayloadSizeError{
+			Err:      ErrPayloadTooSmall,
+			Limit:    MinPiecePayload,
+			Size:     uint64(len(data)),
+			Accepted: uint64(len(data)),
+		}
+	}
+	if uint64(len(data)) > MaxPiecePayload {
+		return commP, 0, &PayloadSizeError{
+			Err:   ErrPayloadTooLarge,
+			Limit: MaxPiecePayload,
+			Size:  uint64(len(data)),
+		}
+	}
+
+	paddedPieceSize = paddedSizeFor(uint64(len(data)))
+	height := bits.TrailingZeros64(paddedPieceSize) - 5
+
+	// a binary counter of complete subtrees, one slot per level
+	var stack [MaxLayers + 1][32]byte
+	var present [MaxLayers + 1]bool
+
+	var block [127]byte
+	var expanded [128]byte
+	var node [32]byte
+	for off := 0; off < len(data); off += 127 {
+		in := data[off:]
+		if len(in) < 127 {
+			// last partial block: zero-fill
+			copy(block[:], in)
+			in = block[:]
+		}
+
+		fr32.Pad(in[:127], expanded[:])
+		hashNode(expanded[0:0], expanded[0:32], expanded[32:64])
+		hashNode(expanded[32:32], expanded[64:96], expanded[96:128])
+		hashNode(node[:0], expanded[0:32], expanded[32:64])
+
+		level := 2
+		for present[level] {
+			hashNode(node[:0], stack[level][:], node[:])
+			present[level] = false
+			level++
+		}
+		stack[level] = node
+		present[level] = true
+	}
+
+	// fold in the nul padding from the right, bottom-up
+	var acc [32]byte
+	var haveAcc bool
+	for level := 2; level < height; level++ {
+		switch {
+		case present[level] && haveAcc:
+			hashNode(acc[:0], stack[level][:], acc[:])
+		case present[level]:
+			hashNode(acc[:0], stack[level][:], nulPadding(uint(level)))
+			haveAcc = true
+		case haveAcc:
+			hashNode(acc[:0], acc[:], nulPadding(uint(level)))
+		}
+	}
+
+	if !haveAcc {
+		// the payload filled an exact power of two of blocks
+		return stack[height], paddedPieceSize, nil
+	}
+	return acc, paddedPieceSize, nil
+}
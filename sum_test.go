@@ -0,0 +1,60 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestSum(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	payload := make([]byte, 127<<12+1)
+	rnd.Read(payload)
+
+	for _, size := range []int{65, 126, 127, 128, 254, 255, 127 * 3, 127*4 - 1, 127 * 4, 127*4 + 1, 127 << 8, 127<<12 + 1} {
+		cp := new(Calc)
+		cp.Write(payload[:size])
+		expCommP, expSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commP, paddedSize, err := Sum(payload[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP[:], expCommP) || paddedSize != expSize {
+			t.Fatalf("Sum() of %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+		}
+	}
+
+	if _, _, err := Sum(payload[:64]); !xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("unexpected error for a short payload: %v", err)
+	}
+}
+
+func BenchmarkSumSmall(b *testing.B) {
+	payload := bytes.Repeat([]byte{0xCC}, 2032)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Sum(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCalcSmall(b *testing.B) {
+	payload := bytes.Repeat([]byte{0xCC}, 2032)
+	cp := new(Calc)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cp.Write(payload)
+		if _, _, err := cp.Digest(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package testvectors provides a canonical set of commP test vectors, together
+// with the deterministic generator used to produce them. The vectors focus on
+// boundary conditions: the minimum payload, sizes around every multiple of the
+// 127-byte fr32 block and around every power-of-two piece boundary, and
+// sequences of Write()s which split the payload across block boundaries.
+//
+// The vectors are available in language-neutral form in vectors.json, next to
+// this file. Every vector describes its payload by a pattern name and a size:
+//
+//	zero        - all bytes are 0x00
+//	0xCC        - all bytes are 0xCC
+//	random-1337 - the output of github.com/jbenet/go-random with seed 1337
+//	              (little-endian uint32s of math/rand, restarted every 4MiB)
+//
+// A non-zero write_size indicates the payload is to be fed to the hasher in
+// chunks of that many bytes, the final chunk being shorter as needed. The
+// result must not depend on it: such vectors exist to exercise the internal
+// carry handling of implementations.
+//
+// Vectors overlapping the Lotus-generated cases in the testdata directory of
+// the parent package are cross-checked against them by the tests.
+package testvectors
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"io"
+	"math/rand"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"golang.org/x/xerrors"
+)
+
+// Vector is a single test vector.
+type Vector struct {
+	Pattern         string `json:"pattern"`
+	PayloadSize     uint64 `json:"payload_size"`
+	WriteSize       uint64 `json:"write_size,omitempty"`
+	PaddedPieceSize uint64 `json:"padded_piece_size"`
+	CommP           string `json:"commp"`     // hex-encoded raw 32-byte commP
+	PieceCID        string `json:"piece_cid"` // base32 CIDv1 fil-commitment-unsealed
+}
+
+// Patterns lists the supported payload pattern names.
+var Patterns = []string{"zero", "0xCC", "random-1337"}
+
+// Payload returns a reader producing size bytes of the named pattern.
+func Payload(pattern string, size uint64) (io.Reader, error) {
+	switch pattern {
+	case "zero":
+		return io.LimitReader(repeatedReader(0x00), int64(size)), nil
+	case "0xCC":
+		return io.LimitReader(repeatedReader(0xCC), int64(size)), nil
+	case "random-1337":
+		return io.LimitReader(&goRandomReader{rnd: rand.New(rand.NewSource(1337))}, int64(size)), nil
+	default:
+		return nil, xerrors.Errorf("unknown payload pattern '%s'", pattern)
+	}
+}
+
+// PayloadSizes returns the payload sizes covered by the canonical vectors.
+func PayloadSizes() []uint64 {
+	sizes := []uint64{commp.MinPiecePayload, 96, 192}
+	seen := map[uint64]bool{}
+	for _, s := range sizes {
+		seen[s] = true
+	}
+	add := func(s uint64) {
+		if s >= commp.MinPiecePayload && !seen[s] {
+			seen[s] = true
+			sizes = append(sizes, s)
+		}
+	}
+	for k := uint(0); k <= 13; k++ {
+		block := uint64(127) << k
+		add(block - 1)
+		add(block)
+		add(block + 1)
+		add(uint64(128) << k)
+	}
+	return sizes
+}
+
+// WriteSizes returns the chunkings applied to a subset of the vectors, chosen
+// to straddle the 127-byte fr32 block in different ways.
+func WriteSizes() []uint64 {
+	return []uint64{1, 31, 100, 126, 128, 254, 4096}
+}
+
+// Generate computes the canonical vectors. The output is fully deterministic.
+func Generate() ([]Vector, error) {
+	var vs []Vector
+	for _, pattern := range Patterns {
+		for _, size := range PayloadSizes() {
+			v, err := Compute(pattern, size, 0)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+	}
+
+	// carry-spanning writes over a handful of sizes, random payload only
+	for _, size := range []uint64{commp.MinPiecePayload, 127*3 + 1, 127*64 - 1, 127 * 1024} {
+		for _, ws := range WriteSizes() {
+			v, err := Compute("random-1337", size, ws)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+	}
+
+	return vs, nil
+}
+
+// Compute derives a single vector, writing the payload in chunks of writeSize
+// bytes, or in one go if writeSize is 0.
+func Compute(pattern string, payloadSize, writeSize uint64) (Vector, error) {
+	r, err := Payload(pattern, payloadSize)
+	if err != nil {
+		return Vector{}, err
+	}
+	payload := make([]byte, payloadSize)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Vector{}, err
+	}
+
+	cp := new(commp.Calc)
+	for p := payload; len(p) > 0; {
+		n := uint64(len(p))
+		if writeSize > 0 && n > writeSize {
+			n = writeSize
+		}
+		if _, err := cp.Write(p[:n]); err != nil {
+			cp.Reset()
+			return Vector{}, err
+		}
+		p = p[n:]
+	}
+	rawCommP, paddedSize, err := cp.Digest()
+	if err != nil {
+		return Vector{}, err
+	}
+
+	return Vector{
+		Pattern:         pattern,
+		PayloadSize:     payloadSize,
+		WriteSize:       writeSize,
+		PaddedPieceSize: paddedSize,
+		CommP:           hex.EncodeToString(rawCommP),
+		PieceCID:        PieceCID(rawCommP),
+	}, nil
+}
+
+var b32enc = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// PieceCID renders a raw commP as a base32 CIDv1 with the fil-commitment-unsealed
+// codec and the sha2-256-trunc254-padded multihash, without depending on
+// go-cid.
+func PieceCID(rawCommP []byte) string {
+	// version 1, codec 0xf101, multihash 0x1012, digest length 32
+	prefix := []byte{0x01, 0x81, 0xE2, 0x03, 0x92, 0x20, 0x20}
+	return "b" + b32enc.EncodeToString(append(prefix, rawCommP...))
+}
+
+type repeatedReader byte
+
+func (rr repeatedReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(rr)
+	}
+	return len(p), nil
+}
+
+// goRandomReader reproduces the output of github.com/jbenet/go-random, which
+// fills 4MiB buffers from consecutive math/rand uint32s, discarding the unused
+// bytes of the last uint32 in a buffer.
+type goRandomReader struct {
+	rnd *rand.Rand
+	buf []byte
+}
+
+const goRandomBufSize = 4 << 20
+
+func (gr *goRandomReader) Read(p []byte) (int, error) {
+	if len(gr.buf) == 0 {
+		gr.buf = make([]byte, goRandomBufSize)
+		for i := 0; i < goRandomBufSize; {
+			n := gr.rnd.Uint32()
+			for j := 0; j < 4 && i < goRandomBufSize; j++ {
+				gr.buf[i] = byte(n)
+				n >>= 8
+				i++
+			}
+		}
+	}
+	n := copy(p, gr.buf)
+	gr.buf = gr.buf[n:]
+	return n, nil
+}
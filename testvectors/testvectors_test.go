@@ -0,0 +1,79 @@
+package testvectors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate vectors.json")
+
+func TestVectors(t *testing.T) {
+	vs, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := json.MarshalIndent(vs, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	js = append(js, '\n')
+
+	if *update {
+		if err := ioutil.WriteFile("vectors.json", js, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := ioutil.ReadFile("vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(js, stored) {
+		t.Fatal("generated vectors differ from vectors.json: run `go test -update` if this is intentional")
+	}
+
+	// all chunkings of the same payload agree
+	byPayload := map[string]Vector{}
+	for _, v := range vs {
+		key := v.Pattern + "/" + strconv.FormatUint(v.PayloadSize, 10)
+		if prev, found := byPayload[key]; found && (prev.CommP != v.CommP || prev.PaddedPieceSize != v.PaddedPieceSize) {
+			t.Fatalf("write size %d over %s produced a different result", v.WriteSize, key)
+		}
+		byPayload[key] = v
+	}
+
+	// cross-check with the Lotus-generated vectors
+	var checked int
+	for pattern, file := range map[string]string{
+		"random-1337": "../testdata/random.txt",
+		"zero":        "../testdata/zero.txt",
+		"0xCC":        "../testdata/0xCC.txt",
+	} {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			parts := strings.Split(sc.Text(), ",")
+			if v, found := byPayload[pattern+"/"+parts[0]]; found {
+				if strconv.FormatUint(v.PaddedPieceSize, 10) != parts[1] || v.PieceCID != parts[2] {
+					t.Fatalf("vector %s/%d does not match %s", pattern, v.PayloadSize, file)
+				}
+				checked++
+			}
+		}
+		f.Close()
+	}
+	if checked < 30 {
+		t.Fatalf("only %d vectors were cross-checked", checked)
+	}
+}
@@ -0,0 +1,41 @@
+package commp
+
+import "golang.org/x/xerrors"
+
+// Tracer creates the spans of a Calc configured via WithTracer, allowing the
+// hashing stage of a pipeline to be instrumented with e.g. OpenTelemetry
+// without this package depending on it.
+type Tracer interface {
+	// StartPiece starts the span covering a single piece, from its first
+	// Write() until Digest() or Reset(), with attribute "bytes" once digested.
+	// All other spans of the piece are its children.
+	StartPiece() Span
+}
+
+// Span is a single traced operation. A Span must be safe for concurrent use:
+// the layer workers start their children concurrently with Write().
+type Span interface {
+	// StartChild starts a span nested within this one.
+	StartChild(name string) Span
+	// SetAttribute annotates the span.
+	SetAttribute(key string, value int64)
+	// End completes the span, marking it as failed if err is not nil.
+	End(err error)
+}
+
+// The spans created within a piece span.
+const (
+	SpanWrite  = "commp.Write"  // a single Write(), with attribute "bytes"
+	SpanLayer  = "commp.layer"  // the lifetime of a layer worker, with attributes "layer" and "nodes" (blocks for layer 0)
+	SpanDigest = "commp.Digest" // the collapse of the tree by Digest()
+)
+
+// errPieceReset ends the span of a piece abandoned by Reset().
+var errPieceReset = xerrors.New("piece abandoned by Reset()")
+
+// WithTracer traces the activity of the Calc via t.
+func WithTracer(t Tracer) Option {
+	return func(c *config) {
+		c.tracer = t
+	}
+}
@@ -0,0 +1,89 @@
+package commp
+
+import (
+	"sync"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]int64
+	err   error
+	ended int
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+	order []string // span names in the order they ended
+}
+
+type recordingSpan struct {
+	t *recordingTracer
+	s *recordedSpan
+}
+
+func (t *recordingTracer) start(name string) Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &recordedSpan{name: name, attrs: make(map[string]int64)}
+	t.spans = append(t.spans, s)
+	return &recordingSpan{t, s}
+}
+
+func (t *recordingTracer) StartPiece() Span { return t.start("piece") }
+
+func (s *recordingSpan) StartChild(name string) Span { return s.t.start(name) }
+
+func (s *recordingSpan) SetAttribute(key string, value int64) {
+	s.t.mu.Lock()
+	s.s.attrs[key] = value
+	s.t.mu.Unlock()
+}
+
+func (s *recordingSpan) End(err error) {
+	s.t.mu.Lock()
+	s.s.err = err
+	s.s.ended++
+	s.t.order = append(s.t.order, s.s.name)
+	s.t.mu.Unlock()
+}
+
+func TestTracer(t *testing.T) {
+	tr := new(recordingTracer)
+	cp := New(WithTracer(tr))
+
+	cp.Write(make([]byte, 127<<10))
+	cp.Write(make([]byte, 100))
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, s := range tr.spans {
+		counts[s.name]++
+		if s.ended != 1 || s.err != nil {
+			t.Fatalf("span %s ended %d times with error %v", s.name, s.ended, s.err)
+		}
+	}
+	// the 1025 blocks are folded into level 2 nodes, with the root at level 13
+	if counts["piece"] != 1 || counts[SpanWrite] != 2 || counts[SpanDigest] != 1 || counts[SpanLayer] != 1+12 {
+		t.Fatalf("unexpected spans %v", counts)
+	}
+	if tr.spans[0].attrs["bytes"] != 127<<10+100 {
+		t.Fatalf("piece span has attributes %v", tr.spans[0].attrs)
+	}
+	if last := tr.order[len(tr.order)-1]; last != "piece" {
+		t.Fatalf("span %s ended after the piece", last)
+	}
+
+	tr = new(recordingTracer)
+	cp = New(WithTracer(tr))
+	cp.Write(make([]byte, 1000))
+	cp.Reset()
+	if s := tr.spans[0]; s.ended != 1 || !xerrors.Is(s.err, errPieceReset) {
+		t.Fatalf("abandoned piece span ended %d times with error %v", s.ended, s.err)
+	}
+}
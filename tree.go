@@ -0,0 +1,70 @@
+package commp
+
+import (
+	"fmt"
+)
+
+// TreeHasher is an EXPERIMENTAL, NON-CONSENSUS extension point, allowing the
+// streaming pipeline of Calc to build trees with a different node hash
+// function and/or arity, e.g. Poseidon over BLS12-381 field elements. The
+// leaves remain the 32-byte fr32-expanded chunks of the payload.
+//
+// HashChildren computes the parent of exactly Arity() children, appending it
+// to dst. The dst slice may share its backing array with the first child:
+// implementations must consume all children before writing to dst. The
+// returned node must be 32 bytes long. Like NodeHasher, a TreeHasher is used
+// concurrently by all layer workers of a Calc, and must be safe for concurrent
+// use.
+type TreeHasher interface {
+	Arity() int
+	HashChildren(dst []byte, children [][]byte) []byte
+}
+
+// WithExperimentalTree instructs the Calc to build its tree using the supplied
+// TreeHasher. The results are NOT a Filecoin commP and are not recognized by
+// any part of the network: this option exists solely to let research into
+// future proof systems reuse the streaming machinery of this package.
+//
+// Every layer is zero-padded to a multiple of the arity, so the size returned
+// by Digest() is 32 * Arity()^height rather than a power of two. Options
+// relying on the binary commP tree (WithNodeHasher, WithBatchHasher) are
+// ignored, while tree node sinks observe the nodes of the experimental tree.
+// The arity must be between 2 and 256, otherwise WithExperimentalTree panics.
+func WithExperimentalTree(th TreeHasher) Option {
+	arity := th.Arity()
+	if arity < 2 || arity > 256 {
+		panic(fmt.Sprintf("unsupported tree arity %d", arity))
+	}
+
+	// the nul padding stack specific to this tree shape
+	nul := make([][]byte, MaxLayers+1)
+	nul[0] = make([]byte, 32)
+	children := make([][]byte, arity)
+	for i := 1; i <= int(MaxLayers); i++ {
+		for j := range children {
+			children[j] = nul[i-1]
+		}
+		nul[i] = th.HashChildren(make([]byte, 0, 32), children)
+	}
+
+	return func(c *config) {
+		c.treeHasher = th
+		c.treeNulPadding = nul
+	}
+}
+
+// paddedSizeFor is the equivalent of the package-level paddedSizeFor, taking
+// the tree shape of the config into account.
+func (c *config) paddedSizeFor(payloadSize uint64) uint64 {
+	if c.treeHasher == nil {
+		return paddedSizeFor(payloadSize)
+	}
+
+	arity := uint64(c.treeHasher.Arity())
+	leaves := (payloadSize + 126) / 127 * 4
+	size := arity
+	for size < leaves {
+		size *= arity
+	}
+	return 32 * size
+}
@@ -0,0 +1,85 @@
+package commp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+)
+
+type sha254TreeHasher int
+
+func (th sha254TreeHasher) Arity() int { return int(th) }
+
+func (th sha254TreeHasher) HashChildren(dst []byte, children [][]byte) []byte {
+	h := sha256.New()
+	for _, c := range children {
+		h.Write(c)
+	}
+	d := h.Sum(dst)
+	d[len(d)-1] &= 0x3F
+	return d
+}
+
+// naive reimplementation: expand everything, zero-extend, reduce
+func refTreeRoot(th TreeHasher, payload []byte) ([]byte, uint64) {
+	blocks := (len(payload) + 126) / 127
+	unpadded := make([]byte, blocks*127)
+	copy(unpadded, payload)
+	padded := make([]byte, blocks*128)
+	fr32.Pad(unpadded, padded)
+
+	var layer [][]byte
+	for i := 0; i < len(padded); i += 32 {
+		layer = append(layer, padded[i:i+32])
+	}
+	size := th.Arity()
+	for size < len(layer) {
+		size *= th.Arity()
+	}
+	for len(layer) < size {
+		layer = append(layer, make([]byte, 32))
+	}
+
+	for len(layer) > 1 {
+		next := make([][]byte, 0, len(layer)/th.Arity())
+		for i := 0; i < len(layer); i += th.Arity() {
+			next = append(next, th.HashChildren(nil, layer[i:i+th.Arity()]))
+		}
+		layer = next
+	}
+	return layer[0], uint64(size) * 32
+}
+
+func TestExperimentalTree(t *testing.T) {
+	for _, arity := range []int{2, 3, 4, 8, 16} {
+		th := sha254TreeHasher(arity)
+		cp := New(WithExperimentalTree(th))
+
+		for _, size := range []int{65, 127, 128, 127 * 4, 127 * 5, 127*64 + 1, 200000} {
+			payload := bytes.Repeat([]byte{0xCC}, size)
+			payload[size/2] = 0x42
+
+			cp.Write(payload)
+			root, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expRoot, expSize := refTreeRoot(th, payload)
+			if !bytes.Equal(root, expRoot) || paddedSize != expSize {
+				t.Fatalf("arity %d tree over %d bytes produced 0x%X / %d, expected 0x%X / %d", arity, size, root, paddedSize, expRoot, expSize)
+			}
+
+			if arity == 2 {
+				ref := new(Calc)
+				ref.Write(payload)
+				commP, commPSize, _ := ref.Digest()
+				if !bytes.Equal(root, commP) || paddedSize != commPSize {
+					t.Fatalf("binary sha254 tree over %d bytes does not match commP", size)
+				}
+			}
+		}
+	}
+}
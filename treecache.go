@@ -0,0 +1,120 @@
+package commp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TreeNodeSink is a callback receiving tree nodes as they are produced by the
+// layer workers of a Calc. Level 0 are the 32-byte fr32-expanded leaves, level
+// 1 their pairwise digests, and so on up to the root, which is identical to the
+// commP returned from Digest(). The index is the position of the node within
+// its level, counting from the left edge of the tree.
+//
+// Calls for the same level arrive strictly in index order and never
+// concurrently, while calls for different levels may happen concurrently.
+// Levels 0 and 1 are produced together by the worker folding the 128-byte
+// blocks of the piece, or with WithInlineFolding() by the goroutine calling
+// Write(), before it returns. Every level above is serviced by its own worker:
+// a goroutine, or with WithPool() successive tasks of the pool, which may run
+// on different goroutines. The node slice is reused as soon as the callback
+// returns: copy it if you need to retain it.
+//
+// Only nodes derived from written data are emitted. Nodes covering the
+// zero-padded remainder of a piece are never materialized by the algorithm,
+// and are omitted as well.
+type TreeNodeSink func(level uint, index uint64, node []byte)
+
+// WithTreeLayers instructs the Calc to pass every node of every tree level at
+// or above minLevel to the supplied sink, allowing one to construct a tree
+// cache in the same pass used to derive the commP. A minLevel of 0 results in
+// every single leaf being emitted, which for a 64GiB piece is 2^31 calls.
+func WithTreeLayers(minLevel uint, sink TreeNodeSink) Option {
+	return func(c *config) {
+		c.nodeSinks = append(c.nodeSinks, nodeSink{
+			minLevel: minLevel,
+			maxLevel: MaxLayers,
+			fn:       sink,
+		})
+	}
+}
+
+// WithLevelObserver instructs the Calc to invoke the supplied callback with
+// every node of the given tree level, in index order, never concurrently.
+// Level 0 observes the fr32-expanded 32-byte leaves, level 2 the roots of the
+// individual 127-byte payload blocks, and so on. The node slice is reused as
+// soon as the callback returns: copy it if you need to retain it. Multiple
+// observers and WithTreeLayers() sinks can be combined on the same Calc.
+func WithLevelObserver(level uint, observer func(index uint64, node []byte)) Option {
+	return func(c *config) {
+		c.nodeSinks = append(c.nodeSinks, nodeSink{
+			minLevel: level,
+			maxLevel: level,
+			fn:       func(_ uint, index uint64, node []byte) { observer(index, node) },
+		})
+	}
+}
+
+// WithLeafObserver is a shorthand for WithLevelObserver(0, observer), giving
+// access to the fr32-expanded leaves without reimplementing the padding.
+func WithLeafObserver(observer func(index uint64, leaf []byte)) Option {
+	return WithLevelObserver(0, observer)
+}
+
+// TreeCache is an in-memory accumulator of tree nodes, suitable for use as a
+// sink via WithTreeLayers(minLevel, tc.Add). Retaining the upper levels of the
+// tree allows generating inclusion proofs without rehashing the entire
+// payload. The zero-value of this object is ready for use. A TreeCache holds
+// the tree of a single piece: use a fresh one for every Digest() cycle.
+type TreeCache struct {
+	mu     sync.Mutex
+	levels [MaxLayers + 1][]byte
+}
+
+// Add appends a node to the cache, and has the signature of a TreeNodeSink.
+// Nodes within a level must be added in index order.
+func (tc *TreeCache) Add(level uint, index uint64, node []byte) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if uint64(len(tc.levels[level])) != index*32 {
+		panic(fmt.Sprintf("out of order node %d added to tree cache level %d holding %d nodes", index, level, len(tc.levels[level])/32))
+	}
+	tc.levels[level] = append(tc.levels[level], node...)
+}
+
+// HasLevel returns whether the cache holds the nodes of the given level.
+func (tc *TreeCache) HasLevel(level uint) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return level <= MaxLayers && len(tc.levels[level]) > 0
+}
+
+// Height returns the level of the tree root, or -1 if the cache is empty.
+func (tc *TreeCache) Height() int {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for l := int(MaxLayers); l >= 0; l-- {
+		if len(tc.levels[l]) > 0 {
+			return l
+		}
+	}
+	return -1
+}
+
+// Node returns the node at the given position within a cached level. Positions
+// past the last data-derived node of a level return the corresponding
+// zero-subtree node. Returns nil if the level is not held by the cache. The
+// returned slice is a copy and can be freely retained or modified.
+func (tc *TreeCache) Node(level uint, index uint64) []byte {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if level > MaxLayers || len(tc.levels[level]) == 0 {
+		return nil
+	}
+	if index >= uint64(len(tc.levels[level])/32) {
+		return append(make([]byte, 0, 32), nulPadding(level)...)
+	}
+	return append(make([]byte, 0, 32), tc.levels[level][index*32:(index+1)*32]...)
+}
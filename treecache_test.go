@@ -0,0 +1,145 @@
+package commp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"sync"
+	"testing"
+
+	randmath "math/rand"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+)
+
+func TestTreeLayers(t *testing.T) {
+	t.Parallel()
+
+	for _, size := range []int64{65, 127, 128, 127 * 3, 127*8 + 1, 127*64 - 1, 20000} {
+		var mu sync.Mutex
+		levels := make(map[uint]map[uint64][]byte)
+
+		cp := New(WithTreeLayers(0, func(level uint, idx uint64, node []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			if levels[level] == nil {
+				levels[level] = make(map[uint64][]byte)
+			}
+			if _, seen := levels[level][idx]; seen {
+				t.Errorf("node %d at level %d emitted twice", idx, level)
+			}
+			levels[level][idx] = append([]byte{}, node...)
+		}))
+
+		if _, err := io.Copy(cp, io.LimitReader(randmath.New(randmath.NewSource(size)), size)); err != nil {
+			t.Fatal(err)
+		}
+		commP, paddedSize, err := cp.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if wantLeaves := uint64((size + 126) / 127 * 4); uint64(len(levels[0])) != wantLeaves {
+			t.Fatalf("size %d: expected %d leaves, got %d", size, wantLeaves, len(levels[0]))
+		}
+
+		top := uint(len(levels) - 1)
+		if 32<<top != paddedSize {
+			t.Fatalf("size %d: tree of height %d does not match padded size %d", size, top, paddedSize)
+		}
+		if len(levels[top]) != 1 || !bytes.Equal(levels[top][0], commP) {
+			t.Fatalf("size %d: root level does not contain the commP", size)
+		}
+
+		for l := uint(1); l <= top; l++ {
+			for idx, node := range levels[l] {
+				left, right := levels[l-1][2*idx], levels[l-1][2*idx+1]
+				if right == nil {
+					right = nulPadding(l - 1)
+				}
+				d := sha256.Sum256(append(append([]byte{}, left...), right...))
+				d[31] &= 0x3F
+				if !bytes.Equal(d[:], node) {
+					t.Fatalf("size %d: node %d at level %d does not match its children", size, idx, l)
+				}
+			}
+		}
+	}
+}
+
+func TestTreeLayersMinLevel(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var seen []uint
+	cp := New(WithTreeLayers(3, func(level uint, _ uint64, _ []byte) {
+		mu.Lock()
+		seen = append(seen, level)
+		mu.Unlock()
+	}))
+
+	if _, err := cp.Write(make([]byte, 127*16)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 64 leaves: 8 nodes at level 3, then 4, 2, 1
+	if len(seen) != 15 {
+		t.Fatalf("expected 15 nodes at levels 3 and above, got %d", len(seen))
+	}
+	for _, l := range seen {
+		if l < 3 {
+			t.Fatalf("unexpected node from level %d", l)
+		}
+	}
+}
+
+func TestLevelObservers(t *testing.T) {
+	t.Parallel()
+
+	payload := make([]byte, 127*10+5)
+	randmath.New(randmath.NewSource(1)).Read(payload)
+
+	var leaves, blocks []byte
+	tc := new(TreeCache)
+	cp := New(
+		WithTreeLayers(0, tc.Add),
+		WithLeafObserver(func(idx uint64, leaf []byte) {
+			if uint64(len(leaves)) != idx*32 {
+				t.Errorf("leaf %d observed out of order", idx)
+			}
+			leaves = append(leaves, leaf...)
+		}),
+		WithLevelObserver(2, func(idx uint64, node []byte) {
+			if uint64(len(blocks)) != idx*32 {
+				t.Errorf("block node %d observed out of order", idx)
+			}
+			blocks = append(blocks, node...)
+		}),
+	)
+	if _, err := cp.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leaves) != 11*4*32 || len(blocks) != 11*32 {
+		t.Fatalf("unexpected observed amounts: %d leaf bytes, %d block node bytes", len(leaves), len(blocks))
+	}
+
+	var expanded [128]byte
+	fr32.Pad(payload[:127], expanded[:])
+	if !bytes.Equal(expanded[:], leaves[:128]) {
+		t.Fatal("observed leaves do not match the fr32 expansion of the payload")
+	}
+
+	for i := uint64(0); i < 11; i++ {
+		if !bytes.Equal(tc.Node(0, i*4), leaves[i*128:i*128+32]) ||
+			!bytes.Equal(tc.Node(2, i), blocks[i*32:i*32+32]) {
+			t.Fatalf("observed nodes at block %d differ from the tree cache", i)
+		}
+	}
+}
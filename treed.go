@@ -0,0 +1,207 @@
+package commp
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// treeDBufSize is the size of the buffer of every level of a TreeDWriter,
+// holding nodes until they are written out.
+const treeDBufSize = 1 << 20
+
+// TreeDSize returns the size of the tree-d cache file of a sector of the given
+// padded size: all of its nodes, 32 bytes each.
+func TreeDSize(sectorPaddedSize uint64) uint64 {
+	return 2*sectorPaddedSize - 32
+}
+
+// TreeDWriter writes the tree of a sector in the on-disk layout of the tree-d
+// cache file of rust-fil-proofs (sc-02-data-tree-d.dat): every level of the
+// binary tree from the leaves up to the root, each level as a contiguous run of
+// 32-byte nodes in index order. Sealing workers handed this file along with
+// the unsealed sector do not need to build the tree again.
+//
+// The nodes are supplied by a Calc hashing the unsealed sector, or only the
+// payload at its start, via WithTreeLayers(0, tw.Add). Once the Calc is
+// Digest()ed, Finish() completes the tree over the zero remainder of the
+// sector.
+type TreeDWriter struct {
+	w          io.WriterAt
+	sectorSize uint64
+	height     uint
+	levels     [MaxLayers + 1]treeDLevel
+
+	mu  sync.Mutex
+	err error
+}
+
+type treeDLevel struct {
+	offset uint64 // of the level within the file
+	count  uint64 // nodes added so far
+	first  []byte
+	buf    []byte
+}
+
+// NewTreeDWriter returns a TreeDWriter writing the tree of a sector of the
+// given padded size to w, which is normally a file of TreeDSize() bytes.
+func NewTreeDWriter(w io.WriterAt, sectorPaddedSize uint64) (*TreeDWriter, error) {
+	if err := PaddedPieceSize(sectorPaddedSize).Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid sector size: %w", err)
+	}
+	tw := &TreeDWriter{
+		w:          w,
+		sectorSize: sectorPaddedSize,
+		height:     uint(bits.TrailingZeros64(sectorPaddedSize)) - 5,
+	}
+	for l := uint(0); l <= tw.height; l++ {
+		tw.levels[l].offset = treeDLevelOffset(sectorPaddedSize, l)
+	}
+	return tw, nil
+}
+
+// treeDLevelOffset returns the offset of a level within a tree-d cache file,
+// after the levels below it, of sectorPaddedSize>>l bytes each.
+func treeDLevelOffset(sectorPaddedSize uint64, level uint) uint64 {
+	return 2 * (sectorPaddedSize - sectorPaddedSize>>level)
+}
+
+// Add buffers a node of the tree, and has the signature of a TreeNodeSink.
+// Nodes within a level must be added in index order. Errors writing the file
+// are returned by Finish().
+func (tw *TreeDWriter) Add(level uint, index uint64, node []byte) {
+	if level > tw.height {
+		tw.fail(xerrors.Errorf("node of level %d above the root of a sector of %d bytes", level, tw.sectorSize))
+		return
+	}
+	l := &tw.levels[level]
+	if index != l.count {
+		tw.fail(xerrors.Errorf("out of order node %d added to level %d holding %d nodes", index, level, l.count))
+		return
+	}
+	if index >= tw.sectorSize>>(level+5) {
+		tw.fail(xerrors.Errorf("node %d beyond the %d nodes of level %d", index, tw.sectorSize>>(level+5), level))
+		return
+	}
+
+	if l.first == nil {
+		l.first = append(make([]byte, 0, 32), node...)
+	}
+	if l.buf == nil {
+		l.buf = make([]byte, 0, treeDBufSize)
+	}
+	l.buf = append(l.buf, node...)
+	l.count++
+	if len(l.buf) == cap(l.buf) {
+		tw.flush(l)
+	}
+}
+
+// Finish writes out the buffered nodes, along with the nodes over the part of
+// the sector no payload was added for, and returns the raw commD of the
+// sector, which is the root of the tree.
+func (tw *TreeDWriter) Finish() (commD []byte, err error) {
+	var zeros []byte
+	for level := uint(0); level <= tw.height; level++ {
+		l := &tw.levels[level]
+
+		// above the root of the payload, the first node covers the payload
+		// and the zeros following it
+		if l.count == 0 && level > 0 && tw.levels[level-1].first != nil {
+			l.first = hashNode(make([]byte, 0, 32), tw.levels[level-1].first, nulPadding(level-1))
+			l.buf = append(l.buf[:0], l.first...)
+			l.count = 1
+		}
+		tw.flush(l)
+
+		nodes := tw.sectorSize >> (level + 5)
+		if l.count == nodes {
+			continue
+		}
+		if zeros == nil {
+			zeros = make([]byte, 0, treeDBufSize)
+		}
+		zeros = zeros[:0]
+		for len(zeros) < cap(zeros) && uint64(len(zeros)) < (nodes-l.count)*32 {
+			zeros = append(zeros, nulPadding(level)...)
+		}
+		for l.count < nodes {
+			chunk := zeros
+			if rest := (nodes - l.count) * 32; rest < uint64(len(chunk)) {
+				chunk = chunk[:rest]
+			}
+			if _, err := tw.w.WriteAt(chunk, int64(l.offset+l.count*32)); err != nil {
+				tw.fail(err)
+				break
+			}
+			l.count += uint64(len(chunk)) / 32
+		}
+		if level == tw.height && l.first == nil {
+			l.first = nulPadding(level)
+		}
+	}
+
+	tw.mu.Lock()
+	err = tw.err
+	tw.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return append(make([]byte, 0, 32), tw.levels[tw.height].first...), nil
+}
+
+// flush writes out the buffered nodes of a level.
+func (tw *TreeDWriter) flush(l *treeDLevel) {
+	if len(l.buf) == 0 {
+		return
+	}
+	buffered := uint64(len(l.buf)) / 32
+	if _, err := tw.w.WriteAt(l.buf, int64(l.offset+(l.count-buffered)*32)); err != nil {
+		tw.fail(err)
+	}
+	l.buf = l.buf[:0]
+}
+
+func (tw *TreeDWriter) fail(err error) {
+	tw.mu.Lock()
+	if tw.err == nil {
+		tw.err = err
+	}
+	tw.mu.Unlock()
+}
+
+// TreeDReader reads the nodes of a tree-d cache file, e.g. one written by a
+// TreeDWriter, and is a NodeSource.
+type TreeDReader struct {
+	r          io.ReaderAt
+	sectorSize uint64
+	height     uint
+}
+
+// NewTreeDReader returns a TreeDReader reading the tree of a sector of the
+// given padded size from r.
+func NewTreeDReader(r io.ReaderAt, sectorPaddedSize uint64) (*TreeDReader, error) {
+	if err := PaddedPieceSize(sectorPaddedSize).Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid sector size: %w", err)
+	}
+	return &TreeDReader{
+		r:          r,
+		sectorSize: sectorPaddedSize,
+		height:     uint(bits.TrailingZeros64(sectorPaddedSize)) - 5,
+	}, nil
+}
+
+// Node returns the node at the given position, or nil if it is out of bounds
+// or can not be read.
+func (td *TreeDReader) Node(level uint, index uint64) []byte {
+	if level > td.height || index >= td.sectorSize>>(level+5) {
+		return nil
+	}
+	node := make([]byte, 32)
+	if _, err := td.r.ReadAt(node, int64(treeDLevelOffset(td.sectorSize, level)+index*32)); err != nil {
+		return nil
+	}
+	return node
+}
@@ -0,0 +1,72 @@
+package commp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+)
+
+func TestTreeDWriter(t *testing.T) {
+	const sectorSize = 8 << 10
+
+	f, err := ioutil.TempFile("", "commp-treed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, payloadSize := range []int{0, 65, 127 * 3, 1000, sectorSize / 2 / 128 * 127, sectorSize / 128 * 127} {
+		payload := make([]byte, payloadSize)
+		rnd.Read(payload)
+
+		// every level of the naive tree over the whole sector
+		sector := make([]byte, sectorSize/128*127)
+		copy(sector, payload)
+		expected := make([]byte, sectorSize)
+		fr32.Pad(sector, expected)
+		for level := expected; len(level) > 32; {
+			var next []byte
+			for i := 0; i < len(level); i += 64 {
+				next = sha254TreeHasher(2).HashChildren(next, [][]byte{level[i : i+32], level[i+32 : i+64]})
+			}
+			expected = append(expected, next...)
+			level = next
+		}
+
+		if err := f.Truncate(0); err != nil {
+			t.Fatal(err)
+		}
+		tw, err := NewTreeDWriter(f, sectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payloadSize > 0 {
+			cp := New(WithTreeLayers(0, tw.Add))
+			cp.Write(payload)
+			if _, _, err := cp.Digest(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		commD, err := tw.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tree, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(tree)) != TreeDSize(sectorSize) || !bytes.Equal(tree, expected) {
+			t.Fatalf("tree over a payload of %d bytes does not match the expected %d bytes", payloadSize, TreeDSize(sectorSize))
+		}
+		if !bytes.Equal(commD, expected[len(expected)-32:]) {
+			t.Fatalf("commD 0x%X over a payload of %d bytes is not the root 0x%X", commD, payloadSize, expected[len(expected)-32:])
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package commp
+
+import "runtime"
+
+// The queues between the layer workers are sized from GOMAXPROCS: the more
+// workers run in parallel, the more nodes are in flight between them. The
+// bounds correspond to 2 and 32 cores.
+const (
+	queueDepthPerProc = 32
+	minQueueDepth     = 64
+	maxQueueDepth     = 1024
+)
+
+// WithExpectedPieceSize hints the padded size of the pieces the Calc is going
+// to process, so that no queue is allocated larger than the amount of nodes
+// passing through it. Pieces of any other size are still hashed correctly.
+func WithExpectedPieceSize(paddedPieceSize uint64) Option {
+	return func(c *config) {
+		c.expectedSize = uint64(PaddedPieceSize(paddedPieceSize).NextPowerOfTwo())
+	}
+}
+
+// queueDepth returns the capacity of the queue feeding the worker of the given
+// layer.
+func (c *config) queueDepth(layer uint) int {
+	depth := queueDepthPerProc * runtime.GOMAXPROCS(0)
+	if depth < minQueueDepth {
+		depth = minQueueDepth
+	} else if depth > maxQueueDepth {
+		depth = maxQueueDepth
+	}
+
+	// a layer sees at most one node per 32<<layer padded bytes
+	if c.expectedSize != 0 {
+		if nodes := c.expectedSize >> (layer + 5); nodes < uint64(depth) {
+			depth = int(nodes)
+			if depth < 1 {
+				depth = 1
+			}
+		}
+	}
+	return depth
+}
@@ -0,0 +1,51 @@
+package commp
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+)
+
+func TestQueueDepth(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	for procs, exp := range map[int]int{1: 64, 4: 128, 16: 512, 64: 1024} {
+		runtime.GOMAXPROCS(procs)
+		var c config
+		for layer := uint(0); layer <= MaxLayers; layer++ {
+			if d := c.queueDepth(layer); d != exp {
+				t.Fatalf("layer %d with %d procs has a queue of %d, expected %d", layer, procs, d, exp)
+			}
+		}
+	}
+
+	runtime.GOMAXPROCS(4)
+	c := New(WithExpectedPieceSize(100 << 10)).cfg // rounded up to 128KiB
+	for layer, exp := range map[uint]int{0: 128, 5: 128, 6: 64, 11: 2, 12: 1, MaxLayers: 1} {
+		if d := c.queueDepth(layer); d != exp {
+			t.Fatalf("layer %d of an expected 128KiB piece has a queue of %d, expected %d", layer, d, exp)
+		}
+	}
+}
+
+func TestExpectedPieceSize(t *testing.T) {
+	data := bytes.Repeat([]byte{0x5A}, 127<<8)
+	for _, size := range []int{65, 127 * 3, 127 << 4, len(data)} {
+		expCommP, expSize, err := Sum(data[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// hinting a smaller piece than the actual one only shrinks the queues
+		for _, hint := range []uint64{128, 1 << 10, 1 << 20} {
+			cp := New(WithExpectedPieceSize(hint))
+			cp.Write(data[:size])
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+				t.Fatalf("%d bytes with a hint of %d produced 0x%X / %d, expected 0x%X / %d", size, hint, commP, paddedSize, expCommP, expSize)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package commp
+
+import (
+	"bufio"
+	"io"
+)
+
+// UnsealedWriter computes the commP of everything written to it, while writing
+// the fr32-padded form of the payload to a destination: exactly the bytes of
+// the piece within an unsealed sector. The padded bytes are the expansion the
+// commP is computed from in the first place, so there is no separate padding
+// pass over the payload.
+type UnsealedWriter struct {
+	cp  *Calc
+	dst *bufio.Writer
+	n   uint64 // padded bytes written
+	err error
+}
+
+// NewUnsealedWriter returns an UnsealedWriter writing the padded payload to
+// dst, and hashing it with a Calc configured with opts.
+func NewUnsealedWriter(dst io.Writer, opts ...Option) *UnsealedWriter {
+	uw := &UnsealedWriter{dst: bufio.NewWriterSize(dst, 1<<20)}
+	uw.cp = New(append(opts[:len(opts):len(opts)], func(c *config) { c.paddedSink = uw.emit })...)
+	return uw
+}
+
+func (uw *UnsealedWriter) emit(padded []byte) {
+	if uw.err == nil {
+		_, uw.err = uw.dst.Write(padded)
+		uw.n += uint64(len(padded))
+	}
+}
+
+// Write adds p to the payload. An error writing to the destination is returned
+// by this or any subsequent call.
+func (uw *UnsealedWriter) Write(p []byte) (int, error) {
+	if uw.err != nil {
+		return 0, uw.err
+	}
+	n, err := uw.cp.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, uw.err
+}
+
+// Finish writes out the rest of the padded piece, zero-filled up to its padded
+// size, and returns the raw commP and the padded size of the piece. The
+// destination now holds exactly paddedPieceSize bytes.
+func (uw *UnsealedWriter) Finish() (commP []byte, paddedPieceSize uint64, err error) {
+	defer uw.cp.Reset()
+	if uw.err != nil {
+		return nil, 0, uw.err
+	}
+
+	commP, paddedPieceSize, err = uw.cp.Digest()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	zeros := make([]byte, 32<<10)
+	for uw.err == nil && uw.n < paddedPieceSize {
+		chunk := zeros
+		if rest := paddedPieceSize - uw.n; rest < uint64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		uw.emit(chunk)
+	}
+	if uw.err == nil {
+		uw.err = uw.dst.Flush()
+	}
+	if uw.err != nil {
+		return nil, 0, uw.err
+	}
+	return commP, paddedPieceSize, nil
+}
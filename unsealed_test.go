@@ -0,0 +1,72 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-commp-hashhash/fr32"
+	"golang.org/x/xerrors"
+)
+
+type failingWriter struct{ after int }
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > fw.after {
+		return fw.after, xerrors.New("disk full")
+	}
+	fw.after -= len(p)
+	return len(p), nil
+}
+
+func TestUnsealedWriter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{65, 127, 1000, 127 << 10, 3<<20 + 5} {
+		payload := make([]byte, size)
+		rnd.Read(payload)
+		expCommP, expSize, err := Sum(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unpadded := make([]byte, expSize/128*127)
+		copy(unpadded, payload)
+		expPadded := make([]byte, expSize)
+		fr32.Pad(unpadded, expPadded)
+
+		var out bytes.Buffer
+		uw := NewUnsealedWriter(&out, WithScratch(new(Scratch)))
+		for p := payload; len(p) > 0; {
+			n := 1 + rnd.Intn(1000)
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := uw.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		commP, paddedSize, err := uw.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(commP, expCommP[:]) || paddedSize != expSize {
+			t.Fatalf("payload of %d bytes produced 0x%X / %d, expected 0x%X / %d", size, commP, paddedSize, expCommP, expSize)
+		}
+		if !bytes.Equal(out.Bytes(), expPadded) {
+			t.Fatalf("payload of %d bytes resulted in %d padded bytes not matching the expected %d", size, out.Len(), len(expPadded))
+		}
+	}
+
+	uw := NewUnsealedWriter(&failingWriter{after: 1 << 20})
+	payload := make([]byte, 4<<20)
+	var err error
+	for i := 0; i < 4 && err == nil; i++ {
+		_, err = uw.Write(payload[i<<20 : (i+1)<<20])
+	}
+	if err == nil {
+		_, _, err = uw.Finish()
+	}
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the error of the destination, got %v", err)
+	}
+}
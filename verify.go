@@ -0,0 +1,152 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// verifyBufSize is a multiple of the 127-byte block, so that full reads do not
+// go through the carry buffer of Calc.
+const verifyBufSize = 127 << 13
+
+var verifyBufPool = sync.Pool{New: func() interface{} { return new([verifyBufSize]byte) }}
+
+// VerifyReader hashes the entire stream, and checks that it results in the
+// expected raw commP and padded piece size. A stream which hashes to anything
+// else results in a *MismatchError matching ErrMismatch, carrying both the
+// expected and the actual values. Errors reading from r or hashing (e.g. a
+// stream shorter than MinPiecePayload) are returned as-is.
+func VerifyReader(r io.Reader, expectedCommP []byte, expectedPaddedSize uint64) error {
+	if len(expectedCommP) != 32 {
+		return xerrors.Errorf("expected commP must be exactly 32 bytes long, got %d bytes instead", len(expectedCommP))
+	}
+
+	bufArr := verifyBufPool.Get().(*[verifyBufSize]byte)
+	defer verifyBufPool.Put(bufArr)
+	buf := bufArr[:]
+
+	cp := new(Calc)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, werr := cp.Write(buf[:n]); werr != nil {
+				cp.Reset()
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			cp.Reset()
+			return err
+		}
+	}
+
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		cp.Reset()
+		return err
+	}
+
+	if paddedSize != expectedPaddedSize || !bytes.Equal(commP, expectedCommP) {
+		return &MismatchError{
+			ExpectedCommP:      append(make([]byte, 0, 32), expectedCommP...),
+			ActualCommP:        commP,
+			ExpectedPaddedSize: expectedPaddedSize,
+			ActualPaddedSize:   paddedSize,
+		}
+	}
+	return nil
+}
+
+// NodeSource provides the nodes of a previously computed tree, such as a
+// TreeCache or a TreeDReader. Node returns nil for nodes it does not hold.
+type NodeSource interface {
+	Node(level uint, index uint64) []byte
+}
+
+// VerifyUnsealedSector hashes the unsealed sector in r, in its padded form and
+// of exactly sectorPaddedSize bytes, and checks that it results in the
+// expected raw commD. On a mismatch the nodes of faultLevel are compared
+// against those held by tree, if not nil, in order to localize the damage:
+// the first differing node is returned as a *SectorFaultError. A level of 15
+// for instance covers 1MiB per node. The tree is only consulted after a
+// mismatch of the root, which is otherwise returned as a *MismatchError.
+func VerifyUnsealedSector(r io.Reader, commD []byte, sectorPaddedSize uint64, tree NodeSource, faultLevel uint) error {
+	if len(commD) != 32 {
+		return xerrors.Errorf("expected commD must be exactly 32 bytes long, got %d bytes instead", len(commD))
+	}
+	if err := PaddedPieceSize(sectorPaddedSize).Validate(); err != nil {
+		return xerrors.Errorf("invalid sector size: %w", err)
+	}
+
+	// the first node of faultLevel which differs from tree
+	var fault *SectorFaultError
+	var opts []Option
+	if tree != nil {
+		opts = append(opts, WithLevelObserver(faultLevel, func(index uint64, node []byte) {
+			if fault != nil {
+				return
+			}
+			if expected := tree.Node(faultLevel, index); expected != nil && !bytes.Equal(expected, node) {
+				fault = &SectorFaultError{
+					Level:    faultLevel,
+					Index:    index,
+					Offset:   index << (faultLevel + 5),
+					Size:     32 << faultLevel,
+					Expected: expected,
+					Actual:   append(make([]byte, 0, 32), node...),
+				}
+			}
+		}))
+	}
+
+	cp := New(opts...)
+	defer cp.Reset()
+
+	// full reads are whole padded blocks
+	buf := make([]byte, 128<<13)
+	var read uint64
+	for {
+		n, err := io.ReadFull(r, buf)
+		read += uint64(n)
+		if read > sectorPaddedSize || n%128 != 0 {
+			return xerrors.Errorf("unsealed sector is not %d bytes long", sectorPaddedSize)
+		}
+		if n > 0 {
+			if _, werr := cp.WritePadded(buf[:n]); werr != nil {
+				return xerrors.Errorf("at offset %d: %w", read-uint64(n), werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if read != sectorPaddedSize {
+		return xerrors.Errorf("unsealed sector of %d bytes instead of %d", read, sectorPaddedSize)
+	}
+
+	root, paddedSize, err := cp.Digest()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(root, commD) {
+		return nil
+	}
+	if fault != nil {
+		return fault
+	}
+	return &MismatchError{
+		ExpectedCommP:      append(make([]byte, 0, 32), commD...),
+		ActualCommP:        root,
+		ExpectedPaddedSize: sectorPaddedSize,
+		ActualPaddedSize:   paddedSize,
+	}
+}
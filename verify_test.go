@@ -0,0 +1,133 @@
+package commp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestVerifyReader(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xCC}, 127<<14+5)
+
+	cp := new(Calc)
+	cp.Write(payload)
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyReader(bytes.NewReader(payload), commP, paddedSize); err != nil {
+		t.Fatal(err)
+	}
+
+	var me *MismatchError
+	err = VerifyReader(bytes.NewReader(payload), commP, 2*paddedSize)
+	if !xerrors.Is(err, ErrMismatch) || !xerrors.As(err, &me) || me.ActualPaddedSize != paddedSize || !bytes.Equal(me.ActualCommP, commP) {
+		t.Fatalf("unexpected error for a size mismatch: %v", err)
+	}
+
+	payload[1000] ^= 0xFF
+	err = VerifyReader(bytes.NewReader(payload), commP, paddedSize)
+	if !xerrors.As(err, &me) || bytes.Equal(me.ActualCommP, commP) || !bytes.Equal(me.ExpectedCommP, commP) {
+		t.Fatalf("unexpected error for a content mismatch: %v", err)
+	}
+
+	err = VerifyReader(bytes.NewReader(payload[:64]), commP, paddedSize)
+	if !xerrors.Is(err, ErrPayloadTooSmall) {
+		t.Fatalf("unexpected error for a short stream: %v", err)
+	}
+
+	err = VerifyReader(io.MultiReader(bytes.NewReader(payload), &failingReader{}), commP, paddedSize)
+	if err != io.ErrClosedPipe {
+		t.Fatalf("unexpected error for a failing stream: %v", err)
+	}
+
+	if err := VerifyReader(bytes.NewReader(payload), commP[:31], paddedSize); err == nil || xerrors.Is(err, ErrMismatch) {
+		t.Fatalf("unexpected error for an invalid commP: %v", err)
+	}
+}
+
+type failingReader struct{}
+
+func (*failingReader) Read([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestVerifyUnsealedSector(t *testing.T) {
+	const sectorSize = 16 << 10
+
+	payload := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(payload)
+	var sector bytes.Buffer
+	uw := NewUnsealedWriter(&sector)
+	uw.Write(payload)
+	uw.Write(make([]byte, sectorSize/128*127-len(payload)))
+	commD, _, err := uw.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tree-d cache file, and a tree cache of the levels from 3 up
+	f, err := ioutil.TempFile("", "commp-treed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	tw, err := NewTreeDWriter(f, sectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := new(TreeCache)
+	cp := New(WithTreeLayers(0, tw.Add), WithTreeLayers(3, tc.Add))
+	cp.Write(payload)
+	if _, _, err := cp.Digest(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	treeD, err := NewTreeDReader(f, sectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyUnsealedSector(bytes.NewReader(sector.Bytes()), commD, sectorSize, treeD, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := append([]byte{}, sector.Bytes()...)
+	corrupt[4321] ^= 0x01
+	for _, c := range []struct {
+		tree  NodeSource
+		level uint
+	}{
+		{treeD, 0},
+		{treeD, 5},
+		{tc, 5},
+	} {
+		err := VerifyUnsealedSector(bytes.NewReader(corrupt), commD, sectorSize, c.tree, c.level)
+		var fault *SectorFaultError
+		if !xerrors.As(err, &fault) || !xerrors.Is(err, ErrMismatch) {
+			t.Fatalf("expected a SectorFaultError, got %v", err)
+		}
+		if fault.Level != c.level || fault.Offset > 4321 || fault.Offset+fault.Size <= 4321 {
+			t.Fatalf("fault at level %d does not cover the corrupted byte: %s", c.level, fault)
+		}
+	}
+
+	// a level the tree cache does not hold, and no tree at all
+	for _, tree := range []NodeSource{tc, nil} {
+		var mismatch *MismatchError
+		if err := VerifyUnsealedSector(bytes.NewReader(corrupt), commD, sectorSize, tree, 1); !xerrors.As(err, &mismatch) {
+			t.Fatalf("expected a MismatchError, got %v", err)
+		}
+	}
+
+	if err := VerifyUnsealedSector(bytes.NewReader(sector.Bytes()[:sectorSize-128]), commD, sectorSize, nil, 0); err == nil {
+		t.Fatal("unexpected success for a truncated sector")
+	}
+}
@@ -0,0 +1,112 @@
+package commp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The stages of a layer worker, tracked with WithDigestTimeout().
+const (
+	stageIdle = uint32(iota) // not running, or done with the piece
+	stageReceiving
+	stageProcessing // hashing, or within a TreeNodeSink or Observer
+	stageSending
+)
+
+var stageNames = [...]string{"idle", "receiving", "processing", "sending"}
+
+// WithDigestTimeout bounds the time Digest() waits for the layer workers to
+// complete the tree, e.g. when a NodeHasher or a TreeNodeSink never returns.
+// Past the timeout Digest() fails with a StallError identifying the layer
+// holding up the pipeline. The stuck workers can not be reclaimed: they are
+// told to drop whatever reaches them once they resume, and the Calc is Closed.
+func WithDigestTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.digestTimeout = d
+	}
+}
+
+// stage returns where the worker of a layer keeps track of its stage, or nil
+// without WithDigestTimeout().
+func (cp *Calc) stage(layer uint) *uint32 {
+	if cp.cfg.digestTimeout <= 0 {
+		return nil
+	}
+	return &cp.stages[layer]
+}
+
+func setStage(stage *uint32, s uint32) {
+	if stage != nil {
+		atomic.StoreUint32(stage, s)
+	}
+}
+
+// collapse signals the end of the piece to the bottom of the pipeline, which
+// in turn collapses the rest all the way to resultCommP, and returns the root.
+func (cp *Calc) collapse() ([]byte, error) {
+	if cp.cfg.digestTimeout <= 0 {
+		cp.pending.flush(cp.layerQueues[0])
+		cp.layerQueues[0].send(nil)
+		return <-cp.resultCommP, nil
+	}
+
+	t := time.NewTimer(cp.cfg.digestTimeout)
+	defer t.Stop()
+
+	q := cp.layerQueues[0]
+	if b := cp.pending.b; b != nil {
+		if !q.sendTimeout(b, t.C) {
+			return nil, cp.stalled(false)
+		}
+		cp.pending.b = nil
+	}
+	if !q.sendTimeout(nil, t.C) {
+		return nil, cp.stalled(false)
+	}
+	select {
+	case root := <-cp.resultCommP:
+		return root, nil
+	case <-t.C:
+		return nil, cp.stalled(true)
+	}
+}
+
+// stalled gives up on the pipeline of the piece, and closes the Calc, whose
+// state remains referenced by the stuck workers. Should they ever resume,
+// they terminate without hashing anything further: the end of the piece is
+// delivered to them in the background if it was not yet.
+func (cp *Calc) stalled(endSent bool) error {
+	atomic.StoreUint32(&cp.aborting, 1)
+	cp.lifecycle = Closed
+	if !endSent {
+		q, pending := cp.layerQueues[0], cp.pending.b
+		cp.pending.b = nil
+		go func() {
+			if pending != nil {
+				cp.discard(pending.nodes)
+				releaseBatch(pending)
+			}
+			q.send(nil)
+		}()
+	}
+
+	e := &StallError{Timeout: cp.cfg.digestTimeout, Stages: make(map[uint]string)}
+	stalled := -1
+	for l := range cp.stages {
+		s := atomic.LoadUint32(&cp.stages[l])
+		if s == stageIdle {
+			continue
+		}
+		e.Stages[uint(l)] = stageNames[s]
+
+		// the workers below the stuck one wait for it to accept their
+		// nodes, those above wait for nodes to arrive
+		if stalled < 0 || s == stageProcessing && e.Stages[uint(stalled)] != stageNames[stageProcessing] {
+			stalled = l
+		}
+	}
+	if stalled >= 0 {
+		e.Layer = uint(stalled)
+	}
+	return e
+}
@@ -0,0 +1,38 @@
+package commp
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestDigestTimeout(t *testing.T) {
+	release := make(chan struct{})
+
+	// the root of the piece is only hashed during Digest()
+	cp := New(WithDigestTimeout(50*time.Millisecond), WithLevelObserver(5, func(uint64, []byte) {
+		<-release
+	}))
+	cp.Write(bytes.Repeat([]byte{0x5A}, 127*8))
+
+	_, _, err := cp.Digest()
+	var se *StallError
+	if !xerrors.Is(err, ErrDigestTimeout) || !xerrors.As(err, &se) {
+		t.Fatalf("stalled Digest() returned %v", err)
+	}
+	if se.Layer != 5 || len(se.Stages) != 1 || se.Stages[5] != "processing" {
+		t.Fatalf("unexpected diagnostics %s", err)
+	}
+	if s := cp.Lifecycle(); s != Closed {
+		t.Fatalf("calc is %s after stalling, expected %s", s, Closed)
+	}
+
+	// the stuck worker exits once it resumes
+	close(release)
+	for cp.ActiveWorkers() > 0 {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,99 @@
+package commp
+
+import "encoding/binary"
+
+// zeroBlock is written through the regular path by WriteZeros() where it can
+// not use the fast path.
+var zeroBlock [127 * 64]byte
+
+// WriteZeros is equivalent to a Write() of n zero bytes, e.g. the holes of a
+// sparse file or the padding of a piece filling a sector. Runs of entire
+// blocks are not expanded and hashed: they are folded into the tree as the
+// precomputed nodes of zero subtrees instead, at a cost independent of n.
+// The fast path is not available with a TreeHasher or a TreeNodeSink, which
+// both need every node of the tree, nor within an UnsealedWriter: in these
+// cases the zeros are written out.
+func (cp *Calc) WriteZeros(n uint64) error {
+	if n == 0 {
+		return nil
+	}
+
+	epoch, err := cp.enterWrite("WriteZeros")
+	if err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if err := cp.checkEpoch("WriteZeros", epoch); err != nil {
+		return err
+	}
+
+	ws, err := cp.begin("WriteZeros", n)
+	if err != nil {
+		return err
+	}
+	if ws != nil {
+		defer ws.End(nil)
+	}
+
+	if cp.cfg.treeHasher != nil || len(cp.cfg.nodeSinks) > 0 || cp.cfg.paddedSink != nil {
+		cp.writeZeros(n)
+		return nil
+	}
+
+	// complete the carried-over block first
+	if c := uint64(len(cp.carry)); c > 0 {
+		head := 127 - c
+		if head > n {
+			head = n
+		}
+		cp.write(zeroBlock[:head])
+		n -= head
+	}
+
+	if blocks := n / 127; blocks > 0 {
+		cp.pending.add(cp.layerQueues[0], zeroRun(blocks))
+	}
+	cp.write(zeroBlock[:n%127])
+	return nil
+}
+
+// writeZeros feeds n zero bytes to the pipeline the regular way.
+func (cp *Calc) writeZeros(n uint64) {
+	for n > uint64(len(zeroBlock)) {
+		cp.write(zeroBlock[:])
+		n -= uint64(len(zeroBlock))
+	}
+	cp.write(zeroBlock[:n])
+}
+
+// A zero run stands in for a run of zero nodes of the level of the queue it
+// is sent on, or of level 2 nodes on layerQueues[0]. It is told apart from
+// nodes, which are never shorter than 32 bytes, by its length.
+const zeroRunSize = 8
+
+func zeroRun(nodes uint64) []byte {
+	r := make([]byte, zeroRunSize)
+	binary.LittleEndian.PutUint64(r, nodes)
+	return r
+}
+
+// zeroRunNodes returns the amount of nodes of a zero run, or 0 for a node.
+func zeroRunNodes(chunk []byte) uint64 {
+	if len(chunk) != zeroRunSize {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(chunk)
+}
+
+// zeroNode returns a writable copy of the zero node of the given level, which
+// the layer workers are free to recycle just like the nodes of a block.
+func (cp *Calc) zeroNode(level uint) []byte {
+	var b []byte
+	if cp.cfg.scratch != nil {
+		b = cp.cfg.scratch.get()[:0]
+	} else {
+		b = make([]byte, 0, 32)
+	}
+	return append(b, nulPadding(level)...)
+}
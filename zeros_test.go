@@ -0,0 +1,100 @@
+package commp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestWriteZeros(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 127<<10)
+	rnd.Read(data)
+
+	// alternating data and zeros, starting with data
+	layouts := [][]int{
+		{0, 65},
+		{0, 127 * 2},
+		{0, 127*4 + 1},
+		{0, 127 << 12},
+		{1, 127*3 + 5},
+		{127, 127},
+		{100, 127*7 + 60, 3},
+		{5000, 127 << 9, 127 * 3, 127*1000 + 1, 64},
+		{127 * 3, 127 * 5, 127, 127 * 6, 1, 127 * 9},
+		{127 << 10, 127 << 10},
+	}
+
+	for name, opts := range map[string][]Option{
+		"default":  nil,
+		"scratch":  {WithScratch(new(Scratch))},
+		"batch":    {WithBatchHasher(new(recordingBatchHasher), 128)},
+		"tree":     {WithExperimentalTree(sha254TreeHasher(2))},
+		"sink":     {WithTreeLayers(3, func(uint, uint64, []byte) {})},
+		"observer": {WithObserver(&countingObserver{depthSamples: map[uint]int{}})},
+		"inline":   {WithInlineFolding()},
+		"timeout":  {WithDigestTimeout(time.Minute)},
+		"pool":     {WithPool(NewPool(2))},
+	} {
+		cp := New(opts...)
+		ref := New(opts...)
+		for _, layout := range layouts {
+			var offset int
+			for i, size := range layout {
+				if i%2 == 0 {
+					cp.Write(data[offset : offset+size])
+					ref.Write(data[offset : offset+size])
+					offset += size
+					continue
+				}
+				if err := cp.WriteZeros(uint64(size)); err != nil {
+					t.Fatal(err)
+				}
+				ref.Write(make([]byte, size))
+			}
+
+			expCommP, expSize, err := ref.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			commP, paddedSize, err := cp.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(commP, expCommP) || paddedSize != expSize {
+				t.Fatalf("%s: layout %v produced 0x%X / %d, expected 0x%X / %d", name, layout, commP, paddedSize, expCommP, expSize)
+			}
+		}
+	}
+}
+
+func TestWriteZerosSector(t *testing.T) {
+	data := bytes.Repeat([]byte{0xCC}, 127)
+	c, _, err := Sum(append(data, make([]byte, 127)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expCommP, err := PadCommP(c[:], 256, 1<<(MaxLayers+5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp := new(Calc)
+	cp.Write(data)
+	if err := cp.WriteZeros(MaxPiecePayload); !xerrors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+	if err := cp.WriteZeros(MaxPiecePayload - 127); err != nil {
+		t.Fatal(err)
+	}
+	commP, paddedSize, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(commP, expCommP) || paddedSize != 1<<(MaxLayers+5) {
+		t.Fatalf("zero-filled sector produced 0x%X / %d, expected 0x%X / %d", commP, paddedSize, expCommP, uint64(1)<<(MaxLayers+5))
+	}
+}